@@ -24,6 +24,8 @@ import (
 	"github.com/spf13/cobra"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+
 	gpuCdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
 	gpuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
 	gpuDiscovery "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
@@ -70,10 +72,18 @@ func cobraRunFunc(cmd *cobra.Command, args []string) error {
 		dryRun = true
 	}
 
+	deviceUID, _ := cmd.Flags().GetInt64("device-node-uid")
+	deviceGID, _ := cmd.Flags().GetInt64("device-node-gid")
+	deviceMode, _ := cmd.Flags().GetString("device-node-mode")
+	gpuPermissions, err := gpuCdihelpers.ParseDeviceNodePermissions(deviceUID, deviceGID, deviceMode)
+	if err != nil {
+		return err
+	}
+
 	for _, argx := range args {
 		switch strings.ToLower(argx) {
 		case "gpu":
-			if err := handleGPUDevices(cdiCache, namingStyle, dryRun); err != nil {
+			if err := handleGPUDevices(cdiCache, namingStyle, dryRun, gpuPermissions); err != nil {
 				return err
 			}
 		case "gaudi":
@@ -94,7 +104,7 @@ func cobraRunFunc(cmd *cobra.Command, args []string) error {
 	// Fix CDI spec permissions as the default permission (600) prevents
 	// use without root or sudo:
 	// https://github.com/cncf-tags/container-device-interface/issues/224
-	specs := cdiCache.GetVendorSpecs(gpuDevice.CDIVendor) // Vendor is same for both gpu and gaudi
+	specs := cdiCache.GetVendorSpecs(cdiregistry.Vendor)
 	for _, spec := range specs {
 		if err := os.Chmod(spec.GetPath(), 0o644); err != nil {
 			return err
@@ -129,14 +139,17 @@ func newCommand() *cobra.Command {
 	cmd.Version = version
 	cmd.Flags().BoolP("version", "v", false, "Show the version of the binary")
 	cmd.Flags().String("cdi-dir", "/etc/cdi", "CDI spec directory")
-	cmd.Flags().String("naming", "classic", "Naming of CDI devices. Options: classic, machine")
+	cmd.Flags().String("naming", "classic", "Naming of CDI devices. Options: classic, machine, serial (GPU only)")
 	cmd.Flags().BoolP("dry-run", "n", false, "Dry-run, do not create CDI manifests")
+	cmd.Flags().Int64("device-node-uid", -1, "Owner user ID of the GPU device nodes in containers, same as the GPU kubelet-plugin argument. The default is -1, which keeps the owner of the host device nodes.")
+	cmd.Flags().Int64("device-node-gid", -1, "Owner group ID of the GPU device nodes in containers, same as the GPU kubelet-plugin argument. The default is -1, which keeps the group of the host device nodes.")
+	cmd.Flags().String("device-node-mode", "", "Octal permissions of the GPU device nodes in containers, e.g. 0660, same as the GPU kubelet-plugin argument. The default is the empty string, which keeps the permissions of the host device nodes.")
 	cmd.SetVersionTemplate("Intel CDI Specs Generator Version: {{.Version}}\n")
 
 	return cmd
 }
 
-func handleGPUDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool) error {
+func handleGPUDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool, permissions gpuCdihelpers.DeviceNodePermissions) error {
 	sysfsDir := gpuDevice.GetSysfsRoot()
 
 	fmt.Println("Scanning for GPUs")
@@ -155,12 +168,19 @@ func handleGPUDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool) e
 		return nil
 	}
 
-	// syncDetectedDevicesWithCdiRegistry overrides uid in detecteddevices from existing cdi spec
-	if err := gpuCdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true); err != nil {
+	// syncDetectedDevicesWithCdiRegistry overrides uid in detecteddevices from existing cdi spec.
+	// Device node permissions need to match the kubelet-plugin ones, otherwise
+	// they are reset to the host device node owner and mode.
+	drift, err := gpuCdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true, permissions)
+	if err != nil {
 		fmt.Printf("unable to sync detected devices to CDI registry: %v", err)
 		return err
 	}
 
+	if !drift.Empty() {
+		fmt.Printf("Fixed CDI registry drift: %v\n", drift)
+	}
+
 	return nil
 }
 
@@ -184,10 +204,15 @@ func handleGaudiDevices(cdiCache *cdiapi.Cache, namingStyle string, dryRun bool)
 	}
 
 	// syncDetectedDevicesWithCdiRegistry overrides uid in detecteddevices from existing cdi spec
-	if err := gaudiCdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true); err != nil {
+	drift, err := gaudiCdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true)
+	if err != nil {
 		fmt.Printf("unable to sync detected devices to CDI registry: %v", err)
 		return err
 	}
 
+	if !drift.Empty() {
+		fmt.Printf("Fixed CDI registry drift: %v\n", drift)
+	}
+
 	return nil
 }
@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+// controlServer modifies existing fake file system on requests received over
+// a unix socket, while kubelet-plugin is using it. Devices are identified by
+// their UID, or serial number based name, as in the template:
+//
+//	POST   /devices                 add devices, body is a devices template
+//	DELETE /devices/{uid}           remove device
+//	POST   /devices/{uid}/unhealthy mark device unhealthy
+//	POST   /devices/{uid}/healthy   mark device healthy
+//	POST   /devices/{uid}/ports/{port}/{up|down} set Gaudi port link state
+type controlServer struct {
+	sync.Mutex
+	deviceType  string
+	testDirs    helpers.TestDirsType
+	devices     deviceRecords
+	realDevices bool
+	// watcher emulates SR-IOV, new PFs are added to it when set.
+	watcher *fsnotify.Watcher
+}
+
+// stdoutLogger prints sriov_numvfs watcher messages to stdout.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Logf(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (stdoutLogger) Errorf(format string, args ...any) {
+	fmt.Printf("ERROR: "+format+"\n", args...)
+}
+
+// serveNode keeps device-faker running until SIGINT or SIGTERM is received,
+// emulating SR-IOV in fake sysfs and / or serving control API.
+func serveNode(deviceType string, testDirs helpers.TestDirsType, devices deviceRecords, realDevices bool, emulateSRIOV bool, controlSocket string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	c := newControlServer(deviceType, testDirs, devices, realDevices)
+
+	if emulateSRIOV {
+		if deviceType != "gpu" {
+			return fmt.Errorf("SR-IOV emulation is not supported for %v devices", deviceType)
+		}
+		watcher, err := fakesysfs.WatchNumvfs(stdoutLogger{}, testDirs.SysfsRoot, testDirs.DevfsRoot, realDevices)
+		if err != nil {
+			return fmt.Errorf("could not start SR-IOV emulation: %v", err)
+		}
+		defer watcher.Close()
+		c.watcher = watcher
+		fmt.Println("emulating SR-IOV: writes to sriov_numvfs files create and remove fake VFs")
+	}
+
+	if controlSocket == "" {
+		<-ctx.Done()
+		return nil
+	}
+
+	return c.serve(ctx, controlSocket)
+}
+
+func newControlServer(deviceType string, testDirs helpers.TestDirsType, devices deviceRecords, realDevices bool) *controlServer {
+	if devices == nil {
+		devices = deviceRecords{}
+	}
+
+	return &controlServer{
+		deviceType:  deviceType,
+		testDirs:    testDirs,
+		devices:     devices,
+		realDevices: realDevices,
+	}
+}
+
+func (c *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /devices", c.addDevices)
+	mux.HandleFunc("DELETE /devices/{uid}", c.removeDevice)
+	mux.HandleFunc("POST /devices/{uid}/unhealthy", func(w http.ResponseWriter, r *http.Request) {
+		c.setDeviceHealth(w, r, false)
+	})
+	mux.HandleFunc("POST /devices/{uid}/healthy", func(w http.ResponseWriter, r *http.Request) {
+		c.setDeviceHealth(w, r, true)
+	})
+	mux.HandleFunc("POST /devices/{uid}/ports/{port}/up", func(w http.ResponseWriter, r *http.Request) {
+		c.setPortState(w, r, true)
+	})
+	mux.HandleFunc("POST /devices/{uid}/ports/{port}/down", func(w http.ResponseWriter, r *http.Request) {
+		c.setPortState(w, r, false)
+	})
+	return mux
+}
+
+// serve listens on socketPath until ctx is done.
+func (c *controlServer) serve(ctx context.Context, socketPath string) error {
+	if err := os.RemoveAll(socketPath); err != nil {
+		return fmt.Errorf("could not remove stale control socket %v: %v", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("could not listen on control socket %v: %v", socketPath, err)
+	}
+
+	server := &http.Server{Handler: c.handler()}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			fmt.Printf("control server shutdown failed: %v\n", err)
+		}
+	}()
+
+	fmt.Printf("control socket: %v\n", socketPath)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("control server failed: %v", err)
+	}
+
+	return nil
+}
+
+func (c *controlServer) addDevices(w http.ResponseWriter, r *http.Request) {
+	devicesBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	devices, err := handleDevices(c.deviceType, devicesBytes, c.testDirs, c.realDevices)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not add devices: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for name, pciAddress := range devices {
+		c.devices[name] = pciAddress
+	}
+
+	if c.watcher != nil {
+		if err := fakesysfs.AddNumvfsWatches(c.watcher, c.testDirs.SysfsRoot); err != nil {
+			http.Error(w, fmt.Sprintf("could not watch new devices: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	fmt.Printf("added devices: %s\n", devicesBytes)
+}
+
+func (c *controlServer) removeDevice(w http.ResponseWriter, r *http.Request) {
+	uid := r.PathValue("uid")
+
+	c.Lock()
+	defer c.Unlock()
+
+	pciAddress, err := c.pciAddress(uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch c.deviceType {
+	case "gpu":
+		err = fakesysfs.RemoveFakeGpuDevice(c.testDirs.SysfsRoot, c.testDirs.DevfsRoot, pciAddress)
+	case "gaudi":
+		err = fakesysfs.RemoveFakeGaudiDevice(c.testDirs.SysfsRoot, c.testDirs.DevfsRoot, pciAddress)
+	case "npu":
+		err = fakesysfs.RemoveFakeNpuDevice(c.testDirs.SysfsRoot, c.testDirs.DevfsRoot, pciAddress)
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not remove device %v: %v", uid, err), http.StatusInternalServerError)
+		return
+	}
+
+	for name, devicePCIAddress := range c.devices {
+		if devicePCIAddress == pciAddress {
+			delete(c.devices, name)
+		}
+	}
+
+	fmt.Printf("removed device: %v\n", uid)
+}
+
+func (c *controlServer) setDeviceHealth(w http.ResponseWriter, r *http.Request, healthy bool) {
+	uid := r.PathValue("uid")
+
+	if c.deviceType != "gaudi" {
+		http.Error(w, fmt.Sprintf("health status is not supported for %v devices", c.deviceType), http.StatusNotImplemented)
+		return
+	}
+
+	status := fakesysfs.GaudiStatusOperational
+	if !healthy {
+		status = fakesysfs.GaudiStatusNeedsReset
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	pciAddress, err := c.pciAddress(uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := fakesysfs.SetFakeGaudiDeviceStatus(c.testDirs.SysfsRoot, pciAddress, status); err != nil {
+		http.Error(w, fmt.Sprintf("could not update device %v: %v", uid, err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("device %v status: %v\n", uid, status)
+}
+
+func (c *controlServer) setPortState(w http.ResponseWriter, r *http.Request, up bool) {
+	uid := r.PathValue("uid")
+
+	if c.deviceType != "gaudi" {
+		http.Error(w, fmt.Sprintf("ports are not supported for %v devices", c.deviceType), http.StatusNotImplemented)
+		return
+	}
+
+	port, err := strconv.ParseUint(r.PathValue("port"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid port %v: %v", r.PathValue("port"), err), http.StatusBadRequest)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	pciAddress, err := c.pciAddress(uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := fakesysfs.SetFakeGaudiPortState(c.testDirs.SysfsRoot, pciAddress, port, up); err != nil {
+		http.Error(w, fmt.Sprintf("could not update device %v: %v", uid, err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("device %v port %d up: %v\n", uid, port, up)
+}
+
+// pciAddress returns the PCI address of the device in fake sysfs from the
+// device records. Caller must hold the lock.
+func (c *controlServer) pciAddress(uid string) (string, error) {
+	pciAddress, found := c.devices[uid]
+	if !found {
+		return "", fmt.Errorf("unknown device %q", uid)
+	}
+
+	return pciAddress, nil
+}
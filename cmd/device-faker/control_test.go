@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestControlRemoveDevice(t *testing.T) {
+	template := `{
+		"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128, "serial": "0123456789abcdef"},
+		"card1": {"uid": "0000-05-00-0-0x56c0", "pciaddress": "0000:05:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 1, "renderdidx": 129}
+	}`
+
+	testDirs, devices, err := handleNode("gpu", path.Join(t.TempDir(), "node"), []byte(template), false)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	handler := newControlServer("gpu", testDirs, devices, false).handler()
+
+	testcases := []struct {
+		name       string
+		uid        string
+		status     int
+		removedDir string
+	}{
+		{
+			name:       "serial named device",
+			uid:        "sn-0123456789abcdef",
+			status:     http.StatusOK,
+			removedDir: "bus/pci/drivers/i915/0000:03:00.0",
+		},
+		{
+			name:   "removed device by its UID",
+			uid:    "0000-03-00-0-0x56c0",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "unknown device",
+			uid:    "sn-fedcba9876543210",
+			status: http.StatusNotFound,
+		},
+		{
+			name:       "PCI address based UID",
+			uid:        "0000-05-00-0-0x56c0",
+			status:     http.StatusOK,
+			removedDir: "bus/pci/drivers/i915/0000:05:00.0",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/devices/"+testcase.uid, strings.NewReader("")))
+
+			if recorder.Code != testcase.status {
+				t.Fatalf("expected status %v, got %v: %v", testcase.status, recorder.Code, recorder.Body.String())
+			}
+
+			if testcase.removedDir == "" {
+				return
+			}
+			if _, err := os.Stat(path.Join(testDirs.SysfsRoot, testcase.removedDir)); !os.IsNotExist(err) {
+				t.Errorf("device directory %v was not removed: %v", testcase.removedDir, err)
+			}
+		})
+	}
+}
+
+// controlTestCase is a control API request and its expected result.
+type controlTestCase struct {
+	name       string
+	deviceType string
+	method     string
+	url        string
+	body       string
+	status     int
+	file       string // file in fake sysfs expected to exist after the request
+	contents   string // expected contents of the file, if set
+}
+
+// newControlServers returns control servers of fake file systems created from
+// the templates, by device type.
+func newControlServers(t *testing.T, templates map[string]string) map[string]*controlServer {
+	t.Helper()
+
+	servers := map[string]*controlServer{}
+	for deviceType, template := range templates {
+		testDirs, devices, err := handleNode(deviceType, path.Join(t.TempDir(), "node"), []byte(template), false)
+		if err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+		servers[deviceType] = newControlServer(deviceType, testDirs, devices, false)
+	}
+
+	return servers
+}
+
+// runControlTestCases sends the requests in order, later ones may use the
+// devices added by earlier ones.
+func runControlTestCases(t *testing.T, servers map[string]*controlServer, testcases []controlTestCase) {
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			server := servers[testcase.deviceType]
+			recorder := httptest.NewRecorder()
+			server.handler().ServeHTTP(recorder, httptest.NewRequest(testcase.method, testcase.url, strings.NewReader(testcase.body)))
+
+			if recorder.Code != testcase.status {
+				t.Fatalf("expected status %v, got %v: %v", testcase.status, recorder.Code, recorder.Body.String())
+			}
+
+			if testcase.file == "" {
+				return
+			}
+			filePath := path.Join(server.testDirs.SysfsRoot, testcase.file)
+			if testcase.contents == "" {
+				if _, err := os.Stat(filePath); err != nil {
+					t.Errorf("expected %v to exist: %v", testcase.file, err)
+				}
+				return
+			}
+			contents, err := os.ReadFile(filePath)
+			if err != nil || strings.TrimSpace(string(contents)) != testcase.contents {
+				t.Errorf("expected %v to contain %q, got %q (%v)", testcase.file, testcase.contents, contents, err)
+			}
+		})
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	servers := newControlServers(t, map[string]string{
+		"gaudi": `{"accel0": {"uid": "0000-0f-00-0-0x1020", "pciaddress": "0000:0f:00.0", "model": "0x1020", "deviceidx": 0, "moduleidx": 0}}`,
+		"gpu":   `{"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128}}`,
+	})
+
+	runControlTestCases(t, servers, []controlTestCase{
+		{
+			name:       "add device",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices",
+			body:       `{"accel1": {"uid": "0000-1a-00-0-0x1020", "pciaddress": "0000:1a:00.0", "model": "0x1020", "deviceidx": 1, "moduleidx": 1}}`,
+			status:     http.StatusOK,
+			file:       "bus/pci/drivers/habanalabs/0000:1a:00.0",
+		},
+		{
+			name:       "add devices with invalid template",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices",
+			body:       `{"accel2": `,
+			status:     http.StatusInternalServerError,
+		},
+		{
+			name:       "unhealthy Gaudi",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/unhealthy",
+			status:     http.StatusOK,
+			file:       "devices/virtual/accel/accel0/device/status",
+			contents:   "needs reset",
+		},
+		{
+			name:       "healthy Gaudi",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/healthy",
+			status:     http.StatusOK,
+			file:       "devices/virtual/accel/accel0/device/status",
+			contents:   "operational",
+		},
+		{
+			name:       "unhealthy added Gaudi",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-1a-00-0-0x1020/unhealthy",
+			status:     http.StatusOK,
+			file:       "devices/virtual/accel/accel1/device/status",
+			contents:   "needs reset",
+		},
+		{
+			name:       "unhealthy unknown device",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-ff-00-0-0x1020/unhealthy",
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "remove unknown device",
+			deviceType: "gaudi",
+			method:     http.MethodDelete,
+			url:        "/devices/0000-ff-00-0-0x1020",
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "bad method for health",
+			deviceType: "gaudi",
+			method:     http.MethodGet,
+			url:        "/devices/0000-0f-00-0-0x1020/healthy",
+			status:     http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "bad method for devices",
+			deviceType: "gaudi",
+			method:     http.MethodPut,
+			url:        "/devices",
+			status:     http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unhealthy GPU",
+			deviceType: "gpu",
+			method:     http.MethodPost,
+			url:        "/devices/0000-03-00-0-0x56c0/unhealthy",
+			status:     http.StatusNotImplemented,
+		},
+		{
+			name:       "healthy GPU",
+			deviceType: "gpu",
+			method:     http.MethodPost,
+			url:        "/devices/0000-03-00-0-0x56c0/healthy",
+			status:     http.StatusNotImplemented,
+		},
+	})
+}
+
+func TestControlGaudiPorts(t *testing.T) {
+	servers := newControlServers(t, map[string]string{
+		"gaudi": `{"accel0": {"uid": "0000-0f-00-0-0x1020", "pciaddress": "0000:0f:00.0", "model": "0x1020", "deviceidx": 0, "moduleidx": 0, "ports": [{"index": 0, "up": true}]}}`,
+		"gpu":   `{"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128}}`,
+	})
+
+	runControlTestCases(t, servers, []controlTestCase{
+		{
+			name:       "port down",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/ports/0/down",
+			status:     http.StatusOK,
+			file:       "bus/pci/drivers/habanalabs/0000:0f:00.0/net/hbl_0/operstate",
+			contents:   "down",
+		},
+		{
+			name:       "port up",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/ports/0/up",
+			status:     http.StatusOK,
+			file:       "bus/pci/drivers/habanalabs/0000:0f:00.0/net/hbl_0/operstate",
+			contents:   "up",
+		},
+		{
+			name:       "invalid port",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/ports/first/up",
+			status:     http.StatusBadRequest,
+		},
+		{
+			name:       "missing port",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-0f-00-0-0x1020/ports/5/up",
+			status:     http.StatusInternalServerError,
+		},
+		{
+			name:       "port of unknown device",
+			deviceType: "gaudi",
+			method:     http.MethodPost,
+			url:        "/devices/0000-ff-00-0-0x1020/ports/0/up",
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "GPU port up",
+			deviceType: "gpu",
+			method:     http.MethodPost,
+			url:        "/devices/0000-03-00-0-0x56c0/ports/0/up",
+			status:     http.StatusNotImplemented,
+		},
+	})
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	gaudiDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+)
+
+// hlsmiModels maps hl-smi product names to PCI device IDs.
+var hlsmiModels = map[string]string{
+	"HL-205":  "0x1000",
+	"HL-225":  "0x1020",
+	"HL-325":  "0x1060",
+	"HL-325L": "0x1060",
+}
+
+// hlsmiColumns are the hl-smi query fields the inventory must contain, in the
+// order expected when the inventory has no header.
+var hlsmiColumns = []string{"index", "module_id", "bus_id", "name"}
+
+func newFromHLSMICommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "from-hl-smi <inventory.csv | ->",
+		Short: "Create Gaudi template from hl-smi inventory",
+		Long: "from-hl-smi converts the output of 'hl-smi -Q index,module_id,bus_id,name -f csv' into a Gaudi template " +
+			"that reproduces the same devices in fake sysfs",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := os.Stdin
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("could not read inventory file %v. Err: %v", args[0], err)
+				}
+				defer file.Close()
+				input = file
+			}
+
+			devices, err := parseHLSMIInventory(input)
+			if err != nil {
+				return fmt.Errorf("failed parsing inventory %v. Err: %v", args[0], err)
+			}
+
+			templateText, err := json.MarshalIndent(devices, "", "  ")
+			if err != nil {
+				return fmt.Errorf("template JSON encoding failed. Err: %v", err)
+			}
+
+			output := cmd.Flag("output").Value.String()
+			if output == "" {
+				fmt.Println(string(templateText))
+				return nil
+			}
+
+			if err := os.WriteFile(output, templateText, 0660); err != nil {
+				return fmt.Errorf("could not write template file %v: %v", output, err)
+			}
+			fmt.Printf("new template: %v\n", output)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", "", "Template file to write, default is stdout")
+
+	return cmd
+}
+
+// parseHLSMIInventory returns Gaudi devices listed in hl-smi CSV output. The
+// header line is optional; without it the columns must be in hlsmiColumns order.
+func parseHLSMIInventory(input io.Reader) (gaudiDevice.DevicesInfo, error) {
+	reader := csv.NewReader(input)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for idx, name := range hlsmiColumns {
+		columns[name] = idx
+	}
+	if len(records) > 0 {
+		if _, err := strconv.ParseUint(strings.TrimSpace(records[0][0]), 10, 64); err != nil {
+			columns, err = hlsmiHeaderColumns(records[0])
+			if err != nil {
+				return nil, err
+			}
+			records = records[1:]
+		}
+	}
+
+	devices := gaudiDevice.DevicesInfo{}
+	for lineIdx, record := range records {
+		field := func(name string) string {
+			if columns[name] >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[columns[name]])
+		}
+
+		deviceIdx, err := strconv.ParseUint(field("index"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid index %q", lineIdx+1, field("index"))
+		}
+		moduleIdx, err := strconv.ParseUint(field("module_id"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid module_id %q", lineIdx+1, field("module_id"))
+		}
+		pciAddress := strings.ToLower(field("bus_id"))
+		if !gaudiDevice.PciRegexp.MatchString(pciAddress) || len(pciAddress) != gaudiDevice.PCIAddressLength {
+			return nil, fmt.Errorf("record %d: invalid bus_id %q", lineIdx+1, field("bus_id"))
+		}
+		model, found := hlsmiModels[field("name")]
+		if !found {
+			return nil, fmt.Errorf("record %d: unsupported device name %q", lineIdx+1, field("name"))
+		}
+
+		name := fmt.Sprintf("accel%d", deviceIdx)
+		if _, found := devices[name]; found {
+			return nil, fmt.Errorf("record %d: duplicate index %d", lineIdx+1, deviceIdx)
+		}
+		devices[name] = &gaudiDevice.DeviceInfo{
+			UID:        gaudiDevice.DeviceUIDFromPCIinfo(pciAddress, model),
+			PCIAddress: pciAddress,
+			Model:      model,
+			DeviceIdx:  deviceIdx,
+			ModuleIdx:  moduleIdx,
+		}
+	}
+
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no Gaudi devices found")
+	}
+
+	return devices, nil
+}
+
+// hlsmiHeaderColumns returns the position of each of hlsmiColumns in the header.
+func hlsmiHeaderColumns(header []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for idx, name := range header {
+		columns[strings.TrimSpace(name)] = idx
+	}
+
+	for _, name := range hlsmiColumns {
+		if _, found := columns[name]; !found {
+			return nil, fmt.Errorf("column %q is missing, query it with 'hl-smi -Q %v -f csv'", name, strings.Join(hlsmiColumns, ","))
+		}
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHLSMIInventory(t *testing.T) {
+	type testCase struct {
+		name      string
+		inventory string
+		expected  map[string]string // device name to UID
+		moduleIdx map[string]uint64
+		err       string
+	}
+
+	testcases := []testCase{
+		{
+			name: "mixed Gaudi2 and Gaudi3 with header",
+			inventory: `bus_id, index, module_id, name
+0000:19:00.0, 0, 2, HL-225
+0000:b3:00.0, 1, 5, HL-325L
+`,
+			expected:  map[string]string{"accel0": "0000-19-00-0-0x1020", "accel1": "0000-b3-00-0-0x1060"},
+			moduleIdx: map[string]uint64{"accel0": 2, "accel1": 5},
+		},
+		{
+			name:      "no header",
+			inventory: "3, 0, 0000:1A:00.0, HL-225\n",
+			expected:  map[string]string{"accel3": "0000-1a-00-0-0x1020"},
+			moduleIdx: map[string]uint64{"accel3": 0},
+		},
+		{
+			name:      "missing column",
+			inventory: "index, bus_id, name\n0, 0000:19:00.0, HL-225\n",
+			err:       `column "module_id" is missing`,
+		},
+		{
+			name:      "unsupported name",
+			inventory: "0, 0, 0000:19:00.0, HL-999\n",
+			err:       "unsupported device name",
+		},
+		{
+			name:      "duplicate index",
+			inventory: "0, 0, 0000:19:00.0, HL-225\n0, 1, 0000:1a:00.0, HL-225\n",
+			err:       "duplicate index",
+		},
+		{
+			name:      "empty",
+			inventory: "index, module_id, bus_id, name\n",
+			err:       "no Gaudi devices found",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			devices, err := parseHLSMIInventory(strings.NewReader(testcase.inventory))
+			if testcase.err != "" {
+				if err == nil || !strings.Contains(err.Error(), testcase.err) {
+					t.Fatalf("expected error containing %q, got %v", testcase.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(devices) != len(testcase.expected) {
+				t.Fatalf("expected %d devices, got %v", len(testcase.expected), devices)
+			}
+			for name, uid := range testcase.expected {
+				gaudi, found := devices[name]
+				if !found || gaudi.UID != uid || gaudi.ModuleIdx != testcase.moduleIdx[name] {
+					t.Errorf("%v: expected UID %v module %d, got %+v", name, uid, testcase.moduleIdx[name], gaudi)
+				}
+			}
+			if problems := lintGaudiDevices(devices); len(problems) != 0 {
+				t.Errorf("converted template has problems: %v", problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	gaudiDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	gpuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	npuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+)
+
+func newLintCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint <template.json>",
+		Short: "Validate template",
+		Long:  "lint checks template for inconsistencies that would result in broken or unrealistic fake sysfs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deviceType := strings.ToLower(cmd.Flag("device-type").Value.String())
+			if _, found := supportedDevices[deviceType]; !found {
+				return fmt.Errorf("invalid device type specified: %s", deviceType)
+			}
+
+			templateBytes, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("could not read template file %v. Err: %v", args[0], err)
+			}
+
+			problems, err := lintTemplate(deviceType, templateBytes)
+			if err != nil {
+				return fmt.Errorf("failed parsing file %v. Err: %v", args[0], err)
+			}
+
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%d problem(s) found in %v", len(problems), args[0])
+			}
+
+			fmt.Printf("%v: OK\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("device-type", "t", "gpu", "Type of devices in the template: gpu, gaudi or npu")
+
+	return cmd
+}
+
+// lintTemplate returns a list of problems found in a single or multi-node template.
+func lintTemplate(deviceType string, templateBytes []byte) ([]string, error) {
+	nodes, err := parseMultiNodeTemplate(templateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if nodes == nil {
+		return lintDevices(deviceType, templateBytes)
+	}
+
+	nodeNames := make([]string, 0, len(nodes))
+	for nodeName := range nodes {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+
+	problems := []string{}
+	for _, nodeName := range nodeNames {
+		nodeProblems, err := lintDevices(deviceType, nodes[nodeName])
+		if err != nil {
+			return nil, fmt.Errorf("node %v: %v", nodeName, err)
+		}
+		for _, problem := range nodeProblems {
+			problems = append(problems, fmt.Sprintf("node %v: %v", nodeName, problem))
+		}
+	}
+
+	return problems, nil
+}
+
+func lintDevices(deviceType string, devicesBytes []byte) ([]string, error) {
+	var problems []string
+
+	switch deviceType {
+	case "gpu":
+		devices := make(gpuDevice.DevicesInfo)
+		if err := json.Unmarshal(devicesBytes, &devices); err != nil {
+			return nil, err
+		}
+		faults := make(templateFaults)
+		if err := json.Unmarshal(devicesBytes, &faults); err != nil {
+			return nil, err
+		}
+		problems = append(lintGPUDevices(devices), lintGPUFaults(faults)...)
+	case "gaudi":
+		devices := make(gaudiDevice.DevicesInfo)
+		if err := json.Unmarshal(devicesBytes, &devices); err != nil {
+			return nil, err
+		}
+		templateDevices := make(map[string]*gaudiTemplateDevice)
+		if err := json.Unmarshal(devicesBytes, &templateDevices); err != nil {
+			return nil, err
+		}
+		problems = append(lintGaudiDevices(devices), lintGaudiPorts(templateDevices)...)
+	case "npu":
+		devices := make(npuDevice.DevicesInfo)
+		if err := json.Unmarshal(devicesBytes, &devices); err != nil {
+			return nil, err
+		}
+		problems = lintNPUDevices(devices)
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// lintPCIInfo checks that the PCI address is valid and matches the UID.
+func lintPCIInfo(name, uid, pciAddress, expectedUID string) []string {
+	if !gpuDevice.PciRegexp.MatchString(pciAddress) || len(pciAddress) != gpuDevice.PCIAddressLength {
+		return []string{fmt.Sprintf("%v: invalid PCI address %q", name, pciAddress)}
+	}
+
+	if uid != expectedUID {
+		return []string{fmt.Sprintf("%v: UID %q does not match PCI address and model, expected %q", name, uid, expectedUID)}
+	}
+
+	return nil
+}
+
+// lintIndexes reports values used by more than one device.
+func lintIndexes(what string, indexes map[uint64][]string) []string {
+	problems := []string{}
+	for idx, names := range indexes {
+		if len(names) > 1 {
+			sort.Strings(names)
+			problems = append(problems, fmt.Sprintf("%v %d is used by multiple devices: %v", what, idx, strings.Join(names, ", ")))
+		}
+	}
+	return problems
+}
+
+func lintGPUDevices(devices gpuDevice.DevicesInfo) []string {
+	problems := []string{}
+	cardIndexes := map[uint64][]string{}
+	renderdIndexes := map[uint64][]string{}
+	vfIndexes := map[string]map[uint64][]string{}
+	byUID := map[string]*gpuDevice.DeviceInfo{}
+
+	for _, gpu := range devices {
+		byUID[gpu.UID] = gpu
+	}
+
+	for name, gpu := range devices {
+		pciAddress := gpu.PCIAddress
+		if pciAddress == "" && len(gpu.UID) == gpuDevice.UIDLength {
+			pciAddress, _ = gpuDevice.PciInfoFromDeviceUID(gpu.UID)
+		}
+		problems = append(problems, lintPCIInfo(name, gpu.UID, pciAddress, gpuDevice.DeviceUIDFromPCIinfo(pciAddress, gpu.Model))...)
+
+		if _, found := gpuDevice.ModelDetails[gpu.Model]; !found {
+			problems = append(problems, fmt.Sprintf("%v: unsupported model %q", name, gpu.Model))
+		}
+
+		if gpu.Driver != "" && gpu.Driver != gpuDevice.I915Driver && gpu.Driver != gpuDevice.XeDriver {
+			problems = append(problems, fmt.Sprintf("%v: unsupported driver %q", name, gpu.Driver))
+		}
+
+		cardIndexes[gpu.CardIdx] = append(cardIndexes[gpu.CardIdx], name)
+		if gpu.RenderdIdx != 0 {
+			renderdIndexes[gpu.RenderdIdx] = append(renderdIndexes[gpu.RenderdIdx], name)
+		}
+
+		switch gpu.DeviceType {
+		case gpuDevice.GpuDeviceType:
+		case gpuDevice.VfDeviceType:
+			parent, found := byUID[gpu.ParentUID]
+			switch {
+			case !found:
+				problems = append(problems, fmt.Sprintf("%v: parent %q of VF is not in the template", name, gpu.ParentUID))
+			case parent.DeviceType != gpuDevice.GpuDeviceType:
+				problems = append(problems, fmt.Sprintf("%v: parent %q of VF is not a GPU", name, gpu.ParentUID))
+			case gpu.VFIndex >= parent.MaxVFs:
+				problems = append(problems, fmt.Sprintf("%v: VF index %d exceeds parent's maximum of %d VFs", name, gpu.VFIndex, parent.MaxVFs))
+			}
+			if _, found := vfIndexes[gpu.ParentUID]; !found {
+				vfIndexes[gpu.ParentUID] = map[uint64][]string{}
+			}
+			vfIndexes[gpu.ParentUID][gpu.VFIndex] = append(vfIndexes[gpu.ParentUID][gpu.VFIndex], name)
+		default:
+			problems = append(problems, fmt.Sprintf("%v: unsupported device type %q", name, gpu.DeviceType))
+		}
+	}
+
+	problems = append(problems, lintIndexes("card index", cardIndexes)...)
+	problems = append(problems, lintIndexes("renderD index", renderdIndexes)...)
+	for parentUID, indexes := range vfIndexes {
+		problems = append(problems, lintIndexes(fmt.Sprintf("%v VF index", parentUID), indexes)...)
+	}
+
+	return problems
+}
+
+func lintGPUFaults(faults templateFaults) []string {
+	problems := []string{}
+	for name, deviceFaults := range faults {
+		for _, fault := range deviceFaults.Faults {
+			switch fault {
+			case fakesysfs.FaultNoLocalMemory, fakesysfs.FaultUnreadableLocalMemory, fakesysfs.FaultNoDRM, fakesysfs.FaultBrokenVirtfn, fakesysfs.FaultNoTiles:
+			default:
+				problems = append(problems, fmt.Sprintf("%v: unsupported fault %q", name, fault))
+			}
+		}
+	}
+	return problems
+}
+
+func lintGaudiDevices(devices gaudiDevice.DevicesInfo) []string {
+	problems := []string{}
+	deviceIndexes := map[uint64][]string{}
+	moduleIndexes := map[uint64][]string{}
+
+	for name, gaudi := range devices {
+		problems = append(problems, lintPCIInfo(name, gaudi.UID, gaudi.PCIAddress, gaudiDevice.DeviceUIDFromPCIinfo(gaudi.PCIAddress, gaudi.Model))...)
+
+		if _, found := gaudiDevice.ModelNames[gaudi.Model]; !found {
+			problems = append(problems, fmt.Sprintf("%v: unsupported model %q", name, gaudi.Model))
+		}
+
+		deviceIndexes[gaudi.DeviceIdx] = append(deviceIndexes[gaudi.DeviceIdx], name)
+		moduleIndexes[gaudi.ModuleIdx] = append(moduleIndexes[gaudi.ModuleIdx], name)
+	}
+
+	problems = append(problems, lintIndexes("accel index", deviceIndexes)...)
+	problems = append(problems, lintIndexes("module index", moduleIndexes)...)
+
+	return problems
+}
+
+func lintGaudiPorts(devices map[string]*gaudiTemplateDevice) []string {
+	problems := []string{}
+	modules := map[uint64]bool{}
+	for _, gaudi := range devices {
+		modules[gaudi.ModuleIdx] = true
+	}
+
+	for name, gaudi := range devices {
+		portIndexes := map[uint64][]string{}
+		for _, port := range gaudi.Ports {
+			portIndexes[port.Index] = append(portIndexes[port.Index], name)
+			if port.PeerModuleIdx == nil {
+				continue
+			}
+			switch {
+			case *port.PeerModuleIdx == gaudi.ModuleIdx:
+				problems = append(problems, fmt.Sprintf("%v: port %d is connected to its own module", name, port.Index))
+			case !modules[*port.PeerModuleIdx]:
+				problems = append(problems, fmt.Sprintf("%v: port %d peer module %d is not in the template", name, port.Index, *port.PeerModuleIdx))
+			}
+		}
+		for _, problem := range lintIndexes("port", portIndexes) {
+			problems = append(problems, fmt.Sprintf("%v: %v", name, problem))
+		}
+	}
+
+	return problems
+}
+
+func lintNPUDevices(devices npuDevice.DevicesInfo) []string {
+	problems := []string{}
+	deviceIndexes := map[uint64][]string{}
+
+	for name, npu := range devices {
+		problems = append(problems, lintPCIInfo(name, npu.UID, npu.PCIAddress, npuDevice.DeviceUIDFromPCIinfo(npu.PCIAddress, npu.Model))...)
+
+		if _, found := npuDevice.ModelNames[npu.Model]; !found {
+			problems = append(problems, fmt.Sprintf("%v: unsupported model %q", name, npu.Model))
+		}
+
+		deviceIndexes[npu.DeviceIdx] = append(deviceIndexes[npu.DeviceIdx], name)
+	}
+
+	problems = append(problems, lintIndexes("accel index", deviceIndexes)...)
+
+	return problems
+}
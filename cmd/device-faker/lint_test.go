@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintTemplate(t *testing.T) {
+	type testCase struct {
+		name       string
+		deviceType string
+		template   string
+		problems   []string // substrings of expected problems, in order
+	}
+
+	testcases := []testCase{
+		{
+			name:       "valid GPU template",
+			deviceType: "gpu",
+			template: `{
+				"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "cardidx": 0, "renderdidx": 128, "devicetype": "gpu", "maxvfs": 8},
+				"card1": {"uid": "0000-03-00-1-0x56c0", "pciaddress": "0000:03:00.1", "model": "0x56c0", "cardidx": 1, "renderdidx": 129, "devicetype": "vf", "parentuid": "0000-03-00-0-0x56c0"}
+			}`,
+		},
+		{
+			name:       "GPU UID mismatch and unsupported model",
+			deviceType: "gpu",
+			template: `{
+				"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:04:00.0", "model": "0x56c0", "cardidx": 0, "devicetype": "gpu"},
+				"card1": {"uid": "0000-05-00-0-0xffff", "pciaddress": "0000:05:00.0", "model": "0xffff", "cardidx": 1, "devicetype": "gpu"}
+			}`,
+			problems: []string{"card0: UID", "card1: unsupported model"},
+		},
+		{
+			name:       "GPU duplicate indexes and missing parent",
+			deviceType: "gpu",
+			template: `{
+				"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "cardidx": 0, "renderdidx": 128, "devicetype": "gpu"},
+				"card1": {"uid": "0000-03-00-1-0x56c0", "pciaddress": "0000:03:00.1", "model": "0x56c0", "cardidx": 0, "renderdidx": 128, "devicetype": "vf", "parentuid": "0000-09-00-0-0x56c0"}
+			}`,
+			problems: []string{"card index 0", "card1: parent", "renderD index 128"},
+		},
+		{
+			name:       "GPU unsupported fault",
+			deviceType: "gpu",
+			template: `{
+				"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "devicetype": "gpu", "faults": ["no-lmem", "no-gpu"]}
+			}`,
+			problems: []string{"card0: unsupported fault \"no-gpu\""},
+		},
+		{
+			name:       "gaudi duplicate module index",
+			deviceType: "gaudi",
+			template: `{
+				"accel0": {"uid": "0000-a0-00-0-0x1020", "pciaddress": "0000:a0:00.0", "model": "0x1020", "deviceidx": 0, "moduleidx": 1},
+				"accel1": {"uid": "0000-b0-00-0-0x1020", "pciaddress": "0000:b0:00.0", "model": "0x1020", "deviceidx": 1, "moduleidx": 1}
+			}`,
+			problems: []string{"module index 1"},
+		},
+		{
+			name:       "gaudi port peers",
+			deviceType: "gaudi",
+			template: `{
+				"accel0": {"uid": "0000-a0-00-0-0x1020", "pciaddress": "0000:a0:00.0", "model": "0x1020", "deviceidx": 0, "moduleidx": 0,
+					"ports": [{"index": 0, "peermoduleidx": 1}, {"index": 1, "peermoduleidx": 2}, {"index": 2}]},
+				"accel1": {"uid": "0000-b0-00-0-0x1020", "pciaddress": "0000:b0:00.0", "model": "0x1020", "deviceidx": 1, "moduleidx": 1,
+					"ports": [{"index": 0, "peermoduleidx": 1}, {"index": 0}]}
+			}`,
+			problems: []string{"accel0: port 1 peer module 2", "accel1: port 0 is connected to its own module", "accel1: port 0 is used by multiple"},
+		},
+		{
+			name:       "multi-node NPU template",
+			deviceType: "npu",
+			template: `{"nodes": {
+				"node1": {"accel0": {"uid": "0000-00-0b-0-0x7d1d", "pciaddress": "0000:00:0b.0", "model": "0x7d1d"}},
+				"node2": {"accel0": {"uid": "0000-00-0b-0-0x7d1d", "pciaddress": "0000:00:0b", "model": "0x7d1d"}}
+			}}`,
+			problems: []string{"node node2: accel0: invalid PCI address"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		problems, err := lintTemplate(testcase.deviceType, []byte(testcase.template))
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", testcase.name, err)
+			continue
+		}
+
+		if len(problems) != len(testcase.problems) {
+			t.Errorf("%v: expected %d problems, got %d: %v", testcase.name, len(testcase.problems), len(problems), problems)
+			continue
+		}
+
+		for i, problem := range problems {
+			if !strings.Contains(problem, testcase.problems[i]) {
+				t.Errorf("%v: expected problem containing %q, got %q", testcase.name, testcase.problems[i], problem)
+			}
+		}
+	}
+}
@@ -20,13 +20,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
 	gaudiDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
 	gpuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	npuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
 	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -34,10 +39,43 @@ var (
 	supportedDevices = map[string]bool{
 		"gpu":   true,
 		"gaudi": true,
+		"npu":   true,
 	}
 	version = "v0.3.0"
 )
 
+// multiNodeTemplate describes several fake nodes, each with its own set of
+// devices in the same format as a single-node template.
+type multiNodeTemplate struct {
+	Nodes map[string]json.RawMessage `json:"nodes"`
+}
+
+// gaudiTemplateDevice is a Gaudi template entry, optionally with NIC ports
+// topology and link states.
+type gaudiTemplateDevice struct {
+	gaudiDevice.DeviceInfo
+	Ports []fakesysfs.GaudiPort `json:"ports,omitempty"`
+}
+
+// deviceRecords maps the names of the fake devices, which the kubelet
+// plugins publish them with, to their PCI addresses in fake sysfs.
+type deviceRecords map[string]string
+
+// add records the UID of every device, and its serial number based name
+// when it has one, with the PCI address of the device.
+func (r deviceRecords) add(uid string, pciAddress string, serialName string) {
+	r[uid] = pciAddress
+	if serialName != "" {
+		r[serialName] = pciAddress
+	}
+}
+
+// templateFaults holds defects to inject into fake sysfs, declared for GPU
+// devices in the template as e.g. "faults": ["no-lmem", "broken-virtfn"].
+type templateFaults map[string]struct {
+	Faults []string `json:"faults"`
+}
+
 func main() {
 	command := newCommand()
 	err := command.Execute()
@@ -48,9 +86,9 @@ func main() {
 
 func newCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "device-faker <gpu | gaudi>",
+		Use:   "device-faker <gpu | gaudi | npu>",
 		Short: "device-faker",
-		Long:  "device-faker creates fake sysfs and devfs in /tmp for Intel GPU or Intel Gaudi based on template ",
+		Long:  "device-faker creates fake sysfs and devfs in /tmp for Intel GPU, Intel Gaudi or Intel NPU based on template ",
 		Args: func(cmd *cobra.Command, args []string) error {
 			// arguments validation
 			if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
@@ -84,7 +122,8 @@ func newCommand() *cobra.Command {
 				newTemplate = true
 			}
 			if newTemplate {
-				return createNewTemplate(deviceType)
+				hls2 := cmd.Flag("hls2").Value.String() == "true"
+				return createNewTemplate(deviceType, hls2)
 			}
 
 			template := cmd.Flag("template").Value.String()
@@ -92,103 +131,263 @@ func newCommand() *cobra.Command {
 				return fmt.Errorf("template parameter is missing")
 			}
 
-			var testDirs helpers.TestDirsType
-			var err error
-			var driverName string
-
-			switch deviceType {
-			case "gpu":
-				driverName = "gpu.intel.com"
-			case "gaudi":
-				driverName = "gaudi.intel.com"
+			templateBytes, err := os.ReadFile(template)
+			if err != nil {
+				return fmt.Errorf("could not read template file %v. Err: %v", template, err)
 			}
 
-			if targetDir == "" {
-				testDirs, err = helpers.NewTestDirs(driverName)
-			} else {
-				testDirs, err = helpers.NewTestDirsAt(targetDir, driverName)
-			}
+			nodes, err := parseMultiNodeTemplate(templateBytes)
 			if err != nil {
-				return fmt.Errorf("error creating temp dirs: %v", err)
+				return fmt.Errorf("failed parsing file %v. Err: %v", template, err)
 			}
 
-			switch deviceType {
-			case "gpu":
-				return handleGPUDevices(template, testDirs, realDevices)
-			case "gaudi":
-				return handleGaudiDevices(template, testDirs, realDevices)
+			controlSocket := cmd.Flag("control-socket").Value.String()
+			emulateSRIOV := cmd.Flag("emulate-sriov").Value.String() == "true"
+			if nodes == nil {
+				testDirs, devices, err := handleNode(deviceType, targetDir, templateBytes, realDevices)
+				if err != nil || (controlSocket == "" && !emulateSRIOV) {
+					return err
+				}
+				return serveNode(deviceType, testDirs, devices, realDevices, emulateSRIOV, controlSocket)
 			}
 
-			return nil
+			if controlSocket != "" || emulateSRIOV {
+				return fmt.Errorf("control socket and SR-IOV emulation are only supported with single-node templates")
+			}
+
+			return handleNodes(deviceType, targetDir, nodes, realDevices)
 		},
 	}
 
 	cmd.Version = version
 	cmd.Flags().BoolP("version", "v", false, "Show the version of the binary")
 	cmd.Flags().BoolP("new-template", "n", false, "Create new template file for given accelerator")
+	cmd.Flags().Bool("hls2", false, "Create new template of HLS-2 server with 8 Gaudi2 and their ports topology")
 	cmd.Flags().StringP("template", "t", "", "Template file to populate devices from")
 	cmd.Flags().StringP("target-dir", "d", "", "Target directory, default is random /tmp/test-*")
 	cmd.Flags().BoolP("real-devices", "r", false, "Create real device files (requires root)")
+	cmd.Flags().BoolP("emulate-sriov", "e", false, "Keep running and create or remove fake VFs on sriov_numvfs writes (GPU only)")
+	cmd.Flags().StringP("control-socket", "s", "", "Keep running and serve fake devices control API on given unix socket")
 	cmd.SetVersionTemplate("device-faker version: {{.Version}}\n")
+	cmd.AddCommand(newSnapshotCommand())
+	cmd.AddCommand(newLintCommand())
+	cmd.AddCommand(newFromHLSMICommand())
 
 	return cmd
 }
 
-func handleGPUDevices(templateFilePath string, testDirs helpers.TestDirsType, realDevices bool) error {
-	devices := make(gpuDevice.DevicesInfo)
-	devicesBytes, err := os.ReadFile(templateFilePath)
+// parseMultiNodeTemplate returns per-node device templates when the template
+// describes multiple nodes, or nil when it is a single-node devices template.
+// A template is multi-node when its only top-level key is "nodes", which must
+// hold at least one node.
+func parseMultiNodeTemplate(templateBytes []byte) (map[string]json.RawMessage, error) {
+	topLevel := map[string]json.RawMessage{}
+	if err := json.Unmarshal(templateBytes, &topLevel); err != nil {
+		return nil, err
+	}
+
+	if _, found := topLevel["nodes"]; !found {
+		return nil, nil
+	}
+
+	if len(topLevel) != 1 {
+		return nil, fmt.Errorf("multi-node template must not have other top-level keys than \"nodes\"")
+	}
+
+	template := multiNodeTemplate{}
+	if err := json.Unmarshal(templateBytes, &template); err != nil {
+		return nil, err
+	}
+
+	if len(template.Nodes) == 0 {
+		return nil, fmt.Errorf("multi-node template has no nodes")
+	}
+
+	for nodeName := range template.Nodes {
+		if !validNodeName(nodeName) {
+			return nil, fmt.Errorf("invalid node name %q", nodeName)
+		}
+	}
+
+	return template.Nodes, nil
+}
+
+// validNodeName returns true when the node name can be used as a directory
+// name under the target directory.
+func validNodeName(nodeName string) bool {
+	return nodeName != "" && nodeName != "." && nodeName != ".." && nodeName == filepath.Base(nodeName)
+}
+
+func driverNameForDeviceType(deviceType string) string {
+	family, err := cdiregistry.Lookup(deviceType)
 	if err != nil {
-		return fmt.Errorf("could not read template file %v. Err: %v", templateFilePath, err)
+		return ""
 	}
+	return family.DriverName()
+}
 
-	if err := json.Unmarshal(devicesBytes, &devices); err != nil {
-		return fmt.Errorf("failed parsing file %v. Err: %v", templateFilePath, err)
+// handleNodes creates a separate fake file system for every node in
+// a multi-node template, under <targetDir>/<node name>. Node names are
+// validated before anything is written.
+func handleNodes(deviceType string, targetDir string, nodes map[string]json.RawMessage, realDevices bool) error {
+	nodeNames := make([]string, 0, len(nodes))
+	for nodeName := range nodes {
+		if !validNodeName(nodeName) {
+			return fmt.Errorf("invalid node name %q", nodeName)
+		}
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+
+	if targetDir == "" {
+		testRoot, err := os.MkdirTemp("", "test-*")
+		if err != nil {
+			return fmt.Errorf("error creating temp dir: %v", err)
+		}
+		if err := os.Chmod(testRoot, 0755); err != nil {
+			return fmt.Errorf("error changing permissions of temp dir: %v", err)
+		}
+		targetDir = testRoot
+	}
+
+	for _, nodeName := range nodeNames {
+		fmt.Printf("node: %v\n", nodeName)
+		if _, _, err := handleNode(deviceType, path.Join(targetDir, nodeName), nodes[nodeName], realDevices); err != nil {
+			return fmt.Errorf("node %v: %v", nodeName, err)
+		}
 	}
 
-	err = fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, realDevices)
+	return nil
+}
+
+// handleNode creates fake file system for a single node in targetDir, or in
+// a random /tmp/test-* directory if targetDir is empty, and returns it with
+// the records of the created devices.
+func handleNode(deviceType string, targetDir string, devicesBytes []byte, realDevices bool) (helpers.TestDirsType, deviceRecords, error) {
+	var testDirs helpers.TestDirsType
+	var err error
+
+	driverName := driverNameForDeviceType(deviceType)
+	if targetDir == "" {
+		testDirs, err = helpers.NewTestDirs(driverName)
+	} else {
+		testDirs, err = helpers.NewTestDirsAt(targetDir, driverName)
+	}
+	if err != nil {
+		return testDirs, nil, fmt.Errorf("error creating temp dirs: %v", err)
+	}
+
+	devices, err := handleDevices(deviceType, devicesBytes, testDirs, realDevices)
 	if err != nil {
 		fmt.Printf("could not setup fake filesystem in %v: %v\n", testDirs.TestRoot, err)
 		if err := os.RemoveAll(testDirs.TestRoot); err != nil {
 			fmt.Printf("could not cleanup temp directory %v: %v\n", testDirs.TestRoot, err)
 		}
-		return err
+		return testDirs, nil, err
 	}
 
 	fmt.Printf("fake file system: %v\n", testDirs.TestRoot)
 	fmt.Printf("fake sysfs: %v\n", testDirs.SysfsRoot)
 	fmt.Printf("fake devfs: %v\n", testDirs.DevfsRoot)
 	fmt.Printf("fake CDI: %v\n", testDirs.CdiRoot)
-	return nil
+	fmt.Printf("kubelet plugin flags: --fake-mode --sysfs-root %v --devfs-root %v --cdi-dir %v\n",
+		testDirs.SysfsRoot, testDirs.DevfsRoot, testDirs.CdiRoot)
+	return testDirs, devices, nil
 }
 
-func handleGaudiDevices(templateFilePath string, testDirs helpers.TestDirsType, realDevices bool) error {
-	devices := make(gaudiDevice.DevicesInfo)
-	devicesBytes, err := os.ReadFile(templateFilePath)
-	if err != nil {
-		return fmt.Errorf("could not read template file %v. Err: %v", templateFilePath, err)
+// handleDevices adds the devices of a template to the fake file system and
+// returns their records.
+func handleDevices(deviceType string, devicesBytes []byte, testDirs helpers.TestDirsType, realDevices bool) (deviceRecords, error) {
+	switch deviceType {
+	case "gpu":
+		return handleGPUDevices(devicesBytes, testDirs, realDevices)
+	case "gaudi":
+		return handleGaudiDevices(devicesBytes, testDirs, realDevices)
+	case "npu":
+		return handleNPUDevices(devicesBytes, testDirs, realDevices)
 	}
 
+	return nil, fmt.Errorf("unsupported device type %v", deviceType)
+}
+
+func handleGPUDevices(devicesBytes []byte, testDirs helpers.TestDirsType, realDevices bool) (deviceRecords, error) {
+	devices := make(gpuDevice.DevicesInfo)
 	if err := json.Unmarshal(devicesBytes, &devices); err != nil {
-		return fmt.Errorf("failed parsing file %v. Err: %v", templateFilePath, err)
+		return nil, fmt.Errorf("failed parsing devices. Err: %v", err)
 	}
 
-	err = fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, realDevices)
-	if err != nil {
-		fmt.Printf("could not setup fake filesystem in %v: %v\n", testDirs.TestRoot, err)
-		if err := os.RemoveAll(testDirs.TestRoot); err != nil {
-			fmt.Printf("could not cleanup temp directory %v: %v\n", testDirs.TestRoot, err)
+	faults := make(templateFaults)
+	if err := json.Unmarshal(devicesBytes, &faults); err != nil {
+		return nil, fmt.Errorf("failed parsing device faults. Err: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, realDevices); err != nil {
+		return nil, err
+	}
+
+	for name, deviceFaults := range faults {
+		if len(deviceFaults.Faults) == 0 {
+			continue
+		}
+		if err := fakesysfs.InjectGpuFaults(testDirs.SysfsRoot, devices[name], deviceFaults.Faults); err != nil {
+			return nil, err
 		}
-		return err
 	}
 
-	fmt.Printf("fake file system: %v\n", testDirs.TestRoot)
-	fmt.Printf("fake sysfs: %v\n", testDirs.SysfsRoot)
-	fmt.Printf("fake devfs: %v\n", testDirs.DevfsRoot)
-	fmt.Printf("fake CDI: %v\n", testDirs.CdiRoot)
-	return nil
+	// fake sysfs has filled in the PCI addresses missing from the template
+	records := deviceRecords{}
+	for _, gpu := range devices {
+		records.add(gpu.UID, gpu.PCIAddress, gpu.SerialName())
+	}
+
+	return records, nil
+}
+
+func handleGaudiDevices(devicesBytes []byte, testDirs helpers.TestDirsType, realDevices bool) (deviceRecords, error) {
+	templateDevices := make(map[string]*gaudiTemplateDevice)
+	if err := json.Unmarshal(devicesBytes, &templateDevices); err != nil {
+		return nil, fmt.Errorf("failed parsing devices. Err: %v", err)
+	}
+
+	devices := make(gaudiDevice.DevicesInfo)
+	for name, templateDevice := range templateDevices {
+		devices[name] = &templateDevice.DeviceInfo
+	}
+
+	if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, realDevices); err != nil {
+		return nil, err
+	}
+
+	records := deviceRecords{}
+	for _, templateDevice := range templateDevices {
+		if err := fakesysfs.FakeGaudiPorts(testDirs.SysfsRoot, templateDevice.PCIAddress, templateDevice.Ports); err != nil {
+			return nil, err
+		}
+		records.add(templateDevice.UID, templateDevice.PCIAddress, "")
+	}
+
+	return records, nil
+}
+
+func handleNPUDevices(devicesBytes []byte, testDirs helpers.TestDirsType, realDevices bool) (deviceRecords, error) {
+	devices := make(npuDevice.DevicesInfo)
+	if err := json.Unmarshal(devicesBytes, &devices); err != nil {
+		return nil, fmt.Errorf("failed parsing devices. Err: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsNpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, realDevices); err != nil {
+		return nil, err
+	}
+
+	records := deviceRecords{}
+	for _, npu := range devices {
+		records.add(npu.UID, npu.PCIAddress, "")
+	}
+
+	return records, nil
 }
 
-func createNewTemplate(deviceType string) error {
+func createNewTemplate(deviceType string, hls2 bool) error {
 	var templateText []byte
 	templateFilePath, err := os.CreateTemp("/tmp/", fmt.Sprintf("%s-template-*.json", deviceType))
 	if err != nil {
@@ -209,6 +408,7 @@ func createNewTemplate(deviceType string) error {
 				DeviceType: "gpu",
 				MaxVFs:     8,
 				VFProfile:  "",
+				Driver:     gpuDevice.I915Driver,
 			},
 			"card1": {
 				UID:        "0000-03-00-1-0x56c0",
@@ -223,6 +423,7 @@ func createNewTemplate(deviceType string) error {
 				ParentUID:  "0000-03-00-0-0x56c0",
 				VFProfile:  "",
 				VFIndex:    0,
+				Driver:     gpuDevice.I915Driver,
 			},
 		}
 		templateText, err = json.MarshalIndent(templateData, "", "  ")
@@ -230,6 +431,13 @@ func createNewTemplate(deviceType string) error {
 			return fmt.Errorf("GPU template JSON encoding failed. Err: %v", err)
 		}
 	case "gaudi":
+		if hls2 {
+			templateText, err = json.MarshalIndent(newHLS2Template(), "", "  ")
+			if err != nil {
+				return fmt.Errorf("gaudi template JSON encoding failed. Err: %v", err)
+			}
+			break
+		}
 		templateData := gaudiDevice.DevicesInfo{
 			"accel0": {
 				UID:        "0000-a0-00-0-0x1020",
@@ -250,6 +458,19 @@ func createNewTemplate(deviceType string) error {
 		if err != nil {
 			return fmt.Errorf("gaudi template JSON encoding failed. Err: %v", err)
 		}
+	case "npu":
+		templateData := npuDevice.DevicesInfo{
+			"0000-00-0b-0-0x7d1d": {
+				UID:        "0000-00-0b-0-0x7d1d",
+				PCIAddress: "0000:00:0b.0",
+				Model:      "0x7d1d",
+				DeviceIdx:  0,
+			},
+		}
+		templateText, err = json.MarshalIndent(templateData, "", "  ")
+		if err != nil {
+			return fmt.Errorf("NPU template JSON encoding failed. Err: %v", err)
+		}
 	}
 
 	err = os.WriteFile(templateFilePath.Name(), templateText, 0660)
@@ -259,3 +480,56 @@ func createNewTemplate(deviceType string) error {
 	fmt.Printf("new template: %v\n", templateFilePath.Name())
 	return nil
 }
+
+// newHLS2Template returns 8 Gaudi2 modules, each with 24 ports, 3 of which are
+// scale-out ports, and the rest connect every module to each of its 7 peers
+// with 3 ports.
+func newHLS2Template() map[string]*gaudiTemplateDevice {
+	const (
+		modules        = 8
+		ports          = 24
+		portsPerPeer   = 3
+		gaudi2DeviceID = "0x1020"
+	)
+	pciAddresses := []string{
+		"0000:19:00.0", "0000:1a:00.0", "0000:33:00.0", "0000:34:00.0",
+		"0000:9a:00.0", "0000:9b:00.0", "0000:b3:00.0", "0000:b4:00.0",
+	}
+	scaleOutPorts := map[uint64]bool{8: true, 22: true, 23: true}
+
+	template := map[string]*gaudiTemplateDevice{}
+	for moduleIdx := uint64(0); moduleIdx < modules; moduleIdx++ {
+		uid := gaudiDevice.DeviceUIDFromPCIinfo(pciAddresses[moduleIdx], gaudi2DeviceID)
+		templateDevice := &gaudiTemplateDevice{
+			DeviceInfo: gaudiDevice.DeviceInfo{
+				UID:        uid,
+				PCIAddress: pciAddresses[moduleIdx],
+				Model:      gaudi2DeviceID,
+				DeviceIdx:  moduleIdx,
+				ModuleIdx:  moduleIdx,
+			},
+		}
+
+		// Scale-up ports are assigned to peers in ascending module order.
+		peers := []uint64{}
+		for peer := uint64(0); peer < modules; peer++ {
+			if peer != moduleIdx {
+				peers = append(peers, peer)
+			}
+		}
+		scaleUpIdx := 0
+		for portIdx := uint64(0); portIdx < ports; portIdx++ {
+			port := fakesysfs.GaudiPort{Index: portIdx, Up: true}
+			if !scaleOutPorts[portIdx] {
+				peer := peers[scaleUpIdx/portsPerPeer]
+				port.PeerModuleIdx = &peer
+				scaleUpIdx++
+			}
+			templateDevice.Ports = append(templateDevice.Ports, port)
+		}
+
+		template[fmt.Sprintf("accel%d", moduleIdx)] = templateDevice
+	}
+
+	return template
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+func TestParseMultiNodeTemplate(t *testing.T) {
+	testcases := []struct {
+		name     string
+		template string
+		nodes    []string // nil for single-node template
+		err      bool
+	}{
+		{
+			name:     "single-node template",
+			template: `{"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0"}}`,
+		},
+		{
+			name:     "empty single-node template",
+			template: `{}`,
+		},
+		{
+			name:     "multi-node template",
+			template: `{"nodes": {"node-1": {"card0": {"uid": "0000-03-00-0-0x56c0"}}, "node-2": {}}}`,
+			nodes:    []string{"node-1", "node-2"},
+		},
+		{
+			name:     "multi-node template without nodes",
+			template: `{"nodes": {}}`,
+			err:      true,
+		},
+		{
+			name:     "multi-node template with null nodes",
+			template: `{"nodes": null}`,
+			err:      true,
+		},
+		{
+			name:     "multi-node template with devices",
+			template: `{"nodes": {"node-1": {}}, "card0": {"uid": "0000-03-00-0-0x56c0"}}`,
+			err:      true,
+		},
+		{
+			name:     "nodes is not an object",
+			template: `{"nodes": ["node-1"]}`,
+			err:      true,
+		},
+		{
+			name:     "node name with path",
+			template: `{"nodes": {"../node-1": {}}}`,
+			err:      true,
+		},
+		{
+			name:     "empty node name",
+			template: `{"nodes": {"": {}}}`,
+			err:      true,
+		},
+		{
+			name:     "invalid JSON",
+			template: `{"nodes": `,
+			err:      true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			nodes, err := parseMultiNodeTemplate([]byte(testcase.template))
+			if testcase.err {
+				if err == nil {
+					t.Errorf("expected error, got nodes %v", nodes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if testcase.nodes == nil {
+				if nodes != nil {
+					t.Errorf("expected single-node template, got nodes %v", nodes)
+				}
+				return
+			}
+
+			nodeNames := make([]string, 0, len(nodes))
+			for nodeName := range nodes {
+				nodeNames = append(nodeNames, nodeName)
+			}
+			sort.Strings(nodeNames)
+			if len(nodeNames) != len(testcase.nodes) {
+				t.Fatalf("expected nodes %v, got %v", testcase.nodes, nodeNames)
+			}
+			for i := range nodeNames {
+				if nodeNames[i] != testcase.nodes[i] {
+					t.Errorf("expected nodes %v, got %v", testcase.nodes, nodeNames)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleNodes(t *testing.T) {
+	nodes := map[string]json.RawMessage{
+		"node-1": json.RawMessage(`{"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128}}`),
+		"node-2": json.RawMessage(`{"card0": {"uid": "0000-05-00-0-0x56c0", "pciaddress": "0000:05:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128}}`),
+	}
+
+	targetDir := path.Join(t.TempDir(), "nodes")
+	if err := handleNodes("gpu", targetDir, nodes, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for nodeName, pciAddress := range map[string]string{"node-1": "0000:03:00.0", "node-2": "0000:05:00.0"} {
+		for _, file := range []string{
+			"sysfs/bus/pci/drivers/i915/" + pciAddress + "/device",
+			"sysfs/class/drm/card0",
+			"dev/dri/card0",
+			"dev/dri/renderD128",
+			"cdi",
+			"kubelet-plugin/plugins/gpu.intel.com",
+		} {
+			if _, err := os.Stat(path.Join(targetDir, nodeName, file)); err != nil {
+				t.Errorf("%v: missing %v: %v", nodeName, file, err)
+			}
+		}
+	}
+	if _, err := os.Stat(path.Join(targetDir, "node-1", "sysfs/bus/pci/drivers/i915/0000:05:00.0")); !os.IsNotExist(err) {
+		t.Errorf("device of node-2 was created on node-1: %v", err)
+	}
+
+	for _, nodeName := range []string{"", ".", "..", "../escape", "node/1", "/node-1"} {
+		t.Run("invalid node name "+nodeName, func(t *testing.T) {
+			testRoot := t.TempDir()
+			targetDir := path.Join(testRoot, "nodes")
+			invalidNodes := map[string]json.RawMessage{
+				"node-1": nodes["node-1"],
+				nodeName: nodes["node-2"],
+			}
+
+			if err := handleNodes("gpu", targetDir, invalidNodes, false); err == nil {
+				t.Fatalf("expected error for node name %q", nodeName)
+			}
+
+			entries, err := os.ReadDir(testRoot)
+			if err != nil {
+				t.Fatalf("could not read test root: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected nothing written for node name %q, got %v", nodeName, entries)
+			}
+		})
+	}
+}
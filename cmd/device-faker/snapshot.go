@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	gaudiDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	gaudiDiscovery "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	gpuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	gpuDiscovery "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot <gpu | gaudi>",
+		Short: "Create template from devices of this host",
+		Long:  "snapshot discovers accelerators in sysfs of this host and writes a template that reproduces them in fake sysfs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			templateText, err := snapshotTemplate(strings.ToLower(args[0]), cmd.Flag("sysfs-root").Value.String())
+			if err != nil {
+				return err
+			}
+
+			output := cmd.Flag("output").Value.String()
+			if output == "" {
+				fmt.Println(string(templateText))
+				return nil
+			}
+
+			if err := os.WriteFile(output, templateText, 0660); err != nil {
+				return fmt.Errorf("could not write template file %v: %v", output, err)
+			}
+			fmt.Printf("new template: %v\n", output)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("sysfs-root", "/sys", "Sysfs location to discover devices from")
+	cmd.Flags().StringP("output", "o", "", "Template file to write, default is stdout")
+
+	return cmd
+}
+
+// snapshotTemplate discovers devices of the device type in sysfsRoot and
+// returns a template that reproduces them in fake sysfs.
+func snapshotTemplate(deviceType string, sysfsRoot string) ([]byte, error) {
+	var devices interface{}
+	switch deviceType {
+	case "gpu":
+		detected := gpuDevice.DevicesInfo(gpuDiscovery.DiscoverDevices(sysfsRoot, gpuDevice.DefaultNamingStyle))
+		if len(detected) == 0 {
+			return nil, fmt.Errorf("no GPU devices found in %v", sysfsRoot)
+		}
+		devices = detected
+	case "gaudi":
+		detected := gaudiDevice.DevicesInfo(gaudiDiscovery.DiscoverDevices(sysfsRoot, gaudiDevice.DefaultNamingStyle))
+		if len(detected) == 0 {
+			return nil, fmt.Errorf("no Gaudi devices found in %v", sysfsRoot)
+		}
+		devices = detected
+	default:
+		return nil, fmt.Errorf("snapshot is not supported for device type: %s", deviceType)
+	}
+
+	templateText, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("template JSON encoding failed. Err: %v", err)
+	}
+
+	return templateText, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	gaudiDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	gaudiDiscovery "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	gpuDevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	gpuDiscovery "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+)
+
+// TestSnapshotRoundTrip fakes devices from a template, snapshots them, fakes
+// them again from the snapshot and checks that the same devices are discovered.
+func TestSnapshotRoundTrip(t *testing.T) {
+	testcases := []struct {
+		deviceType string
+		template   string
+		discover   func(sysfsRoot string) interface{}
+	}{
+		{
+			deviceType: "gpu",
+			template: `{
+				"card0": {"uid": "0000-03-00-0-0x56c0", "pciaddress": "0000:03:00.0", "model": "0x56c0", "memorymib": 16256, "devicetype": "gpu", "cardidx": 0, "renderdidx": 128, "maxvfs": 8},
+				"card1": {"uid": "0000-03-00-1-0x56c0", "pciaddress": "0000:03:00.1", "model": "0x56c0", "memorymib": 8128, "devicetype": "vf", "cardidx": 1, "renderdidx": 129, "parentuid": "0000-03-00-0-0x56c0"},
+				"card2": {"uid": "0000-04-00-0-0x0bd5", "pciaddress": "0000:04:00.0", "model": "0x0bd5", "memorymib": 131072, "devicetype": "gpu", "cardidx": 2, "renderdidx": 130, "maxvfs": 8, "driver": "xe"}
+			}`,
+			discover: func(sysfsRoot string) interface{} {
+				return gpuDiscovery.DiscoverDevices(sysfsRoot, gpuDevice.DefaultNamingStyle)
+			},
+		},
+		{
+			deviceType: "gaudi",
+			template: `{
+				"accel0": {"uid": "0000-0f-00-0-0x1020", "pciaddress": "0000:0f:00.0", "model": "0x1020", "deviceidx": 0, "moduleidx": 2},
+				"accel1": {"uid": "0000-1a-00-0-0x1020", "pciaddress": "0000:1a:00.0", "model": "0x1020", "deviceidx": 1, "moduleidx": 3, "pciroot": "16"}
+			}`,
+			discover: func(sysfsRoot string) interface{} {
+				return gaudiDiscovery.DiscoverDevices(sysfsRoot, gaudiDevice.DefaultNamingStyle)
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.deviceType, func(t *testing.T) {
+			testDirs, _, err := handleNode(testcase.deviceType, path.Join(t.TempDir(), "faked"), []byte(testcase.template), false)
+			if err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+			expected := testcase.discover(testDirs.SysfsRoot)
+
+			snapshot, err := snapshotTemplate(testcase.deviceType, testDirs.SysfsRoot)
+			if err != nil {
+				t.Fatalf("could not snapshot devices: %v", err)
+			}
+
+			snapshotDirs, _, err := handleNode(testcase.deviceType, path.Join(t.TempDir(), "snapshot"), snapshot, false)
+			if err != nil {
+				t.Fatalf("could not fake devices from snapshot: %v\n%s", err, snapshot)
+			}
+			detected := testcase.discover(snapshotDirs.SysfsRoot)
+
+			if !reflect.DeepEqual(detected, expected) {
+				t.Errorf("devices faked from snapshot differ:\n%+v\nexpected:\n%+v\nsnapshot:\n%s", detected, expected, snapshot)
+			}
+		})
+	}
+
+	if _, err := snapshotTemplate("npu", t.TempDir()); err == nil {
+		t.Errorf("expected error for unsupported device type")
+	}
+}
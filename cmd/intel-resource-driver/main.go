@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	gaudiplugin "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/plugin"
+	gpuplugin "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/plugin"
+	qatplugin "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/plugin"
+)
+
+// intel-resource-driver runs the kubelet plugin of the accelerator given as
+// subcommand, so that one container image serves all DaemonSets.
+func main() {
+	command := &cobra.Command{
+		Use:   "intel-resource-driver",
+		Short: "Intel resource drivers kubelet plugins",
+	}
+
+	command.AddCommand(
+		gpuplugin.NewCommand("gpu"),
+		gaudiplugin.NewCommand("gaudi"),
+		qatplugin.NewCommand("qat"),
+	)
+
+	if err := command.Execute(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
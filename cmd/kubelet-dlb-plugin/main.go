@@ -0,0 +1,18 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"os"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/dlb/plugin"
+)
+
+func main() {
+	// Execute() already prints out the error.
+	if err := plugin.NewCommand("kubelet-plugin").Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,20 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"os"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/iaa/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/plugin"
+)
+
+func main() {
+	// Execute() already prints out the error.
+	if err := plugin.NewCommand("kubelet-plugin", device.IAA, cdiregistry.IAA).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -17,21 +17,16 @@
 package main
 
 import (
-	"reflect"
-	"testing"
+	"fmt"
+	"os"
 
-	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/plugin"
 )
 
-func TestDeviceInfoDeepCopy(t *testing.T) {
-	di := device.DeviceInfo{
-		UID:   "f",
-		Model: "ff",
-	}
-
-	dc := di.DeepCopy()
-
-	if !reflect.DeepEqual(&di, dc) {
-		t.Fatalf("device infos %v and %v do not match", di, dc)
+func main() {
+	command := plugin.NewCommand("kubelet-plugin")
+	if err := command.Execute(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 }
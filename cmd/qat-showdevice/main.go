@@ -17,6 +17,15 @@ func printPFDevice(pfdev *device.PFDevice) {
 	fmt.Printf("Num VFs:   %d\n", pfdev.NumVFs)
 	fmt.Printf("Max VFs:   %d\n", pfdev.TotalVFs)
 
+	capabilities := pfdev.Capabilities()
+	if pfdev.FirmwareVersion != "" {
+		fmt.Printf("Firmware:  %s\n", pfdev.FirmwareVersion)
+	}
+	if pfdev.NumRingPairs > 0 {
+		fmt.Printf("Rings:     %d (%d per VF)\n", pfdev.NumRingPairs, capabilities.RingPairs)
+		fmt.Printf("Per VF:    %d cy instances, %d dc instances\n", capabilities.CyInstances, capabilities.DcInstances)
+	}
+
 	for _, vfdev := range pfdev.AvailableDevices {
 		fmt.Printf("\tVF UID %s: device %s, device node %s, IOMMU %s, driver %s\n", vfdev.UID(), vfdev.PCIDevice(), vfdev.DeviceNode(), vfdev.Iommu(), vfdev.Driver())
 	}
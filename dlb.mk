@@ -0,0 +1,47 @@
+# Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+DLB_VERSION ?= v0.1.0
+DLB_IMAGE_NAME ?= intel-dlb-resource-driver
+DLB_IMAGE_VERSION ?= $(DLB_VERSION)
+DLB_IMAGE_TAG ?= $(REGISTRY)/$(DLB_IMAGE_NAME):$(DLB_IMAGE_VERSION)
+
+DLB_BINARIES = \
+bin/kubelet-dlb-plugin
+
+DLB_COMMON_SRC = \
+$(COMMON_SRC) \
+pkg/dlb/cdi/*.go \
+pkg/dlb/device/*.go \
+pkg/dlb/plugin/*.go
+
+DLB_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${DLB_VERSION}
+
+.PHONY: dlb
+dlb: $(DLB_BINARIES)
+
+bin/kubelet-dlb-plugin: cmd/kubelet-dlb-plugin/*.go $(DLB_COMMON_SRC)
+	CGO_ENABLED=0 GOOS=linux GOARCH=${ARCH} \
+	  go build -a -ldflags "${DLB_LDFLAGS}" -mod vendor -o $@ ./cmd/kubelet-dlb-plugin
+
+.PHONY: dlb-container-build
+dlb-container-build: cleanall vendor
+	@echo "Building DLB resource driver container..."
+	$(DOCKER) build --pull --platform="linux/$(ARCH)" -t $(DLB_IMAGE_TAG) \
+	--build-arg LOCAL_LICENSES=$(LOCAL_LICENSES) -f Dockerfile.dlb .
+
+.PHONY: dlb-container-push
+dlb-container-push: dlb-container-build
+	$(DOCKER) push $(DLB_IMAGE_TAG)
@@ -0,0 +1,47 @@
+# Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+DSA_VERSION ?= v0.1.0
+DSA_IMAGE_NAME ?= intel-dsa-resource-driver
+DSA_IMAGE_VERSION ?= $(DSA_VERSION)
+DSA_IMAGE_TAG ?= $(REGISTRY)/$(DSA_IMAGE_NAME):$(DSA_IMAGE_VERSION)
+
+DSA_BINARIES = \
+bin/kubelet-dsa-plugin
+
+DSA_COMMON_SRC = \
+$(COMMON_SRC) \
+pkg/idxd/cdi/*.go \
+pkg/idxd/device/*.go \
+pkg/idxd/plugin/*.go
+
+DSA_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${DSA_VERSION}
+
+.PHONY: dsa
+dsa: $(DSA_BINARIES)
+
+bin/kubelet-dsa-plugin: cmd/kubelet-dsa-plugin/*.go $(DSA_COMMON_SRC)
+	CGO_ENABLED=0 GOOS=linux GOARCH=${ARCH} \
+	  go build -a -ldflags "${DSA_LDFLAGS}" -mod vendor -o $@ ./cmd/kubelet-dsa-plugin
+
+.PHONY: dsa-container-build
+dsa-container-build: cleanall vendor
+	@echo "Building DSA resource driver container..."
+	$(DOCKER) build --pull --platform="linux/$(ARCH)" -t $(DSA_IMAGE_TAG) \
+	--build-arg LOCAL_LICENSES=$(LOCAL_LICENSES) -f Dockerfile.dsa .
+
+.PHONY: dsa-container-push
+dsa-container-push: dsa-container-build
+	$(DOCKER) push $(DSA_IMAGE_TAG)
@@ -25,7 +25,8 @@ GAUDI_COMMON_SRC = \
 $(COMMON_SRC) \
 pkg/gaudi/cdihelpers/*.go \
 pkg/gaudi/device/*.go \
-pkg/gaudi/discovery/*.go
+pkg/gaudi/discovery/*.go \
+pkg/gaudi/plugin/*.go
 
 GAUDI_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${GAUDI_VERSION}
 
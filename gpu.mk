@@ -25,7 +25,9 @@ GPU_COMMON_SRC = \
 $(COMMON_SRC) \
 pkg/gpu/cdihelpers/*.go \
 pkg/gpu/device/*.go \
-pkg/gpu/discovery/*.go
+pkg/gpu/device/*.json \
+pkg/gpu/discovery/*.go \
+pkg/gpu/plugin/*.go
 
 GPU_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${GPU_VERSION}
 
@@ -0,0 +1,48 @@
+# Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+IAA_VERSION ?= v0.1.0
+IAA_IMAGE_NAME ?= intel-iaa-resource-driver
+IAA_IMAGE_VERSION ?= $(IAA_VERSION)
+IAA_IMAGE_TAG ?= $(REGISTRY)/$(IAA_IMAGE_NAME):$(IAA_IMAGE_VERSION)
+
+IAA_BINARIES = \
+bin/kubelet-iaa-plugin
+
+IAA_COMMON_SRC = \
+$(COMMON_SRC) \
+pkg/iaa/device/*.go \
+pkg/idxd/cdi/*.go \
+pkg/idxd/device/*.go \
+pkg/idxd/plugin/*.go
+
+IAA_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${IAA_VERSION}
+
+.PHONY: iaa
+iaa: $(IAA_BINARIES)
+
+bin/kubelet-iaa-plugin: cmd/kubelet-iaa-plugin/*.go $(IAA_COMMON_SRC)
+	CGO_ENABLED=0 GOOS=linux GOARCH=${ARCH} \
+	  go build -a -ldflags "${IAA_LDFLAGS}" -mod vendor -o $@ ./cmd/kubelet-iaa-plugin
+
+.PHONY: iaa-container-build
+iaa-container-build: cleanall vendor
+	@echo "Building IAA resource driver container..."
+	$(DOCKER) build --pull --platform="linux/$(ARCH)" -t $(IAA_IMAGE_TAG) \
+	--build-arg LOCAL_LICENSES=$(LOCAL_LICENSES) -f Dockerfile.iaa .
+
+.PHONY: iaa-container-push
+iaa-container-push: iaa-container-build
+	$(DOCKER) push $(IAA_IMAGE_TAG)
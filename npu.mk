@@ -0,0 +1,48 @@
+# Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+NPU_VERSION ?= v0.1.0
+NPU_IMAGE_NAME ?= intel-npu-resource-driver
+NPU_IMAGE_VERSION ?= $(NPU_VERSION)
+NPU_IMAGE_TAG ?= $(REGISTRY)/$(NPU_IMAGE_NAME):$(NPU_IMAGE_VERSION)
+
+NPU_BINARIES = \
+bin/kubelet-npu-plugin
+
+NPU_COMMON_SRC = \
+$(COMMON_SRC) \
+pkg/npu/cdihelpers/*.go \
+pkg/npu/device/*.go \
+pkg/npu/discovery/*.go \
+pkg/npu/plugin/*.go
+
+NPU_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${NPU_VERSION}
+
+.PHONY: npu
+npu: $(NPU_BINARIES)
+
+bin/kubelet-npu-plugin: cmd/kubelet-npu-plugin/*.go $(NPU_COMMON_SRC)
+	CGO_ENABLED=0 GOOS=linux GOARCH=${ARCH} \
+	  go build -a -ldflags "${NPU_LDFLAGS}" -mod vendor -o $@ ./cmd/kubelet-npu-plugin
+
+.PHONY: npu-container-build
+npu-container-build: cleanall vendor
+	@echo "Building NPU resource driver container..."
+	$(DOCKER) build --pull --platform="linux/$(ARCH)" -t $(NPU_IMAGE_TAG) \
+	--build-arg LOCAL_LICENSES=$(LOCAL_LICENSES) -f Dockerfile.npu .
+
+.PHONY: npu-container-push
+npu-container-push: npu-container-build
+	$(DOCKER) push $(NPU_IMAGE_TAG)
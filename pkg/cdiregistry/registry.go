@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cdiregistry names the CDI vendor, classes and specs of the device
+// families supported by the resource drivers, so that the kubelet plugins,
+// the CDI specs generator and the device faker agree on them.
+package cdiregistry
+
+import (
+	"fmt"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
+)
+
+// Vendor is the CDI vendor, and the DRA driver name domain, of all device families.
+const Vendor = "intel.com"
+
+// CDI classes of the device families.
+const (
+	GPUClass   = "gpu"
+	GaudiClass = "gaudi"
+	NPUClass   = "npu"
+	QATClass   = "qat"
+	DSAClass   = "dsa"
+	IAAClass   = "iaa"
+	DLBClass   = "dlb"
+)
+
+// Family is a device family with its own CDI kind and DRA driver.
+type Family struct {
+	Class string
+}
+
+var (
+	GPU   = Family{Class: GPUClass}
+	Gaudi = Family{Class: GaudiClass}
+	NPU   = Family{Class: NPUClass}
+	QAT   = Family{Class: QATClass}
+	DSA   = Family{Class: DSAClass}
+	IAA   = Family{Class: IAAClass}
+	DLB   = Family{Class: DLBClass}
+)
+
+// Families lists all supported device families.
+var Families = []Family{GPU, Gaudi, NPU, QAT, DSA, IAA, DLB}
+
+// Lookup returns the family by its CDI class, CDI kind or DRA driver name.
+func Lookup(name string) (Family, error) {
+	for _, family := range Families {
+		if name == family.Class || name == family.Kind() || name == family.DriverName() {
+			return family, nil
+		}
+	}
+
+	return Family{}, fmt.Errorf("unknown device family %v", name)
+}
+
+// Kind returns the CDI kind, e.g. intel.com/gpu.
+func (f Family) Kind() string {
+	return Vendor + "/" + f.Class
+}
+
+// DriverName returns the DRA driver name, e.g. gpu.intel.com.
+func (f Family) DriverName() string {
+	return f.Class + "." + Vendor
+}
+
+// SpecName returns the name of the CDI spec file, without extension, that the
+// kubelet plugin writes devices to, e.g. intel.com-gpu.
+func (f Family) SpecName() string {
+	return cdiapi.GenerateSpecName(Vendor, f.Class)
+}
+
+// QualifiedName returns the fully qualified CDI device name, e.g. intel.com/gpu=card0.
+func (f Family) QualifiedName(device string) string {
+	return cdiparser.QualifiedName(Vendor, f.Class, device)
+}
+
+// Specs returns the specs of the family's CDI kind in the CDI cache.
+func (f Family) Specs(cache *cdiapi.Cache) []*cdiapi.Spec {
+	specs := []*cdiapi.Spec{}
+	for _, spec := range cache.GetVendorSpecs(Vendor) {
+		if spec.Kind == f.Kind() {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// HasDevices returns true when the specs of the family's CDI kind in the CDI
+// cache have devices, i.e. the kubelet plugin has run on the node before.
+func (f Family) HasDevices(cache *cdiapi.Cache) bool {
+	for _, spec := range f.Specs(cache) {
+		if len(spec.Devices) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdiregistry
+
+import (
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	specs "tags.cncf.io/container-device-interface/specs-go"
+)
+
+func TestFamilyNames(t *testing.T) {
+	if GPU.Kind() != "intel.com/gpu" || GPU.DriverName() != "gpu.intel.com" || GPU.SpecName() != "intel.com-gpu" {
+		t.Errorf("unexpected GPU names: kind %v, driver %v, spec %v", GPU.Kind(), GPU.DriverName(), GPU.SpecName())
+	}
+
+	if name := QAT.QualifiedName("qatvf-0000-6b-00-1"); name != "intel.com/qat=qatvf-0000-6b-00-1" {
+		t.Errorf("unexpected qualified name %v", name)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"gaudi", "intel.com/gaudi", "gaudi.intel.com"} {
+		family, err := Lookup(name)
+		if err != nil || family != Gaudi {
+			t.Errorf("%v: unexpected family %v, error: %v", name, family, err)
+		}
+	}
+
+	if _, err := Lookup("fpga"); err == nil {
+		t.Errorf("expected error for unknown family")
+	}
+}
+
+func TestHasDevices(t *testing.T) {
+	cache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(t.TempDir()), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	if GPU.HasDevices(cache) {
+		t.Errorf("expected no GPU devices in empty CDI cache")
+	}
+
+	spec := &specs.Spec{
+		Version: specs.CurrentVersion,
+		Kind:    GPU.Kind(),
+		Devices: []specs.Device{
+			{Name: "0000-00-02-0-0x56c0", ContainerEdits: specs.ContainerEdits{Env: []string{"GPU=0"}}},
+		},
+	}
+	if err := cache.WriteSpec(spec, GPU.SpecName()); err != nil {
+		t.Fatalf("could not write CDI spec: %v", err)
+	}
+	if err := cache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI registry: %v", err)
+	}
+
+	if !GPU.HasDevices(cache) {
+		t.Errorf("expected GPU devices in CDI cache")
+	}
+	if Gaudi.HasDevices(cache) {
+		t.Errorf("expected no Gaudi devices in CDI cache")
+	}
+}
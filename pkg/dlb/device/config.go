@@ -0,0 +1,49 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConfigAPIVersion = "dlb.intel.com/v1alpha1"
+	ConfigKind       = "VFConfig"
+)
+
+// VFConfig is the opaque device configuration accepted in ResourceClaims
+// and DeviceClasses, it selects the resources assigned to the allocated VF.
+type VFConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	Resources       `json:",inline"`
+}
+
+// DecodeVFConfig parses and validates opaque device configuration parameters.
+func DecodeVFConfig(parameters []byte) (*VFConfig, error) {
+	config := &VFConfig{}
+
+	decoder := json.NewDecoder(bytes.NewReader(parameters))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("could not parse device configuration: %v", err)
+	}
+
+	if config.APIVersion != ConfigAPIVersion || config.Kind != ConfigKind {
+		return nil, fmt.Errorf("unsupported device configuration '%s/%s', expected '%s/%s'",
+			config.APIVersion, config.Kind, ConfigAPIVersion, ConfigKind)
+	}
+
+	for _, f := range config.Resources.files() {
+		if *f.value < 0 {
+			return nil, fmt.Errorf("negative %s in device configuration", f.name)
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,447 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+const (
+	SysfsEnvVarName  = "SYSFS_ROOT"
+	sysfsDefaultRoot = "/sys"
+
+	devicePath       = "bus/pci/devices"
+	driverPath       = "bus/pci/drivers"
+	moduleName       = "dlb2"
+	vfioPCI          = "vfio-pci"
+	pciDevicePattern = "????:??:??.?"
+	numVFs           = "sriov_numvfs"
+	totalVFs         = "sriov_totalvfs"
+	vfDeviceNode     = "/dev/vfio"
+
+	// dlb2 driver exposes the resources of the PF in total_resources, and
+	// the resources assigned to every VF in vfN_resources of the PF device.
+	pfTotalResources   = "total_resources"
+	vfResourcesPattern = "vf%d_resources"
+	numSchedDomains    = "num_sched_domains"
+	numLdbQueues       = "num_ldb_queues"
+	numLdbPorts        = "num_ldb_ports"
+	numDirPorts        = "num_dir_ports"
+)
+
+var vfRegexp = regexp.MustCompile(`^virtfn([0-9]+)$`)
+
+// GetSysfsRoot returns the sysfs mount point from SYSFS_ROOT env var, or /sys.
+func GetSysfsRoot() string {
+	if sysfsRoot := os.Getenv(SysfsEnvVarName); sysfsRoot != "" {
+		return sysfsRoot
+	}
+	return sysfsDefaultRoot
+}
+
+// Resources are the scheduling domains, queues and ports of a DLB PF or VF.
+type Resources struct {
+	SchedDomains int `json:"numSchedDomains,omitempty"`
+	LdbQueues    int `json:"numLdbQueues,omitempty"`
+	LdbPorts     int `json:"numLdbPorts,omitempty"`
+	DirPorts     int `json:"numDirPorts,omitempty"`
+}
+
+type resourceFile struct {
+	name  string
+	value *int
+}
+
+func (r *Resources) files() []resourceFile {
+	return []resourceFile{
+		{numSchedDomains, &r.SchedDomains},
+		{numLdbQueues, &r.LdbQueues},
+		{numLdbPorts, &r.LdbPorts},
+		{numDirPorts, &r.DirPorts},
+	}
+}
+
+type DLBDevices []*PFDevice
+
+// VF devices mapped by UID.
+type VFDevices map[string]*VFDevice
+
+type PFDevice struct {
+	sysfsRoot string
+	Device    string // PCI address
+	NumVFs    int
+	TotalVFs  int
+	Total     Resources // resources of the PF shared by its VFs
+	VFs       VFDevices
+}
+
+type VFDevice struct {
+	pfdevice    *PFDevice
+	VFDevice    string // PCI address
+	VFIndex     int
+	VFDriver    string
+	VFIommu     string
+	Defaults    Resources // resources assigned to the VF at discovery
+	AllocatedBy string    // claim UID
+}
+
+// New discovers PF devices bound to the dlb2 driver and their VFs.
+func New(sysfsRoot string) (DLBDevices, error) {
+	dlbdevices := make(DLBDevices, 0)
+
+	pattern := filepath.Join(sysfsRoot, driverPath, moduleName, pciDevicePattern)
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("no PCI PF devices found")
+	}
+
+	for _, p := range paths {
+		symlinktarget, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			klog.Warningf("Expected '%s' to be a symlink: %v", p, err)
+			continue
+		}
+
+		pf := &PFDevice{
+			sysfsRoot: sysfsRoot,
+			Device:    filepath.Base(symlinktarget),
+			VFs:       make(VFDevices),
+		}
+
+		if err := pf.syncConfig(); err != nil {
+			klog.Warningf("Could not sync config for '%s': %v", pf.Device, err)
+			continue
+		}
+
+		dlbdevices = append(dlbdevices, pf)
+	}
+
+	return dlbdevices, nil
+}
+
+func (p *PFDevice) devicePath() string {
+	return filepath.Join(p.sysfsRoot, devicePath, p.Device)
+}
+
+func (p *PFDevice) read(file string) (string, error) {
+	val, err := os.ReadFile(filepath.Join(p.devicePath(), file))
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %v", file, err)
+	}
+
+	return strings.TrimSpace(string(val)), nil
+}
+
+func (p *PFDevice) readInt(file string) (int, error) {
+	str, err := p.read(file)
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read value from %s: %v", file, err)
+	}
+
+	return val, nil
+}
+
+func (p *PFDevice) write(file string, value string) error {
+	return os.WriteFile(filepath.Join(p.devicePath(), file), []byte(value), 0600)
+}
+
+func (p *PFDevice) readResources(dir string) (Resources, error) {
+	resources := Resources{}
+
+	for _, f := range resources.files() {
+		val, err := p.readInt(filepath.Join(dir, f.name))
+		if err != nil {
+			return Resources{}, err
+		}
+		*f.value = val
+	}
+
+	return resources, nil
+}
+
+func (p *PFDevice) syncConfig() error {
+	var err error
+
+	if p.NumVFs, err = p.readInt(numVFs); err != nil {
+		return err
+	}
+	if p.TotalVFs, err = p.readInt(totalVFs); err != nil {
+		return err
+	}
+	if p.Total, err = p.readResources(pfTotalResources); err != nil {
+		return err
+	}
+
+	return p.getVFs()
+}
+
+func (p *PFDevice) getVFs() error {
+	entries, err := os.ReadDir(p.devicePath())
+	if err != nil {
+		return fmt.Errorf("could not read %v: %v", p.devicePath(), err)
+	}
+
+	for _, entry := range entries {
+		match := vfRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		vfpath, err := filepath.EvalSymlinks(filepath.Join(p.devicePath(), entry.Name()))
+		if err != nil {
+			klog.Warningf("Expected symlink for '%s': %v", entry.Name(), err)
+			continue
+		}
+
+		vfdevice := filepath.Base(vfpath)
+		if _, exists := p.VFs[deviceuid(vfdevice)]; exists {
+			continue
+		}
+
+		index, _ := strconv.Atoi(match[1])
+		vf := &VFDevice{
+			pfdevice: p,
+			VFDevice: vfdevice,
+			VFIndex:  index,
+		}
+
+		if vf.Defaults, err = p.readResources(vf.resourcesDir()); err != nil {
+			klog.Warningf("Could not read resources of VF '%s': %v", vfdevice, err)
+			continue
+		}
+
+		vf.update()
+		p.VFs[vf.UID()] = vf
+	}
+
+	return nil
+}
+
+// EnableVFs creates all VFs of the PF device, and binds them to vfio-pci.
+func (p *PFDevice) EnableVFs() error {
+	if p.NumVFs != p.TotalVFs {
+		if p.NumVFs != 0 {
+			// sriov_numvfs can only be changed from zero
+			if err := p.write(numVFs, "0"); err != nil {
+				return err
+			}
+		}
+		if err := p.write(numVFs, strconv.Itoa(p.TotalVFs)); err != nil {
+			return err
+		}
+		p.NumVFs = p.TotalVFs
+	}
+
+	if err := p.getVFs(); err != nil {
+		return err
+	}
+
+	for _, vf := range p.VFs {
+		if vf.VFDriver == vfioPCI {
+			continue
+		}
+		if err := vf.enableVFIO(); err != nil {
+			klog.Errorf("Enabling VF '%s': %v", vf.UID(), err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetControlNode() *VFDevice {
+	return &VFDevice{
+		VFDevice: "vfio",
+		VFDriver: vfioPCI,
+		VFIommu:  "vfio",
+	}
+}
+
+func GetCDIDevices(dlbdevices DLBDevices) VFDevices {
+	vfdevices := GetResourceDevices(dlbdevices)
+
+	ctrl := GetControlNode()
+	vfdevices[ctrl.UID()] = ctrl
+
+	return vfdevices
+}
+
+func GetResourceDevices(dlbdevices DLBDevices) VFDevices {
+	vfdevices := make(VFDevices, 0)
+
+	for _, pf := range dlbdevices {
+		for uid, vf := range pf.VFs {
+			vfdevices[uid] = vf
+		}
+	}
+
+	return vfdevices
+}
+
+func (q DLBDevices) find(deviceUID string) *VFDevice {
+	for _, pf := range q {
+		if vf, exists := pf.VFs[deviceUID]; exists {
+			return vf
+		}
+	}
+	return nil
+}
+
+// Allocate records VF device as allocated by the claim and assigns the
+// requested resources to it. Nil resources keep the VF resources as they
+// were at discovery.
+func (q DLBDevices) Allocate(deviceUID string, allocatedBy string, resources *Resources) (*VFDevice, error) {
+	if allocatedBy == "" {
+		return nil, fmt.Errorf("no allocator ID given")
+	}
+
+	vf := q.find(deviceUID)
+	if vf == nil {
+		return nil, fmt.Errorf("no such device '%s' available", deviceUID)
+	}
+
+	if vf.AllocatedBy == allocatedBy {
+		// duplicated request, already allocated
+		return vf, nil
+	}
+	if vf.AllocatedBy != "" {
+		return nil, fmt.Errorf("device '%s' is already allocated", deviceUID)
+	}
+
+	if resources != nil {
+		// resources not given in the request keep their default value
+		requested := vf.Defaults
+		given := resources.files()
+		for i, f := range requested.files() {
+			if *given[i].value != 0 {
+				*f.value = *given[i].value
+			}
+		}
+
+		if err := vf.setResources(requested); err != nil {
+			return nil, fmt.Errorf("could not assign resources to device '%s': %v", deviceUID, err)
+		}
+	}
+
+	vf.AllocatedBy = allocatedBy
+
+	return vf, nil
+}
+
+// Free releases all VF devices allocated by the claim, restoring their
+// resources. Returns the number of released VF devices.
+func (q DLBDevices) Free(allocatedBy string) int {
+	freed := 0
+
+	for _, pf := range q {
+		for _, vf := range pf.VFs {
+			if vf.AllocatedBy != allocatedBy {
+				continue
+			}
+
+			if err := vf.setResources(vf.Defaults); err != nil {
+				klog.Warningf("Could not restore resources of device '%s': %v", vf.UID(), err)
+			}
+			vf.AllocatedBy = ""
+			freed++
+		}
+	}
+
+	return freed
+}
+
+func (v *VFDevice) resourcesDir() string {
+	return fmt.Sprintf(vfResourcesPattern, v.VFIndex)
+}
+
+// setResources writes VF resources, which the dlb2 driver accepts only while
+// the VF is not bound to a driver.
+func (v *VFDevice) setResources(resources Resources) error {
+	if resources == v.current() {
+		return nil
+	}
+
+	if err := v.sysfs().Unbind(v.VFDevice, vfioPCI); err != nil {
+		return err
+	}
+
+	for _, f := range resources.files() {
+		if err := v.pfdevice.write(filepath.Join(v.resourcesDir(), f.name), strconv.Itoa(*f.value)); err != nil {
+			return fmt.Errorf("cannot write %s: %v", f.name, err)
+		}
+	}
+
+	return v.sysfs().Bind(v.VFDevice, vfioPCI)
+}
+
+func (v *VFDevice) current() Resources {
+	resources, err := v.pfdevice.readResources(v.resourcesDir())
+	if err != nil {
+		return Resources{}
+	}
+	return resources
+}
+
+func (v *VFDevice) sysfs() *pci.Sysfs {
+	return pci.NewSysfs(v.pfdevice.sysfsRoot)
+}
+
+func (v *VFDevice) update() {
+	if driver, err := v.sysfs().Driver(v.VFDevice); err == nil {
+		v.VFDriver = driver
+	}
+
+	if iommu, err := v.sysfs().IOMMUGroup(v.VFDevice); err == nil {
+		v.VFIommu = iommu
+	}
+}
+
+func (v *VFDevice) enableVFIO() error {
+	if err := v.sysfs().OverrideDriver(v.VFDevice, vfioPCI); err != nil {
+		return err
+	}
+
+	v.update()
+
+	return nil
+}
+
+func (v *VFDevice) DeviceNode() string {
+	return vfDeviceNode + "/" + v.VFIommu
+}
+
+func (v *VFDevice) PCIDevice() string {
+	return v.VFDevice
+}
+
+func (v *VFDevice) PFDevice() string {
+	return v.pfdevice.Device
+}
+
+func (v *VFDevice) PFResources() Resources {
+	return v.pfdevice.Total
+}
+
+func deviceuid(device string) string {
+	return "dlbvf-" + pci.RFC1123Address(device)
+}
+
+func (v *VFDevice) UID() string {
+	return deviceuid(v.VFDevice)
+}
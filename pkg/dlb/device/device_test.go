@@ -0,0 +1,178 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func newFakeDLBDevices(t *testing.T) DLBDevices {
+	sysfsRoot := filepath.Join(t.TempDir(), "sysfs")
+
+	if err := fakesysfs.FakeSysFsDLBContents(sysfsRoot, fakesysfs.DLBDevices{
+		{Device: "0000:6d:00.0", TotalVFs: 16, NumVFs: 2,
+			Total: fakesysfs.DLBResources{SchedDomains: 32, LdbQueues: 32, LdbPorts: 64, DirPorts: 64},
+			VFResources: []fakesysfs.DLBResources{
+				{SchedDomains: 1, LdbQueues: 2, LdbPorts: 4, DirPorts: 4},
+				{SchedDomains: 1, LdbQueues: 2, LdbPorts: 4, DirPorts: 4},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	dlbdevices, err := New(sysfsRoot)
+	if err != nil {
+		t.Fatalf("could not discover DLB devices: %v", err)
+	}
+
+	return dlbdevices
+}
+
+func TestNew(t *testing.T) {
+	dlbdevices := newFakeDLBDevices(t)
+
+	if len(dlbdevices) != 1 {
+		t.Fatalf("expected one PF device, got %d", len(dlbdevices))
+	}
+
+	pf := dlbdevices[0]
+	if pf.Device != "0000:6d:00.0" || pf.NumVFs != 2 || pf.TotalVFs != 16 || pf.Total.LdbQueues != 32 {
+		t.Errorf("unexpected PF device %+v", pf)
+	}
+
+	vf, exists := pf.VFs["dlbvf-0000-6d-00-2"]
+	if !exists {
+		t.Fatalf("expected VF device dlbvf-0000-6d-00-2, got %v", pf.VFs)
+	}
+
+	if vf.VFIndex != 1 || vf.VFDriver != "vfio-pci" || vf.DeviceNode() != "/dev/vfio/402" {
+		t.Errorf("unexpected VF device %+v", vf)
+	}
+
+	if vf.Defaults != (Resources{SchedDomains: 1, LdbQueues: 2, LdbPorts: 4, DirPorts: 4}) {
+		t.Errorf("unexpected VF resources %+v", vf.Defaults)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	dlbdevices := newFakeDLBDevices(t)
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-1", "uid1", &Resources{LdbQueues: 8}); err != nil {
+		t.Fatalf("could not allocate VF device: %v", err)
+	}
+
+	vf := dlbdevices.find("dlbvf-0000-6d-00-1")
+	if vf.current() != (Resources{SchedDomains: 1, LdbQueues: 8, LdbPorts: 4, DirPorts: 4}) {
+		t.Errorf("unexpected resources of allocated VF device %+v", vf.current())
+	}
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-1", "uid1", &Resources{LdbQueues: 8}); err != nil {
+		t.Errorf("duplicated allocation failed: %v", err)
+	}
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-1", "uid2", nil); err == nil {
+		t.Errorf("VF device allocated by two claims")
+	}
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-9", "uid2", nil); err == nil {
+		t.Errorf("nonexistent VF device allocated")
+	}
+
+	if freed := dlbdevices.Free("uid1"); freed != 1 {
+		t.Errorf("expected 1 VF device freed, got %d", freed)
+	}
+
+	if vf.current() != vf.Defaults {
+		t.Errorf("VF device resources not restored: %+v", vf.current())
+	}
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-1", "uid2", nil); err != nil {
+		t.Errorf("freed VF device could not be allocated: %v", err)
+	}
+}
+
+func TestDecodeVFConfig(t *testing.T) {
+	type testCase struct {
+		name       string
+		parameters string
+		expected   Resources
+		pass       bool
+	}
+
+	testcases := []testCase{
+		{"queues and ports", `{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "VFConfig", "numLdbQueues": 4, "numLdbPorts": 8}`,
+			Resources{LdbQueues: 4, LdbPorts: 8}, true},
+		{"wrong kind", `{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "Config", "numLdbQueues": 4}`, Resources{}, false},
+		{"unknown field", `{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "VFConfig", "numQueues": 4}`, Resources{}, false},
+		{"negative value", `{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "VFConfig", "numDirPorts": -1}`, Resources{}, false},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		config, err := DecodeVFConfig([]byte(testcase.parameters))
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+			continue
+		}
+		if err == nil && config.Resources != testcase.expected {
+			t.Errorf("%v: unexpected resources %+v", testcase.name, config.Resources)
+		}
+	}
+}
+
+func TestReadStateOrCreateEmpty(t *testing.T) {
+	dlbdevices := newFakeDLBDevices(t)
+	statefile := filepath.Join(t.TempDir(), "state")
+
+	// a missing state file on a fresh install is not lost
+	if lost, err := dlbdevices.ReadStateOrCreateEmpty(statefile, false); err != nil || lost {
+		t.Fatalf("expected missing state file on fresh install not to be lost, got lost %v, error: %v", lost, err)
+	}
+	if _, err := os.Stat(statefile); err != nil {
+		t.Errorf("empty state file was not created: %v", err)
+	}
+
+	// a missing state file with devices in use is lost, as it was deleted
+	if err := os.Remove(statefile); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if lost, err := dlbdevices.ReadStateOrCreateEmpty(statefile, true); err != nil || !lost {
+		t.Fatalf("expected missing state file to be lost, got lost %v, error: %v", lost, err)
+	}
+
+	if _, err := dlbdevices.Allocate("dlbvf-0000-6d-00-1", "uid1", nil); err != nil {
+		t.Fatalf("could not allocate VF device: %v", err)
+	}
+	if err := dlbdevices.SaveState(statefile); err != nil {
+		t.Fatalf("could not save state: %v", err)
+	}
+
+	restored := newFakeDLBDevices(t)
+	if lost, err := restored.ReadStateOrCreateEmpty(statefile, true); err != nil || lost {
+		t.Fatalf("expected state to be read, got lost %v, error: %v", lost, err)
+	}
+	if freed := restored.Free("uid1"); freed != 1 {
+		t.Errorf("expected restored VF device allocation, freed %d", freed)
+	}
+
+	if err := os.WriteFile(statefile, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if lost, err := newFakeDLBDevices(t).ReadStateOrCreateEmpty(statefile, true); err != nil || !lost {
+		t.Errorf("expected corrupted state file to be lost, got lost %v, error: %v", lost, err)
+	}
+	if _, err := os.Stat(statefile + ".corrupted"); err != nil {
+		t.Errorf("corrupted state file was not kept: %v", err)
+	}
+	if lost, err := newFakeDLBDevices(t).ReadStateOrCreateEmpty(statefile, true); err != nil || lost {
+		t.Errorf("expected new empty state file, got lost %v, error: %v", lost, err)
+	}
+}
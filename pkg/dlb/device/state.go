@@ -0,0 +1,107 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// Map allocation id to VF device.
+type savedAllocations map[string][]string
+
+// ReadStateOrCreateEmpty restores allocations from the state file, or creates
+// an empty state file. The returned lost is true when the state file was
+// corrupted, or was missing while devices were inUse, and allocations of
+// prepared claims need to be recovered. A missing state file on a fresh
+// install is not lost.
+func (q DLBDevices) ReadStateOrCreateEmpty(statefile string, inUse bool) (lost bool, err error) {
+	if statefile == "" {
+		return false, nil
+	}
+
+	if _, err := os.Stat(statefile); os.IsNotExist(err) {
+		klog.Infof("State file '%s' not found, creating empty state file", statefile)
+		return inUse, createEmptyState(statefile)
+	}
+
+	return q.readState(statefile)
+}
+
+func createEmptyState(statefile string) error {
+	f, err := os.OpenFile(statefile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create state file '%s': %v", statefile, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("{}"); err != nil {
+		return fmt.Errorf("failed to write to state file '%s': %v", statefile, err)
+	}
+
+	return nil
+}
+
+func (q DLBDevices) readState(statefile string) (bool, error) {
+	if statefile == "" {
+		return false, nil
+	}
+
+	savedstatebytes, err := os.ReadFile(statefile)
+	if err != nil {
+		return false, fmt.Errorf("could not read state file '%s': %v", statefile, err)
+	}
+
+	saveddevices := make(savedAllocations, 0)
+	if err := json.Unmarshal(savedstatebytes, &saveddevices); err != nil {
+		klog.Errorf("State file '%s' is corrupted: %v", statefile, err)
+		if err := helpers.KeepCorruptedFile(statefile); err != nil {
+			return false, err
+		}
+		return true, createEmptyState(statefile)
+	}
+
+	for allocatedby, vfdevices := range saveddevices {
+		for _, vf := range vfdevices {
+			// resources were assigned to the VF before the restart
+			if _, err := q.Allocate(vf, allocatedby, nil); err != nil {
+				klog.Errorf("Failed to restore VF device '%s' for '%s': %v", vf, allocatedby, err)
+				continue
+			}
+
+			klog.V(5).Infof("Successfully restored VF device '%s' for '%s'", vf, allocatedby)
+		}
+	}
+
+	return false, nil
+}
+
+func (q DLBDevices) SaveState(statefile string) error {
+	if statefile == "" {
+		return nil
+	}
+
+	saveddevices := make(savedAllocations, 0)
+
+	for _, pf := range q {
+		for uid, vf := range pf.VFs {
+			if vf.AllocatedBy != "" {
+				saveddevices[vf.AllocatedBy] = append(saveddevices[vf.AllocatedBy], uid)
+			}
+		}
+	}
+
+	encodedstate, err := json.MarshalIndent(saveddevices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed save state JSON encoding to file '%s': %v", statefile, err)
+	}
+
+	return os.WriteFile(statefile, encodedstate, 0600)
+}
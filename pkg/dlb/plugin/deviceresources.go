@@ -0,0 +1,48 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/dlb/device"
+)
+
+func deviceResources(vfdevices device.VFDevices) *[]resourceapi.Device {
+	resourcedevices := []resourceapi.Device{}
+
+	for _, vf := range vfdevices {
+		pfresources := vf.PFResources()
+		device := resourceapi.Device{
+			Name: vf.UID(),
+			Basic: &resourceapi.BasicDevice{
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"pfDevice": {
+						StringValue: ptr.To(vf.PFDevice()),
+					},
+					"maxSchedDomains": {
+						IntValue: ptr.To(int64(pfresources.SchedDomains)),
+					},
+					"maxLdbQueues": {
+						IntValue: ptr.To(int64(pfresources.LdbQueues)),
+					},
+					"maxLdbPorts": {
+						IntValue: ptr.To(int64(pfresources.LdbPorts)),
+					},
+					"maxDirPorts": {
+						IntValue: ptr.To(int64(pfresources.DirPorts)),
+					},
+				},
+			},
+		}
+		resourcedevices = append(resourcedevices, device)
+
+		klog.V(5).Infof("Adding Device resource: name '%s', PF device '%s'", device.Name, vf.PFDevice())
+	}
+
+	return &resourcedevices
+}
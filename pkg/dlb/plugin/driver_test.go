@@ -0,0 +1,229 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/dlb/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+const (
+	testNodeName  = "test-node-01"
+	testNameSpace = "test-namespace-01"
+)
+
+// newFakeSysfs creates fake sysfs with one DLB PF device and its two VFs in
+// testRoot and returns its path.
+func newFakeSysfs(t *testing.T, testRoot string) string {
+	sysfsRoot := filepath.Join(testRoot, "sysfs")
+
+	if err := fakesysfs.FakeSysFsDLBContents(sysfsRoot, fakesysfs.DLBDevices{
+		{Device: "0000:6d:00.0", TotalVFs: 16, NumVFs: 2,
+			Total: fakesysfs.DLBResources{SchedDomains: 32, LdbQueues: 32, LdbPorts: 64, DirPorts: 64},
+			VFResources: []fakesysfs.DLBResources{
+				{SchedDomains: 1, LdbQueues: 2, LdbPorts: 4, DirPorts: 4},
+				{SchedDomains: 1, LdbQueues: 2, LdbPorts: 4, DirPorts: 4},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	return sysfsRoot
+}
+
+func newFakeDriver(t *testing.T) *driver {
+	testRoot := t.TempDir()
+	sysfsRoot := newFakeSysfs(t, testRoot)
+
+	dlbdevices, err := device.New(sysfsRoot)
+	if err != nil {
+		t.Fatalf("could not discover DLB devices: %v", err)
+	}
+
+	return &driver{
+		kubeclient: kubefake.NewSimpleClientset(),
+		nodename:   testNodeName,
+		devices:    dlbdevices,
+		statefile:  filepath.Join(testRoot, "state"),
+		recorder:   &record.FakeRecorder{},
+	}
+}
+
+func withConfig(claim *resourcev1.ResourceClaim, parameters string) *resourcev1.ResourceClaim {
+	claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+		{
+			Source:   resourcev1.AllocationConfigSourceClaim,
+			Requests: []string{"request1"},
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver:     driverName,
+					Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+				},
+			},
+		},
+	}
+	return claim
+}
+
+func TestDriver(t *testing.T) {
+	type testCase struct {
+		name             string
+		claims           []*resourcev1.ResourceClaim
+		prepare          *drav1.NodePrepareResourcesRequest
+		unprepare        *drav1.NodeUnprepareResourcesRequest
+		expectedResponse *drav1.NodePrepareResourcesResponse
+	}
+
+	driver := newFakeDriver(t)
+
+	testcases := []testCase{
+		{
+			name: "DLB allocate VF with queues and ports",
+			claims: []*resourcev1.ResourceClaim{
+				withConfig(helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"dlbvf-0000-6d-00-1"}),
+					`{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "VFConfig", "numLdbQueues": 4, "numLdbPorts": 8}`),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dlbvf-0000-6d-00-1", CDIDeviceIDs: []string{"intel.com/dlb=dlbvf-0000-6d-00-1", "intel.com/dlb=dlbvf-vfio"}}}},
+				},
+			},
+		},
+		{
+			name: "DLB VF already allocated",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim2", "uid2", "request1", driverName, testNodeName, []string{"dlbvf-0000-6d-00-1"}),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid2", Name: "claim2", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Error: "device 'dlbvf-0000-6d-00-1' is already allocated"},
+				},
+			},
+		},
+		{
+			name: "DLB invalid configuration",
+			claims: []*resourcev1.ResourceClaim{
+				withConfig(helpers.NewClaim(testNameSpace, "claim3", "uid3", "request1", driverName, testNodeName, []string{"dlbvf-0000-6d-00-2"}),
+					`{"apiVersion": "dlb.intel.com/v1alpha1", "kind": "QueueConfig"}`),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid3", Name: "claim3", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid3": {Error: "unsupported device configuration 'dlb.intel.com/v1alpha1/QueueConfig', expected 'dlb.intel.com/v1alpha1/VFConfig'"},
+				},
+			},
+		},
+		{
+			name: "DLB VF after unprepare",
+			unprepare: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid2", Name: "claim2", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dlbvf-0000-6d-00-1", CDIDeviceIDs: []string{"intel.com/dlb=dlbvf-0000-6d-00-1", "intel.com/dlb=dlbvf-vfio"}}}},
+				},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		for _, testClaim := range testcase.claims {
+			createdClaim, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testClaim.Namespace).Create(context.TODO(), testClaim, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("could not create test claim: %v", err)
+				continue
+			}
+			t.Logf("created test claim: %+v", createdClaim)
+		}
+
+		if testcase.unprepare != nil {
+			if _, err := driver.NodeUnprepareResources(context.TODO(), testcase.unprepare); err != nil {
+				t.Errorf("%v: error %v, expected no error", testcase.name, err)
+				continue
+			}
+		}
+
+		response, err := driver.NodePrepareResources(context.TODO(), testcase.prepare)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(testcase.expectedResponse, response) {
+			responseJSON, _ := json.MarshalIndent(response, "", "\t")
+			expectedResponseJSON, _ := json.MarshalIndent(testcase.expectedResponse, "", "\t")
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
+		}
+	}
+}
+
+func TestRecoverLostState(t *testing.T) {
+	testRoot := t.TempDir()
+	t.Setenv(device.SysfsEnvVarName, newFakeSysfs(t, testRoot))
+
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"dlbvf-0000-6d-00-1"})
+	claim.Status.ReservedFor = []resourcev1.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod1", UID: "pod-uid1"}}
+
+	statefile := filepath.Join(testRoot, "state")
+	config := &configType{
+		clientset: kubefake.NewSimpleClientset(claim),
+		nodeName:  testNodeName,
+		cdiRoot:   t.TempDir(),
+		stateFile: statefile,
+	}
+
+	// no state file while VFs are enabled, as if it was deleted
+	driver, err := newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not create driver: %v", err)
+	}
+	if freed := driver.devices.Free("uid1"); freed != 1 {
+		t.Errorf("expected claim to be recovered after state file was deleted, freed %d", freed)
+	}
+
+	// corrupted state file, as if it was lost
+	if err := os.WriteFile(statefile, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: could not corrupt state file: %v", err)
+	}
+	if _, err = newDriver(context.TODO(), config); err != nil {
+		t.Fatalf("could not restart driver: %v", err)
+	}
+	state, err := os.ReadFile(statefile)
+	if err != nil || !strings.Contains(string(state), "dlbvf-0000-6d-00-1") {
+		t.Errorf("expected recovered VF device in state file, got %s, %v", state, err)
+	}
+}
@@ -0,0 +1,131 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fakesysfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+)
+
+const dlbModuleName = "dlb2"
+
+type DLBDevices []*DLBDevice
+
+type DLBDevice struct {
+	Device      string // PF PCI address
+	TotalVFs    int
+	NumVFs      int
+	Total       DLBResources   // total_resources of the PF
+	VFResources []DLBResources // vfN_resources, for the first NumVFs VFs
+}
+
+type DLBResources struct {
+	SchedDomains int
+	LdbQueues    int
+	LdbPorts     int
+	DirPorts     int
+}
+
+func (r DLBResources) files(dir string) []pcidevicefiles {
+	return []pcidevicefiles{
+		{path.Join(dir, "num_sched_domains"), strconv.Itoa(r.SchedDomains)},
+		{path.Join(dir, "num_ldb_queues"), strconv.Itoa(r.LdbQueues)},
+		{path.Join(dir, "num_ldb_ports"), strconv.Itoa(r.LdbPorts)},
+		{path.Join(dir, "num_dir_ports"), strconv.Itoa(r.DirPorts)},
+	}
+}
+
+// FakeSysFsDLBContents creates dlb2 PF devices with their resources, and
+// NumVFs VFs bound to vfio-pci for every PF in sysfsRoot.
+func FakeSysFsDLBContents(sysfsRoot string, dlbdevices DLBDevices) error {
+	// ...bus/pci/drivers/dlb2
+	kerneldriverdir := path.Join(sysfsRoot, sysfsDriverPath, dlbModuleName)
+	if err := os.MkdirAll(kerneldriverdir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs driver dir: %v", err)
+	}
+
+	// ...bus/pci/drivers/vfio-pci
+	vfiopcidriverdir := path.Join(sysfsRoot, sysfsDriverPath, vfioPCI)
+	if err := os.MkdirAll(vfiopcidriverdir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs pci driver dir: %v", err)
+	}
+
+	// ...bus/pci/devices
+	pcidevicedir := path.Join(sysfsRoot, sysfsDevicePath)
+	if err := os.MkdirAll(pcidevicedir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs device dir: %v", err)
+	}
+
+	// ...kernel/iommu_groups
+	iommudir := path.Join(sysfsRoot, vfIOMMUpath)
+
+	iommu := 400
+	for _, pf := range dlbdevices {
+		// ...devices/pci/pcixxx:xx/xxxx:xx:xx.x
+		devicedir := path.Join(sysfsRoot, pcipath(pf.Device), pf.Device)
+		if err := os.MkdirAll(devicedir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs device dir: %v", err)
+		}
+
+		// .../bus/pci/devices/xxxx:xx:xx.x -> ...devices/pci/pcixxx:xx/xxxx:xx:xx.x
+		if err := os.Symlink(devicedir, path.Join(pcidevicedir, pf.Device)); err != nil {
+			return fmt.Errorf("creating fake sysfs device link: %v", err)
+		}
+
+		// .../bus/pci/drivers/dlb2/xxxx:xx:xx.x -> ...devices/pci/pcixxx:xx/xxxx:xx:xx.x
+		if err := os.Symlink(devicedir, path.Join(kerneldriverdir, pf.Device)); err != nil {
+			return fmt.Errorf("creating fake sysfs device driver link: %v", err)
+		}
+
+		files := []pcidevicefiles{
+			{numVFs, strconv.Itoa(pf.NumVFs)},
+			{totalVFs, strconv.Itoa(pf.TotalVFs)},
+		}
+		files = append(files, pf.Total.files("total_resources")...)
+		if err := writesysfsfiles(devicedir, files); err != nil {
+			return fmt.Errorf("creating fake sysfs device files: %v", err)
+		}
+
+		for i := 0; i < pf.NumVFs; i++ {
+			// VFs follow the PF in the same PCI device
+			vfdev := pf.Device[:len(pf.Device)-1] + strconv.Itoa(i+1)
+			vfpath := path.Join(sysfsRoot, pcipath(pf.Device), vfdev)
+
+			if err := os.MkdirAll(vfpath, 0755); err != nil {
+				return fmt.Errorf("creating fake sysfs vf device directory: %v", err)
+			}
+			if err := os.Symlink(vfpath, path.Join(pcidevicedir, vfdev)); err != nil {
+				return fmt.Errorf("creating fake sysfs vf device symlink '%s': %v", vfpath, err)
+			}
+			if err := os.Symlink(vfpath, path.Join(devicedir, vfDevicePattern+strconv.Itoa(i))); err != nil {
+				return fmt.Errorf("creating fake sysfs vf link: %v", err)
+			}
+
+			iommu++
+			vfiommupath := path.Join(iommudir, strconv.Itoa(iommu))
+			if err := os.MkdirAll(vfiommupath, 0755); err != nil {
+				return fmt.Errorf("cannot create iommu dir in '%s'", iommudir)
+			}
+			if err := os.Symlink(vfiommupath, path.Join(vfpath, vfIOMMU)); err != nil {
+				return fmt.Errorf("creating vfiommu symlink: %v", err)
+			}
+			if err := os.Symlink(vfiopcidriverdir, path.Join(vfpath, vfDriver)); err != nil {
+				return fmt.Errorf("creating vfio driver symlink: %v", err)
+			}
+
+			resources := DLBResources{}
+			if i < len(pf.VFResources) {
+				resources = pf.VFResources[i]
+			}
+			if err := writesysfsfiles(devicedir, resources.files(fmt.Sprintf("vf%d_resources", i))); err != nil {
+				return fmt.Errorf("creating fake sysfs vf resources files: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
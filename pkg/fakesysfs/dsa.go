@@ -0,0 +1,112 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fakesysfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const (
+	dsaBusPath   = "bus/dsa/devices"
+	dsaDevfsPath = "dsa"
+)
+
+type DSADevices []*DSADevice
+
+type DSADevice struct {
+	Device     string // e.g. dsa0
+	PCIAddress string
+	State      string
+	NumaNode   int
+	WorkQueues []DSAWorkQueue
+	Engines    []DSAEngine
+}
+
+type DSAWorkQueue struct {
+	WorkQueue string // e.g. wq0.0
+	State     string
+	Mode      string
+	Type      string
+	Size      int
+	GroupID   int
+}
+
+type DSAEngine struct {
+	Engine  string // e.g. engine0.0
+	GroupID int
+}
+
+// FakeSysFsDSAContents creates idxd devices, work queues and engines layout of
+// the dsa bus in sysfsRoot, and work queue device files in devfsRoot.
+func FakeSysFsDSAContents(sysfsRoot string, devfsRoot string, dsadevices DSADevices) error {
+	// ...bus/dsa/devices
+	busdir := path.Join(sysfsRoot, dsaBusPath)
+	if err := os.MkdirAll(busdir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs dsa bus dir: %v", err)
+	}
+
+	// .../dev/dsa
+	devfsdir := path.Join(devfsRoot, dsaDevfsPath)
+	if err := os.MkdirAll(devfsdir, 0755); err != nil {
+		return fmt.Errorf("creating fake devfs dsa dir: %v", err)
+	}
+
+	for _, d := range dsadevices {
+		// ...devices/pcixxxx:xx/xxxx:xx:xx.x/dsaX
+		devicedir := path.Join(sysfsRoot, pcipath(d.PCIAddress), d.PCIAddress, d.Device)
+		if err := os.MkdirAll(devicedir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs dsa device dir: %v", err)
+		}
+		if err := os.Symlink(devicedir, path.Join(busdir, d.Device)); err != nil {
+			return fmt.Errorf("creating fake sysfs dsa device link: %v", err)
+		}
+
+		if err := writesysfsfiles(devicedir, []pcidevicefiles{
+			{"state", d.State},
+			{"numa_node", strconv.Itoa(d.NumaNode)},
+		}); err != nil {
+			return fmt.Errorf("creating fake sysfs dsa device files: %v", err)
+		}
+
+		for _, wq := range d.WorkQueues {
+			wqdir := path.Join(devicedir, wq.WorkQueue)
+			if err := writesysfsfiles(wqdir, []pcidevicefiles{
+				{"state", wq.State},
+				{"mode", wq.Mode},
+				{"type", wq.Type},
+				{"size", strconv.Itoa(wq.Size)},
+				{"group_id", strconv.Itoa(wq.GroupID)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs work queue files: %v", err)
+			}
+			if err := os.Symlink(wqdir, path.Join(busdir, wq.WorkQueue)); err != nil {
+				return fmt.Errorf("creating fake sysfs work queue link: %v", err)
+			}
+
+			if err := helpers.WriteFile(path.Join(devfsdir, wq.WorkQueue), ""); err != nil {
+				return fmt.Errorf("creating fake devfs work queue file: %v", err)
+			}
+		}
+
+		for _, engine := range d.Engines {
+			enginedir := path.Join(devicedir, engine.Engine)
+			if err := writesysfsfiles(enginedir, []pcidevicefiles{
+				{"group_id", strconv.Itoa(engine.GroupID)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs engine files: %v", err)
+			}
+			if err := os.Symlink(enginedir, path.Join(busdir, engine.Engine)); err != nil {
+				return fmt.Errorf("creating fake sysfs engine link: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -17,6 +17,7 @@
 package fakesysfs
 
 import (
+	"encoding/binary"
 	"fmt"
 	"os"
 	"path"
@@ -61,6 +62,25 @@ func newPCIAddress(driverDir string, currentAddress string) (string, error) {
 	return "", fmt.Errorf("no addresses left")
 }
 
+// pciConfigWithSerial returns 4KiB PCIe config space with Device Serial Number
+// extended capability following an AER capability, serial being 16 hex digits.
+func pciConfigWithSerial(serial string) ([]byte, error) {
+	serialNumber, err := strconv.ParseUint(serial, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device serial number %v: %v", serial, err)
+	}
+
+	config := make([]byte, 4096)
+	// AER capability, version 2, next at 0x150
+	binary.LittleEndian.PutUint32(config[0x100:], 0x0001|2<<16|0x150<<20)
+	// DSN capability, version 1, last
+	binary.LittleEndian.PutUint32(config[0x150:], 0x0003|1<<16)
+	binary.LittleEndian.PutUint32(config[0x154:], uint32(serialNumber))
+	binary.LittleEndian.PutUint32(config[0x158:], uint32(serialNumber>>32))
+
+	return config, nil
+}
+
 // sanitizeFakeSysFsDir ensuring the /tmp location of fake sysfs.
 func sanitizeFakeSysFsDir(sysfsRootUntrusted string) error {
 	// fake sysfsroot should be deletable.
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakesysfs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// checkTree fails the test when the files, relative to root, do not exist or
+// have other content than expected. Empty expected content only checks that
+// the file exists, "-> target" checks the symlink target, and missing lists
+// files that must not exist.
+func checkTree(t *testing.T, root string, files map[string]string, missing []string) {
+	t.Helper()
+
+	for file, expected := range files {
+		filePath := path.Join(root, file)
+		switch {
+		case strings.HasPrefix(expected, "-> "):
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				t.Errorf("expected symlink %v: %v", file, err)
+			} else if target != strings.TrimPrefix(expected, "-> ") {
+				t.Errorf("symlink %v: expected target %q, got %q", file, strings.TrimPrefix(expected, "-> "), target)
+			}
+		case expected == "":
+			if _, err := os.Stat(filePath); err != nil {
+				t.Errorf("expected %v to exist: %v", file, err)
+			}
+		default:
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Errorf("could not read %v: %v", file, err)
+			} else if strings.TrimSpace(string(content)) != expected {
+				t.Errorf("%v: expected %q, got %q", file, expected, content)
+			}
+		}
+	}
+
+	for _, file := range missing {
+		if _, err := os.Lstat(path.Join(root, file)); err == nil {
+			t.Errorf("expected %v not to exist", file)
+		}
+	}
+}
+
+func TestSanitizeFakeSysFsDir(t *testing.T) {
+	testcases := []struct {
+		sysfsRoot string
+		valid     bool
+	}{
+		{"/tmp/test-123/sysfs", true},
+		{"/tmp", true},
+		{"/sys", false},
+		{"/tmp/../sys", false},
+		{"", false},
+	}
+
+	for _, testcase := range testcases {
+		if err := sanitizeFakeSysFsDir(testcase.sysfsRoot); (err == nil) != testcase.valid {
+			t.Errorf("%q: expected valid %v, got error %v", testcase.sysfsRoot, testcase.valid, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakesysfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+// Defects that can be injected into fake GPU sysfs after it was created.
+const (
+	// FaultNoLocalMemory removes local memory size files of the device.
+	FaultNoLocalMemory = "no-lmem"
+	// FaultNoDRM removes drm directory of the PCI device.
+	FaultNoDRM = "no-drm"
+	// FaultBrokenVirtfn makes virtfnN symlinks of the PF, or the one pointing
+	// to the VF, dangling.
+	FaultBrokenVirtfn = "broken-virtfn"
+	// FaultNoTiles removes tile (gt) directories of the device.
+	FaultNoTiles = "no-tiles"
+	// FaultUnreadableLocalMemory replaces local memory size files of the
+	// device with directories, so that reading them fails.
+	FaultUnreadableLocalMemory = "unreadable-lmem"
+
+	// brokenVirtfnTarget has the same length as a valid virtfn symlink target.
+	brokenVirtfnTarget = "../ffff:ff:1f.7"
+)
+
+// InjectGpuFaults breaks fake sysfs of the given GPU in the ways listed in
+// faults, so that error handling of discovery and SR-IOV code can be tested.
+func InjectGpuFaults(sysfsRoot string, gpu *device.DeviceInfo, faults []string) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	gpuDevDir := path.Join(sysfsRoot, gpu.SysfsDriverPath(), gpu.PCIAddress)
+	if _, err := os.Stat(gpuDevDir); err != nil {
+		return fmt.Errorf("device %v not found: %v", gpu.PCIAddress, err)
+	}
+
+	// drm removal has to be last, other faults need the drm dir.
+	removeDRM := false
+	for _, fault := range faults {
+		var err error
+		switch fault {
+		case FaultNoLocalMemory:
+			err = removeMatching(
+				path.Join(gpuDevDir, "drm/card*/lmem_total_bytes"),
+				path.Join(gpuDevDir, "tile*/physical_vram_size_bytes"))
+		case FaultUnreadableLocalMemory:
+			err = makeUnusable(
+				path.Join(gpuDevDir, "drm/card*/lmem_total_bytes"),
+				path.Join(gpuDevDir, "tile*/physical_vram_size_bytes"))
+		case FaultNoDRM:
+			removeDRM = true
+		case FaultBrokenVirtfn:
+			err = breakVirtfnLinks(gpuDevDir, gpu)
+		case FaultNoTiles:
+			err = removeMatching(
+				path.Join(gpuDevDir, "drm/card*/gt/gt*"),
+				path.Join(gpuDevDir, "drm/card*/prelim_iov/vf*/gt*"),
+				path.Join(gpuDevDir, "tile*"))
+		default:
+			err = fmt.Errorf("unsupported fault %q", fault)
+		}
+		if err != nil {
+			return fmt.Errorf("injecting %v into %v: %v", fault, gpu.UID, err)
+		}
+	}
+
+	if removeDRM {
+		if err := os.RemoveAll(path.Join(gpuDevDir, "drm")); err != nil {
+			return fmt.Errorf("injecting %v into %v: %v", FaultNoDRM, gpu.UID, err)
+		}
+	}
+
+	return nil
+}
+
+func removeMatching(patterns ...string) error {
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := os.RemoveAll(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// makeUnusable replaces the matching files with directories, so that reading
+// and writing them fails also for root, which file permissions would not do.
+func makeUnusable(patterns ...string) error {
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+			if err := os.Mkdir(file, 0755); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// breakVirtfnLinks retargets PF's virtfn symlinks, or the parent's symlink to
+// the VF, to a non-existing PCI device.
+func breakVirtfnLinks(gpuDevDir string, gpu *device.DeviceInfo) error {
+	virtfns, _ := filepath.Glob(path.Join(gpuDevDir, "virtfn*"))
+	if gpu.DeviceType == device.VfDeviceType {
+		virtfns = []string{path.Join(path.Dir(gpuDevDir), gpu.ParentPCIAddress(), fmt.Sprintf("virtfn%d", gpu.VFIndex))}
+	}
+
+	for _, virtfn := range virtfns {
+		if err := os.Remove(virtfn); err != nil {
+			return err
+		}
+		if err := os.Symlink(brokenVirtfnTarget, virtfn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Defects that can be injected into fake QAT sysfs after it was created.
+const (
+	// FaultUnwritableNumVFs makes sriov_numvfs of the PF device unusable, so
+	// that enabling VFs fails.
+	FaultUnwritableNumVFs = "unwritable-numvfs"
+	// FaultUnwritableState makes qat/state of the PF device unusable, so that
+	// bringing the device up or down fails.
+	FaultUnwritableState = "unwritable-state"
+	// FaultNoVFs removes the virtfnN symlinks of the PF device, like when VFs
+	// were only partially created.
+	FaultNoVFs = "no-vfs"
+)
+
+// InjectQATFaults breaks fake sysfs of the given QAT PF device in the ways
+// listed in faults, so that error handling of SR-IOV provisioning and service
+// configuration can be tested.
+func InjectQATFaults(pfDevice string, faults []string) error {
+	deviceDir := path.Join(testSysfsRoot, sysfsDevicePath, pfDevice)
+	if _, err := os.Stat(deviceDir); err != nil {
+		return fmt.Errorf("device %v not found: %v", pfDevice, err)
+	}
+
+	for _, fault := range faults {
+		var err error
+		switch fault {
+		case FaultUnwritableNumVFs:
+			err = makeUnusable(path.Join(deviceDir, numVFs))
+		case FaultUnwritableState:
+			err = makeUnusable(path.Join(deviceDir, qatState))
+		case FaultNoVFs:
+			err = removeMatching(path.Join(deviceDir, vfDevicePattern+"*"))
+		default:
+			err = fmt.Errorf("unsupported fault %q", fault)
+		}
+		if err != nil {
+			return fmt.Errorf("injecting %v into %v: %v", fault, pfDevice, err)
+		}
+	}
+
+	return nil
+}
+
+// DelayQATVFs hides the VFs of the given QAT PF device, like when VF creation
+// is slow. VFs appear when the returned function is called.
+func DelayQATVFs(pfDevice string) (func() error, error) {
+	deviceDir := path.Join(testSysfsRoot, sysfsDevicePath, pfDevice)
+	virtfns, err := filepath.Glob(path.Join(deviceDir, vfDevicePattern+"*"))
+	if err != nil || len(virtfns) == 0 {
+		return nil, fmt.Errorf("no VFs of %v found: %v", pfDevice, err)
+	}
+
+	targets := map[string]string{}
+	for _, virtfn := range virtfns {
+		target, err := os.Readlink(virtfn)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Remove(virtfn); err != nil {
+			return nil, err
+		}
+		targets[virtfn] = target
+	}
+
+	return func() error {
+		for virtfn, target := range targets {
+			if err := os.Symlink(target, virtfn); err != nil {
+				return fmt.Errorf("creating delayed VF of %v: %v", pfDevice, err)
+			}
+		}
+		return nil
+	}, nil
+}
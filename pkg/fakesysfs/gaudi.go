@@ -20,9 +20,27 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+// GaudiPort describes a NIC port of a fake Gaudi. Scale-up ports connect to
+// another Gaudi module in the same server, scale-out ports (no peer module)
+// are used for networking between servers.
+type GaudiPort struct {
+	Index         uint64  `json:"index"`
+	PeerModuleIdx *uint64 `json:"peermoduleidx,omitempty"`
+	Up            bool    `json:"up"`
+}
+
+// Values of habanalabs device status sysfs file.
+const (
+	GaudiStatusOperational = device.StatusOperational
+	GaudiStatusNeedsReset  = "needs reset"
 )
 
 func FakeSysFsGaudiContents(sysfsRoot string, devfsRoot string, gaudis device.DevicesInfo, realDeviceFiles bool) error {
@@ -33,43 +51,77 @@ func FakeSysFsGaudiContents(sysfsRoot string, devfsRoot string, gaudis device.De
 	return fakeSysFsGaudiDevices(sysfsRoot, devfsRoot, gaudis, realDeviceFiles)
 }
 
-// fakeSysFsGaudiDevices creates PCI and DRM devices layout in existing fake sysfsRoot.
+// fakeGaudiPCIDeviceDir returns the PCI device directory of the Gaudi under
+// its PCI root complex, relative to sysfs root, e.g.
+// devices/pci0000:0f/0000:0f:00.0. The root complex ID defaults to the bus
+// number of the PCI address.
+func fakeGaudiPCIDeviceDir(gaudi *device.DeviceInfo) string {
+	pciRoot := gaudi.PCIRoot
+	if pciRoot == "" {
+		pciRoot = gaudi.PCIAddress[5:7]
+	}
+
+	return path.Join("devices", "pci0000:"+pciRoot, gaudi.PCIAddress)
+}
+
+// fakeSysFsGaudiDevices creates PCI and accel devices layout in existing fake sysfsRoot.
 // This will be called when fake sysfs is being created and when more devices added
 // to existing fake sysfs.
 func fakeSysFsGaudiDevices(sysfsRoot string, devfsRoot string, gaudis device.DevicesInfo, realDeviceFiles bool) error {
 	for _, gaudi := range gaudis {
-		// bus/pci/driver/<device> setup
-		pciDriverDevDir := path.Join(sysfsRoot, "bus/pci/drivers/habanalabs/", gaudi.PCIAddress)
-		if err := os.MkdirAll(pciDriverDevDir, 0755); err != nil {
-			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		if !pci.AddressRegexp.MatchString(gaudi.PCIAddress) {
+			return fmt.Errorf("creating fake sysfs, invalid PCI address %q of %v", gaudi.PCIAddress, gaudi.UID)
 		}
 
-		if writeErr := helpers.WriteFile(path.Join(pciDriverDevDir, "device"), gaudi.Model); writeErr != nil {
-			return fmt.Errorf("creating fake sysfs dir, err: %v", writeErr)
+		// devices/pci0000:<root>/<device> setup
+		pciDeviceDir := path.Join(sysfsRoot, fakeGaudiPCIDeviceDir(gaudi))
+		if err := os.MkdirAll(pciDeviceDir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
 		}
 
-		deviceName := fmt.Sprintf("accel%v", gaudi.DeviceIdx)
-		controlDeviceName := fmt.Sprintf("accel_controlD%v", gaudi.DeviceIdx)
-		// devices/virtual/accel/<device> setup
-		dirPath := path.Join(sysfsRoot, "devices/virtual/accel", deviceName, "device")
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			return fmt.Errorf("creating fake sysfs dir, err: %v", err)
-		}
-		// $ cat /sys/devices/virtual/accel/accel0/device/pci_addr
-		// 0000:0f:00.0
-		if writeErr := helpers.WriteFile(path.Join(dirPath, "pci_addr"), gaudi.PCIAddress); writeErr != nil {
-			return fmt.Errorf("creating fake sysfs dir, err: %v", writeErr)
+		for file, value := range map[string]string{
+			"device": gaudi.Model,
+			// $ cat /sys/class/accel/accel0/device/pci_addr
+			// 0000:0f:00.0
+			"pci_addr":  gaudi.PCIAddress,
+			"module_id": fmt.Sprintf("%v", gaudi.ModuleIdx),
+			"status":    GaudiStatusOperational,
+			"numa_node": fmt.Sprintf("%v", gaudi.NUMANode),
+		} {
+			if writeErr := helpers.WriteFile(path.Join(pciDeviceDir, file), value); writeErr != nil {
+				return fmt.Errorf("creating fake sysfs dir, err: %v", writeErr)
+			}
 		}
 
-		if writeErr := helpers.WriteFile(path.Join(dirPath, "module_id"), fmt.Sprintf("%v", gaudi.DeviceIdx)); writeErr != nil {
-			return fmt.Errorf("creating fake sysfs dir, err: %v", writeErr)
+		// bus/pci/devices/<device> and bus/pci/drivers/habanalabs/<device> links
+		// to the PCI device, and its driver link
+		pciDriverDir := path.Join(sysfsRoot, device.SysfsDriverPath)
+		pciDevicesDir := path.Join(sysfsRoot, pci.DevicesPath)
+		for _, dir := range []string{pciDriverDir, pciDevicesDir} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", err)
+			}
+			if err := os.Symlink(pciDeviceDir, path.Join(dir, gaudi.PCIAddress)); err != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", err)
+			}
 		}
-
-		dirPath = path.Join(sysfsRoot, "devices/virtual/accel", controlDeviceName)
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
+		if err := os.Symlink(pciDriverDir, path.Join(pciDeviceDir, "driver")); err != nil {
 			return fmt.Errorf("creating fake sysfs, err: %v", err)
 		}
 
+		deviceName := fmt.Sprintf("accel%v", gaudi.DeviceIdx)
+		controlDeviceName := fmt.Sprintf("accel_controlD%v", gaudi.DeviceIdx)
+		// devices/virtual/accel/<device> setup, with device link to the PCI device
+		for _, name := range []string{deviceName, controlDeviceName} {
+			dirPath := path.Join(sysfsRoot, device.SysfsAccelPath, name)
+			if err := os.MkdirAll(dirPath, 0755); err != nil {
+				return fmt.Errorf("creating fake sysfs dir, err: %v", err)
+			}
+			if err := os.Symlink(pciDeviceDir, path.Join(dirPath, "device")); err != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", err)
+			}
+		}
+
 		// class/accel setup
 		sysfsAccelClassDir := path.Join(sysfsRoot, "class/accel")
 		if err := os.MkdirAll(sysfsAccelClassDir, 0755); err != nil {
@@ -144,3 +196,157 @@ func fakeGaudiPlainDeviceFiles(devfsRoot, accelDevPath string, accelIdx uint64)
 
 	return nil
 }
+
+// findFakeGaudiAccelIdx returns accel device index of the Gaudi with given PCI address.
+func findFakeGaudiAccelIdx(sysfsRoot string, pciAddress string) (string, error) {
+	accelDir := path.Join(sysfsRoot, "devices/virtual/accel")
+	accelFiles, err := os.ReadDir(accelDir)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %v: %v", accelDir, err)
+	}
+
+	for _, accelFile := range accelFiles {
+		if !device.AccelRegexp.MatchString(accelFile.Name()) {
+			continue
+		}
+		pciAddr, err := os.ReadFile(path.Join(accelDir, accelFile.Name(), "device/pci_addr"))
+		if err == nil && strings.TrimSpace(string(pciAddr)) == pciAddress {
+			return strings.TrimPrefix(accelFile.Name(), "accel"), nil
+		}
+	}
+
+	return "", fmt.Errorf("no accel device found for %v", pciAddress)
+}
+
+// RemoveFakeGaudiDevice deletes PCI and accel layout of the Gaudi with given
+// PCI address from fake sysfs and devfs.
+func RemoveFakeGaudiDevice(sysfsRoot string, devfsRoot string, pciAddress string) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	accelIdx, err := findFakeGaudiAccelIdx(sysfsRoot, pciAddress)
+	if err != nil {
+		return err
+	}
+
+	pciDeviceDir, err := filepath.EvalSymlinks(path.Join(sysfsRoot, device.SysfsDriverPath, pciAddress))
+	if err != nil {
+		return fmt.Errorf("no PCI device found for %v: %v", pciAddress, err)
+	}
+
+	deviceName := "accel" + accelIdx
+	controlDeviceName := "accel_controlD" + accelIdx
+	toRemove := []string{
+		pciDeviceDir,
+		path.Join(sysfsRoot, pci.DevicesPath, pciAddress),
+		path.Join(sysfsRoot, "class/accel", deviceName),
+		path.Join(sysfsRoot, "class/accel", controlDeviceName),
+		path.Join(sysfsRoot, "devices/virtual/accel", deviceName),
+		path.Join(sysfsRoot, "devices/virtual/accel", controlDeviceName),
+		path.Join(sysfsRoot, "bus/pci/drivers/habanalabs/", pciAddress),
+		path.Join(devfsRoot, "accel", deviceName),
+		path.Join(devfsRoot, "accel", controlDeviceName),
+		path.Join(devfsRoot, "hl"+accelIdx),
+		path.Join(devfsRoot, "hl_controlD"+accelIdx),
+	}
+
+	for _, filePath := range toRemove {
+		if err := os.RemoveAll(filePath); err != nil {
+			return fmt.Errorf("could not cleanup %v: %v", filePath, err)
+		}
+	}
+
+	return nil
+}
+
+// SetFakeGaudiDeviceStatus overwrites the status sysfs file of the Gaudi with given PCI address.
+func SetFakeGaudiDeviceStatus(sysfsRoot string, pciAddress string, status string) error {
+	accelIdx, err := findFakeGaudiAccelIdx(sysfsRoot, pciAddress)
+	if err != nil {
+		return err
+	}
+
+	statusFilePath := path.Join(sysfsRoot, "devices/virtual/accel", "accel"+accelIdx, "device/status")
+	if err := helpers.WriteFile(statusFilePath, status); err != nil {
+		return fmt.Errorf("could not write %v: %v", statusFilePath, err)
+	}
+
+	return nil
+}
+
+func gaudiPortDir(sysfsRoot string, pciAddress string, port uint64) string {
+	return path.Join(sysfsRoot, device.SysfsDriverPath, pciAddress, "net", fmt.Sprintf("hbl_%d", port))
+}
+
+// FakeGaudiPorts creates net/hbl_<port> directories in the Gaudi PCI device
+// directory, with operstate "up" or "down", dev_port holding the port index
+// and, for scale-up ports, peer_module_id holding the module index of the
+// connected Gaudi. On real hardware the topology comes from hlml instead.
+func FakeGaudiPorts(sysfsRoot string, pciAddress string, ports []GaudiPort) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	for _, port := range ports {
+		portDir := gaudiPortDir(sysfsRoot, pciAddress, port.Index)
+		if err := os.MkdirAll(portDir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		}
+
+		if writeErr := helpers.WriteFile(path.Join(portDir, "dev_port"), fmt.Sprint(port.Index)); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+		}
+
+		if port.PeerModuleIdx != nil {
+			if writeErr := helpers.WriteFile(path.Join(portDir, "peer_module_id"), fmt.Sprint(*port.PeerModuleIdx)); writeErr != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+			}
+		}
+
+		if err := SetFakeGaudiPortState(sysfsRoot, pciAddress, port.Index, port.Up); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetFakeGaudiPortState sets operstate of the given port of the Gaudi with given PCI address.
+func SetFakeGaudiPortState(sysfsRoot string, pciAddress string, port uint64, up bool) error {
+	operstate := "down"
+	if up {
+		operstate = "up"
+	}
+
+	portDir := gaudiPortDir(sysfsRoot, pciAddress, port)
+	if _, err := os.Stat(portDir); err != nil {
+		return fmt.Errorf("port %d of %v not found: %v", port, pciAddress, err)
+	}
+
+	if err := helpers.WriteFile(path.Join(portDir, "operstate"), operstate); err != nil {
+		return fmt.Errorf("could not write operstate of port %d of %v: %v", port, pciAddress, err)
+	}
+
+	return nil
+}
+
+// FakeGaudiHwmon creates the hwmon device of the Gaudi with given PCI address,
+// with temperature in millidegrees Celsius and power in microwatts.
+func FakeGaudiHwmon(sysfsRoot string, pciAddress string, temperatureMilliC int64, powerMicroW int64) error {
+	hwmonDir := path.Join(sysfsRoot, device.SysfsDriverPath, pciAddress, "hwmon/hwmon0")
+	if err := os.MkdirAll(hwmonDir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs, err: %v", err)
+	}
+
+	for file, value := range map[string]int64{
+		"temp1_input":  temperatureMilliC,
+		"power1_input": powerMicroW,
+	} {
+		if err := helpers.WriteFile(path.Join(hwmonDir, file), fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -18,13 +18,11 @@ package fakesysfs
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"testing"
 
 	"github.com/fsnotify/fsnotify"
 
@@ -48,11 +46,12 @@ var perDeviceIdTilesDirs = map[string][]string{
 	"0x0000": {},      // No-tile dummy to simulate discovery issues
 }
 
+// countVFs returns the number of VFs of every PF, by the UID of the PF.
 func countVFs(devices device.DevicesInfo) map[string]int {
 	perDeviceNumvfs := map[string]int{}
-	for deviceUID, gpu := range devices {
+	for _, gpu := range devices {
 		if gpu.DeviceType == device.VfDeviceType {
-			perDeviceNumvfs[deviceUID] += 1
+			perDeviceNumvfs[gpu.ParentUID] += 1
 		}
 	}
 	return perDeviceNumvfs
@@ -181,14 +180,17 @@ func addFakeVFsOnParent(numvfsFilePath string, devfsRoot string, numVFs uint64,
 	}
 	parentVFsDir := path.Join(sysfsI915DeviceDir, "drm", fmt.Sprintf("card%d", parentCardIdx), "prelim_iov")
 
-	// check if auto_provisioning is enabled
-	automatic, err := autoProvisioningEnabled(parentVFsDir)
-	if err != nil {
-		return fmt.Errorf("could not detect auto_provisioning: %v", err)
-	}
-	if automatic {
-		// TODO: implement automatic provisioning, without VF profiles
-		fmt.Println("WARNING: auto_provisioning in fake sysfs is not implemented")
+	driver := path.Base(sysfsI915Dir)
+	if driver == device.I915Driver {
+		// check if auto_provisioning is enabled
+		automatic, err := autoProvisioningEnabled(parentVFsDir)
+		if err != nil {
+			return fmt.Errorf("could not detect auto_provisioning: %v", err)
+		}
+		if automatic {
+			// TODO: implement automatic provisioning, without VF profiles
+			fmt.Println("WARNING: auto_provisioning in fake sysfs is not implemented")
+		}
 	}
 
 	// generate DeviceInfo for VFs.
@@ -219,9 +221,15 @@ func addFakeVFsOnParent(numvfsFilePath string, devfsRoot string, numVFs uint64,
 		vfPCIAddress := fmt.Sprintf("%s%d", currentPCIdev, pciFunctionIdx)
 		vfUID = device.DeviceUIDFromPCIinfo(vfPCIAddress, model)
 
-		vfMem, err := getVFMemoryAmountMiB(parentVFsDir, vfIdx)
+		var vfMem uint64
+		if driver == device.XeDriver {
+			// xe provisions VFs automatically, splitting local memory evenly.
+			vfMem, err = getXeVFMemoryAmountMiB(sysfsI915DeviceDir, numVFs)
+		} else {
+			vfMem, err = getVFMemoryAmountMiB(parentVFsDir, vfIdx)
+		}
 		if err != nil {
-			return fmt.Errorf("could not get lmem_quota from VF%d on %v: %v", vfIdx, parentPCIAddress, err)
+			return fmt.Errorf("could not get memory amount for VF%d on %v: %v", vfIdx, parentPCIAddress, err)
 		}
 
 		newDevices[vfUID] = &device.DeviceInfo{
@@ -234,6 +242,7 @@ func addFakeVFsOnParent(numvfsFilePath string, devfsRoot string, numVFs uint64,
 			UID:        vfUID,
 			VFIndex:    vfIdx,
 			ParentUID:  device.DeviceUIDFromPCIinfo(parentPCIAddress, model),
+			Driver:     driver,
 		}
 	}
 
@@ -276,6 +285,31 @@ func getVFMemoryAmountMiB(parentVFsDir string, pciVFIdx uint64) (uint64, error)
 	return lmemTotalMiB, nil
 }
 
+// getXeVFMemoryAmountMiB returns the parent's local memory amount divided by
+// the number of VFs.
+func getXeVFMemoryAmountMiB(sysfsXeDeviceDir string, numVFs uint64) (uint64, error) {
+	vramFiles, err := filepath.Glob(path.Join(sysfsXeDeviceDir, "tile*", "physical_vram_size_bytes"))
+	if err != nil || len(vramFiles) == 0 {
+		return 0, fmt.Errorf("could not find physical_vram_size_bytes in %v", sysfsXeDeviceDir)
+	}
+
+	vramTotalBytes := uint64(0)
+	for _, vramFile := range vramFiles {
+		data, err := os.ReadFile(vramFile)
+		if err != nil {
+			return 0, fmt.Errorf("could not read file %v: %v", vramFile, err)
+		}
+
+		vramBytes, err := strconv.ParseUint(strings.TrimSpace(string(data)), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse value %v from file %v: %v", string(data), vramFile, err)
+		}
+		vramTotalBytes += vramBytes
+	}
+
+	return vramTotalBytes / (1024 * 1024) / numVFs, nil
+}
+
 // Duplicate code from pkg/sriov/sriov.go. TODO: minimize duplication.
 // getGTdirs returns directories named gt* in vfTilesDir.
 func getGTdirs(vfDir string) []string {
@@ -351,7 +385,7 @@ func fakeSysfsSRIOVContents(sysfsRoot string, gpus device.DevicesInfo) error {
 			}
 			gpu.PCIAddress, _ = device.PciInfoFromDeviceUID(deviceUID)
 		}
-		i915DevDir := path.Join(sysfsRoot, "bus/pci/drivers/i915/", gpu.PCIAddress)
+		i915DevDir := path.Join(sysfsRoot, gpu.SysfsDriverPath(), gpu.PCIAddress)
 
 		switch gpu.DeviceType {
 		case "gpu":
@@ -389,6 +423,11 @@ func fakeSysfsPF(deviceUID string, gpu *device.DeviceInfo, numvfs int, i915DevDi
 		return fmt.Errorf("creating fake sysfs, err(s): '%v', '%v', '%v'", writeErr1, writeErr2, writeErr3)
 	}
 
+	// xe has no prelim_iov, VFs are provisioned automatically.
+	if gpu.Driver == device.XeDriver {
+		return nil
+	}
+
 	cardName := fmt.Sprintf("card%v", gpu.CardIdx)
 	prelimIovDir := path.Join(i915DevDir, "drm", cardName, "prelim_iov")
 	pfDir := path.Join(prelimIovDir, "pf")
@@ -429,7 +468,7 @@ func fakeSysfsVF(vf *device.DeviceInfo, numvfs int, sysfsRoot string, i915DevDir
 		return fmt.Errorf("creating fake sysfs, err: %v", err)
 	}
 
-	parentI915DevDir := path.Join(sysfsRoot, "bus/pci/drivers/i915/", vf.ParentPCIAddress())
+	parentI915DevDir := path.Join(sysfsRoot, vf.SysfsDriverPath(), vf.ParentPCIAddress())
 
 	parentLinkName := path.Join(parentI915DevDir, fmt.Sprintf("virtfn%d", vf.VFIndex))
 	if vf.PCIAddress == "" {
@@ -447,46 +486,72 @@ func fakeSysfsVF(vf *device.DeviceInfo, numvfs int, sysfsRoot string, i915DevDir
 	return nil
 }
 
+// Logger is used by the sriov_numvfs watcher to report its progress and
+// errors. *testing.T satisfies it.
+type Logger interface {
+	Logf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
 // WatchNumvfs returns watcher that monitors numvfs_file and
 // updates fakesysfs respectively to written values.
 // It is caller's responsibility to close the watcher when the
 // testcase comes to an end.
-func WatchNumvfs(t *testing.T, sysfsRoot string, devfsRoot string, realDevices bool) *fsnotify.Watcher {
+func WatchNumvfs(logger Logger, sysfsRoot string, devfsRoot string, realDevices bool) (*fsnotify.Watcher, error) {
 	// Create new watcher.
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("could not create fsnotify watcher: %v", err)
 	}
 
-	go watchPFnumvfs(t, devfsRoot, watcher, realDevices)
+	go watchPFnumvfs(logger, devfsRoot, watcher, realDevices)
 
-	// find all sriov_numvfs and watch them
-	sysfsI915Dir := filepath.Join(sysfsRoot, "/bus/pci/drivers/i915/")
-	files, err := os.ReadDir(sysfsI915Dir)
-	if err != nil {
-		t.Fatalf("could not monitor sriov_numvfs files in %v: %v", sysfsI915Dir, err)
+	if err := AddNumvfsWatches(watcher, sysfsRoot); err != nil {
+		watcher.Close()
+		return nil, err
 	}
 
-	for _, pciDBDF := range files {
-		deviceDBDF := pciDBDF.Name()
-		// check if file is pci device
-		if !device.PciRegexp.MatchString(deviceDBDF) {
-			continue
-		}
+	return watcher, nil
+}
 
-		deviceI915Dir := filepath.Join(sysfsI915Dir, deviceDBDF)
-		numvfsFilePath := filepath.Join(deviceI915Dir, "sriov_numvfs")
-		_, err := os.ReadFile(numvfsFilePath)
+// AddNumvfsWatches adds all sriov_numvfs files found in fake sysfs to the
+// watcher, e.g. after new devices were added to fake sysfs. Files that are
+// already watched are not affected.
+func AddNumvfsWatches(watcher *fsnotify.Watcher, sysfsRoot string) error {
+	// find all sriov_numvfs and watch them
+	numvfsFilesFound := false
+	for _, driverPath := range []string{device.SysfsI915path, device.SysfsXePath} {
+		sysfsDriverDir := filepath.Join(sysfsRoot, driverPath)
+		files, err := os.ReadDir(sysfsDriverDir)
 		if err != nil {
 			continue
 		}
-		err = watcher.Add(numvfsFilePath)
-		if err != nil {
-			t.Fatalf("could not add file to watch, err: %v", err)
+		numvfsFilesFound = true
+
+		for _, pciDBDF := range files {
+			deviceDBDF := pciDBDF.Name()
+			// check if file is pci device
+			if !device.PciRegexp.MatchString(deviceDBDF) {
+				continue
+			}
+
+			numvfsFilePath := filepath.Join(sysfsDriverDir, deviceDBDF, "sriov_numvfs")
+			_, err := os.ReadFile(numvfsFilePath)
+			if err != nil {
+				continue
+			}
+			err = watcher.Add(numvfsFilePath)
+			if err != nil {
+				return fmt.Errorf("could not add file to watch, err: %v", err)
+			}
 		}
 	}
 
-	return watcher
+	if !numvfsFilesFound {
+		return fmt.Errorf("could not monitor sriov_numvfs files: no GPU driver directories in %v", sysfsRoot)
+	}
+
+	return nil
 }
 
 // updateVFsOnWrite handles updates of sriov_numvfs file in fake sysfs.
@@ -494,14 +559,14 @@ func WatchNumvfs(t *testing.T, sysfsRoot string, devfsRoot string, realDevices b
 // - calls removeFakeVFsOnParent if 0 VFs were requested
 // - calls addFakeVFsOnParent if > 0 VFs were requested
 // - does nothing if there was no value - its own truncation caused event.
-func updateVFsOnWrite(t *testing.T, devfsRoot string, numvfsFilePath string, realDevices bool) {
+func updateVFsOnWrite(logger Logger, devfsRoot string, numvfsFilePath string, realDevices bool) {
 	numvfsBytes, err := os.ReadFile(numvfsFilePath)
 	if err != nil {
-		t.Errorf("could not read numvfs file %v: %v", numvfsFilePath, err)
+		logger.Errorf("could not read numvfs file %v: %v", numvfsFilePath, err)
 	}
 
 	numvfsStr := strings.TrimSpace(string(numvfsBytes))
-	t.Logf("detected new sriov_numvfs value %v: '%v'", numvfsFilePath, numvfsStr)
+	logger.Logf("detected new sriov_numvfs value %v: '%v'", numvfsFilePath, numvfsStr)
 
 	if len(numvfsStr) == 0 {
 		// File was truncated, nothing to do, it was us.
@@ -512,36 +577,36 @@ func updateVFsOnWrite(t *testing.T, devfsRoot string, numvfsFilePath string, rea
 	// so the values will accumulate over time if it's not truncated.
 	f, err := os.OpenFile(numvfsFilePath, os.O_TRUNC, os.ModeAppend)
 	if err != nil {
-		t.Errorf("could not open file %v for truncation: %v", numvfsFilePath, err)
+		logger.Errorf("could not open file %v for truncation: %v", numvfsFilePath, err)
 		// Do not do anything else, fake sysfs is not alright.
 		return
 	}
 	if err = f.Close(); err != nil {
-		t.Errorf("could not close file handler for %v after truncation: %v", numvfsFilePath, err)
+		logger.Errorf("could not close file handler for %v after truncation: %v", numvfsFilePath, err)
 		// Do not do anything else, fake sysfs is not alright.
 		return
 	}
 
 	numvfsInt, err := strconv.ParseUint(numvfsStr, 10, 64)
 	if err != nil {
-		t.Errorf("could not convert string into int: %s", string(numvfsBytes))
+		logger.Errorf("could not convert string into int: %s", string(numvfsBytes))
 		return
 	}
 
-	t.Logf("updating SR-IOV setup of fake device %v\n", numvfsFilePath)
+	logger.Logf("updating SR-IOV setup of fake device %v", numvfsFilePath)
 	if numvfsInt == 0 {
 		if err := removeFakeVFsOnParent(devfsRoot, numvfsFilePath); err != nil {
-			t.Errorf("could not remove fake VFs: %v", err)
+			logger.Errorf("could not remove fake VFs: %v", err)
 		}
 	} else {
 		if err := addFakeVFsOnParent(numvfsFilePath, devfsRoot, numvfsInt, realDevices); err != nil {
-			t.Errorf("could not add fake VFs: %v", err)
+			logger.Errorf("could not add fake VFs: %v", err)
 		}
 	}
 }
 
 // watchPFnumvfs starts listening for events by watching file changes.
-func watchPFnumvfs(t *testing.T, devfsRoot string, watcher *fsnotify.Watcher, realDevices bool) {
+func watchPFnumvfs(logger Logger, devfsRoot string, watcher *fsnotify.Watcher, realDevices bool) {
 	for {
 		select {
 		case event, ok := <-watcher.Events:
@@ -549,15 +614,60 @@ func watchPFnumvfs(t *testing.T, devfsRoot string, watcher *fsnotify.Watcher, re
 				return
 			}
 			if event.Has(fsnotify.Write) {
-				updateVFsOnWrite(t, devfsRoot, event.Name, realDevices)
+				updateVFsOnWrite(logger, devfsRoot, event.Name, realDevices)
 			}
 		case err, ok := <-watcher.Errors:
 			if !ok { // channel was closed
 				return
 			}
-			t.Logf("fsnotify watcher error: %v\n", err)
+			logger.Logf("fsnotify watcher error: %v", err)
+		}
+	}
+}
+
+// RemoveFakeGpuDevice deletes PCI and DRM layout of the GPU with given PCI
+// address from fake sysfs and devfs, including its VFs, if any.
+func RemoveFakeGpuDevice(sysfsRoot string, devfsRoot string, pciAddress string) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	i915DevDir := path.Join(sysfsRoot, device.SysfsI915path, pciAddress)
+	if _, err := os.Stat(i915DevDir); err != nil {
+		i915DevDir = path.Join(sysfsRoot, device.SysfsXePath, pciAddress)
+		if _, err := os.Stat(i915DevDir); err != nil {
+			return fmt.Errorf("device %v not found: %v", pciAddress, err)
+		}
+	}
+
+	numvfsFilePath := path.Join(i915DevDir, "sriov_numvfs")
+	if _, err := os.Stat(numvfsFilePath); err == nil {
+		if err := removeFakeVFsOnParent(devfsRoot, numvfsFilePath); err != nil {
+			return fmt.Errorf("could not remove VFs of %v: %v", pciAddress, err)
+		}
+	}
+
+	// VF is also referenced from its parent.
+	if physfn, err := os.Readlink(path.Join(i915DevDir, "physfn")); err == nil {
+		virtfns, _ := filepath.Glob(filepath.Join(i915DevDir, physfn, "virtfn*"))
+		for _, virtfn := range virtfns {
+			if target, err := os.Readlink(virtfn); err == nil && path.Base(target) == pciAddress {
+				if err := os.Remove(virtfn); err != nil {
+					return fmt.Errorf("could not cleanup VF symlink %v: %v", virtfn, err)
+				}
+			}
 		}
 	}
+
+	if err := removeFakeVFDRM(devfsRoot, i915DevDir); err != nil {
+		return fmt.Errorf("could not cleanup fake DRM: %v", err)
+	}
+
+	if err := os.RemoveAll(i915DevDir); err != nil {
+		return fmt.Errorf("could not cleanup fake PCI dir %v: %v", i915DevDir, err)
+	}
+
+	return nil
 }
 
 func FakeSysFsGpuContents(sysfsRoot string, devfsRoot string, gpus device.DevicesInfo, realDevices bool) error {
@@ -578,7 +688,7 @@ func fakeSysFsGpuDevices(sysfsRoot string, devfsRoot string, gpus device.Devices
 		}
 
 		// driver setup
-		i915DevDir := path.Join(sysfsRoot, "bus/pci/drivers/i915/", gpu.PCIAddress)
+		i915DevDir := path.Join(sysfsRoot, gpu.SysfsDriverPath(), gpu.PCIAddress)
 		if err := os.MkdirAll(i915DevDir, 0750); err != nil {
 			return fmt.Errorf("creating fake sysfs, err: %v", err)
 		}
@@ -587,6 +697,16 @@ func fakeSysFsGpuDevices(sysfsRoot string, devfsRoot string, gpus device.Devices
 			return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
 		}
 
+		if gpu.Serial != "" {
+			config, err := pciConfigWithSerial(gpu.Serial)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path.Join(i915DevDir, "config"), config, 0600); err != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", err)
+			}
+		}
+
 		if err := fakeGpuDRI(sysfsRoot, devfsRoot, gpu, i915DevDir, realDevices); err != nil {
 			return err
 		}
@@ -621,9 +741,32 @@ func fakeGpuDRI(sysfsRoot string, devfsRoot string, gpu *device.DeviceInfo, i915
 		return fmt.Errorf("creating fake sysfs, err: %v", err)
 	}
 
-	localMemoryStr := fmt.Sprint(gpu.MemoryMiB * 1024 * 1024)
-	if writeErr := helpers.WriteFile(path.Join(drmDirLinkTarget, "lmem_total_bytes"), localMemoryStr); writeErr != nil {
-		return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+	if gpu.Driver == device.XeDriver {
+		if err := fakeXeTiles(gpu, i915DevDir); err != nil {
+			return err
+		}
+	} else {
+		// i915 has a gtN dir for every tile in DRM card dir.
+		for tileIdx := range perDeviceIdTilesDirs[gpu.Model] {
+			if err := os.MkdirAll(path.Join(drmDirLinkTarget, "gt", fmt.Sprintf("gt%d", tileIdx)), 0750); err != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", err)
+			}
+		}
+
+		localMemoryStr := fmt.Sprint(gpu.MemoryMiB * 1024 * 1024)
+		if writeErr := helpers.WriteFile(path.Join(drmDirLinkTarget, "lmem_total_bytes"), localMemoryStr); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+		}
+
+		if gpu.MaxFreqMHz != 0 {
+			if writeErr := helpers.WriteFile(path.Join(drmDirLinkTarget, "gt_RP0_freq_mhz"), fmt.Sprint(gpu.MaxFreqMHz)); writeErr != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+			}
+		}
+
+		if err := fakeEngineTimeslice(path.Join(drmDirLinkTarget, "engine", "rcs0"), "timeslice_duration_ms", "1"); err != nil {
+			return err
+		}
 	}
 
 	if err := os.MkdirAll(path.Join(devfsRoot, "dri/by-path"), 0750); err != nil {
@@ -644,6 +787,55 @@ func fakeGpuDRI(sysfsRoot string, devfsRoot string, gpu *device.DeviceInfo, i915
 	return createDevfsSymlinks(devfsRoot, cardName, renderdName, gpu.PCIAddress)
 }
 
+// fakeXeTiles creates xe tileN/gtN dirs in PCI device dir, with local memory
+// split evenly between the tiles.
+func fakeXeTiles(gpu *device.DeviceInfo, xeDevDir string) error {
+	numTiles := uint64(len(perDeviceIdTilesDirs[gpu.Model]))
+	if numTiles == 0 {
+		numTiles = 1
+	}
+
+	tileMemoryStr := fmt.Sprint(gpu.MemoryMiB * 1024 * 1024 / numTiles)
+	for tileIdx := uint64(0); tileIdx < numTiles; tileIdx++ {
+		tileDir := path.Join(xeDevDir, fmt.Sprintf("tile%d", tileIdx))
+		gtDir := path.Join(tileDir, fmt.Sprintf("gt%d", tileIdx))
+		if err := os.MkdirAll(path.Join(gtDir, "freq0"), 0750); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		}
+
+		if gpu.MaxFreqMHz != 0 {
+			if writeErr := helpers.WriteFile(path.Join(gtDir, "freq0", "rp0_freq"), fmt.Sprint(gpu.MaxFreqMHz)); writeErr != nil {
+				return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+			}
+		}
+
+		if writeErr := helpers.WriteFile(path.Join(tileDir, "physical_vram_size_bytes"), tileMemoryStr); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+		}
+
+		if err := fakeEngineTimeslice(path.Join(gtDir, "engines", "rcs"), "timeslice_duration_us", "1000"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fakeEngineTimeslice creates the engine timeslice file and its default.
+func fakeEngineTimeslice(engineDir string, fileName string, value string) error {
+	if err := os.MkdirAll(path.Join(engineDir, ".defaults"), 0750); err != nil {
+		return fmt.Errorf("creating fake sysfs, err: %v", err)
+	}
+
+	for _, filePath := range []string{path.Join(engineDir, fileName), path.Join(engineDir, ".defaults", fileName)} {
+		if writeErr := helpers.WriteFile(filePath, value); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", writeErr)
+		}
+	}
+
+	return nil
+}
+
 func createDevfsSymlinks(devfsRoot, cardName, renderdName, pciAddress string) error {
 	if err := os.Symlink(fmt.Sprintf("../%v", cardName), path.Join(devfsRoot, "dri/by-path/", fmt.Sprintf("pci-%v-card", pciAddress))); err != nil {
 		return fmt.Errorf("creating fake sysfs, err: %v", err)
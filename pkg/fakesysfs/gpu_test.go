@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakesysfs
+
+import (
+	"path"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+func TestFakeSysFsGpuContents(t *testing.T) {
+	testcases := []struct {
+		name    string
+		devices device.DevicesInfo
+		files   map[string]string
+		missing []string
+		valid   bool
+	}{
+		{
+			name: "i915 PF with VF",
+			devices: device.DevicesInfo{
+				"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, MaxVFs: 2, Driver: device.I915Driver},
+				"0000-03-00-1-0x56c0": {UID: "0000-03-00-1-0x56c0", PCIAddress: "0000:03:00.1", Model: "0x56c0", MemoryMiB: 8128, DeviceType: "vf", CardIdx: 1, RenderdIdx: 129, ParentUID: "0000-03-00-0-0x56c0", Driver: device.I915Driver},
+			},
+			files: map[string]string{
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/device":                                      "0x56c0",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/sriov_numvfs":                                "1",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/sriov_totalvfs":                              "2",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/card0/lmem_total_bytes":                  "17045651456",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/card0/gt/gt0":                            "",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/card0/engine/rcs0/timeslice_duration_ms": "1",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/card0/prelim_iov/pf/auto_provisioning":   "1",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/card0/prelim_iov/vf2/gt/lmem_quota":      "0",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/drm/renderD128":                              "",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/virtfn0":                                     "-> ../0000:03:00.1",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.1/physfn":                                      "-> ../0000:03:00.0",
+				"sysfs/bus/pci/drivers/i915/0000:03:00.1/drm/card1/lmem_total_bytes":                  "8522825728",
+				"sysfs/class/drm/card0":                   "",
+				"sysfs/class/drm/card1":                   "",
+				"dev/dri/card0":                           "",
+				"dev/dri/renderD129":                      "",
+				"dev/dri/by-path/pci-0000:03:00.0-card":   "-> ../card0",
+				"dev/dri/by-path/pci-0000:03:00.1-render": "-> ../renderD129",
+			},
+			missing: []string{
+				"sysfs/bus/pci/drivers/i915/0000:03:00.0/config",
+				"sysfs/bus/pci/drivers/xe",
+			},
+			valid: true,
+		},
+		{
+			name: "xe PF with serial number",
+			devices: device.DevicesInfo{
+				"0000-04-00-0-0x0bd5": {UID: "0000-04-00-0-0x0bd5", PCIAddress: "0000:04:00.0", Model: "0x0bd5", MemoryMiB: 131072, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, MaxVFs: 8, MaxFreqMHz: 1600, Serial: "0123456789abcdef", Driver: device.XeDriver},
+			},
+			files: map[string]string{
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/device":                                                "0x0bd5",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/config":                                                "",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/sriov_totalvfs":                                        "8",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile0/physical_vram_size_bytes":                        "68719476736",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile1/physical_vram_size_bytes":                        "68719476736",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile0/gt0/freq0/rp0_freq":                              "1600",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile1/gt1/freq0/rp0_freq":                              "1600",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile0/gt0/engines/rcs/timeslice_duration_us":           "1000",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/tile0/gt0/engines/rcs/.defaults/timeslice_duration_us": "1000",
+				"sysfs/class/drm/card0": "",
+				"dev/dri/renderD128":    "",
+			},
+			missing: []string{
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/drm/card0/lmem_total_bytes",
+				"sysfs/bus/pci/drivers/xe/0000:04:00.0/drm/card0/prelim_iov",
+				"sysfs/bus/pci/drivers/i915",
+			},
+			valid: true,
+		},
+		{
+			name: "VF without parent",
+			devices: device.DevicesInfo{
+				"0000-03-00-1-0x56c0": {UID: "0000-03-00-1-0x56c0", PCIAddress: "0000:03:00.1", Model: "0x56c0", DeviceType: "vf", CardIdx: 1, RenderdIdx: 129, ParentUID: "0000-03-00-0-0x56c0"},
+			},
+		},
+		{
+			name: "unsupported device type",
+			devices: device.DevicesInfo{
+				"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Model: "0x56c0", DeviceType: "npu", CardIdx: 0, RenderdIdx: 128},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			testRoot := t.TempDir()
+			err := FakeSysFsGpuContents(path.Join(testRoot, "sysfs"), path.Join(testRoot, "dev"), testcase.devices, false)
+			if (err == nil) != testcase.valid {
+				t.Fatalf("expected valid %v, got error %v", testcase.valid, err)
+			}
+
+			checkTree(t, testRoot, testcase.files, testcase.missing)
+		})
+	}
+}
+
+func TestFakeSysFsGpuContentsOutsideTmp(t *testing.T) {
+	if err := FakeSysFsGpuContents("/sys", "/dev", device.DevicesInfo{}, false); err == nil {
+		t.Errorf("fake sysfs outside /tmp was not rejected")
+	}
+}
+
+func TestRemoveFakeGpuDevice(t *testing.T) {
+	testRoot := t.TempDir()
+	sysfsRoot, devfsRoot := path.Join(testRoot, "sysfs"), path.Join(testRoot, "dev")
+	if err := FakeSysFsGpuContents(sysfsRoot, devfsRoot, device.DevicesInfo{
+		"0000-03-00-0-0x56c0": {UID: "0000-03-00-0-0x56c0", PCIAddress: "0000:03:00.0", Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, MaxVFs: 2},
+		"0000-03-00-1-0x56c0": {UID: "0000-03-00-1-0x56c0", PCIAddress: "0000:03:00.1", Model: "0x56c0", MemoryMiB: 8128, DeviceType: "vf", CardIdx: 1, RenderdIdx: 129, ParentUID: "0000-03-00-0-0x56c0"},
+		"0000-05-00-0-0x56c0": {UID: "0000-05-00-0-0x56c0", PCIAddress: "0000:05:00.0", Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 2, RenderdIdx: 130},
+	}, false); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := RemoveFakeGpuDevice(sysfsRoot, devfsRoot, "0000:03:00.0"); err != nil {
+		t.Fatalf("could not remove device: %v", err)
+	}
+
+	checkTree(t, testRoot,
+		map[string]string{
+			"sysfs/bus/pci/drivers/i915/0000:05:00.0/device": "0x56c0",
+			"sysfs/class/drm/card2":                          "",
+			"dev/dri/card2":                                  "",
+		},
+		[]string{
+			"sysfs/bus/pci/drivers/i915/0000:03:00.0",
+			"sysfs/bus/pci/drivers/i915/0000:03:00.1",
+			"sysfs/class/drm/card0",
+			"sysfs/class/drm/card1",
+			"dev/dri/card0",
+			"dev/dri/renderD129",
+			"dev/dri/by-path/pci-0000:03:00.0-card",
+		})
+
+	if err := RemoveFakeGpuDevice(sysfsRoot, devfsRoot, "0000:03:00.0"); err == nil {
+		t.Errorf("removing missing device did not fail")
+	}
+}
@@ -0,0 +1,111 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fakesysfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const iaaDevfsPath = "iax"
+
+type IAADevices []*IAADevice
+
+type IAADevice struct {
+	Device     string // e.g. iax1
+	PCIAddress string
+	State      string
+	NumaNode   int
+	OpCap      string // e.g. 00000000,00000000,00000000,00000000,00000000,007f000c,00000000,00000001
+	WorkQueues []IAAWorkQueue
+	Engines    []IAAEngine
+}
+
+type IAAWorkQueue struct {
+	WorkQueue string // e.g. wq0.0
+	State     string
+	Mode      string
+	Type      string
+	Size      int
+	GroupID   int
+}
+
+type IAAEngine struct {
+	Engine  string // e.g. engine0.0
+	GroupID int
+}
+
+// FakeSysFsIAAContents creates idxd IAA devices, work queues and engines layout
+// of the dsa bus in sysfsRoot, and work queue device files in devfsRoot.
+func FakeSysFsIAAContents(sysfsRoot string, devfsRoot string, iaadevices IAADevices) error {
+	// ...bus/dsa/devices
+	busdir := path.Join(sysfsRoot, dsaBusPath)
+	if err := os.MkdirAll(busdir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs dsa bus dir: %v", err)
+	}
+
+	// .../dev/iax
+	devfsdir := path.Join(devfsRoot, iaaDevfsPath)
+	if err := os.MkdirAll(devfsdir, 0755); err != nil {
+		return fmt.Errorf("creating fake devfs iax dir: %v", err)
+	}
+
+	for _, d := range iaadevices {
+		// ...devices/pcixxxx:xx/xxxx:xx:xx.x/iaaX
+		devicedir := path.Join(sysfsRoot, pcipath(d.PCIAddress), d.PCIAddress, d.Device)
+		if err := os.MkdirAll(devicedir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs iaa device dir: %v", err)
+		}
+		if err := os.Symlink(devicedir, path.Join(busdir, d.Device)); err != nil {
+			return fmt.Errorf("creating fake sysfs iaa device link: %v", err)
+		}
+
+		if err := writesysfsfiles(devicedir, []pcidevicefiles{
+			{"state", d.State},
+			{"numa_node", strconv.Itoa(d.NumaNode)},
+			{"op_cap", d.OpCap},
+		}); err != nil {
+			return fmt.Errorf("creating fake sysfs iaa device files: %v", err)
+		}
+
+		for _, wq := range d.WorkQueues {
+			wqdir := path.Join(devicedir, wq.WorkQueue)
+			if err := writesysfsfiles(wqdir, []pcidevicefiles{
+				{"state", wq.State},
+				{"mode", wq.Mode},
+				{"type", wq.Type},
+				{"size", strconv.Itoa(wq.Size)},
+				{"group_id", strconv.Itoa(wq.GroupID)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs work queue files: %v", err)
+			}
+			if err := os.Symlink(wqdir, path.Join(busdir, wq.WorkQueue)); err != nil {
+				return fmt.Errorf("creating fake sysfs work queue link: %v", err)
+			}
+
+			if err := helpers.WriteFile(path.Join(devfsdir, wq.WorkQueue), ""); err != nil {
+				return fmt.Errorf("creating fake devfs work queue file: %v", err)
+			}
+		}
+
+		for _, engine := range d.Engines {
+			enginedir := path.Join(devicedir, engine.Engine)
+			if err := writesysfsfiles(enginedir, []pcidevicefiles{
+				{"group_id", strconv.Itoa(engine.GroupID)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs engine files: %v", err)
+			}
+			if err := os.Symlink(enginedir, path.Join(busdir, engine.Engine)); err != nil {
+				return fmt.Errorf("creating fake sysfs engine link: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakesysfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+)
+
+func FakeSysFsNpuContents(sysfsRoot string, devfsRoot string, npus device.DevicesInfo, realDeviceFiles bool) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	return fakeSysFsNpuDevices(sysfsRoot, devfsRoot, npus, realDeviceFiles)
+}
+
+// fakeSysFsNpuDevices creates intel_vpu PCI and accel devices layout in existing fake sysfsRoot.
+func fakeSysFsNpuDevices(sysfsRoot string, devfsRoot string, npus device.DevicesInfo, realDeviceFiles bool) error {
+	sysfsAccelClassDir := path.Join(sysfsRoot, device.SysfsAccelPath)
+	if err := os.MkdirAll(sysfsAccelClassDir, 0755); err != nil {
+		return fmt.Errorf("creating fake sysfs, err: %v", err)
+	}
+
+	for _, npu := range npus {
+		// bus/pci/drivers/intel_vpu/<device> setup
+		pciDriverDevDir := path.Join(sysfsRoot, device.SysfsDriverPath, npu.PCIAddress)
+		if err := os.MkdirAll(pciDriverDevDir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		}
+
+		if writeErr := helpers.WriteFile(path.Join(pciDriverDevDir, "device"), npu.Model); writeErr != nil {
+			return fmt.Errorf("creating fake sysfs dir, err: %v", writeErr)
+		}
+
+		// bus/pci/drivers/intel_vpu/<device>/accel/<accel> setup
+		deviceName := fmt.Sprintf("accel%v", npu.DeviceIdx)
+		accelDir := path.Join(pciDriverDevDir, "accel", deviceName)
+		if err := os.MkdirAll(accelDir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs dir, err: %v", err)
+		}
+
+		// class/accel/<accel> -> ../../bus/pci/drivers/intel_vpu/<device>/accel/<accel>
+		linkTarget := path.Join("../..", device.SysfsDriverPath, npu.PCIAddress, "accel", deviceName)
+		if err := os.Symlink(linkTarget, path.Join(sysfsAccelClassDir, deviceName)); err != nil {
+			return fmt.Errorf("creating fake sysfs, err: %v", err)
+		}
+
+		if err := fakeNpuDevfs(devfsRoot, npu, realDeviceFiles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fakeNpuDevfs(devfsRoot string, npu *device.DeviceInfo, realDevices bool) error {
+	accelDevPath := path.Join(devfsRoot, device.DevfsAccelPath)
+	if err := os.MkdirAll(accelDevPath, 0755); err != nil {
+		return fmt.Errorf("creating fake devs, err: %v", err)
+	}
+
+	accelDevFile := path.Join(accelDevPath, fmt.Sprintf("accel%v", npu.DeviceIdx))
+	if realDevices {
+		if err := createDevice(accelDevFile); err != nil {
+			return fmt.Errorf("creating fake devfs, err: %v", err)
+		}
+		return nil
+	}
+
+	if err := helpers.WriteFile(accelDevFile, ""); err != nil {
+		return fmt.Errorf("creating fake devfs, err: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveFakeNpuDevice deletes PCI and accel layout of the NPU with given PCI
+// address from fake sysfs and devfs.
+func RemoveFakeNpuDevice(sysfsRoot string, devfsRoot string, pciAddress string) error {
+	if err := sanitizeFakeSysFsDir(sysfsRoot); err != nil {
+		return err
+	}
+
+	pciDriverDevDir := path.Join(sysfsRoot, device.SysfsDriverPath, pciAddress)
+	accelFiles, err := os.ReadDir(path.Join(pciDriverDevDir, "accel"))
+	if err != nil {
+		return fmt.Errorf("device %v not found: %v", pciAddress, err)
+	}
+
+	for _, accelFile := range accelFiles {
+		deviceName := accelFile.Name()
+		if err := os.Remove(path.Join(sysfsRoot, device.SysfsAccelPath, deviceName)); err != nil {
+			return fmt.Errorf("could not cleanup accel symlink: %v", err)
+		}
+		if err := os.Remove(path.Join(devfsRoot, device.DevfsAccelPath, deviceName)); err != nil {
+			return fmt.Errorf("could not cleanup accel device file: %v", err)
+		}
+	}
+
+	if err := os.RemoveAll(pciDriverDevDir); err != nil {
+		return fmt.Errorf("could not cleanup fake PCI dir %v: %v", pciDriverDevDir, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakesysfs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+)
+
+func TestFakeSysFsNpuContents(t *testing.T) {
+	testRoot := t.TempDir()
+	sysfsRoot := path.Join(testRoot, "sysfs")
+	devfsRoot := path.Join(testRoot, "dev")
+
+	npus := device.DevicesInfo{
+		"0000-00-0b-0-0x7d1d": {UID: "0000-00-0b-0-0x7d1d", PCIAddress: "0000:00:0b.0", Model: "0x7d1d", DeviceIdx: 0},
+		"0000-00-0c-0-0x643e": {UID: "0000-00-0c-0-0x643e", PCIAddress: "0000:00:0c.0", Model: "0x643e", DeviceIdx: 1},
+	}
+
+	if err := FakeSysFsNpuContents(sysfsRoot, devfsRoot, npus, false); err != nil {
+		t.Fatalf("could not create fake sysfs: %v", err)
+	}
+
+	files := map[string]string{
+		"sysfs/bus/pci/drivers/intel_vpu/0000:00:0b.0/device": "0x7d1d",
+		"sysfs/bus/pci/drivers/intel_vpu/0000:00:0c.0/device": "0x643e",
+		"dev/accel/accel0": "",
+		"dev/accel/accel1": "",
+	}
+	for file, expected := range files {
+		contents, err := os.ReadFile(path.Join(testRoot, file))
+		if err != nil {
+			t.Errorf("missing %v: %v", file, err)
+			continue
+		}
+		if strings.TrimSpace(string(contents)) != expected {
+			t.Errorf("%v: expected %q, got %q", file, expected, contents)
+		}
+	}
+
+	links := map[string]string{
+		"sysfs/class/accel/accel0": "../../bus/pci/drivers/intel_vpu/0000:00:0b.0/accel/accel0",
+		"sysfs/class/accel/accel1": "../../bus/pci/drivers/intel_vpu/0000:00:0c.0/accel/accel1",
+	}
+	for link, expected := range links {
+		target, err := os.Readlink(path.Join(testRoot, link))
+		if err != nil {
+			t.Errorf("missing symlink %v: %v", link, err)
+			continue
+		}
+		if target != expected {
+			t.Errorf("%v: expected link to %v, got %v", link, expected, target)
+		}
+		if _, err := os.Stat(path.Join(testRoot, link)); err != nil {
+			t.Errorf("%v: dangling symlink: %v", link, err)
+		}
+	}
+
+	if err := FakeSysFsNpuContents("/sys", devfsRoot, npus, false); err == nil {
+		t.Errorf("expected error for sysfs root outside of /tmp")
+	}
+}
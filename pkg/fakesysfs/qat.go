@@ -19,12 +19,15 @@ const (
 	sysfsDevicePath  = "bus/pci/devices"
 	sysfsDriverPath  = "bus/pci/drivers"
 	moduleName       = "4xxx"
+	qatDeviceID      = "0x4940"
 	vfioPCI          = "vfio-pci"
 	vfioBind         = vfioPCI + "/bind"
 	vfioUnbind       = vfioPCI + "/unbind"
 	pciDevicePattern = "????:??:??.?"
 	qatState         = "qat/state"
 	qatServices      = "qat/cfg_services"
+	qatNumRingPairs  = "qat/num_rps"
+	debugfsPath      = "kernel/debug"
 	driverOverride   = "driver_override"
 	numVFs           = "sriov_numvfs"
 	totalVFs         = "sriov_totalvfs"
@@ -39,10 +42,19 @@ type QATDevices []*PFDevice
 
 type PFDevice struct {
 	Device   string
+	DeviceID string // PCI device ID, 0x4940 (4xxx) by default
+	Driver   string // kernel driver, 4xxx by default
 	State    string
 	Services string
 	TotalVFs int
 	NumVFs   int
+	NumaNode int
+	Serial   string // PCIe device serial number as 16 hex digits, none when empty
+	// Passthrough PF device is bound to vfio-pci and has no VFs.
+	Passthrough bool
+	// NumRingPairs and FirmwareVersion are not written when unset.
+	NumRingPairs    int
+	FirmwareVersion string
 }
 
 type pcidevicefiles struct {
@@ -73,6 +85,8 @@ func pcipath(device string) string {
 	return "devices/pci" + device[0:7]
 }
 
+// FakeSysFsQATVFContents creates totalvfs VF devices of the PF device, each with
+// an IOMMU group and bound to vfio-pci, and the virtfn links of the PF device.
 func FakeSysFsQATVFContents(sysfsRoot string, pcipath string, totalvfs int, device string, iommu *int) error {
 	// ...bus/pci/devices
 	devicepath := path.Join(sysfsRoot, sysfsDevicePath)
@@ -123,17 +137,14 @@ func FakeSysFsQATVFContents(sysfsRoot string, pcipath string, totalvfs int, devi
 	return nil
 }
 
+// FakeSysFsQATContents creates a fake sysfs of QAT PF devices, with their qat
+// state and services and SR-IOV files, and their VF devices, in a fixed
+// directory which is set as SYSFS_ROOT.
 func FakeSysFsQATContents(qatdevices QATDevices) error {
 	sysfsRoot := testSysfsRoot
 	os.Setenv("SYSFS_ROOT", testSysfsRoot)
 	os.Setenv("DEVFS_ROOT", testDevfsRoot)
 
-	// ...bus/pci/drivers/<moduleName>
-	kerneldriverdir := path.Join(sysfsRoot, sysfsDriverPath, moduleName)
-	if err := os.MkdirAll(kerneldriverdir, 0755); err != nil {
-		return fmt.Errorf("creating fake sysfs driver dir: %v", err)
-	}
-
 	// ...bus/pci/drivers/vfio-pci
 	vfiopcidriverdir := path.Join(sysfsRoot, sysfsDriverPath, vfioPCI)
 	if err := os.MkdirAll(vfiopcidriverdir, 0755); err != nil {
@@ -147,7 +158,23 @@ func FakeSysFsQATContents(qatdevices QATDevices) error {
 	}
 
 	iommu := 350
+	pfiommu := 300
 	for _, pf := range qatdevices {
+		driver := pf.Driver
+		if driver == "" {
+			driver = moduleName
+		}
+		deviceID := pf.DeviceID
+		if deviceID == "" {
+			deviceID = qatDeviceID
+		}
+
+		// ...bus/pci/drivers/<driver>
+		kerneldriverdir := path.Join(sysfsRoot, sysfsDriverPath, driver)
+		if err := os.MkdirAll(kerneldriverdir, 0755); err != nil {
+			return fmt.Errorf("creating fake sysfs driver dir: %v", err)
+		}
+
 		// ...devices/pci/pcixxx:xx/xxxx:xx:xx.x
 		devicedir := path.Join(sysfsRoot, pcipath(pf.Device), pf.Device)
 		if err := os.MkdirAll(devicedir, 0755); err != nil {
@@ -159,20 +186,74 @@ func FakeSysFsQATContents(qatdevices QATDevices) error {
 			return fmt.Errorf("creating fake sysfs device driver link: %v", err)
 		}
 
-		// .../bus/pci/devices/xxxx:xx:xx.x -> ...bus/pci/drivers/<moduleName>/xxxx:xx:xx.x
-		if err := os.Symlink(devicedir, path.Join(kerneldriverdir, pf.Device)); err != nil {
+		bounddriverdir := kerneldriverdir
+		if pf.Passthrough {
+			bounddriverdir = vfiopcidriverdir
+		}
+
+		// .../bus/pci/devices/xxxx:xx:xx.x -> ...bus/pci/drivers/<driver>/xxxx:xx:xx.x
+		if err := os.Symlink(devicedir, path.Join(bounddriverdir, pf.Device)); err != nil {
 			return fmt.Errorf("creating fake sysfs device driver link: %v", err)
 		}
 
+		// ...devices/pci/pcixxx:xx/xxxx:xx:xx.x/driver -> ...bus/pci/drivers/<driver>
+		if err := os.Symlink(bounddriverdir, path.Join(devicedir, vfDriver)); err != nil {
+			return fmt.Errorf("creating fake sysfs device driver symlink: %v", err)
+		}
+
+		// ...devices/pci/pcixxx:xx/xxxx:xx:xx.x/iommu_group -> ...kernel/iommu_groups/<n>
+		pfiommu++
+		pfiommupath := path.Join(sysfsRoot, vfIOMMUpath, strconv.Itoa(pfiommu))
+		if err := os.MkdirAll(pfiommupath, 0755); err != nil {
+			return fmt.Errorf("cannot create iommu dir '%s': %v", pfiommupath, err)
+		}
+		if err := os.Symlink(pfiommupath, path.Join(devicedir, vfIOMMU)); err != nil {
+			return fmt.Errorf("creating iommu symlink of '%s': %v", pf.Device, err)
+		}
+
 		if err := writesysfsfiles(devicedir, []pcidevicefiles{
+			{"device", deviceID},
 			{numVFs, strconv.Itoa(pf.NumVFs)},
 			{totalVFs, strconv.Itoa(pf.TotalVFs)},
 			{qatState, pf.State},
 			{qatServices, pf.Services},
+			{"numa_node", strconv.Itoa(pf.NumaNode)},
 		}); err != nil {
 			return fmt.Errorf("creating fake sysfs device driver files: %v", err)
 		}
 
+		if pf.Serial != "" {
+			config, err := pciConfigWithSerial(pf.Serial)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path.Join(devicedir, "config"), config, 0600); err != nil {
+				return fmt.Errorf("creating fake sysfs device config: %v", err)
+			}
+		}
+
+		if pf.NumRingPairs > 0 {
+			if err := writesysfsfiles(devicedir, []pcidevicefiles{
+				{qatNumRingPairs, strconv.Itoa(pf.NumRingPairs)},
+			}); err != nil {
+				return fmt.Errorf("creating fake sysfs device ring pairs file: %v", err)
+			}
+		}
+
+		if pf.FirmwareVersion != "" {
+			// ...kernel/debug/qat_<driver>_xxxx:xx:xx.x
+			debugdir := path.Join(sysfsRoot, debugfsPath, fmt.Sprintf("qat_%s_%s", driver, pf.Device))
+			if err := writesysfsfiles(debugdir, []pcidevicefiles{
+				{"version/fw", pf.FirmwareVersion},
+			}); err != nil {
+				return fmt.Errorf("creating fake debugfs firmware version file: %v", err)
+			}
+		}
+
+		if pf.Passthrough {
+			continue
+		}
+
 		if err := FakeSysFsQATVFContents(sysfsRoot, pcipath(pf.Device), pf.TotalVFs, pf.Device, &iommu); err != nil {
 			return fmt.Errorf("creating fake sysfs VF files: %v", err)
 		}
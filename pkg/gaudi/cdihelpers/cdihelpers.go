@@ -19,47 +19,41 @@ package cdihelpers
 import (
 	"fmt"
 	"path"
+	"reflect"
 
 	"k8s.io/klog/v2"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
 	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
 	containerDevfsRoot = "/dev"
 )
 
-func getGaudiSpecs(cdiCache *cdiapi.Cache) []*cdiapi.Spec {
-	gaudiSpecs := []*cdiapi.Spec{}
-	for _, cdiSpec := range cdiCache.GetVendorSpecs(device.CDIVendor) {
-		if cdiSpec.Kind == device.CDIKind {
-			gaudiSpecs = append(gaudiSpecs, cdiSpec)
-		}
-	}
-	return gaudiSpecs
-}
-
 // SyncDetectedDevicesWithRegistry adds detected devices into cdi registry if they are not yet there.
 // Update existing registry devices with detected.
 // Remove absent registry devices.
-func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo, doCleanup bool) error {
-	gaudiSpecs := getGaudiSpecs(cdiCache)
+// Returns registry devices that were updated or removed.
+func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo, doCleanup bool) (helpers.CDIDrift, error) {
+	gaudiSpecs := cdiregistry.Gaudi.Specs(cdiCache)
 	if len(gaudiSpecs) == 0 {
 		klog.V(5).Infof("No existing specs found for vendor %v of kind %v, creating new", device.CDIVendor, device.CDIKind)
 
 		if err := addDevicesToNewSpec(cdiCache, detectedDevices); err != nil {
-			return fmt.Errorf("failed adding devices to new CID spec: %v", err)
+			return helpers.CDIDrift{}, fmt.Errorf("failed adding devices to new CID spec: %v", err)
 		}
 
-		return nil
+		return helpers.CDIDrift{}, nil
 	}
 
-	devicesToAdd, err := updateDevicesInSpecsAndWrite(cdiCache, detectedDevices, gaudiSpecs)
+	devicesToAdd, drift, err := updateDevicesInSpecsAndWrite(cdiCache, detectedDevices, gaudiSpecs)
 	if err != nil {
-		return fmt.Errorf("failed updating CDI specs: %v", err)
+		return drift, fmt.Errorf("failed updating CDI specs: %v", err)
 	}
 
 	if len(devicesToAdd) > 0 {
@@ -68,21 +62,23 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 
 		klog.V(5).Infof("Adding %d new devices to CDI spec", len(devicesToAdd))
 
-		return addDevicesToSpecAndWrite(cdiCache, devicesToAdd, apispec.Spec, specName)
+		return drift, addDevicesToSpecAndWrite(cdiCache, devicesToAdd, apispec.Spec, specName)
 	}
 
-	return nil
+	return drift, nil
 }
 
 // updateDevicesInSpecsAndWrite updates existing devices with potentially new data in devicesToAdd
-// and returns leftover devices that were not found in spec and need plain adding.
-func updateDevicesInSpecsAndWrite(cdCache *cdiapi.Cache, devicesToAdd device.DevicesInfo, vendorSpecs []*cdiapi.Spec) (device.DevicesInfo, error) {
+// and returns leftover devices that were not found in spec and need plain adding,
+// along with the spec devices that had to be fixed or removed.
+func updateDevicesInSpecsAndWrite(cdCache *cdiapi.Cache, devicesToAdd device.DevicesInfo, vendorSpecs []*cdiapi.Spec) (device.DevicesInfo, helpers.CDIDrift, error) {
 	// loop through each Gaudi spec's devices
 	// - remove from spec not detected devices
 	// - update found devices with accel and accel_controlD indexes
 	//   - delete from devicesToAdd so they are not added as duplicates
 	// - write spec
 	// add rest of detected devices to first vendor spec
+	drift := helpers.CDIDrift{}
 	devices := devicesToAdd.DeepCopy()
 	for specIdx, vendorSpec := range vendorSpecs {
 		if vendorSpec.Kind != device.CDIKind {
@@ -100,7 +96,11 @@ func updateDevicesInSpecsAndWrite(cdCache *cdiapi.Cache, devicesToAdd device.Dev
 			if detectedDevice, found := devices[specDevice.Name]; found {
 
 				// always update the device nodes
-				specDevice.ContainerEdits.DeviceNodes = newContainerEditsDeviceNodes(detectedDevice.DeviceIdx)
+				deviceNodes := newContainerEditsDeviceNodes(detectedDevice.DeviceIdx)
+				if !reflect.DeepEqual(specDevice.ContainerEdits.DeviceNodes, deviceNodes) {
+					drift.Fixed = append(drift.Fixed, specDevice.Name)
+				}
+				specDevice.ContainerEdits.DeviceNodes = deviceNodes
 				filteredDevices = append(filteredDevices, specDevice)
 				// Regardless if we needed to update the existing device or not,
 				// it is in CDI registry so no need to add it again later.
@@ -108,6 +108,10 @@ func updateDevicesInSpecsAndWrite(cdCache *cdiapi.Cache, devicesToAdd device.Dev
 			} else {
 				// skip CDI devices that were not detected
 				klog.V(5).Infof("Removing device %v from CDI registry", specDevice.Name)
+				// Per-claim devices only have env vars, they are not drift.
+				if len(specDevice.ContainerEdits.DeviceNodes) != 0 {
+					drift.Removed = append(drift.Removed, specDevice.Name)
+				}
 			}
 		}
 
@@ -115,11 +119,49 @@ func updateDevicesInSpecsAndWrite(cdCache *cdiapi.Cache, devicesToAdd device.Dev
 		specName := path.Base(vendorSpec.GetPath())
 		klog.V(5).Infof("Updating spec %v", specName)
 		if err := writeSpec(cdCache, vendorSpec.Spec, specName); err != nil {
-			return nil, fmt.Errorf("failed to save CDI spec %v: %v", specName, err)
+			return nil, drift, fmt.Errorf("failed to save CDI spec %v: %v", specName, err)
 		}
 	}
 
-	return devices, nil
+	return devices, drift, nil
+}
+
+// WriteDevices updates device nodes of the CDI devices to match the given
+// Gaudi devices, and adds devices which are not in any spec to the first
+// vendor spec. Unlike SyncDetectedDevicesWithRegistry, other CDI devices,
+// including the per-claim devices, are kept.
+func WriteDevices(cdiCache *cdiapi.Cache, devices device.DevicesInfo) error {
+	gaudiSpecs := cdiregistry.Gaudi.Specs(cdiCache)
+	if len(gaudiSpecs) == 0 {
+		return addDevicesToNewSpec(cdiCache, devices)
+	}
+
+	devicesToAdd := devices.DeepCopy()
+	for _, vendorSpec := range gaudiSpecs {
+		updated := false
+		for specDeviceIdx, specDevice := range vendorSpec.Devices {
+			gaudi, found := devicesToAdd[specDevice.Name]
+			if !found {
+				continue
+			}
+
+			vendorSpec.Devices[specDeviceIdx].ContainerEdits.DeviceNodes = newContainerEditsDeviceNodes(gaudi.DeviceIdx)
+			delete(devicesToAdd, specDevice.Name)
+			updated = true
+		}
+
+		if updated {
+			if err := writeSpec(cdiCache, vendorSpec.Spec, path.Base(vendorSpec.GetPath())); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(devicesToAdd) == 0 {
+		return nil
+	}
+
+	return addDevicesToSpecAndWrite(cdiCache, devicesToAdd, gaudiSpecs[0].Spec, path.Base(gaudiSpecs[0].GetPath()))
 }
 
 func AddDeviceToAnySpec(cdiCache *cdiapi.Cache, vendor string, newDevice cdiSpecs.Device) error {
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdihelpers_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+// TestCDISpecsGolden generates CDI specs from fake sysfs for Gaudi setups and
+// compares them with testdata/<name>.yaml.
+func TestCDISpecsGolden(t *testing.T) {
+	gaudi2 := device.DevicesInfo{
+		"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, ModuleIdx: 2, UID: "0000-0f-00-0-0x1020"},
+		"0000-1a-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, ModuleIdx: 3, UID: "0000-1a-00-0-0x1020"},
+	}
+
+	testcases := []struct {
+		name        string
+		namingStyle string
+		devices     device.DevicesInfo
+	}{
+		{name: "gaudi2-machine", namingStyle: device.DefaultNamingStyle, devices: gaudi2},
+		{name: "gaudi2-classic", namingStyle: "classic", devices: gaudi2},
+		{
+			name:        "gaudi3",
+			namingStyle: device.DefaultNamingStyle,
+			devices: device.DevicesInfo{
+				"0000-33-00-0-0x1060": {Model: "0x1060", PCIAddress: "0000:33:00.0", DeviceIdx: 0, ModuleIdx: 0, UID: "0000-33-00-0-0x1060"},
+				"0000-4d-00-0-0x1060": {Model: "0x1060", PCIAddress: "0000:4d:00.0", DeviceIdx: 1, ModuleIdx: 1, UID: "0000-4d-00-0-0x1060"},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			testDirs, err := helpers.NewTestDirs(device.DriverName)
+			if err != nil {
+				t.Fatalf("could not create fake system dirs: %v", err)
+			}
+			defer os.RemoveAll(testDirs.TestRoot)
+			t.Setenv(device.DevfsEnvVarName, testDirs.DevfsRoot)
+
+			if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, testcase.devices, false); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(testDirs.CdiRoot), cdiapi.WithAutoRefresh(false))
+			if err != nil {
+				t.Fatalf("could not create CDI cache: %v", err)
+			}
+
+			detected := discovery.DiscoverDevices(testDirs.SysfsRoot, testcase.namingStyle)
+			if len(detected) != len(testcase.devices) {
+				t.Fatalf("expected %d devices, detected %d: %v", len(testcase.devices), len(detected), detected)
+			}
+			if _, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detected, true); err != nil {
+				t.Fatalf("could not write CDI specs: %v", err)
+			}
+
+			specs, err := helpers.GoldenCDISpecs(testDirs.CdiRoot, testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			helpers.CompareGolden(t, path.Join("testdata", testcase.name+".yaml"), specs)
+		})
+	}
+}
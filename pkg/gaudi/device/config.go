@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConfigAPIVersion = "gaudi.intel.com/v1alpha1"
+	ConfigKind       = "GaudiConfig"
+
+	// SharingShared lets all consumers of the ResourceClaim use its Gaudi
+	// accelerators, the default.
+	SharingShared = "shared"
+	// SharingExclusive restricts the Gaudi accelerators of the ResourceClaim
+	// to a single consumer.
+	SharingExclusive = "exclusive"
+)
+
+// GaudiConfig is the opaque device configuration accepted in ResourceClaims
+// and DeviceClasses.
+type GaudiConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	// Sharing is either shared or exclusive.
+	Sharing string `json:"sharing,omitempty"`
+}
+
+// DecodeGaudiConfig parses and validates opaque device configuration parameters.
+func DecodeGaudiConfig(parameters []byte) (*GaudiConfig, error) {
+	config := &GaudiConfig{}
+
+	decoder := json.NewDecoder(bytes.NewReader(parameters))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("could not parse device configuration: %v", err)
+	}
+
+	if config.APIVersion != ConfigAPIVersion || config.Kind != ConfigKind {
+		return nil, fmt.Errorf("unsupported device configuration '%s/%s', expected '%s/%s'",
+			config.APIVersion, config.Kind, ConfigAPIVersion, ConfigKind)
+	}
+
+	switch config.Sharing {
+	case "":
+		config.Sharing = SharingShared
+	case SharingShared, SharingExclusive:
+	default:
+		return nil, fmt.Errorf("unsupported sharing mode %q, expected %v or %v", config.Sharing, SharingShared, SharingExclusive)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"testing"
+)
+
+func TestDecodeGaudiConfig(t *testing.T) {
+	testcases := []struct {
+		name       string
+		parameters string
+		sharing    string
+		pass       bool
+	}{
+		{"exclusive", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "sharing": "exclusive"}`, SharingExclusive, true},
+		{"shared", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "sharing": "shared"}`, SharingShared, true},
+		{"no settings", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig"}`, SharingShared, true},
+		{"wrong kind", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GpuConfig"}`, "", false},
+		{"unknown field", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "timeSlicing": {}}`, "", false},
+		{"unknown sharing", `{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "sharing": "time-sliced"}`, "", false},
+	}
+
+	for _, testcase := range testcases {
+		config, err := DecodeGaudiConfig([]byte(testcase.parameters))
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+			continue
+		}
+		if err == nil && config.Sharing != testcase.sharing {
+			t.Errorf("%v: expected sharing %v, got %v", testcase.name, testcase.sharing, config.Sharing)
+		}
+	}
+}
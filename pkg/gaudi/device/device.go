@@ -21,11 +21,14 @@ import (
 	"os"
 	"path"
 	"regexp"
-	"strings"
+	"slices"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
 )
 
 var (
-	PciRegexp          = regexp.MustCompile(`[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+	PciRegexp          = pci.AddressRegexp
 	AccelRegexp        = regexp.MustCompile(`^accel[0-9]+$`)
 	AccelControlRegexp = regexp.MustCompile(`^accel_controlD[0-9]+$`)
 	ModelNames         = map[string]string{
@@ -42,6 +45,9 @@ var (
 )
 
 const (
+	// StatusOperational is the status of a healthy device in its status sysfs file.
+	StatusOperational = "operational"
+
 	DevfsEnvVarName  = "DEVFS_ROOT"
 	devfsDefaultRoot = "/dev"
 	DevfsAccelPath   = "accel"
@@ -54,11 +60,11 @@ const (
 	SysfsDriverPath = "bus/pci/drivers/habanalabs"
 	SysfsAccelPath  = "devices/virtual/accel/"
 
-	CDIVendor        = "intel.com"
-	CDIClass         = "gaudi"
+	CDIVendor        = cdiregistry.Vendor
+	CDIClass         = cdiregistry.GaudiClass
 	CDIKind          = CDIVendor + "/" + CDIClass
 	DriverName       = CDIClass + "." + CDIVendor
-	PCIAddressLength = len("0000:00:00.0")
+	PCIAddressLength = pci.AddressLength
 
 	PreparedClaimsFileName  = "preparedClaims.json"
 	PluginRegistrarFileName = DriverName + ".sock"
@@ -66,6 +72,9 @@ const (
 
 	DefaultNamingStyle       = "machine"
 	VisibleDevicesEnvVarName = "HABANA_VISIBLE_DEVICES"
+	// ScaleOutInterfacesEnvVarName lists network interfaces of the scale-out
+	// ports of the claim's devices.
+	ScaleOutInterfacesEnvVarName = "GAUDI_SCALE_OUT_INTERFACES"
 )
 
 // DeviceInfo is an internal structure type to store info about discovered device.
@@ -79,6 +88,10 @@ type DeviceInfo struct {
 	DeviceIdx  uint64 `json:"deviceidx"`  // accel device number (e.g. 0 for /dev/accel/accel0)
 	ModuleIdx  uint64 `json:"moduleidx"`  // OAM slot number, needed for Habana Runtime to set networking
 	PCIRoot    string `json:"pciroot"`    // PCI Root complex ID
+	NUMANode   int64  `json:"numanode"`   // NUMA node of the device, -1 when not reported by the platform
+	// ScaleOutPorts are network interfaces of the external ports, which are not
+	// connected to other Gaudi modules in the server.
+	ScaleOutPorts []string `json:"scaleoutports,omitempty"`
 }
 
 func (g DeviceInfo) CDIName() string {
@@ -87,6 +100,7 @@ func (g DeviceInfo) CDIName() string {
 
 func (g *DeviceInfo) DeepCopy() *DeviceInfo {
 	di := *g
+	di.ScaleOutPorts = slices.Clone(g.ScaleOutPorts)
 	return &di
 }
 
@@ -100,20 +114,12 @@ func (g *DeviceInfo) SetModelName() {
 
 func DeviceUIDFromPCIinfo(pciAddress string, pciid string) string {
 	// 0000:00:01.0, 0x0000 -> 0000-00-01-0-0x0000
-	// Replace colons and the dot in PCI address with hyphens.
-	rfc1123PCIaddress := strings.ReplaceAll(strings.ReplaceAll(pciAddress, ":", "-"), ".", "-")
-	newUID := fmt.Sprintf("%v-%v", rfc1123PCIaddress, pciid)
-
-	return newUID
+	return pci.DeviceUID(pciAddress, pciid)
 }
 
 func PciInfoFromDeviceUID(deviceUID string) (string, string) {
 	// 0000-00-01-0-0x0000 -> 0000:00:01.0, 0x0000
-	rfc1123PCIaddress := deviceUID[:PCIAddressLength]
-	pciAddress := strings.Replace(strings.Replace(rfc1123PCIaddress, "-", ":", 2), "-", ".", 1)
-	deviceId := deviceUID[PCIAddressLength:]
-
-	return pciAddress, deviceId
+	return pci.ParseDeviceUID(deviceUID)
 }
 
 // DevicesInfo is a dictionary with DeviceInfo.uid being the key.
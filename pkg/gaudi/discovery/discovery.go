@@ -19,11 +19,11 @@ package discovery
 import (
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
 
 	"k8s.io/klog/v2"
 )
@@ -36,38 +36,34 @@ type gaudiIndexesType struct {
 // Detect devices from sysfs.
 func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo {
 
+	sysfs := pci.NewSysfs(sysfsDir)
 	sysfsDriverDir := path.Join(sysfsDir, device.SysfsDriverPath)
 	sysfsAccelDir := path.Join(sysfsDir, device.SysfsAccelPath)
 
 	devices := make(map[string]*device.DeviceInfo)
 
-	driverDirFiles, err := os.ReadDir(sysfsDriverDir)
+	pciAddresses, err := sysfs.DriverDevices(path.Base(device.SysfsDriverPath))
 	if err != nil {
-		if err == os.ErrNotExist {
-			klog.V(5).Infof("No Intel Gaudi devices found on this host. %v does not exist", sysfsDriverDir)
-			return devices
-		}
-		klog.Errorf("could not read sysfs directory %v: %v", sysfsAccelDir, err)
+		klog.Error(err)
+		return devices
+	}
+
+	if len(pciAddresses) == 0 {
+		klog.V(5).Infof("No Intel Gaudi devices found on this host in %v", sysfsDriverDir)
 		return devices
 	}
 
 	deviceIndexes := getAccelIndexes(sysfsAccelDir)
 
-	for _, pciAddress := range driverDirFiles {
-		devicePCIAddress := pciAddress.Name()
-		// check if file is PCI device
-		if !device.PciRegexp.MatchString(devicePCIAddress) {
-			continue
-		}
+	for _, devicePCIAddress := range pciAddresses {
 		klog.V(5).Infof("Found Gaudi PCI device: %s", devicePCIAddress)
 
-		deviceIdFile := path.Join(sysfsDriverDir, devicePCIAddress, "device")
-		deviceIdBytes, err := os.ReadFile(deviceIdFile)
+		deviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
+		deviceId, err := sysfs.DeviceID(deviceDir)
 		if err != nil {
-			klog.Errorf("Failed reading device file (%s): %+v", deviceIdFile, err)
+			klog.Errorf("Failed reading device file of %s: %+v", devicePCIAddress, err)
 			continue
 		}
-		deviceId := strings.TrimSpace(string(deviceIdBytes))
 		uid := device.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
 		klog.V(5).Infof("New gaudi UID: %v", uid)
 		newDeviceInfo := &device.DeviceInfo{
@@ -88,20 +84,18 @@ func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo
 		newDeviceInfo.ModuleIdx = deviceIdx.moduleIdx
 
 		klog.V(5).Infof("Parsing PCI root complex ID for %v", newDeviceInfo.UID)
-		link := path.Join(sysfsDriverDir, devicePCIAddress)
-		// e.g. /sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/0000:18:00.0/0000:19:00.0
-		linkTarget, err := filepath.EvalSymlinks(link)
+		pciRoot, err := sysfs.PCIRoot(deviceDir)
 		if err != nil {
-			klog.Errorf("Could not determine PCI root complex ID from '%v': %v", link, err)
-		} else {
-			klog.V(5).Infof("PCI device location: %v", linkTarget)
-			parts := strings.Split(linkTarget, "/")
-			if len(parts) > 3 && parts[0] == "" && parts[2] == "devices" {
-				newDeviceInfo.PCIRoot = strings.Replace(parts[3], "pci0000:", "", 1)
-			} else {
-				klog.Warningf("could not parse sysfs link target %v: %v", linkTarget, parts)
-			}
+			klog.Warningf("Could not determine PCI root complex ID of %v: %v", devicePCIAddress, err)
+		}
+		newDeviceInfo.PCIRoot = pciRoot
+
+		numaNode, err := sysfs.NUMANode(deviceDir)
+		if err != nil {
+			klog.Warningf("Could not determine NUMA node of %v: %v", devicePCIAddress, err)
 		}
+		newDeviceInfo.NUMANode = numaNode
+		newDeviceInfo.ScaleOutPorts = getScaleOutPorts(deviceDir)
 
 		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
 	}
@@ -109,6 +103,31 @@ func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo
 	return devices
 }
 
+// getScaleOutPorts returns sorted names of network interfaces of the device
+// which are not scale-up ports, i.e. have no peer module.
+func getScaleOutPorts(deviceDir string) []string {
+	netDir := path.Join(deviceDir, "net")
+	netFiles, err := os.ReadDir(netDir)
+	if err != nil {
+		klog.V(5).Infof("No network interfaces found for %v: %v", path.Base(deviceDir), err)
+		return nil
+	}
+
+	ports := []string{}
+	for _, netFile := range netFiles {
+		if _, err := os.Stat(path.Join(netDir, netFile.Name(), "peer_module_id")); err == nil {
+			continue
+		}
+		ports = append(ports, netFile.Name())
+	}
+
+	if len(ports) == 0 {
+		return nil
+	}
+
+	return ports
+}
+
 func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
 	if namingStyle == "classic" {
 		return "accel" + strconv.FormatUint(info.DeviceIdx, 10)
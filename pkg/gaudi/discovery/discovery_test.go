@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestDiscoverDevices(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, ModuleIdx: 2, UID: "0000-0f-00-0-0x1020"},
+			"0000-1a-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, ModuleIdx: 3, UID: "0000-1a-00-0-0x1020", PCIRoot: "16", NUMANode: 1},
+			"0000-33-00-0-0x1060": {Model: "0x1060", PCIAddress: "0000:33:00.0", DeviceIdx: 2, ModuleIdx: 0, UID: "0000-33-00-0-0x1060"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	expected := map[string]struct {
+		accelIdx  uint64
+		moduleIdx uint64
+		pciRoot   string
+		numaNode  int64
+	}{
+		"0000-0f-00-0-0x1020": {0, 2, "0f", 0},
+		"0000-1a-00-0-0x1020": {1, 3, "16", 1},
+		"0000-33-00-0-0x1060": {2, 0, "33", 0},
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+	if len(detected) != len(expected) {
+		t.Fatalf("expected %d devices, detected %d: %v", len(expected), len(detected), detected)
+	}
+
+	for uid, want := range expected {
+		gaudi, found := detected[uid]
+		if !found {
+			t.Errorf("device %v was not detected", uid)
+			continue
+		}
+		if gaudi.DeviceIdx != want.accelIdx || gaudi.ModuleIdx != want.moduleIdx || gaudi.PCIRoot != want.pciRoot || gaudi.NUMANode != want.numaNode || gaudi.ModelName == "Unknown" {
+			t.Errorf("device %v: expected accel%d, module %d, PCI root %v, NUMA node %d, got %+v", uid, want.accelIdx, want.moduleIdx, want.pciRoot, want.numaNode, gaudi)
+		}
+	}
+
+	classic := discovery.DiscoverDevices(testDirs.SysfsRoot, "classic")
+	if gaudi, found := classic["accel1"]; !found || gaudi.UID != "0000-1a-00-0-0x1020" {
+		t.Errorf("device not named by accel index with classic naming: %v", classic)
+	}
+
+	if err := fakesysfs.RemoveFakeGaudiDevice(testDirs.SysfsRoot, testDirs.DevfsRoot, "0000:1a:00.0"); err != nil {
+		t.Fatalf("could not remove fake device: %v", err)
+	}
+	detected = discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+	if _, found := detected["0000-1a-00-0-0x1020"]; found || len(detected) != len(expected)-1 {
+		t.Errorf("removed device still detected: %v", detected)
+	}
+}
+
+func TestReadTelemetry(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"},
+			"0000-1a-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, UID: "0000-1a-00-0-0x1020"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+	if err := fakesysfs.FakeGaudiHwmon(testDirs.SysfsRoot, "0000:0f:00.0", 45500, 150000000); err != nil {
+		t.Fatalf("setup error: could not create fake hwmon: %v", err)
+	}
+
+	temperature, power := discovery.ReadTelemetry(testDirs.SysfsRoot, "0000:0f:00.0")
+	if temperature == nil || *temperature != 45.5 || power == nil || *power != 150 {
+		t.Errorf("expected 45.5 C and 150 W, got %v C and %v W", temperature, power)
+	}
+
+	temperature, power = discovery.ReadTelemetry(testDirs.SysfsRoot, "0000:1a:00.0")
+	if temperature != nil || power != nil {
+		t.Errorf("expected no telemetry without hwmon device, got %v C and %v W", temperature, power)
+	}
+}
+
+func TestDiscoverScaleOutPorts(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1060": {Model: "0x1060", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, ModuleIdx: 0, UID: "0000-0f-00-0-0x1060"},
+			"0000-1a-00-0-0x1060": {Model: "0x1060", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, ModuleIdx: 1, UID: "0000-1a-00-0-0x1060"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	peerModule := uint64(1)
+	if err := fakesysfs.FakeGaudiPorts(testDirs.SysfsRoot, "0000:0f:00.0", []fakesysfs.GaudiPort{
+		{Index: 0, PeerModuleIdx: &peerModule, Up: true},
+		{Index: 1, Up: true},
+		{Index: 2, Up: false},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake ports: %v", err)
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+	if ports := detected["0000-0f-00-0-0x1060"].ScaleOutPorts; !slices.Equal(ports, []string{"hbl_1", "hbl_2"}) {
+		t.Errorf("expected scale-out ports hbl_1 and hbl_2, got %v", ports)
+	}
+	if ports := detected["0000-1a-00-0-0x1060"].ScaleOutPorts; len(ports) != 0 {
+		t.Errorf("expected no scale-out ports on device without network interfaces, got %v", ports)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+)
+
+// DeviceStatus returns the status reported by the habanalabs driver for the
+// Gaudi with given PCI address, e.g. "operational" or "needs reset".
+func DeviceStatus(sysfsDir string, pciAddress string) (string, error) {
+	dat, err := os.ReadFile(path.Join(sysfsDir, device.SysfsDriverPath, pciAddress, "status"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(dat)), nil
+}
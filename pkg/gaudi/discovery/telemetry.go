@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+)
+
+const (
+	hwmonTemperatureFile = "temp1_input"  // millidegrees Celsius
+	hwmonPowerFile       = "power1_input" // microwatts
+)
+
+// ReadTelemetry returns temperature in degrees Celsius and power in watts of
+// the Gaudi with given PCI address, read from the hwmon device of the
+// habanalabs driver, nil when not available. Memory usage and ECC counters
+// are not exposed in sysfs.
+func ReadTelemetry(sysfsDir string, pciAddress string) (temperatureCelsius *float64, powerWatts *float64) {
+	hwmonDirs, _ := filepath.Glob(path.Join(sysfsDir, device.SysfsDriverPath, pciAddress, "hwmon", "hwmon*"))
+	if len(hwmonDirs) == 0 {
+		klog.V(5).Infof("no hwmon device found for Gaudi %v", pciAddress)
+		return nil, nil
+	}
+
+	return readHwmonValue(hwmonDirs[0], hwmonTemperatureFile, 1000), readHwmonValue(hwmonDirs[0], hwmonPowerFile, 1000000)
+}
+
+// readHwmonValue returns the value of the hwmon file divided by scale, nil
+// when it cannot be read.
+func readHwmonValue(hwmonDir string, file string, scale float64) *float64 {
+	filePath := path.Join(hwmonDir, file)
+	dat, err := os.ReadFile(filePath)
+	if err != nil {
+		klog.V(5).Infof("could not read %v: %v", filePath, err)
+		return nil
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(string(dat)), 10, 64)
+	if err != nil {
+		klog.V(5).Infof("could not parse %v: %v", filePath, err)
+		return nil
+	}
+
+	scaled := float64(value) / scale
+	return &scaled
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	coreclientset "k8s.io/client-go/kubernetes"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const (
+	DefaultCDIRoot                   = helpers.DefaultCDIRoot
+	DefaultKubeletPluginDir          = helpers.DefaultKubeletPluginsDir + device.DriverName
+	DefaultKubeletPluginsRegistryDir = helpers.DefaultKubeletPluginsRegistryDir
+
+	// deviceCheckInterval is how often devices are rediscovered, and with
+	// health monitoring enabled, their status is checked.
+	deviceCheckInterval = 10 * time.Second
+)
+
+type configType struct {
+	clientset                 coreclientset.Interface
+	cdiRoot                   string
+	kubeletPluginDir          string
+	kubeletPluginsRegistryDir string
+	nodeName                  string
+	httpEndpoint              string
+	pprofPath                 string
+	auditLog                  string
+	telemetry                 bool
+	healthMonitoring          bool
+	cdiDriftEvents            bool
+	// startPlugin starts the kubelet plugin, helpers.StartPlugin if nil.
+	startPlugin helpers.StartPluginFunc
+}
+
+// gaudiFlags are the command line flags specific to the Gaudi kubelet plugin.
+type gaudiFlags struct {
+	telemetry        bool
+	healthMonitoring bool
+	cdiDriftEvents   bool
+}
+
+func (f *gaudiFlags) add(fs *pflag.FlagSet) {
+	fs.BoolVar(&f.telemetry, "telemetry", false,
+		"Export temperature and power of Gaudi devices as metrics, read from their hwmon devices on every scrape. Requires --http-endpoint.")
+	fs.BoolVar(&f.healthMonitoring, "health-monitoring", false,
+		"Check the status of Gaudi devices periodically, and withdraw devices which are not operational from allocation until they recover.")
+}
+
+// NewCommand returns the command running the Gaudi kubelet plugin.
+func NewCommand(use string) *cobra.Command {
+	gaudiflags := &gaudiFlags{}
+
+	return helpers.NewApp(use, "Intel Gaudi resource-driver kubelet plugin",
+		func(ctx context.Context, flags *helpers.AppFlags) error {
+			return run(ctx, flags, gaudiflags)
+		},
+		gaudiflags.add,
+		helpers.CDIDriftEventsFlag(&gaudiflags.cdiDriftEvents))
+}
+
+func run(ctx context.Context, flags *helpers.AppFlags, gaudiflags *gaudiFlags) error {
+	coreclient, err := flags.NewKubeClient()
+	if err != nil {
+		return err
+	}
+
+	config := &configType{
+		nodeName:                  flags.NodeNameOrDefault("127.0.0.1"),
+		clientset:                 coreclient,
+		cdiRoot:                   flags.CDIDirOrDefault(DefaultCDIRoot),
+		kubeletPluginDir:          path.Join(flags.KubeletPluginsDir(), device.DriverName),
+		kubeletPluginsRegistryDir: flags.KubeletPluginsRegistryDir(),
+		httpEndpoint:              *flags.HTTPEndpoint,
+		pprofPath:                 *flags.PprofPath,
+		auditLog:                  *flags.AuditLog,
+		telemetry:                 gaudiflags.telemetry,
+		healthMonitoring:          gaudiflags.healthMonitoring,
+		cdiDriftEvents:            gaudiflags.cdiDriftEvents,
+	}
+
+	return callPlugin(ctx, config)
+}
+
+func callPlugin(ctx context.Context, config *configType) error {
+	if err := os.MkdirAll(config.kubeletPluginDir, 0750); err != nil {
+		return fmt.Errorf("failed to create plugin dir: %v", err)
+	}
+
+	driver, err := newDriver(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	if config.httpEndpoint != "" {
+		if err := startHTTPEndpoint(config, driver); err != nil {
+			return err
+		}
+	}
+
+	helpers.WaitForStopSignal()
+
+	if err := driver.Shutdown(ctx); err != nil {
+		klog.FromContext(ctx).Error(err, "could not stop DRA driver gracefully")
+		return err
+	}
+
+	return nil
+}
+
+// startHTTPEndpoint serves the liveness and readiness checks and metrics of
+// the plugin, and optionally the profiling data.
+func startHTTPEndpoint(config *configType, driver *driver) error {
+	mux := http.NewServeMux()
+	mux.Handle(helpers.HealthzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegistrationCheck(driver.plugin),
+		"cdi":          helpers.WritableDirCheck(config.cdiRoot),
+	})
+	mux.Handle(helpers.ReadyzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegisteredCheck(driver.plugin),
+		"cdi":          helpers.WritableDirCheck(config.cdiRoot),
+	})
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(
+		helpers.NewDeviceUsageCollector("intel_gaudi", driver.state.DeviceUsage),
+		helpers.NewCDIDriftCollector("intel_gaudi", driver.state.CDIDrift),
+		helpers.NewUnhealthyDevicesCollector("intel_gaudi", driver.state.Unhealthy))
+	if config.telemetry {
+		registry.CustomMustRegister(helpers.NewDeviceTelemetryCollector("intel_gaudi", driver.deviceTelemetry))
+	}
+	mux.Handle(helpers.MetricsPath, metrics.HandlerFor(registry, metrics.HandlerOpts{}))
+
+	if config.pprofPath != "" {
+		helpers.AddPprofHandlers(mux, config.pprofPath)
+	}
+
+	return helpers.ServeHTTPEndpoint(config.httpEndpoint, mux)
+}
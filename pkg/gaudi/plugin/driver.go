@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
+)
+
+// compile-time test for implementation conformance with the interface.
+var _ drav1.DRAPluginServer = (*driver)(nil)
+
+type driver struct {
+	client   coreclientset.Interface
+	state    *nodeState
+	sysfsDir string
+	plugin   kubeletplugin.DRAPlugin
+	recorder record.EventRecorder
+	audit    *helpers.AuditLogger
+	retrier  *helpers.UnprepareRetrier
+}
+
+func newDriver(ctx context.Context, config *configType) (*driver, error) {
+	driverVersion.PrintDriverVersion(device.DriverName)
+	sysfsDir := device.GetSysfsRoot()
+	preparedClaimsFilePath := path.Join(config.kubeletPluginDir, device.PreparedClaimsFileName)
+
+	detectedDevices := discovery.DiscoverDevices(sysfsDir, device.DefaultNamingStyle)
+	if len(detectedDevices) == 0 {
+		klog.Info("No supported devices detected")
+	}
+
+	klog.V(3).Info("Creating new NodeState")
+	state, err := newNodeState(ctx, detectedDevices, config.cdiRoot, preparedClaimsFilePath, config.nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new NodeState: %v", err)
+	}
+
+	d := &driver{
+		state:    state,
+		sysfsDir: sysfsDir,
+		client:   config.clientset,
+		recorder: helpers.NewEventRecorder(config.clientset, device.DriverName, config.nodeName),
+	}
+
+	if config.auditLog != "" {
+		if d.audit, err = helpers.NewAuditLogger(config.auditLog, device.DriverName, config.nodeName); err != nil {
+			return nil, err
+		}
+	}
+
+	d.retrier = helpers.NewUnprepareRetrier(func(ctx context.Context, claim *drav1.Claim) error {
+		return d.state.FreeClaimDevices(claim.UID)
+	}, d.recorder)
+
+	if d.state.checkpointLost {
+		klog.Info("Prepared claims file was lost, recovering prepared claims")
+		if err := helpers.RecoverPreparedClaims(ctx, config.clientset, device.DriverName, config.nodeName, d.state.Prepare); err != nil {
+			klog.Errorf("could not recover prepared claims: %v", err)
+		}
+	}
+
+	d.reportMissingPreparedDevices(config.nodeName)
+	helpers.ReportCDIDrift(d.recorder, config.nodeName, d.state.CDIDrift(), config.cdiDriftEvents)
+
+	helpers.ReportNoDevices(d.recorder, config.nodeName, len(detectedDevices))
+
+	opts := helpers.PluginOptions{
+		DriverName:          device.DriverName,
+		NodeName:            config.nodeName,
+		Clientset:           config.clientset,
+		RegistrarSocketPath: path.Join(config.kubeletPluginsRegistryDir, device.PluginRegistrarFileName),
+		PluginSocketPath:    path.Join(config.kubeletPluginDir, device.PluginSocketFileName),
+	}
+
+	startPlugin := config.startPlugin
+	if startPlugin == nil {
+		startPlugin = helpers.StartPlugin
+	}
+	if d.plugin, err = startPlugin(ctx, d, opts, d.state.GetResources()); err != nil {
+		return nil, err
+	}
+
+	go d.retrier.Run(ctx, helpers.UnprepareRetryInterval)
+
+	go d.monitorDevices(ctx, config.nodeName, deviceCheckInterval, config.healthMonitoring)
+
+	klog.V(3).Info("Finished creating new driver")
+	return d, nil
+}
+
+func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepareResourcesRequest) (*drav1.NodePrepareResourcesResponse, error) {
+	klog.V(5).Infof("NodePrepareResource is called: request: %+v", req)
+
+	preparedResources := &drav1.NodePrepareResourcesResponse{Claims: map[string]*drav1.NodePrepareResourceResponse{}}
+
+	for _, claim := range req.Claims {
+		preparedResources.Claims[claim.UID] = d.nodePrepareResource(ctx, claim)
+		d.audit.LogPrepare(claim, preparedResources.Claims[claim.UID])
+	}
+
+	return preparedResources, nil
+}
+
+func (d *driver) nodePrepareResource(ctx context.Context, claim *drav1.Claim) *drav1.NodePrepareResourceResponse {
+	klog.V(5).Infof("NodePrepareResource is called: request: %+v", claim)
+
+	if claimPreparation, found := d.state.PreparedDevices(claim.UID); found {
+		klog.V(3).Infof("Claim %s was already prepared, nothing to do", claim.UID)
+		return &drav1.NodePrepareResourceResponse{
+			Devices: claimPreparation,
+		}
+	}
+
+	resourceClaim, err := d.client.ResourceV1beta1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		return helpers.PrepareFailed(d.recorder, claim, fmt.Sprintf("could not find ResourceClaim %s in namespace %s: %v", claim.Name, claim.Namespace, err))
+	}
+
+	if err := d.state.Prepare(ctx, resourceClaim); err != nil {
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
+	}
+
+	claimPreparation, _ := d.state.PreparedDevices(claim.UID)
+	return &drav1.NodePrepareResourceResponse{Devices: claimPreparation}
+}
+
+// reportMissingPreparedDevices records a Warning Event on the Node for every
+// checkpointed claim preparation referring to a device that is no longer present.
+func (d *driver) reportMissingPreparedDevices(nodeName string) {
+	for claimUID, deviceNames := range d.state.MissingPreparedDevices() {
+		for _, deviceName := range deviceNames {
+			klog.Warningf("prepared device %v of claim %v is no longer available", deviceName, claimUID)
+			d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.PreparedDeviceMissingReason,
+				"device %v prepared for claim %v is no longer available on node", deviceName, claimUID)
+		}
+	}
+}
+
+func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnprepareResourcesRequest) (*drav1.NodeUnprepareResourcesResponse, error) {
+	klog.V(5).Infof("NodeUnprepareResource is called: number of claims: %d", len(req.Claims))
+	unpreparedResources := &drav1.NodeUnprepareResourcesResponse{
+		Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
+	}
+
+	for _, claim := range req.Claims {
+		unpreparedResources.Claims[claim.UID] = d.nodeUnprepareResource(ctx, claim)
+		d.audit.LogUnprepare(claim, unpreparedResources.Claims[claim.UID])
+	}
+
+	return unpreparedResources, nil
+}
+
+func (d *driver) nodeUnprepareResource(ctx context.Context, claim *drav1.Claim) *drav1.NodeUnprepareResourceResponse {
+	klog.V(3).Infof("NodeUnprepareResource is called: claim: %+v", claim)
+
+	err := d.state.FreeClaimDevices(claim.UID)
+	if err != nil {
+		d.retrier.Failed(claim, err)
+		return &drav1.NodeUnprepareResourceResponse{Error: fmt.Sprintf("error freeing devices: %v", err)}
+	}
+	d.retrier.Succeeded(claim.UID)
+
+	klog.V(3).Infof("Freed devices for claim '%v'", claim.UID)
+	return &drav1.NodeUnprepareResourceResponse{}
+}
+
+// deviceTelemetry returns temperature and power of the Gaudi devices.
+func (d *driver) deviceTelemetry() []helpers.DeviceTelemetry {
+	return d.state.DeviceTelemetry(d.sysfsDir)
+}
+
+// monitorDevices rediscovers the devices every interval until ctx is done,
+// and with checkStatus also checks their status. The devices are republished
+// when any of them disappeared, failed, came back or recovered.
+func (d *driver) monitorDevices(ctx context.Context, nodeName string, interval time.Duration, checkStatus bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.checkDevices(ctx, nodeName, checkStatus)
+		}
+	}
+}
+
+// checkDevices withdraws missing and unhealthy devices from the ResourceSlices,
+// and publishes returned, new and recovered devices.
+func (d *driver) checkDevices(ctx context.Context, nodeName string, checkStatus bool) {
+	removed, added := d.state.UpdateDevices(discovery.DiscoverDevices(d.sysfsDir, device.DefaultNamingStyle))
+	failed, recovered := map[string]string{}, []string{}
+	if checkStatus {
+		failed, recovered = d.state.UpdateHealth(d.sysfsDir)
+	}
+	if len(removed) == 0 && len(added) == 0 && len(failed) == 0 && len(recovered) == 0 {
+		return
+	}
+
+	for _, gaudiUID := range removed {
+		klog.Warningf("Device %v disappeared, withdrawing it from allocation", gaudiUID)
+		d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.DeviceUnhealthyReason,
+			"Gaudi %v is %v and withdrawn from allocation", gaudiUID, deviceMissingReason)
+		for _, claimUID := range d.state.ClaimsWithDevice(gaudiUID) {
+			d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.PreparedDeviceMissingReason,
+				"device %v prepared for claim %v is no longer available on node", gaudiUID, claimUID)
+		}
+	}
+	for _, gaudiUID := range added {
+		klog.Infof("Device %v appeared, publishing it for allocation", gaudiUID)
+		d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeNormal, helpers.DeviceRecoveredReason,
+			"Gaudi %v is present and published for allocation", gaudiUID)
+	}
+	for gaudiUID, reason := range failed {
+		klog.Warningf("Device %v is unhealthy, withdrawing it from allocation: %v", gaudiUID, reason)
+		d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.DeviceUnhealthyReason,
+			"Gaudi %v is unhealthy and withdrawn from allocation: %v", gaudiUID, reason)
+	}
+	for _, gaudiUID := range recovered {
+		klog.Infof("Device %v recovered, publishing it for allocation", gaudiUID)
+		d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeNormal, helpers.DeviceRecoveredReason,
+			"Gaudi %v is healthy again and published for allocation", gaudiUID)
+	}
+
+	if err := d.plugin.PublishResources(ctx, d.state.GetResources()); err != nil {
+		klog.Errorf("could not publish resources after device change: %v", err)
+	}
+}
+
+func (d *driver) Shutdown(ctx context.Context) error {
+	d.plugin.Stop()
+	return nil
+}
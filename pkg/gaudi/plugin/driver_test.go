@@ -0,0 +1,695 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	drahelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestFakeSysfs(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Errorf("could not create fake system dirs: %v", err)
+		return
+	}
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"},
+		},
+		false,
+	); err != nil {
+		t.Errorf("setup error: could not create fake sysfs: %v", err)
+		return
+	}
+
+	if err := os.RemoveAll(testDirs.TestRoot); err != nil {
+		t.Errorf("could not cleanup test root %v: %v", testDirs.TestRoot, err)
+	}
+}
+
+func getFakeDriver(testDirs helpers.TestDirsType) (*driver, error) {
+	return getFakeNodeDriver(testDirs, "node1", kubefake.NewSimpleClientset())
+}
+
+func getFakeNodeDriver(testDirs helpers.TestDirsType, nodeName string, clientset *kubefake.Clientset) (*driver, error) {
+
+	config := &configType{
+		nodeName:                  nodeName,
+		clientset:                 clientset,
+		cdiRoot:                   testDirs.CdiRoot,
+		kubeletPluginDir:          testDirs.KubeletPluginDir,
+		kubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+	}
+
+	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+
+	return newDriver(context.TODO(), config)
+}
+
+// withSharing adds a GaudiConfig with the sharing mode to the allocation of the
+// claim, and reserves the claim for the given Pods.
+func withSharing(claim *resourcev1.ResourceClaim, sharing string, pods ...string) *resourcev1.ResourceClaim {
+	claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+		{
+			Source: resourcev1.AllocationConfigSourceClass,
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver: device.DriverName,
+					Parameters: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "gaudi.intel.com/v1alpha1", "kind": "GaudiConfig", "sharing": "` + sharing + `"}`),
+					},
+				},
+			},
+		},
+	}
+	for _, pod := range pods {
+		claim.Status.ReservedFor = append(claim.Status.ReservedFor, resourcev1.ResourceClaimConsumerReference{
+			Resource: "pods", Name: pod, UID: types.UID(pod),
+		})
+	}
+	return claim
+}
+
+func TestNodePrepareResources(t *testing.T) {
+	type testCase struct {
+		name                   string
+		claims                 []*resourcev1.ResourceClaim
+		request                *drav1.NodePrepareResourcesRequest
+		expectedResponse       *drav1.NodePrepareResourcesResponse
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
+	}
+
+	testcases := []testCase{
+		{
+			name: "one Gaudi success",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim("default", "claim1", "uid1", "request1", "gaudi.intel.com", "node1", []string{"0000-00-02-0-0x1020"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: "default"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid1"}}}},
+				},
+			},
+			preparedClaims: nil,
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid1"}}},
+			},
+		},
+		{
+			name: "single Gaudi, already prepared claim",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim("namespace2", "claim2", "uid2", "request2", "gaudi.intel.com", "node1", []string{"0000-00-02-0-0x1020"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{Name: "claim2", Namespace: "namespace2", UID: "uid2"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Devices: []*drav1.Device{{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}}},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}},
+			},
+		},
+		{
+			name: "single unavailable device",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim("namespace3", "claim3", "uid3", "request3", "gaudi.intel.com", "node1", []string{"0000-00-05-0-0x1020"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{Name: "claim3", Namespace: "namespace3", UID: "uid3"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid3": {Error: "could not find allocatable device 0000-00-05-0-0x1020 (pool node1)"},
+				},
+			},
+		},
+		{
+			name: "exclusive Gaudi, one consumer",
+			claims: []*resourcev1.ResourceClaim{
+				withSharing(helpers.NewClaim("namespace4", "claim4", "uid4", "request4", "gaudi.intel.com", "node1", []string{"0000-00-03-0-0x1020"}), "exclusive", "pod1"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{Name: "claim4", Namespace: "namespace4", UID: "uid4"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid4": {Devices: []*drav1.Device{{RequestNames: []string{"request4"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020", "intel.com/gaudi=uid4"}}}},
+				},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid4": {{RequestNames: []string{"request4"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020", "intel.com/gaudi=uid4"}}},
+			},
+		},
+		{
+			name: "exclusive Gaudi, two consumers",
+			claims: []*resourcev1.ResourceClaim{
+				withSharing(helpers.NewClaim("namespace5", "claim5", "uid5", "request5", "gaudi.intel.com", "node1", []string{"0000-00-03-0-0x1020"}), "exclusive", "pod1", "pod2"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{Name: "claim5", Namespace: "namespace5", UID: "uid5"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid5": {Error: "device 0000-00-03-0-0x1020 is exclusive, but claim namespace5/claim5 is reserved for 2 consumers"},
+				},
+			},
+		},
+		{
+			name: "shared Gaudi, two consumers",
+			claims: []*resourcev1.ResourceClaim{
+				withSharing(helpers.NewClaim("namespace6", "claim6", "uid6", "request6", "gaudi.intel.com", "node1", []string{"0000-00-03-0-0x1020"}), "shared", "pod1", "pod2"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{Name: "claim6", Namespace: "namespace6", UID: "uid6"}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid6": {Devices: []*drav1.Device{{RequestNames: []string{"request6"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020", "intel.com/gaudi=uid6"}}}},
+				},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid6": {{RequestNames: []string{"request6"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-03-0-0x1020", "intel.com/gaudi=uid6"}}},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		testDirs, err := helpers.NewTestDirs(device.DriverName)
+		defer helpers.CleanupTest(t, testcase.name, testDirs.TestRoot)
+		if err != nil {
+			t.Errorf("%v: setup error: %v", testcase.name, err)
+			return
+		}
+
+		if err := fakesysfs.FakeSysFsGaudiContents(
+			testDirs.SysfsRoot,
+			testDirs.DevfsRoot,
+			device.DevicesInfo{
+				"0000-00-02-0-0x1020": {Model: "0x1020", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x1020"},
+				"0000-00-03-0-0x1020": {Model: "0x1020", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x1020"},
+				"0000-00-04-0-0x1020": {Model: "0x1020", DeviceIdx: 2, PCIAddress: "0000:00:04.0", UID: "0000-00-04-0-0x1020"},
+			},
+			false,
+		); err != nil {
+			t.Errorf("setup error: could not create fake sysfs: %v", err)
+			return
+		}
+
+		preparedClaimFilePath := path.Join(testDirs.KubeletPluginDir, "preparedClaims.json")
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
+			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
+			continue
+		}
+
+		driver, driverErr := getFakeDriver(testDirs)
+		if driverErr != nil {
+			t.Errorf("could not create kubelet-plugin: %v\n", driverErr)
+			continue
+		}
+
+		for _, testClaim := range testcase.claims {
+			createdClaim, err := driver.client.ResourceV1beta1().ResourceClaims(testClaim.Namespace).Create(context.TODO(), testClaim, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("could not create test claim: %v", err)
+				continue
+			}
+			t.Logf("created test claim: %+v", createdClaim)
+		}
+
+		response, err := driver.NodePrepareResources(context.TODO(), testcase.request)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(testcase.expectedResponse, response) {
+			responseJSON, _ := json.MarshalIndent(response, "", "\t")
+			expectedResponseJSON, _ := json.MarshalIndent(testcase.expectedResponse, "", "\t")
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
+		}
+
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		expectedPreparedClaims := testcase.expectedPreparedClaims
+		if expectedPreparedClaims == nil {
+			expectedPreparedClaims = drahelpers.ClaimPreparations{}
+		}
+
+		if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) {
+			preparedClaimsJSON, _ := json.MarshalIndent(preparedClaims, "", "\t")
+			expectedPreparedClaimsJSON, _ := json.MarshalIndent(testcase.expectedPreparedClaims, "", "\t")
+			t.Errorf(
+				"%v: unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
+				testcase.name, string(preparedClaimsJSON), string(expectedPreparedClaimsJSON),
+			)
+		}
+	}
+}
+
+/*
+func TestNodeUnprepareResources(t *testing.T) {
+	type testCase struct {
+		name                   string
+		request                *drav1.NodeUnprepareResourcesRequest
+		expectedResponse       *drav1.NodeUnprepareResourcesResponse
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
+	}
+
+	testcases := []testCase{
+		{
+			name: "blank request",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
+			},
+			preparedClaims:         drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "single claim",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim1", Namespace: "namespace1", Uid: "cuid1"},
+				},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid1": {}},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"cuid1": {{UID: "0000-b3-00-0-0x1020"}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "subset of claims",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim2", Namespace: "namespace2", Uid: "cuid2"},
+				},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid2": {}},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"cuid1": {{UID: "0000-af-00-0-0x1020"}},
+				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"cuid1": {{UID: "0000-af-00-0-0x1020", PCIAddress: "0000:af:00.0", DeviceIdx: 1, ModuleIdx: 1, Model: "0x1020"}},
+			},
+		},
+		{
+			name: "non-existent claim success",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim1", Namespace: "namespace1", Uid: "cuid1"},
+				},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid1": {}},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		testDirs, err := helpers.NewTestDirs()
+		defer helpers.CleanupTest(t, testcase.name, testDirs.TestRoot)
+		if err != nil {
+			t.Errorf("%v: setup error: %v", testcase.name, err)
+			return
+		}
+
+		if err := fakesysfs.FakeSysFsGaudiContents(
+			testDirs.SysfsRoot,
+			testDirs.DevfsRoot,
+			device.DevicesInfo{
+				"0000-b3-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:b3:00.0", DeviceIdx: 0, UID: "0000-b3-00-0-0x1020"},
+				"0000-af-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:af:00.0", DeviceIdx: 1, UID: "0000-af-00-0-0x1020"},
+			},
+		); err != nil {
+			t.Errorf("setup error: could not create fake sysfs: %v", err)
+			return
+		}
+
+		preparedClaimFilePath := path.Join(testDirs.DriverPluginRoot, device.PreparedClaimsFileName)
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
+			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
+		}
+
+		driver, driverErr := getFakeDriver(testDirs)
+		if driverErr != nil {
+			t.Errorf("could not create kubelet-plugin: %v\n", driverErr)
+			continue
+		}
+
+		response, err := driver.NodeUnprepareResources(context.TODO(), testcase.request)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+		}
+
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+		}
+
+		if !reflect.DeepEqual(response, testcase.expectedResponse) {
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, response, testcase.expectedResponse)
+		}
+
+		if !reflect.DeepEqual(testcase.expectedPreparedClaims, preparedClaims) {
+			preparedClaimsJSON, _ := json.MarshalIndent(preparedClaims, "", "\t")
+			expectedPreparedClaimsJSON, _ := json.MarshalIndent(testcase.expectedPreparedClaims, "", "\t")
+			t.Errorf(
+				"unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
+				preparedClaimsJSON, expectedPreparedClaimsJSON,
+			)
+			break
+		}
+	}
+}
+
+*/
+
+func TestMultiNodePrepare(t *testing.T) {
+	testDirs, err := helpers.NewMultiNodeTestDirs(device.DriverName, "node1", "node2")
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer testDirs.Cleanup(t, "TestMultiNodePrepare")
+
+	nodeDevices := map[string]device.DevicesInfo{
+		"node1": {"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"}},
+		"node2": {"0000-10-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:10:00.0", DeviceIdx: 0, UID: "0000-10-00-0-0x1020"}},
+	}
+
+	clientset := kubefake.NewSimpleClientset()
+	drivers := map[string]*driver{}
+	for nodeName, devices := range nodeDevices {
+		nodeDirs := testDirs.Nodes[nodeName]
+		if err := fakesysfs.FakeSysFsGaudiContents(nodeDirs.SysfsRoot, nodeDirs.DevfsRoot, devices, false); err != nil {
+			t.Fatalf("setup error: could not create fake sysfs of %v: %v", nodeName, err)
+		}
+
+		if drivers[nodeName], err = getFakeNodeDriver(nodeDirs, nodeName, clientset); err != nil {
+			t.Fatalf("could not create kubelet-plugin of %v: %v", nodeName, err)
+		}
+	}
+
+	for nodeName, devices := range nodeDevices {
+		allocatable := drivers[nodeName].state.allocatable
+		for uid := range devices {
+			if _, found := allocatable[uid]; !found || len(allocatable) != 1 {
+				t.Errorf("%v: expected only device %v, got %v", nodeName, uid, allocatable)
+			}
+		}
+	}
+
+	claim := helpers.NewClaim("default", "claim1", "uid1", "request1", device.DriverName, "node2", []string{"0000-10-00-0-0x1020"})
+	if _, err := clientset.ResourceV1beta1().ResourceClaims("default").Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+
+	response, err := drivers["node2"].NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{
+		Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: "default"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &drav1.NodePrepareResourceResponse{Devices: []*drav1.Device{
+		{RequestNames: []string{"request1"}, PoolName: "node2", DeviceName: "0000-10-00-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-10-00-0-0x1020", "intel.com/gaudi=uid1"}},
+	}}
+	if !reflect.DeepEqual(response.Claims["uid1"], expected) {
+		t.Errorf("unexpected response: %+v, expected %+v", response.Claims["uid1"], expected)
+	}
+
+	if _, found := drivers["node1"].state.prepared["uid1"]; found {
+		t.Errorf("claim prepared on node2 is prepared also on node1")
+	}
+}
+
+func TestDriverWithFakePlugin(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer helpers.CleanupTest(t, "TestDriverWithFakePlugin", testDirs.TestRoot)
+
+	gaudi0 := &device.DeviceInfo{Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"}
+	gaudi1 := &device.DeviceInfo{Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, UID: "0000-1a-00-0-0x1020"}
+	if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, device.DevicesInfo{gaudi0.UID: gaudi0, gaudi1.UID: gaudi1}, false); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	plugin := &helpers.FakeDRAPlugin{}
+	clientset := kubefake.NewSimpleClientset()
+	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+	driver, err := newDriver(context.TODO(), &configType{
+		nodeName:                  "node1",
+		clientset:                 clientset,
+		cdiRoot:                   testDirs.CdiRoot,
+		kubeletPluginDir:          testDirs.KubeletPluginDir,
+		kubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+		startPlugin:               plugin.Start,
+	})
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+
+	if published := plugin.PublishedDevices(); !reflect.DeepEqual(published, []string{gaudi0.UID, gaudi1.UID}) {
+		t.Errorf("expected both devices to be published, got %v", published)
+	}
+	if opts := plugin.Options(); opts.DriverName != device.DriverName || opts.NodeName != "node1" {
+		t.Errorf("unexpected plugin options: %+v", opts)
+	}
+	if err := drahelpers.PluginRegisteredCheck(driver.plugin)(); err != nil {
+		t.Errorf("expected started plugin to be registered: %v", err)
+	}
+
+	claim := helpers.NewClaim("default", "claim1", "uid1", "request1", device.DriverName, "node1", []string{gaudi1.UID})
+	if _, err := clientset.ResourceV1beta1().ResourceClaims("default").Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+	prepared, err := plugin.Prepare(context.TODO(), claim)
+	if err != nil || prepared.Claims["uid1"].Error != "" || len(prepared.Claims["uid1"].Devices) != 1 {
+		t.Fatalf("unexpected prepare response: %+v, %v", prepared, err)
+	}
+	unprepared, err := plugin.Unprepare(context.TODO(), claim)
+	if err != nil || unprepared.Claims["uid1"].Error != "" {
+		t.Fatalf("unexpected unprepare response: %+v, %v", unprepared, err)
+	}
+
+	// removed device is withdrawn from allocation
+	if err := fakesysfs.RemoveFakeGaudiDevice(testDirs.SysfsRoot, testDirs.DevfsRoot, gaudi0.PCIAddress); err != nil {
+		t.Fatalf("could not remove fake device: %v", err)
+	}
+	driver.checkDevices(context.TODO(), "node1", false)
+	if published := plugin.PublishedDevices(); !reflect.DeepEqual(published, []string{gaudi1.UID}) {
+		t.Errorf("expected only %v to be published after removing %v, got %v", gaudi1.UID, gaudi0.UID, published)
+	}
+	if count := len(plugin.Published()); count != 2 {
+		t.Errorf("expected resources to be published twice, got %d", count)
+	}
+
+	if err := driver.Shutdown(context.TODO()); err != nil || !plugin.Stopped() {
+		t.Errorf("expected driver to stop the plugin: %v", err)
+	}
+	if _, err := plugin.Prepare(context.TODO(), claim); err == nil {
+		t.Errorf("expected prepare through stopped plugin to fail")
+	}
+}
+
+func TestPrepareFailedEvents(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "TestPrepareFailedEvents", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x1020": {Model: "0x1020", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x1020"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	driver.recorder = recorder
+
+	claim := helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gaudi.intel.com", "node1", []string{"0000-00-09-0-0x1020"})
+	if _, err := driver.client.ResourceV1beta1().ResourceClaims(claim.Namespace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+
+	response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{
+		{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+		{UID: "uid2", Name: "claim2", Namespace: "namespace1"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedEvents := map[string]bool{}
+	for uid, substring := range map[string]string{"uid1": "0000-00-09-0-0x1020", "uid2": "could not find ResourceClaim claim2"} {
+		claimError := response.Claims[uid].Error
+		if !strings.Contains(claimError, substring) {
+			t.Errorf("%v: expected error with %q, got %q", uid, substring, claimError)
+		}
+		expectedEvents["Warning "+drahelpers.PrepareFailedReason+" "+claimError] = true
+	}
+
+	if len(recorder.Events) != len(expectedEvents) {
+		t.Fatalf("expected %d events, got %d", len(expectedEvents), len(recorder.Events))
+	}
+	for range expectedEvents {
+		if event := <-recorder.Events; !expectedEvents[event] {
+			t.Errorf("unexpected event %q, expected one of %v", event, expectedEvents)
+		}
+	}
+}
+
+// TestPrepareWhileRetryingUnprepare prepares claims while the unprepare
+// retrier frees them, so that go test -race catches unlocked access to the
+// prepared claims.
+func TestPrepareWhileRetryingUnprepare(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "TestPrepareWhileRetryingUnprepare", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGaudiContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x1020": {Model: "0x1020", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x1020"},
+			"0000-00-03-0-0x1020": {Model: "0x1020", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x1020"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+
+	for _, claim := range []*resourcev1.ResourceClaim{
+		helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gaudi.intel.com", "node1", []string{"0000-00-02-0-0x1020"}),
+		helpers.NewClaim("namespace1", "claim2", "uid2", "request2", "gaudi.intel.com", "node1", []string{"0000-00-03-0-0x1020"}),
+	} {
+		if _, err := driver.client.ResourceV1beta1().ResourceClaims(claim.Namespace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("could not create test claim: %v", err)
+		}
+	}
+
+	claims := []*drav1.Claim{
+		{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+		{UID: "uid2", Name: "claim2", Namespace: "namespace1"},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: claims})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			for uid, claimResponse := range response.Claims {
+				if claimResponse.Error != "" {
+					t.Errorf("%v: unexpected prepare error: %v", uid, claimResponse.Error)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			for _, claim := range claims {
+				driver.retrier.Failed(claim, fmt.Errorf("unprepare timed out"))
+			}
+			driver.retrier.Retry(context.TODO())
+		}
+	}()
+	wg.Wait()
+
+	if pending := driver.retrier.Pending(); pending != 0 {
+		t.Errorf("expected no pending unprepare retries, got %d", pending)
+	}
+}
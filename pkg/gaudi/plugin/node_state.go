@@ -0,0 +1,565 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
+	cdiSpecs "tags.cncf.io/container-device-interface/specs-go"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	cdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// deviceMissingReason is the unhealthy reason of devices which are no longer
+// detected, e.g. dropped off the PCI bus after a fatal error.
+const deviceMissingReason = "not present on the node"
+
+type nodeState struct {
+	sync.Mutex
+	cdiCache               *cdiapi.Cache
+	allocatable            device.DevicesInfo
+	prepared               helpers.ClaimPreparations
+	preparedClaimsFilePath string
+	cdiDrift               helpers.CDIDrift
+	nodeName               string
+	checkpointLost         bool              // prepared claims file was missing or corrupted
+	unhealthy              map[string]string // reasons by device UID, unhealthy devices are not published
+}
+
+func newNodeState(ctx context.Context, detectedDevices map[string]*device.DeviceInfo, cdiRoot string, preparedClaimsFilePath string, nodeName string) (*nodeState, error) {
+	for ddev := range detectedDevices {
+		klog.V(3).Infof("new device: %+v", ddev)
+	}
+
+	cdiCache, err := helpers.NewCDICache(cdiRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Devices are in use when the plugin has written CDI specs before, so a
+	// missing prepared claims file is lost rather than new.
+	inUse := cdiregistry.Gaudi.HasDevices(cdiCache)
+
+	// syncDetectedDevicesWithRegistry overrides uid in detecteddevices from existing cdi spec
+	cdiDrift, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sync detected devices to CDI registry: %v", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
+	for duid, ddev := range detectedDevices {
+		klog.V(5).Infof("CDI device: %v : %+v", duid, ddev)
+	}
+
+	// TODO: should be only create prepared claims, discard old preparations. Do we even need the snapshot?
+	preparedClaims, checkpointLost, err := helpers.GetOrCreatePreparedClaims(preparedClaimsFilePath, inUse)
+	if err != nil {
+		klog.Errorf("Error getting prepared claims: %v", err)
+		return nil, fmt.Errorf("failed to get prepared claims: %v", err)
+	}
+
+	klog.V(5).Info("Creating NodeState")
+	// TODO: allocatable should include cdi-described
+	state := &nodeState{
+		cdiCache:               cdiCache,
+		allocatable:            detectedDevices,
+		prepared:               preparedClaims,
+		cdiDrift:               cdiDrift,
+		preparedClaimsFilePath: preparedClaimsFilePath,
+		checkpointLost:         checkpointLost,
+		nodeName:               nodeName,
+	}
+
+	/*
+		klog.V(5).Info("Syncing allocatable devices")
+		err = state.syncPreparedDevicesFromFile(clientset, preparedClaims)
+		if err != nil {
+			return nil, fmt.Errorf("unable to sync allocated devices from GaudiAllocationState: %v", err)
+		}
+	*/
+
+	klog.V(5).Infof("Synced state with CDI and GaudiAllocationState: %+v", state)
+	for duid, ddev := range state.allocatable {
+		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
+	}
+
+	return state, nil
+}
+
+// FreeClaimDevices cleans up prepared claims records and returns error if it was encountered, otherwise nil.
+func (s *nodeState) FreeClaimDevices(claimUID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.prepared[claimUID] == nil {
+		return nil
+	}
+
+	klog.V(5).Infof("Freeing devices from claim %v", claimUID)
+
+	// The claim stays prepared until all of its cleanup is done, so that a
+	// failed unprepare can be retried.
+	if err := cdihelpers.DeleteDeviceAndWrite(s.cdiCache, claimUID); err != nil {
+		return fmt.Errorf("failed to delete CDI device: %v", err)
+	}
+
+	claimDevices := s.prepared[claimUID]
+	delete(s.prepared, claimUID)
+
+	// write prepared claims to file
+	if err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared); err != nil {
+		s.prepared[claimUID] = claimDevices
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+func (s *nodeState) GetResources() kubeletplugin.Resources {
+	devices := []resourcev1.Device{}
+
+	for gaudiUID, gaudi := range s.allocatable {
+		if _, found := s.unhealthy[gaudiUID]; found {
+			continue
+		}
+
+		moduleIdx := int64(gaudi.ModuleIdx)
+		// Modules 0-1, 2-3, 4-5 and 6-7 are the aligned sets of 2, and
+		// modules 0-3 and 4-7 the aligned sets of 4 in a server.
+		moduleGroup2 := moduleIdx / 2
+		moduleGroup4 := moduleIdx / 4
+		newDevice := resourcev1.Device{
+			Name: gaudiUID,
+			Basic: &resourcev1.BasicDevice{
+				Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+					"model": {
+						StringValue: &gaudi.ModelName,
+					},
+					"pciRoot": {
+						StringValue: &gaudi.PCIRoot,
+					},
+					"moduleIndex": {
+						IntValue: &moduleIdx,
+					},
+					"moduleGroup2": {
+						IntValue: &moduleGroup2,
+					},
+					"moduleGroup4": {
+						IntValue: &moduleGroup4,
+					},
+				},
+			},
+		}
+
+		scaleOutPorts := int64(len(gaudi.ScaleOutPorts))
+		newDevice.Basic.Attributes["scaleOutPorts"] = resourcev1.DeviceAttribute{IntValue: &scaleOutPorts}
+
+		// Platforms without NUMA affinity of PCI devices report -1.
+		if gaudi.NUMANode >= 0 {
+			numaNode := gaudi.NUMANode
+			newDevice.Basic.Attributes["numaNode"] = resourcev1.DeviceAttribute{IntValue: &numaNode}
+		}
+
+		devices = append(devices, newDevice)
+	}
+
+	return kubeletplugin.Resources{Devices: devices}
+}
+
+// cdiHabanaEnvVar ensures there is a CDI device with name == claimUID, that has
+// only env vars for Habana Runtime, without device nodes.
+func (s *nodeState) cdiHabanaEnvVar(claimUID string, env []string) error {
+	cdidev := s.cdiCache.GetDevice(claimUID)
+	if cdidev != nil { // overwrite the contents
+		cdidev.Device.ContainerEdits = cdiSpecs.ContainerEdits{
+			Env: env,
+		}
+
+		// Save into the same spec where the device was found.
+		deviceSpec := cdidev.GetSpec()
+		specName := path.Base(deviceSpec.GetPath())
+		if err := s.cdiCache.WriteSpec(deviceSpec.Spec, specName); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	// Create new CDI device and save into first vendor spec.
+	newDevice := cdiSpecs.Device{
+		Name: claimUID,
+		ContainerEdits: cdiSpecs.ContainerEdits{
+			Env: env,
+		},
+	}
+
+	if err := cdihelpers.AddDeviceToAnySpec(s.cdiCache, device.CDIVendor, newDevice); err != nil {
+		return fmt.Errorf("could not add CDI device into CDI registry: %v", err)
+	}
+
+	return nil
+}
+
+/*
+func (s *nodeState) syncPreparedDevicesFromFile(preparedClaims helpers.ClaimPreparations) error {
+	klog.V(5).Infof("Syncing %d Prepared allocations from GaudiAllocationState to internal state", len(preparedClaims))
+
+	if s.prepared == nil {
+		s.prepared = make(helpers.ClaimPreparations)
+	}
+
+	for claimuid, preparedDevices := range preparedClaims {
+		skipPreparedClaim := false
+		prepared := []*device.DeviceInfo{}
+		for _, preparedDevice := range preparedDevices {
+			klog.V(5).Infof("claim %v had device %+v", claimuid, preparedDevice)
+
+			if _, exists := s.allocatable[preparedDevice.UID]; !exists {
+				klog.Errorf("prepared device %v no longer available for claim %v, dropping claim preparation", preparedDevice.UID, claimuid)
+				skipPreparedClaim = true
+				break
+			}
+
+			newdevice := s.allocatable[preparedDevice.UID].DeepCopy()
+			prepared = append(prepared, newdevice)
+		}
+
+		if !skipPreparedClaim {
+			s.prepared[claimuid] = prepared
+		}
+	}
+
+	return nil
+}
+*/
+
+func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if claim.Status.Allocation == nil {
+		return fmt.Errorf("no allocation found in claim %v/%v status", claim.Namespace, claim.Name)
+	}
+
+	allocatedDevices := []*drav1.Device{}
+	visibleDevices := device.VisibleDevicesEnvVarName + "="
+	scaleOutInterfaces := []string{}
+	devs := 0
+
+	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
+		// ATM the only pool is cluster node's pool: all devices on current node.
+		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.nodeName {
+			klog.FromContext(ctx).Info("ignoring claim allocation device", allocatedDevice)
+			continue
+		}
+
+		allocatableDevice, found := s.allocatable[allocatedDevice.Device]
+		if !found {
+			return fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
+		}
+
+		if reason, found := s.unhealthy[allocatedDevice.Device]; found {
+			return fmt.Errorf("device %v is unhealthy: %v", allocatedDevice.Device, reason)
+		}
+
+		config, err := requestConfig(claim, allocatedDevice.Request)
+		if err != nil {
+			return err
+		}
+		if config != nil && config.Sharing == device.SharingExclusive && len(claim.Status.ReservedFor) > 1 {
+			return fmt.Errorf("device %v is exclusive, but claim %v/%v is reserved for %d consumers",
+				allocatedDevice.Device, claim.Namespace, claim.Name, len(claim.Status.ReservedFor))
+		}
+
+		newDevice := drav1.Device{
+			RequestNames: []string{allocatedDevice.Request},
+			PoolName:     allocatedDevice.Pool,
+			DeviceName:   allocatedDevice.Device,
+			CDIDeviceIDs: []string{allocatableDevice.CDIName()},
+		}
+		allocatedDevices = append(allocatedDevices, &newDevice)
+
+		devs++
+		if devs > 1 {
+			visibleDevices += ","
+		}
+		visibleDevices += fmt.Sprintf("%v", allocatableDevice.DeviceIdx)
+		scaleOutInterfaces = append(scaleOutInterfaces, allocatableDevice.ScaleOutPorts...)
+	}
+
+	if devs > 0 {
+		env := []string{visibleDevices}
+		if len(scaleOutInterfaces) > 0 {
+			env = append(env, device.ScaleOutInterfacesEnvVarName+"="+strings.Join(scaleOutInterfaces, ","))
+		}
+
+		if err := s.cdiHabanaEnvVar(string(claim.UID), env); err != nil {
+			return fmt.Errorf("failed ensuring Habana Runtime specific CDI device: %v", err)
+		}
+
+		cdiName := cdiparser.QualifiedName(device.CDIVendor, device.CDIClass, string(claim.UID))
+		allocatedDevices[0].CDIDeviceIDs = append(allocatedDevices[0].CDIDeviceIDs, cdiName)
+	}
+
+	s.prepared[string(claim.UID)] = allocatedDevices
+
+	err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared)
+	if err != nil {
+		klog.Errorf("Error writing prepared claims to file: %v", err)
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	klog.V(5).Infof("Created prepared claim %v allocation", claim.UID)
+	return nil
+}
+
+// requestConfig returns the opaque configuration of the driver for the request,
+// nil if there is none. Configuration from the ResourceClaim follows
+// configuration from the DeviceClass, so the last one wins.
+func requestConfig(claim *resourcev1.ResourceClaim, request string) (*device.GaudiConfig, error) {
+	var gaudiConfig *device.GaudiConfig
+
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != device.DriverName {
+			continue
+		}
+		if len(config.Requests) > 0 && !slices.Contains(config.Requests, request) {
+			continue
+		}
+
+		decoded, err := device.DecodeGaudiConfig(config.Opaque.Parameters.Raw)
+		if err != nil {
+			return nil, err
+		}
+		gaudiConfig = decoded
+	}
+
+	return gaudiConfig, nil
+}
+
+// PreparedDevices returns the devices prepared for the claim, and whether the
+// claim is prepared.
+func (s *nodeState) PreparedDevices(claimUID string) ([]*drav1.Device, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	claimDevices, found := s.prepared[claimUID]
+	return claimDevices, found
+}
+
+// MissingPreparedDevices returns the prepared devices that are not
+// allocatable, by the UID of the claim they are prepared for.
+func (s *nodeState) MissingPreparedDevices() map[string][]string {
+	s.Lock()
+	defer s.Unlock()
+
+	missing := map[string][]string{}
+	for claimUID, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			if _, found := s.allocatable[claimDevice.DeviceName]; !found {
+				missing[claimUID] = append(missing[claimUID], claimDevice.DeviceName)
+			}
+		}
+	}
+
+	return missing
+}
+
+// DeviceUsage returns every allocatable Gaudi device and whether it is taken
+// by a prepared claim.
+func (s *nodeState) DeviceUsage() []helpers.DeviceUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	preparedDevices := map[string]bool{}
+	for _, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			preparedDevices[claimDevice.DeviceName] = true
+		}
+	}
+
+	usage := []helpers.DeviceUsage{}
+	for gaudiUID := range s.allocatable {
+		deviceUsage := helpers.DeviceUsage{Device: gaudiUID, Resource: "devices", Total: 1}
+		if preparedDevices[gaudiUID] {
+			deviceUsage.Allocated = 1
+		}
+		usage = append(usage, deviceUsage)
+	}
+
+	return usage
+}
+
+// DeviceTelemetry returns temperature and power of every allocatable Gaudi
+// device, read from sysfs under sysfsDir.
+func (s *nodeState) DeviceTelemetry(sysfsDir string) []helpers.DeviceTelemetry {
+	s.Lock()
+	defer s.Unlock()
+
+	telemetry := []helpers.DeviceTelemetry{}
+	for gaudiUID, gaudi := range s.allocatable {
+		temperature, power := discovery.ReadTelemetry(sysfsDir, gaudi.PCIAddress)
+		telemetry = append(telemetry, helpers.DeviceTelemetry{
+			Device:             gaudiUID,
+			TemperatureCelsius: temperature,
+			PowerWatts:         power,
+		})
+	}
+
+	return telemetry
+}
+
+// UpdateDevices compares the allocatable devices with the detected devices.
+// Devices which are no longer detected are marked unhealthy, so they are not
+// published, and are returned as removed. Devices which are detected again or
+// for the first time are written to the CDI registry and returned as added.
+func (s *nodeState) UpdateDevices(detectedDevices device.DevicesInfo) (removed []string, added []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.unhealthy == nil {
+		s.unhealthy = map[string]string{}
+	}
+
+	for gaudiUID := range s.allocatable {
+		if _, found := detectedDevices[gaudiUID]; found || s.unhealthy[gaudiUID] == deviceMissingReason {
+			continue
+		}
+		s.unhealthy[gaudiUID] = deviceMissingReason
+		removed = append(removed, gaudiUID)
+	}
+
+	appeared := device.DevicesInfo{}
+	for gaudiUID, gaudi := range detectedDevices {
+		if _, found := s.allocatable[gaudiUID]; !found || s.unhealthy[gaudiUID] == deviceMissingReason {
+			appeared[gaudiUID] = gaudi
+		}
+	}
+
+	if len(appeared) == 0 {
+		return removed, nil
+	}
+
+	// Accel index may change when the device comes back. Devices are
+	// published only once their CDI devices are written, or on next check.
+	if err := cdihelpers.WriteDevices(s.cdiCache, appeared); err != nil {
+		klog.Errorf("could not write CDI devices of appeared devices: %v", err)
+		return removed, nil
+	}
+
+	for gaudiUID, gaudi := range appeared {
+		s.allocatable[gaudiUID] = gaudi
+		delete(s.unhealthy, gaudiUID)
+		added = append(added, gaudiUID)
+	}
+
+	return removed, added
+}
+
+// UpdateHealth reads the status of every allocatable Gaudi device from sysfs
+// under sysfsDir, and returns the devices which became unhealthy with the
+// reason, and the devices which recovered.
+func (s *nodeState) UpdateHealth(sysfsDir string) (map[string]string, []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.unhealthy == nil {
+		s.unhealthy = map[string]string{}
+	}
+
+	failed := map[string]string{}
+	recovered := []string{}
+	for gaudiUID, gaudi := range s.allocatable {
+		if s.unhealthy[gaudiUID] == deviceMissingReason {
+			continue
+		}
+
+		reason := ""
+		status, err := discovery.DeviceStatus(sysfsDir, gaudi.PCIAddress)
+		switch {
+		case err != nil:
+			reason = fmt.Sprintf("could not read status: %v", err)
+		case status != device.StatusOperational:
+			reason = fmt.Sprintf("status %q", status)
+		}
+
+		_, wasUnhealthy := s.unhealthy[gaudiUID]
+		switch {
+		case reason != "" && !wasUnhealthy:
+			s.unhealthy[gaudiUID] = reason
+			failed[gaudiUID] = reason
+		case reason == "" && wasUnhealthy:
+			delete(s.unhealthy, gaudiUID)
+			recovered = append(recovered, gaudiUID)
+		}
+	}
+
+	return failed, recovered
+}
+
+// ClaimsWithDevice returns UIDs of prepared claims using the device.
+func (s *nodeState) ClaimsWithDevice(gaudiUID string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	claimUIDs := []string{}
+	for claimUID, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			if claimDevice.DeviceName == gaudiUID {
+				claimUIDs = append(claimUIDs, claimUID)
+				break
+			}
+		}
+	}
+
+	return claimUIDs
+}
+
+// Unhealthy returns the reasons of unhealthy devices by device UID.
+func (s *nodeState) Unhealthy() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+
+	return maps.Clone(s.unhealthy)
+}
+
+// CDIDrift returns CDI registry devices that were rewritten to match detected devices.
+func (s *nodeState) CDIDrift() helpers.CDIDrift {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cdiDrift
+}
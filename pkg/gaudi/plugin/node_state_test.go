@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestDeviceInfoDeepCopy(t *testing.T) {
+	di := device.DeviceInfo{
+		UID:   "f",
+		Model: "ff",
+	}
+
+	dc := di.DeepCopy()
+
+	if !reflect.DeepEqual(&di, dc) {
+		t.Fatalf("device infos %v and %v do not match", di, dc)
+	}
+}
+
+func TestGetResourcesModuleGroups(t *testing.T) {
+	state := &nodeState{allocatable: device.DevicesInfo{}}
+	for moduleIdx := uint64(0); moduleIdx < 8; moduleIdx++ {
+		uid := device.DeviceUIDFromPCIinfo(fmt.Sprintf("0000:%02x:00.0", 0x10+moduleIdx), "0x1020")
+		state.allocatable[uid] = &device.DeviceInfo{UID: uid, Model: "0x1020", ModuleIdx: moduleIdx}
+	}
+
+	for _, resourceDevice := range state.GetResources().Devices {
+		moduleIdx := int64(state.allocatable[resourceDevice.Name].ModuleIdx)
+		for attribute, expected := range map[resourcev1.QualifiedName]int64{
+			"moduleIndex":  moduleIdx,
+			"moduleGroup2": moduleIdx / 2,
+			"moduleGroup4": moduleIdx / 4,
+		} {
+			value := resourceDevice.Basic.Attributes[attribute].IntValue
+			if value == nil || *value != expected {
+				t.Errorf("device %v (module %d): expected %v %d, got %v", resourceDevice.Name, moduleIdx, attribute, expected, value)
+			}
+		}
+	}
+}
+
+func TestGetResourcesNUMANodeAndPorts(t *testing.T) {
+	state := &nodeState{allocatable: device.DevicesInfo{
+		"0000-0f-00-0-0x1020": {UID: "0000-0f-00-0-0x1020", Model: "0x1020", NUMANode: 1, ScaleOutPorts: []string{"hbl_1", "hbl_2"}},
+		"0000-1a-00-0-0x1020": {UID: "0000-1a-00-0-0x1020", Model: "0x1020", NUMANode: -1},
+	}}
+
+	for _, resourceDevice := range state.GetResources().Devices {
+		value := resourceDevice.Basic.Attributes["numaNode"].IntValue
+		switch resourceDevice.Name {
+		case "0000-0f-00-0-0x1020":
+			if value == nil || *value != 1 {
+				t.Errorf("device %v: expected numaNode 1, got %v", resourceDevice.Name, value)
+			}
+			if ports := resourceDevice.Basic.Attributes["scaleOutPorts"].IntValue; ports == nil || *ports != 2 {
+				t.Errorf("device %v: expected 2 scaleOutPorts, got %v", resourceDevice.Name, ports)
+			}
+		default:
+			if _, found := resourceDevice.Basic.Attributes["numaNode"]; found {
+				t.Errorf("device %v: unexpected numaNode %v for unknown NUMA node", resourceDevice.Name, *value)
+			}
+		}
+	}
+}
+
+func TestUpdateHealth(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	devices := device.DevicesInfo{
+		"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"},
+		"0000-1a-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, UID: "0000-1a-00-0-0x1020"},
+	}
+	if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, false); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	state := &nodeState{allocatable: devices}
+	if failed, recovered := state.UpdateHealth(testDirs.SysfsRoot); len(failed) != 0 || len(recovered) != 0 {
+		t.Errorf("expected all devices healthy, got failed %v, recovered %v", failed, recovered)
+	}
+
+	if err := fakesysfs.SetFakeGaudiDeviceStatus(testDirs.SysfsRoot, "0000:1a:00.0", fakesysfs.GaudiStatusNeedsReset); err != nil {
+		t.Fatalf("could not set device status: %v", err)
+	}
+	failed, _ := state.UpdateHealth(testDirs.SysfsRoot)
+	if reason, found := failed["0000-1a-00-0-0x1020"]; len(failed) != 1 || !found || !strings.Contains(reason, "needs reset") {
+		t.Errorf("expected device 0000-1a-00-0-0x1020 to fail with needs reset, got %v", failed)
+	}
+	if failed, _ := state.UpdateHealth(testDirs.SysfsRoot); len(failed) != 0 {
+		t.Errorf("expected unhealthy device to be reported once, got %v", failed)
+	}
+
+	resources := state.GetResources()
+	if len(resources.Devices) != 1 || resources.Devices[0].Name != "0000-0f-00-0-0x1020" {
+		t.Errorf("expected only the healthy device to be published, got %v", resources.Devices)
+	}
+
+	if err := fakesysfs.SetFakeGaudiDeviceStatus(testDirs.SysfsRoot, "0000:1a:00.0", fakesysfs.GaudiStatusOperational); err != nil {
+		t.Fatalf("could not set device status: %v", err)
+	}
+	if _, recovered := state.UpdateHealth(testDirs.SysfsRoot); !reflect.DeepEqual(recovered, []string{"0000-1a-00-0-0x1020"}) {
+		t.Errorf("expected device 0000-1a-00-0-0x1020 to recover, got %v", recovered)
+	}
+	if unhealthy := state.Unhealthy(); len(unhealthy) != 0 {
+		t.Errorf("expected no unhealthy devices, got %v", unhealthy)
+	}
+}
+
+func TestUpdateDevices(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+	t.Setenv(device.DevfsEnvVarName, testDirs.DevfsRoot)
+
+	gaudi0 := &device.DeviceInfo{Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"}
+	gaudi1 := &device.DeviceInfo{Model: "0x1020", PCIAddress: "0000:1a:00.0", DeviceIdx: 1, UID: "0000-1a-00-0-0x1020"}
+	if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, device.DevicesInfo{gaudi0.UID: gaudi0}, false); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(testDirs.CdiRoot), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+	state := &nodeState{allocatable: device.DevicesInfo{gaudi0.UID: gaudi0.DeepCopy()}, cdiCache: cdiCache}
+
+	if err := fakesysfs.RemoveFakeGaudiDevice(testDirs.SysfsRoot, testDirs.DevfsRoot, gaudi0.PCIAddress); err != nil {
+		t.Fatalf("could not remove fake device: %v", err)
+	}
+	removed, added := state.UpdateDevices(discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle))
+	if !reflect.DeepEqual(removed, []string{gaudi0.UID}) || len(added) != 0 {
+		t.Errorf("expected device %v to be removed, got removed %v, added %v", gaudi0.UID, removed, added)
+	}
+	if devices := state.GetResources().Devices; len(devices) != 0 {
+		t.Errorf("expected missing device not to be published, got %v", devices)
+	}
+	if removed, _ := state.UpdateDevices(discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)); len(removed) != 0 {
+		t.Errorf("expected missing device to be reported once, got %v", removed)
+	}
+
+	// The device comes back with another accel index, and a new one is hot-plugged.
+	returned := &device.DeviceInfo{Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 2, UID: "0000-0f-00-0-0x1020"}
+	if err := fakesysfs.FakeSysFsGaudiContents(testDirs.SysfsRoot, testDirs.DevfsRoot, device.DevicesInfo{returned.UID: returned, gaudi1.UID: gaudi1}, false); err != nil {
+		t.Fatalf("could not add fake devices: %v", err)
+	}
+	_, added = state.UpdateDevices(discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle))
+	slices.Sort(added)
+	if !reflect.DeepEqual(added, []string{gaudi0.UID, gaudi1.UID}) {
+		t.Errorf("expected devices %v and %v to be added, got %v", gaudi0.UID, gaudi1.UID, added)
+	}
+	if devices := state.GetResources().Devices; len(devices) != 2 {
+		t.Errorf("expected both devices to be published, got %v", devices)
+	}
+
+	if err := state.cdiCache.Refresh(); err != nil {
+		t.Fatalf("could not refresh CDI cache: %v", err)
+	}
+	for uid, accel := range map[string]string{gaudi0.UID: "accel2", gaudi1.UID: "accel1"} {
+		cdiDevice := state.cdiCache.GetDevice(device.CDIKind + "=" + uid)
+		if cdiDevice == nil || path.Base(cdiDevice.ContainerEdits.DeviceNodes[0].Path) != accel {
+			t.Errorf("expected CDI device %v with %v device node, got %+v", uid, accel, cdiDevice)
+		}
+	}
+}
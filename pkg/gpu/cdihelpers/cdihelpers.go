@@ -29,38 +29,33 @@ import (
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	specs "tags.cncf.io/container-device-interface/specs-go"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 const (
 	containerDevdriPath = "/dev/dri"
 )
 
-func getGPUSpecs(cdiCache *cdiapi.Cache) []*cdiapi.Spec {
-	gaudiSpecs := []*cdiapi.Spec{}
-	for _, cdiSpec := range cdiCache.GetVendorSpecs(device.CDIVendor) {
-		if cdiSpec.Kind == device.CDIKind {
-			gaudiSpecs = append(gaudiSpecs, cdiSpec)
-		}
-	}
-	return gaudiSpecs
-}
-
 // SyncDetectedDevicesWithRegistry adds detected devices into cdi registry if they are not yet there.
 // Update existing registry devices with detected.
 // Remove absent registry devices.
-func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo, doCleanup bool) error {
-
-	vendorSpecs := getGPUSpecs(cdiCache)
+// Set device node permissions of registry devices.
+// Returns registry devices that were updated or removed.
+func SyncDetectedDevicesWithRegistry(
+	cdiCache *cdiapi.Cache, detectedDevices device.DevicesInfo, doCleanup bool, permissions DeviceNodePermissions) (helpers.CDIDrift, error) {
+	drift := helpers.CDIDrift{}
+	vendorSpecs := cdiregistry.GPU.Specs(cdiCache)
 	devicesToAdd := detectedDevices.DeepCopy()
 
 	if len(vendorSpecs) == 0 {
 		klog.V(5).Infof("No existing specs found for vendor %v, creating new", device.CDIVendor)
-		if err := addNewDevicesToNewRegistry(cdiCache, devicesToAdd); err != nil {
+		if err := addNewDevicesToNewRegistry(cdiCache, devicesToAdd, permissions); err != nil {
 			klog.V(5).Infof("Failed adding card to cdi registry: %v", err)
-			return err
+			return drift, err
 		}
-		return nil
+		return drift, nil
 	}
 
 	// loop through spec devices
@@ -81,7 +76,8 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 			// if matched detected - check and update cardIdx and renderDIdx if needed - add to filtered Devices
 			if detectedDevice, found := devicesToAdd[specDevice.Name]; found {
 
-				if SyncDeviceNodes(specDevice, detectedDevice, device.CardRegexp, device.RenderdRegexp) {
+				if SyncDeviceNodes(specDevice, detectedDevice, device.CardRegexp, device.RenderdRegexp, permissions) {
+					drift.Fixed = append(drift.Fixed, specDevice.Name)
 					specChanged = true
 				}
 
@@ -92,6 +88,7 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 			} else if doCleanup {
 				// skip CDI devices that were not detected
 				klog.V(5).Infof("Removing device %v from CDI registry", specDevice.Name)
+				drift.Removed = append(drift.Removed, specDevice.Name)
 				specChanged = true
 			} else {
 				filteredDevices = append(filteredDevices, specDevice)
@@ -105,7 +102,7 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 			err := cdiCache.WriteSpec(vendorSpec.Spec, specName)
 			if err != nil {
 				klog.Errorf("failed writing CDI spec %v: %v", vendorSpec.GetPath(), err)
-				return fmt.Errorf("failed writing CDI spec %v: %v", vendorSpec.GetPath(), err)
+				return drift, fmt.Errorf("failed writing CDI spec %v: %v", vendorSpec.GetPath(), err)
 			}
 		}
 	}
@@ -114,13 +111,13 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 		// add devices that were not found in registry to the first existing vendor spec
 		apispec := vendorSpecs[0]
 		klog.V(5).Infof("Adding %d devices to CDI spec", len(devicesToAdd))
-		AddDevicesToSpec(devicesToAdd, apispec.Spec)
+		AddDevicesToSpec(devicesToAdd, apispec.Spec, permissions)
 		specName := path.Base(apispec.GetPath())
 
 		cdiVersion, err := cdiapi.MinimumRequiredVersion(apispec.Spec)
 		if err != nil {
 			klog.Errorf("failed to get minimum CDI version for spec %v: %v", apispec.GetPath(), err)
-			return fmt.Errorf("failed to get minimum CDI version for spec %v: %v", apispec.GetPath(), err)
+			return drift, fmt.Errorf("failed to get minimum CDI version for spec %v: %v", apispec.GetPath(), err)
 		}
 		if apispec.Version != cdiVersion {
 			apispec.Version = cdiVersion
@@ -130,16 +127,16 @@ func SyncDetectedDevicesWithRegistry(cdiCache *cdiapi.Cache, detectedDevices dev
 		err = cdiCache.WriteSpec(apispec.Spec, specName)
 		if err != nil {
 			klog.Errorf("failed to write CDI spec %v: %v", apispec.GetPath(), err)
-			return fmt.Errorf("failed write CDI spec %v: %v", apispec.GetPath(), err)
+			return drift, fmt.Errorf("failed write CDI spec %v: %v", apispec.GetPath(), err)
 		}
 	}
 
-	return nil
+	return drift, nil
 }
 
 func SyncDeviceNodes(
 	specDevice specs.Device, detectedDevice *device.DeviceInfo,
-	cardregexp *regexp.Regexp, renderdregexp *regexp.Regexp) bool {
+	cardregexp *regexp.Regexp, renderdregexp *regexp.Regexp, permissions DeviceNodePermissions) bool {
 	specChanged := false
 	dridevpath := device.GetDevfsDriDir()
 
@@ -158,6 +155,10 @@ func SyncDeviceNodes(
 				deviceNode.Path = path.Join(dridevpath, fmt.Sprintf("card%d", detectedDevice.CardIdx))
 				specChanged = true
 			}
+			if permissions.apply(deviceNode) {
+				klog.V(5).Infof("Fixing card permissions for CDI device %v", detectedDevice.UID)
+				specChanged = true
+			}
 		case renderdregexp.MatchString(driFileName):
 			klog.V(5).Infof("CDI device node %v is a renderD device: %v", deviceNodeIdx, driFileName)
 			renderdIdx, err := strconv.ParseUint(strings.Split(driFileName, "renderD")[1], 10, 64)
@@ -170,6 +171,10 @@ func SyncDeviceNodes(
 				deviceNode.Path = path.Join(dridevpath, fmt.Sprintf("renderD%d", detectedDevice.RenderdIdx))
 				specChanged = true
 			}
+			if permissions.apply(deviceNode) {
+				klog.V(5).Infof("Fixing renderD permissions for CDI device %v", detectedDevice.UID)
+				specChanged = true
+			}
 		default:
 			klog.Warningf("Unexpected device node %v in CDI device %v", deviceNode.Path, specDevice.Name)
 		}
@@ -178,14 +183,14 @@ func SyncDeviceNodes(
 }
 
 // addNewDevicesToNewRegistry writes devices into new vendor-specific CDI spec, should only be called if such spec does not exist.
-func addNewDevicesToNewRegistry(cdiCache *cdiapi.Cache, devices device.DevicesInfo) error {
+func addNewDevicesToNewRegistry(cdiCache *cdiapi.Cache, devices device.DevicesInfo, permissions DeviceNodePermissions) error {
 	klog.V(5).Infof("Adding %v devices to new spec", len(devices))
 
 	spec := &specs.Spec{
 		Kind: device.CDIKind,
 	}
 
-	AddDevicesToSpec(devices, spec)
+	AddDevicesToSpec(devices, spec, permissions)
 	klog.V(5).Infof("spec devices length: %v", len(spec.Devices))
 
 	cdiVersion, err := cdiapi.MinimumRequiredVersion(spec)
@@ -209,7 +214,9 @@ func addNewDevicesToNewRegistry(cdiCache *cdiapi.Cache, devices device.DevicesIn
 	return nil
 }
 
-func AddDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec) {
+// AddDevicesToSpec adds the DRI device nodes of devices, with the given
+// permissions, and their by-path mounts to the spec.
+func AddDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec, permissions DeviceNodePermissions) {
 	devdriPath := device.GetDevfsDriDir()
 
 	for name, device := range devices {
@@ -238,6 +245,10 @@ func AddDevicesToSpec(devices device.DevicesInfo, spec *specs.Spec) {
 			)
 		}
 
+		for _, deviceNode := range newDevice.ContainerEdits.DeviceNodes {
+			permissions.apply(deviceNode)
+		}
+
 		addBypathMounts(device, &newDevice, devdriPath)
 
 		spec.Devices = append(spec.Devices, newDevice)
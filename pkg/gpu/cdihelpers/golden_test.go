@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdihelpers_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+// TestCDISpecsGolden generates CDI specs from fake sysfs for typical GPU
+// setups and compares them with testdata/<name>.yaml. Update the golden files
+// with UPDATE_GOLDEN=1 when the change of the specs is intended.
+func TestCDISpecsGolden(t *testing.T) {
+	flex170 := device.DevicesInfo{
+		"0000-03-00-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-03-00-0-0x56c0", Serial: "00000000000a0b0c"},
+		"0000-04-00-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-04-00-0-0x56c0"},
+	}
+
+	testcases := []struct {
+		name        string
+		namingStyle string
+		devices     device.DevicesInfo
+		mode        string
+	}{
+		{name: "flex170-machine", namingStyle: device.DefaultNamingStyle, devices: flex170},
+		{name: "flex170-classic", namingStyle: "classic", devices: flex170},
+		{name: "flex170-serial", namingStyle: device.SerialNamingStyle, devices: flex170},
+		{name: "flex170-mode", namingStyle: device.DefaultNamingStyle, devices: flex170, mode: "0660"},
+		{
+			name:        "flex170-vfs",
+			namingStyle: device.DefaultNamingStyle,
+			devices: device.DevicesInfo{
+				"0000-03-00-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-03-00-0-0x56c0", MaxVFs: 16},
+				"0000-03-00-1-0x56c0": {Model: "0x56c0", MemoryMiB: 8064, DeviceType: "vf", CardIdx: 1, RenderdIdx: 129, UID: "0000-03-00-1-0x56c0", VFIndex: 0, VFProfile: "flex170_m2", ParentUID: "0000-03-00-0-0x56c0"},
+				"0000-03-00-2-0x56c0": {Model: "0x56c0", MemoryMiB: 8064, DeviceType: "vf", CardIdx: 2, RenderdIdx: 130, UID: "0000-03-00-2-0x56c0", VFIndex: 1, VFProfile: "flex170_m2", ParentUID: "0000-03-00-0-0x56c0"},
+			},
+		},
+		{
+			name:        "max1100",
+			namingStyle: device.DefaultNamingStyle,
+			devices: device.DevicesInfo{
+				"0000-29-00-0-0x0bd9": {Model: "0x0bd9", MemoryMiB: 49152, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-29-00-0-0x0bd9", Driver: device.XeDriver},
+			},
+		},
+		{
+			name:        "max1550",
+			namingStyle: device.DefaultNamingStyle,
+			devices: device.DevicesInfo{
+				"0000-29-00-0-0x0bd5": {Model: "0x0bd5", MemoryMiB: 131072, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-29-00-0-0x0bd5", Driver: device.XeDriver},
+				"0000-3a-00-0-0x0bd5": {Model: "0x0bd5", MemoryMiB: 131072, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-3a-00-0-0x0bd5", Driver: device.XeDriver},
+			},
+		},
+		{
+			name:        "arc",
+			namingStyle: device.DefaultNamingStyle,
+			devices: device.DevicesInfo{
+				"0000-03-00-0-0x56a0": {Model: "0x56a0", MemoryMiB: 16384, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-03-00-0-0x56a0"},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			testDirs, err := helpers.NewTestDirs(device.DriverName)
+			if err != nil {
+				t.Fatalf("could not create fake system dirs: %v", err)
+			}
+			defer os.RemoveAll(testDirs.TestRoot)
+			t.Setenv(device.DevDriEnvVarName, path.Join(testDirs.DevfsRoot, "dri"))
+
+			if err := fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, testcase.devices, false); err != nil {
+				t.Fatalf("setup error: could not create fake sysfs: %v", err)
+			}
+
+			permissions, err := cdihelpers.ParseDeviceNodePermissions(-1, -1, testcase.mode)
+			if err != nil {
+				t.Fatalf("invalid device node mode: %v", err)
+			}
+
+			cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(testDirs.CdiRoot), cdiapi.WithAutoRefresh(false))
+			if err != nil {
+				t.Fatalf("could not create CDI cache: %v", err)
+			}
+
+			detected := discovery.DiscoverDevices(testDirs.SysfsRoot, testcase.namingStyle)
+			if len(detected) != len(testcase.devices) {
+				t.Fatalf("expected %d devices, detected %d: %v", len(testcase.devices), len(detected), detected)
+			}
+			if _, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detected, true, permissions); err != nil {
+				t.Fatalf("could not write CDI specs: %v", err)
+			}
+
+			specs, err := helpers.GoldenCDISpecs(testDirs.CdiRoot, testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			helpers.CompareGolden(t, path.Join("testdata", testcase.name+".yaml"), specs)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdihelpers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	specs "tags.cncf.io/container-device-interface/specs-go"
+)
+
+// DeviceNodePermissions are the owner and mode of the DRI device nodes created
+// in containers, e.g. the render group ID of the container image, so that
+// non-root containers can open the devices. Unset fields keep the owner and
+// mode of the host device nodes.
+type DeviceNodePermissions struct {
+	UID      *uint32
+	GID      *uint32
+	FileMode *os.FileMode
+}
+
+// ParseDeviceNodePermissions parses device node uid and gid, negative when
+// not set, and octal mode, e.g. 0660, empty when not set.
+func ParseDeviceNodePermissions(uid int64, gid int64, mode string) (DeviceNodePermissions, error) {
+	permissions := DeviceNodePermissions{}
+
+	for _, id := range []struct {
+		name  string
+		value int64
+		field **uint32
+	}{
+		{"uid", uid, &permissions.UID},
+		{"gid", gid, &permissions.GID},
+	} {
+		if id.value < 0 {
+			continue
+		}
+		if id.value > int64(^uint32(0)) {
+			return DeviceNodePermissions{}, fmt.Errorf("invalid device node %v %d", id.name, id.value)
+		}
+		value := uint32(id.value)
+		*id.field = &value
+	}
+
+	if mode != "" {
+		value, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || value > 0777 {
+			return DeviceNodePermissions{}, fmt.Errorf("invalid device node mode %q, expected octal permissions like 0660", mode)
+		}
+		fileMode := os.FileMode(value)
+		permissions.FileMode = &fileMode
+	}
+
+	return permissions, nil
+}
+
+// apply sets the permissions to the CDI device node, and returns true when
+// the device node was changed.
+func (p DeviceNodePermissions) apply(deviceNode *specs.DeviceNode) bool {
+	changed := false
+
+	if !equalPtr(deviceNode.UID, p.UID) {
+		deviceNode.UID = clonePtr(p.UID)
+		changed = true
+	}
+	if !equalPtr(deviceNode.GID, p.GID) {
+		deviceNode.GID = clonePtr(p.GID)
+		changed = true
+	}
+	if !equalPtr(deviceNode.FileMode, p.FileMode) {
+		deviceNode.FileMode = clonePtr(p.FileMode)
+		changed = true
+	}
+
+	return changed
+}
+
+func equalPtr[T comparable](a *T, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func clonePtr[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	clone := *value
+	return &clone
+}
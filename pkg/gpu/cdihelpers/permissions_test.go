@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdihelpers_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	specs "tags.cncf.io/container-device-interface/specs-go"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+func TestParseDeviceNodePermissions(t *testing.T) {
+	testcases := []struct {
+		uid  int64
+		gid  int64
+		mode string
+		pass bool
+	}{
+		{-1, -1, "", true},
+		{0, 110, "0660", true},
+		{1000, -1, "666", true},
+		{-1, 4294967296, "", false},
+		{-1, -1, "0999", false},
+		{-1, -1, "01777", false},
+		{-1, -1, "rw", false},
+	}
+
+	for _, testcase := range testcases {
+		permissions, err := cdihelpers.ParseDeviceNodePermissions(testcase.uid, testcase.gid, testcase.mode)
+		if testcase.pass != (err == nil) {
+			t.Errorf("%d:%d %q: unexpected result: %v", testcase.uid, testcase.gid, testcase.mode, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if (permissions.UID == nil) != (testcase.uid < 0) || (permissions.UID != nil && int64(*permissions.UID) != testcase.uid) {
+			t.Errorf("%d:%d %q: unexpected uid %v", testcase.uid, testcase.gid, testcase.mode, permissions.UID)
+		}
+		if (permissions.GID == nil) != (testcase.gid < 0) || (permissions.GID != nil && int64(*permissions.GID) != testcase.gid) {
+			t.Errorf("%d:%d %q: unexpected gid %v", testcase.uid, testcase.gid, testcase.mode, permissions.GID)
+		}
+		if (permissions.FileMode == nil) != (testcase.mode == "") {
+			t.Errorf("%d:%d %q: unexpected mode %v", testcase.uid, testcase.gid, testcase.mode, permissions.FileMode)
+		}
+	}
+}
+
+func TestSyncDeviceNodePermissions(t *testing.T) {
+	// CDI registry accepts only character devices as device nodes.
+	devfsDriDir := t.TempDir()
+	for _, name := range []string{"card0", "renderD128"} {
+		if err := os.Symlink("/dev/null", path.Join(devfsDriDir, name)); err != nil {
+			t.Fatalf("setup error: could not create fake device node %v: %v", name, err)
+		}
+	}
+	t.Setenv(device.DevDriEnvVarName, devfsDriDir)
+
+	cdiCache, err := cdiapi.NewCache(cdiapi.WithSpecDirs(t.TempDir()), cdiapi.WithAutoRefresh(false))
+	if err != nil {
+		t.Fatalf("could not create CDI cache: %v", err)
+	}
+
+	devices := device.DevicesInfo{
+		"0000-00-02-0-0x56c0": {Model: "0x56c0", DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+	}
+
+	checkDeviceNodes := func(permissions cdihelpers.DeviceNodePermissions) {
+		t.Helper()
+		if err := cdiCache.Refresh(); err != nil {
+			t.Fatalf("could not refresh CDI registry: %v", err)
+		}
+		cdiDevice := cdiCache.GetDevice(device.CDIKind + "=0000-00-02-0-0x56c0")
+		if cdiDevice == nil {
+			t.Fatalf("device not found in CDI registry")
+		}
+		deviceNodes := cdiDevice.ContainerEdits.DeviceNodes
+		if len(deviceNodes) != 2 {
+			t.Fatalf("expected card and renderD device nodes, got %v", deviceNodes)
+		}
+		for _, deviceNode := range deviceNodes {
+			if !sameDeviceNodePermissions(deviceNode, permissions) {
+				t.Errorf("device node %v: expected permissions %+v, got uid %v, gid %v, mode %v",
+					deviceNode.Path, permissions, deviceNode.UID, deviceNode.GID, deviceNode.FileMode)
+			}
+		}
+	}
+
+	permissions, _ := cdihelpers.ParseDeviceNodePermissions(-1, 110, "0660")
+	if _, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, devices.DeepCopy(), true, permissions); err != nil {
+		t.Fatalf("could not add devices to CDI registry: %v", err)
+	}
+	checkDeviceNodes(permissions)
+
+	newPermissions, _ := cdihelpers.ParseDeviceNodePermissions(1000, 1000, "")
+	drift, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, devices.DeepCopy(), true, newPermissions)
+	if err != nil {
+		t.Fatalf("could not sync devices to CDI registry: %v", err)
+	}
+	if len(drift.Fixed) != 1 {
+		t.Errorf("expected permissions of one device to be fixed, got %+v", drift)
+	}
+	checkDeviceNodes(newPermissions)
+
+	// Syncing again with the same permissions, e.g. by the CDI specs generator
+	// given the same arguments as the kubelet-plugin, keeps them.
+	drift, err = cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, devices.DeepCopy(), true, newPermissions)
+	if err != nil {
+		t.Fatalf("could not re-sync devices to CDI registry: %v", err)
+	}
+	if !drift.Empty() {
+		t.Errorf("expected no drift when syncing with the same permissions, got %+v", drift)
+	}
+	checkDeviceNodes(newPermissions)
+}
+
+func sameDeviceNodePermissions(deviceNode *specs.DeviceNode, permissions cdihelpers.DeviceNodePermissions) bool {
+	sameID := func(a, b *uint32) bool { return (a == nil && b == nil) || (a != nil && b != nil && *a == *b) }
+	sameMode := func(a, b *os.FileMode) bool { return (a == nil && b == nil) || (a != nil && b != nil && *a == *b) }
+
+	return sameID(deviceNode.UID, permissions.UID) && sameID(deviceNode.GID, permissions.GID) && sameMode(deviceNode.FileMode, permissions.FileMode)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConfigAPIVersion = "gpu.intel.com/v1alpha1"
+	ConfigKind       = "GpuConfig"
+
+	// minTimeslice is the shortest timeslice both i915 and xe accept.
+	minTimeslice = time.Millisecond
+)
+
+// GpuConfig is the opaque device configuration accepted in ResourceClaims
+// and DeviceClasses.
+type GpuConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	// TimeSlicing sets the scheduler timeslice of the GPU engines, for the
+	// containers sharing the GPU through the same ResourceClaim.
+	TimeSlicing *TimeSlicing `json:"timeSlicing,omitempty"`
+}
+
+// TimeSlicing is the time-sliced sharing mode of a GPU.
+type TimeSlicing struct {
+	// Interval is how long a context runs on an engine before the GPU
+	// scheduler switches to the next context waiting for it.
+	Interval metav1.Duration `json:"interval"`
+}
+
+// DecodeGpuConfig parses and validates opaque device configuration parameters.
+func DecodeGpuConfig(parameters []byte) (*GpuConfig, error) {
+	config := &GpuConfig{}
+
+	decoder := json.NewDecoder(bytes.NewReader(parameters))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("could not parse device configuration: %v", err)
+	}
+
+	if config.APIVersion != ConfigAPIVersion || config.Kind != ConfigKind {
+		return nil, fmt.Errorf("unsupported device configuration '%s/%s', expected '%s/%s'",
+			config.APIVersion, config.Kind, ConfigAPIVersion, ConfigKind)
+	}
+
+	if config.TimeSlicing != nil && config.TimeSlicing.Interval.Duration < minTimeslice {
+		return nil, fmt.Errorf("time-slicing interval %v is shorter than %v", config.TimeSlicing.Interval.Duration, minTimeslice)
+	}
+
+	return config, nil
+}
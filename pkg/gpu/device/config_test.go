@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDecodeGpuConfig(t *testing.T) {
+	testcases := []struct {
+		name       string
+		parameters string
+		interval   time.Duration
+		pass       bool
+	}{
+		{"time-slicing", `{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GpuConfig", "timeSlicing": {"interval": "5ms"}}`, 5 * time.Millisecond, true},
+		{"no settings", `{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GpuConfig"}`, 0, true},
+		{"wrong kind", `{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "VFConfig"}`, 0, false},
+		{"unknown field", `{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GpuConfig", "timeSlicing": {"weight": 2}}`, 0, false},
+		{"too short interval", `{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GpuConfig", "timeSlicing": {"interval": "100us"}}`, 0, false},
+	}
+
+	for _, testcase := range testcases {
+		config, err := DecodeGpuConfig([]byte(testcase.parameters))
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		interval := time.Duration(0)
+		if config.TimeSlicing != nil {
+			interval = config.TimeSlicing.Interval.Duration
+		}
+		if interval != testcase.interval {
+			t.Errorf("%v: expected interval %v, got %v", testcase.name, testcase.interval, interval)
+		}
+	}
+}
+
+func TestTimeslice(t *testing.T) {
+	sysfsDir := t.TempDir()
+
+	testcases := []struct {
+		gpu       DeviceInfo
+		engineDir string
+		file      string
+		value     string
+	}{
+		{DeviceInfo{UID: "0000-00-02-0-0x56c0", PCIAddress: "0000:00:02.0", DeviceType: GpuDeviceType, CardIdx: 1},
+			"bus/pci/drivers/i915/0000:00:02.0/drm/card1/engine/rcs0", "timeslice_duration_ms", "5"},
+		{DeviceInfo{UID: "0000-00-03-0-0x0bd5", PCIAddress: "0000:00:03.0", DeviceType: GpuDeviceType, Driver: XeDriver},
+			"bus/pci/drivers/xe/0000:00:03.0/tile0/gt0/engines/ccs", "timeslice_duration_us", "5000"},
+	}
+
+	for _, testcase := range testcases {
+		engineDir := path.Join(sysfsDir, testcase.engineDir)
+		if err := os.MkdirAll(path.Join(engineDir, engineDefaultsDir), 0750); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+		for _, file := range []string{path.Join(engineDir, testcase.file), path.Join(engineDir, engineDefaultsDir, testcase.file)} {
+			if err := os.WriteFile(file, []byte("1\n"), 0600); err != nil {
+				t.Fatalf("setup error: %v", err)
+			}
+		}
+
+		if err := testcase.gpu.SetTimeslice(sysfsDir, 5*time.Millisecond); err != nil {
+			t.Errorf("%v: could not set timeslice: %v", testcase.gpu.UID, err)
+		}
+		if value, _ := os.ReadFile(path.Join(engineDir, testcase.file)); string(value) != testcase.value {
+			t.Errorf("%v: expected timeslice %v, got %q", testcase.gpu.UID, testcase.value, value)
+		}
+		if interval, modified, err := testcase.gpu.Timeslice(sysfsDir); err != nil || interval != 5*time.Millisecond || !modified {
+			t.Errorf("%v: expected modified timeslice of 5ms, got %v, %v, %v", testcase.gpu.UID, interval, modified, err)
+		}
+
+		if err := testcase.gpu.ResetTimeslice(sysfsDir); err != nil {
+			t.Errorf("%v: could not reset timeslice: %v", testcase.gpu.UID, err)
+		}
+		if value, _ := os.ReadFile(path.Join(engineDir, testcase.file)); string(value) != "1\n" {
+			t.Errorf("%v: expected default timeslice, got %q", testcase.gpu.UID, value)
+		}
+		if _, modified, err := testcase.gpu.Timeslice(sysfsDir); err != nil || modified {
+			t.Errorf("%v: expected default timeslice, got modified %v, %v", testcase.gpu.UID, modified, err)
+		}
+	}
+
+	vf := DeviceInfo{UID: "0000-00-02-1-0x56c0", PCIAddress: "0000:00:02.1", DeviceType: VfDeviceType}
+	if err := vf.SetTimeslice(sysfsDir, 5*time.Millisecond); err == nil {
+		t.Errorf("expected time-slicing of VF to fail")
+	}
+
+	noEngines := DeviceInfo{UID: "0000-00-04-0-0x56c0", PCIAddress: "0000:00:04.0", DeviceType: GpuDeviceType}
+	if err := noEngines.SetTimeslice(sysfsDir, 5*time.Millisecond); err == nil {
+		t.Errorf("expected time-slicing of GPU without engines to fail")
+	}
+}
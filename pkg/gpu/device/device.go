@@ -21,11 +21,15 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
 )
 
 var (
-	PciRegexp     = regexp.MustCompile(`[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+	PciRegexp     = pci.AddressRegexp
 	CardRegexp    = regexp.MustCompile(`^card[0-9]+$`)
 	RenderdRegexp = regexp.MustCompile(`^renderD[0-9]+$`)
 )
@@ -37,15 +41,20 @@ const (
 	// driver.sysfsI915Dir and driver.sysfsDRMDir are sysfsI915path and sysfsDRMpath
 	// respectively prefixed with $SYSFS_ROOT.
 	SysfsI915path    = "bus/pci/drivers/i915"
+	SysfsXePath      = "bus/pci/drivers/xe"
 	SysfsDRMpath     = "class/drm/"
 	sysfsDefaultRoot = "/sys"
 
-	CDIVendor  = "intel.com"
-	CDIClass   = "gpu"
+	// SysfsDebugDRIpath is where debugfs has DRM card dirs, when mounted.
+	SysfsDebugDRIpath = "kernel/debug/dri"
+	sysfsModulePath   = "module"
+
+	CDIVendor  = cdiregistry.Vendor
+	CDIClass   = cdiregistry.GPUClass
 	CDIKind    = CDIVendor + "/" + CDIClass
 	DriverName = CDIClass + "." + CDIVendor
 
-	PCIAddressLength = len("0000:00:00.0")
+	PCIAddressLength = pci.AddressLength
 	UIDLength        = len("0000-00-00-0-0x0000")
 
 	PreparedClaimsFileName  = "preparedClaims.json"
@@ -55,6 +64,18 @@ const (
 	DefaultNamingStyle = "machine"
 	GpuDeviceType      = "gpu"
 	VfDeviceType       = "vf"
+
+	// SystemMemoryType is the memory type of GPUs without local memory.
+	SystemMemoryType = "system"
+
+	// SerialNamingStyle names devices by their serial number, so that the names
+	// do not change when PCI addresses do.
+	SerialNamingStyle = "serial"
+	serialNamePrefix  = "sn-"
+
+	// Kernel mode drivers supported for GPUs.
+	I915Driver = "i915"
+	XeDriver   = "xe"
 )
 
 // VfAttributeFiles is a list of filenames that needs to be configured for a VF
@@ -68,57 +89,6 @@ var VfAttributeFiles = []string{
 	"preempt_timeout_us",
 }
 
-var ModelDetails = map[string]map[string]string{
-	"0x56a0": {
-		"model":  "A770",
-		"family": "Arc",
-	},
-	"0x56a1": {
-		"model":  "A750",
-		"family": "Arc",
-	},
-	"0x56a2": {
-		"model":  "A580",
-		"family": "Arc",
-	},
-	"0x56c0": {
-		"model":  "Flex 170",
-		"family": "Data Center Flex",
-	},
-	"0x56c1": {
-		"model":  "Flex 140",
-		"family": "Data Center Flex",
-	},
-	"0x0b69": {
-		"model":  "Max 1550",
-		"family": "Data Center Max",
-	},
-	"0x0bd0": {
-		"model":  "Max 1550",
-		"family": "Data Center Max",
-	},
-	"0x0bd5": {
-		"model":  "Max 1550",
-		"family": "Data Center Max",
-	},
-	"0x0bd6": {
-		"model":  "Max 1450",
-		"family": "Data Center Max",
-	},
-	"0x0bd9": {
-		"model":  "Max 1100",
-		"family": "Data Center Max",
-	},
-	"0x0bda": {
-		"model":  "Max 1100",
-		"family": "Data Center Max",
-	},
-	"0x0bdb": {
-		"model":  "Max 1100",
-		"family": "Data Center Max",
-	},
-}
-
 // DeviceInfo is an internal structure type to store info about discovered device.
 type DeviceInfo struct {
 	// UID is a unique identifier on node, used in ResourceSlice K8s API object as RFC1123-compliant identifier.
@@ -131,6 +101,10 @@ type DeviceInfo struct {
 	CardIdx     uint64 `json:"cardidx"`     // card device number (e.g. 0 for /dev/dri/card0)
 	RenderdIdx  uint64 `json:"renderdidx"`  // renderD device number (e.g. 128 for /dev/dri/renderD128)
 	MemoryMiB   uint64 `json:"memorymib"`   // in MiB
+	TileCount   uint64 `json:"tilecount"`   // number of tiles (GTs), 0 when unknown
+	PCIeGen     uint64 `json:"pciegen"`     // PCIe generation of current link, 0 when unknown
+	PCIeWidth   uint64 `json:"pciewidth"`   // current PCIe link width, number of lanes
+	PCIeMaxMTs  uint64 `json:"pciemaxmts"`  // maximum PCIe link speed in MT/s
 	Millicores  uint64 `json:"millicores"`  // [0-1000] where 1000 means whole GPU.
 	DeviceType  string `json:"devicetype"`  // gpu, vf, any
 	MaxVFs      uint64 `json:"maxvfs"`      // if enabled, non-zero maximum amount of VFs
@@ -138,6 +112,17 @@ type DeviceInfo struct {
 	VFProfile   string `json:"vfprofile"`   // name of the SR-IOV profile
 	VFIndex     uint64 `json:"vfindex"`     // 0-based PCI index of the VF on the GPU, DRM indexing starts with 1
 	Provisioned bool   `json:"provisioned"` // true if the SR-IOV VF is configured and enabled
+	Driver      string `json:"driver"`      // kernel mode driver, i915 or xe, empty means i915
+	DriverVer   string `json:"driverver"`   // kernel mode driver version, or kernel release of in-tree driver
+	GuCVersion  string `json:"gucversion"`  // loaded GuC firmware version, empty when unknown
+	HuCVersion  string `json:"hucversion"`  // loaded HuC firmware version, empty when unknown
+	XeCores     uint64 `json:"xecores"`     // number of Xe-cores, 0 when unknown
+	EUs         uint64 `json:"eus"`         // number of execution units (vector engines), 0 when unknown
+	MaxFreqMHz  uint64 `json:"maxfreqmhz"`  // maximum hardware GT frequency in MHz, 0 when unknown
+	Serial      string `json:"serial"`      // PCIe Device Serial Number, 16 hex digits, empty when unknown
+	MemoryType  string `json:"memorytype"`  // local memory type, e.g. HBM2e or GDDR6, or system
+	ECC         *bool  `json:"ecc"`         // ECC of local memory, nil when unknown
+	Exclusive   bool   `json:"exclusive"`   // true if the GPU must not be shared by time-slicing
 }
 
 func (g DeviceInfo) CDIName() string {
@@ -166,6 +151,9 @@ func (g *DeviceInfo) SetModelInfo() {
 	if deviceDetails, found := ModelDetails[g.Model]; found {
 		g.ModelName = deviceDetails["model"]
 		g.FamilyName = deviceDetails["family"]
+		g.XeCores, _ = strconv.ParseUint(deviceDetails["xecores"], 10, 64)
+		g.EUs, _ = strconv.ParseUint(deviceDetails["eus"], 10, 64)
+		g.MemoryType = deviceDetails["memorytype"]
 
 		return
 	}
@@ -174,25 +162,55 @@ func (g *DeviceInfo) SetModelInfo() {
 	g.FamilyName = "Unknown"
 }
 
+// SysfsDriverPath returns sysfs PCI driver directory, relative to sysfs root,
+// of the kernel mode driver the device is bound to.
+func (g *DeviceInfo) SysfsDriverPath() string {
+	if g.Driver == XeDriver {
+		return SysfsXePath
+	}
+	return SysfsI915path
+}
+
+// MemoryBandwidthClass returns the bandwidth class of the memory type: high
+// for HBM, medium for GDDR, low for system memory, or empty string.
+func (g *DeviceInfo) MemoryBandwidthClass() string {
+	switch {
+	case strings.HasPrefix(g.MemoryType, "HBM"):
+		return "high"
+	case strings.HasPrefix(g.MemoryType, "GDDR"):
+		return "medium"
+	case g.MemoryType == SystemMemoryType:
+		return "low"
+	}
+	return ""
+}
+
+// SerialName returns the device name based on its serial number, or empty
+// string when the serial number is unknown.
+func (g *DeviceInfo) SerialName() string {
+	if g.Serial == "" {
+		return ""
+	}
+	return serialNamePrefix + g.Serial
+}
+
+// SysfsModuleVersionPath returns path of the version file of the kernel
+// module, relative to sysfs root. Only out-of-tree modules have it.
+func SysfsModuleVersionPath(driver string) string {
+	return path.Join(sysfsModulePath, driver, "version")
+}
+
 // DevicesInfo is a dictionary with DeviceInfo.uid being the key.
 type DevicesInfo map[string]*DeviceInfo
 
 func DeviceUIDFromPCIinfo(pciAddress string, pciid string) string {
 	// 0000:00:01.0, 0x0000 -> 0000-00-01-0-0x0000
-	// Replace colons and the dot in PCI address with hyphens.
-	rfc1123PCIaddress := strings.ReplaceAll(strings.ReplaceAll(pciAddress, ":", "-"), ".", "-")
-	newUID := fmt.Sprintf("%v-%v", rfc1123PCIaddress, pciid)
-
-	return newUID
+	return pci.DeviceUID(pciAddress, pciid)
 }
 
 func PciInfoFromDeviceUID(deviceUID string) (string, string) {
 	// 0000-00-01-0-0x0000 -> 0000:00:01.0, 0x0000
-	rfc1123PCIaddress := deviceUID[:PCIAddressLength]
-	pciAddress := strings.Replace(strings.Replace(rfc1123PCIaddress, "-", ":", 2), "-", ".", 1)
-	deviceId := deviceUID[PCIAddressLength:]
-
-	return pciAddress, deviceId
+	return pci.ParseDeviceUID(deviceUID)
 }
 
 func (g *DevicesInfo) DeepCopy() DevicesInfo {
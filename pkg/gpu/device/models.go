@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+var modelIDRegexp = regexp.MustCompile(`^0x[0-9a-f]{4}$`)
+
+// defaultModels are the details of supported GPUs, by PCI device ID.
+//
+//go:embed models.json
+var defaultModels []byte
+
+// ModelDetails are the details of supported GPUs by PCI device ID: "model" and
+// "family" names, optional "xecores" and "eus" counts, and local "memorytype".
+// ECC of local memory depends on the GPU configuration and is detected.
+var ModelDetails = mustParseModels(defaultModels)
+
+func mustParseModels(data []byte) map[string]map[string]string {
+	models, err := parseModels(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded GPU models: %v", err))
+	}
+
+	return models
+}
+
+func parseModels(data []byte) (map[string]map[string]string, error) {
+	models := map[string]map[string]string{}
+	if err := yaml.UnmarshalStrict(data, &models); err != nil {
+		return nil, err
+	}
+
+	for modelID, details := range models {
+		if !modelIDRegexp.MatchString(modelID) {
+			return nil, fmt.Errorf("invalid PCI device ID %q, expected e.g. 0x56c0", modelID)
+		}
+		if details["model"] == "" || details["family"] == "" {
+			return nil, fmt.Errorf("device %v has no model or family name", modelID)
+		}
+	}
+
+	return models, nil
+}
+
+// LoadModelDetails adds GPU models from JSON or YAML file to ModelDetails,
+// replacing the details of already known models.
+func LoadModelDetails(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("could not read GPU models file: %v", err)
+	}
+
+	models, err := parseModels(data)
+	if err != nil {
+		return fmt.Errorf("could not parse GPU models file %v: %v", filePath, err)
+	}
+
+	for modelID, details := range models {
+		ModelDetails[modelID] = details
+	}
+
+	return nil
+}
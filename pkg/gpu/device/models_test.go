@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadModelDetails(t *testing.T) {
+	t.Cleanup(func() { ModelDetails = mustParseModels(defaultModels) })
+
+	if ModelDetails["0x56c0"]["model"] != "Flex 170" {
+		t.Fatalf("embedded GPU models not loaded: %v", ModelDetails["0x56c0"])
+	}
+
+	testcases := []struct {
+		name     string
+		contents string
+		pass     bool
+	}{
+		{"yaml", "\"0xe20b\":\n  model: B580\n  family: Arc\n  xecores: \"20\"\n\"0x56c0\":\n  model: Flex 170 new\n  family: Data Center Flex\n", true},
+		{"json", `{"0xe20c": {"model": "B570", "family": "Arc"}}`, true},
+		{"no family", `{"0xe20d": {"model": "B999"}}`, false},
+		{"invalid device ID", `{"e20b": {"model": "B580", "family": "Arc"}}`, false},
+		{"invalid format", `["0xe20b"]`, false},
+	}
+
+	for _, testcase := range testcases {
+		filePath := path.Join(t.TempDir(), "models")
+		if err := os.WriteFile(filePath, []byte(testcase.contents), 0600); err != nil {
+			t.Fatalf("setup error: could not write models file: %v", err)
+		}
+
+		err := LoadModelDetails(filePath)
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+		}
+	}
+
+	gpu := DeviceInfo{Model: "0xe20b"}
+	gpu.SetModelInfo()
+	if gpu.ModelName != "B580" || gpu.FamilyName != "Arc" || gpu.XeCores != 20 {
+		t.Errorf("unexpected details of loaded model: %+v", gpu)
+	}
+
+	if ModelDetails["0x56c0"]["model"] != "Flex 170 new" || ModelDetails["0xe20c"]["model"] != "B570" {
+		t.Errorf("loaded models not added: %v, %v", ModelDetails["0x56c0"], ModelDetails["0xe20c"])
+	}
+
+	if err := LoadModelDetails(path.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing models file")
+	}
+}
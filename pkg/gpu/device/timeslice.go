@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// engineDefaultsDir is the engine sysfs dir with the values the KMD booted with.
+const engineDefaultsDir = ".defaults"
+
+// timesliceFiles returns the scheduler timeslice files of all engines of the
+// GPU and the time unit of their values: milliseconds for i915 and
+// microseconds for xe.
+func (g *DeviceInfo) timesliceFiles(sysfsDir string) ([]string, time.Duration) {
+	deviceDir := path.Join(sysfsDir, g.SysfsDriverPath(), g.PCIAddress)
+
+	if g.Driver == XeDriver {
+		files, _ := filepath.Glob(path.Join(deviceDir, "tile*", "gt*", "engines", "*", "timeslice_duration_us"))
+		return files, time.Microsecond
+	}
+
+	files, _ := filepath.Glob(path.Join(deviceDir, "drm", fmt.Sprintf("card%d", g.CardIdx), "engine", "*", "timeslice_duration_ms"))
+	return files, time.Millisecond
+}
+
+// SetTimeslice sets the scheduler timeslice of all engines of the GPU.
+func (g *DeviceInfo) SetTimeslice(sysfsDir string, interval time.Duration) error {
+	if g.DeviceType != GpuDeviceType {
+		return fmt.Errorf("time-slicing is not supported for %v device %v", g.DeviceType, g.UID)
+	}
+
+	files, unit := g.timesliceFiles(sysfsDir)
+	if len(files) == 0 {
+		return fmt.Errorf("no engine timeslice found for GPU %v", g.UID)
+	}
+
+	value := fmt.Sprint(int64(interval / unit))
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte(value), 0600); err != nil {
+			return fmt.Errorf("could not set engine timeslice of GPU %v: %v", g.UID, err)
+		}
+	}
+
+	return nil
+}
+
+// ResetTimeslice restores the default scheduler timeslice of all engines of
+// the GPU.
+func (g *DeviceInfo) ResetTimeslice(sysfsDir string) error {
+	if g.DeviceType != GpuDeviceType {
+		return nil
+	}
+
+	files, _ := g.timesliceFiles(sysfsDir)
+	for _, file := range files {
+		defaultFile := path.Join(path.Dir(file), engineDefaultsDir, path.Base(file))
+		defaultValue, err := os.ReadFile(defaultFile)
+		if err != nil {
+			return fmt.Errorf("could not read default engine timeslice of GPU %v: %v", g.UID, err)
+		}
+
+		currentValue, err := os.ReadFile(file)
+		if err == nil && strings.TrimSpace(string(currentValue)) == strings.TrimSpace(string(defaultValue)) {
+			continue
+		}
+
+		if err := os.WriteFile(file, defaultValue, 0600); err != nil {
+			return fmt.Errorf("could not reset engine timeslice of GPU %v: %v", g.UID, err)
+		}
+	}
+
+	return nil
+}
+
+// Timeslice returns the scheduler timeslice of the GPU engines, and whether it
+// differs from the default timeslice the KMD booted with.
+func (g *DeviceInfo) Timeslice(sysfsDir string) (time.Duration, bool, error) {
+	files, unit := g.timesliceFiles(sysfsDir)
+	if len(files) == 0 {
+		return 0, false, fmt.Errorf("no engine timeslice found for GPU %v", g.UID)
+	}
+
+	currentValue, err := os.ReadFile(files[0])
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read engine timeslice of GPU %v: %v", g.UID, err)
+	}
+	defaultValue, err := os.ReadFile(path.Join(path.Dir(files[0]), engineDefaultsDir, path.Base(files[0])))
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read default engine timeslice of GPU %v: %v", g.UID, err)
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(string(currentValue)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not parse engine timeslice of GPU %v: %v", g.UID, err)
+	}
+
+	return time.Duration(value) * unit, strings.TrimSpace(string(currentValue)) != strings.TrimSpace(string(defaultValue)), nil
+}
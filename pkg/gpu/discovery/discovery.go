@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
 
 	"k8s.io/klog/v2"
 )
@@ -33,41 +34,47 @@ const (
 	initialMillicores = 1000
 )
 
-// Detect devices from sysfs. Only i915 KMD is supported at the moment.
+// Detect devices from sysfs. GPUs bound to i915 and xe KMDs are supported.
 func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo {
+	sysfs := pci.NewSysfs(sysfsDir)
+	devices := make(map[string]*device.DeviceInfo)
 
-	sysfsI915Dir := path.Join(sysfsDir, device.SysfsI915path)
-	sysfsDRMDir := path.Join(sysfsDir, device.SysfsDRMpath)
+	for _, driver := range []string{device.I915Driver, device.XeDriver} {
+		discoverDriverDevices(sysfs, driver, namingStyle, devices)
+	}
 
-	devices := make(map[string]*device.DeviceInfo)
+	if len(devices) == 0 {
+		klog.V(5).Infof("No Intel GPU devices found on this host in %v", sysfsDir)
+	}
 
-	files, err := os.ReadDir(sysfsI915Dir)
+	return devices
+}
 
+// discoverDriverDevices adds GPUs bound to given KMD to devices.
+func discoverDriverDevices(sysfs *pci.Sysfs, driver string, namingStyle string, devices map[string]*device.DeviceInfo) {
+	sysfsDriverDir := sysfs.DriverDir(driver)
+	sysfsDRMDir := path.Join(sysfs.Root, device.SysfsDRMpath)
+
+	pciAddresses, err := sysfs.DriverDevices(driver)
 	if err != nil {
-		if err == os.ErrNotExist {
-			klog.V(5).Infof("No Intel GPU devices found on this host. %v does not exist", sysfsI915Dir)
-			return devices
-		}
 		klog.Errorf("could not read sysfs directory: %v", err)
-		return devices
+		return
 	}
 
-	for _, pciAddress := range files {
-		devicePCIAddress := pciAddress.Name()
-		// check if file is PCI device
-		if !device.PciRegexp.MatchString(devicePCIAddress) {
-			continue
-		}
-		klog.V(5).Infof("Found GPU PCI device: %s", devicePCIAddress)
+	driverVersion := ""
+	if len(pciAddresses) > 0 {
+		driverVersion = getDriverVersion(sysfs.Root, driver)
+	}
+
+	for _, devicePCIAddress := range pciAddresses {
+		klog.V(5).Infof("Found %v GPU PCI device: %s", driver, devicePCIAddress)
 
-		deviceI915Dir := path.Join(sysfsI915Dir, devicePCIAddress)
-		deviceIdFile := path.Join(deviceI915Dir, "device")
-		deviceIdBytes, err := os.ReadFile(deviceIdFile)
+		deviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
+		deviceId, err := sysfs.DeviceID(deviceDir)
 		if err != nil {
-			klog.Errorf("Failed reading device file (%s): %+v", deviceIdFile, err)
+			klog.Errorf("Failed reading device file of %s: %+v", devicePCIAddress, err)
 			continue
 		}
-		deviceId := strings.TrimSpace(string(deviceIdBytes))
 		uid := device.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
 		klog.V(5).Infof("New gpu UID: %v", uid)
 		newDeviceInfo := &device.DeviceInfo{
@@ -79,10 +86,12 @@ func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo
 			DeviceType: device.GpuDeviceType, // presume GPU, detect the physfn / parent lower
 			CardIdx:    0,
 			RenderdIdx: 0,
+			Driver:     driver,
+			DriverVer:  driverVersion,
 		}
 		newDeviceInfo.SetModelInfo()
 
-		cardIdx, renderdIdx, err := DeduceCardAndRenderdIndexes(deviceI915Dir)
+		cardIdx, renderdIdx, err := DeduceCardAndRenderdIndexes(deviceDir)
 		if err != nil {
 			continue
 		}
@@ -90,14 +99,39 @@ func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo
 		newDeviceInfo.CardIdx = cardIdx
 		newDeviceInfo.RenderdIdx = renderdIdx
 
-		drmGpuDir := path.Join(sysfsDRMDir, fmt.Sprintf("card%d", cardIdx))
-		newDeviceInfo.MemoryMiB = getLocalMemoryAmountMiB(drmGpuDir)
+		if driver == device.XeDriver {
+			newDeviceInfo.MemoryMiB = getXeLocalMemoryAmountMiB(deviceDir)
+			newDeviceInfo.TileCount = getXeTileCount(deviceDir)
+			newDeviceInfo.MaxFreqMHz = getXeMaxFrequencyMHz(deviceDir)
+		} else {
+			drmGpuDir := path.Join(sysfsDRMDir, fmt.Sprintf("card%d", cardIdx))
+			newDeviceInfo.MemoryMiB = getLocalMemoryAmountMiB(drmGpuDir)
+			newDeviceInfo.TileCount = getTileCount(drmGpuDir)
+			newDeviceInfo.MaxFreqMHz = readUintFile(path.Join(drmGpuDir, "gt_RP0_freq_mhz"))
+		}
 
-		detectSRIOV(newDeviceInfo, sysfsI915Dir, devicePCIAddress, deviceId)
-		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
-	}
+		if newDeviceInfo.MemoryMiB == 0 {
+			// no local memory, ECC of system memory is not known
+			newDeviceInfo.MemoryType = device.SystemMemoryType
+		} else {
+			detectECC(sysfs.Root, newDeviceInfo)
+		}
 
-	return devices
+		detectPCIeLink(sysfs, newDeviceInfo, deviceDir)
+		if serial, err := sysfs.SerialNumber(deviceDir); err == nil {
+			newDeviceInfo.Serial = serial
+		} else {
+			klog.V(5).Infof("Could not read serial number of %s: %v", devicePCIAddress, err)
+		}
+		detectFirmwareVersions(sysfs.Root, newDeviceInfo)
+		detectSRIOV(sysfs, newDeviceInfo, sysfsDriverDir, devicePCIAddress, deviceId)
+		deviceName := determineDeviceName(newDeviceInfo, namingStyle)
+		if _, found := devices[deviceName]; found {
+			klog.Warningf("Device name %v of %v is not unique, using UID", deviceName, newDeviceInfo.UID)
+			deviceName = newDeviceInfo.UID
+		}
+		devices[deviceName] = newDeviceInfo
+	}
 }
 
 func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
@@ -105,29 +139,46 @@ func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
 		return "card" + strconv.FormatUint(info.CardIdx, 10)
 	}
 
+	// VFs may report serial number of their PF, devices without serial
+	// number fall back to UID
+	if namingStyle == device.SerialNamingStyle && info.DeviceType == device.GpuDeviceType && info.SerialName() != "" {
+		return info.SerialName()
+	}
+
 	return info.UID
 }
 
+// detectPCIeLink sets PCIe link generation, width and maximum speed of the GPU.
+// Link of a VF is usually unknown.
+func detectPCIeLink(sysfs *pci.Sysfs, newDeviceInfo *device.DeviceInfo, deviceDir string) {
+	link, err := sysfs.Link(deviceDir)
+	if err != nil {
+		klog.V(5).Infof("Could not read PCIe link of %s: %v", newDeviceInfo.PCIAddress, err)
+		return
+	}
+
+	newDeviceInfo.PCIeGen = link.Generation()
+	newDeviceInfo.PCIeWidth = link.Width
+	newDeviceInfo.PCIeMaxMTs = link.MaxSpeed
+}
+
 // Detects if the GPU is a VF or PF. For PF check if SR-IOV is enabled, and the maximum
 // number of VFs. For VF detects parent PR.
-func detectSRIOV(newDeviceInfo *device.DeviceInfo, sysfsI915Dir string, devicePCIAddress string, deviceID string) {
-	deviceI915Dir := path.Join(sysfsI915Dir, devicePCIAddress)
-	totalvfsFile := path.Join(deviceI915Dir, "sriov_totalvfs")
-	totalvfsByte, err := os.ReadFile(totalvfsFile)
+func detectSRIOV(sysfs *pci.Sysfs, newDeviceInfo *device.DeviceInfo, sysfsDriverDir string, devicePCIAddress string, deviceID string) {
+	deviceDir := path.Join(sysfsDriverDir, devicePCIAddress)
+	totalvfs, err := sysfs.TotalVFs(deviceDir)
 	if err != nil {
-		klog.V(5).Infof("Could not read totalvfs file (%s): %+v. Checking for physfn.", totalvfsFile, err)
+		klog.V(5).Infof("Could not read totalvfs of %s: %+v. Checking for physfn.", devicePCIAddress, err)
 		// Detect parent if device this is a VF
-		physfnLink := path.Join(deviceI915Dir, "physfn")
-		parentLink, err := os.Readlink(physfnLink)
+		parentPCIAddress, err := sysfs.PhysFn(deviceDir)
 		if err != nil {
-			klog.Errorf("Failed reading %v: %v. Ignoring SR-IOV for device %v", physfnLink, err, devicePCIAddress)
+			klog.Errorf("Failed reading physfn: %v. Ignoring SR-IOV for device %v", err, devicePCIAddress)
 
 			return
 		}
 
 		// no error, find out which VF index current device belongs to
-		parentPCIAddress := parentLink[3:]
-		vfIdx, err := deduceVfIdx(sysfsI915Dir, parentPCIAddress, devicePCIAddress)
+		vfIdx, err := sysfs.VFIndex(path.Join(sysfsDriverDir, parentPCIAddress), devicePCIAddress)
 		if err != nil {
 			klog.Errorf("Ignoring device %v. Error: %v", devicePCIAddress, err)
 
@@ -145,77 +196,74 @@ func detectSRIOV(newDeviceInfo *device.DeviceInfo, sysfsI915Dir string, devicePC
 		return
 	}
 
-	totalvfsInt, err := strconv.ParseUint(strings.TrimSpace(string(totalvfsByte)), 10, 64)
-	if err != nil {
-		klog.Errorf("Could not convert string into int: %s", string(totalvfsByte))
-
-		return
-	}
-
-	klog.V(5).Infof("Detected SR-IOV capacity, max VFs: %v", totalvfsInt)
+	klog.V(5).Infof("Detected SR-IOV capacity, max VFs: %v", totalvfs)
 
 	// check if driver will pick up new VFs as DRM devices for dynamic provisioning
-	driversAutoprobeFile := path.Join(sysfsI915Dir, devicePCIAddress, "sriov_drivers_autoprobe")
-	driversAutoprobeByte, err := os.ReadFile(driversAutoprobeFile)
+	driversAutoprobe, err := sysfs.ReadFile(deviceDir, "sriov_drivers_autoprobe")
 	if err != nil {
 		klog.V(5).Infof("Could not read sriov_drivers_autoprobe file: %v. Not enabling SR-IOV", err)
 
 		return
 	}
 
-	if strings.TrimSpace(string(driversAutoprobeByte)) == "0" {
+	if driversAutoprobe == "0" {
 		klog.V(5).Info("sriov_drivers_autoprobe disabled. Not enabling SR-IOV")
 
 		return
 	}
 	klog.V(5).Info("Driver autoprobe is enabled, enabling SR-IOV")
-	newDeviceInfo.MaxVFs = totalvfsInt
+	newDeviceInfo.MaxVFs = totalvfs
 }
 
-func deduceVfIdx(sysfsI915Dir string, parentDBDF string, vfDBDF string) (uint64, error) {
-	filePath := path.Join(sysfsI915Dir, parentDBDF, "virtfn*")
+// getTileCount reads the tile count.
+func getTileCount(drmGpuDir string) (numTiles uint64) {
+	filePath := path.Join(drmGpuDir, "gt/gt*")
 	files, _ := filepath.Glob(filePath)
 
-	for _, virtfn := range files {
-		klog.V(5).Infof("Checking %v", virtfn)
-		virtfnTarget, err := os.Readlink(virtfn)
-		if err != nil {
-			klog.Warningf("Failed reading virtfn symlink %v: %v. Skipping", virtfn, err)
-			continue
-		}
+	if len(files) == 0 {
+		return 1
+	}
+	return uint64(len(files))
+}
 
-		// ../0000:00:02.1  # 15 chars
-		if len(virtfnTarget) != 15 {
-			klog.Warningf("Symlink target does not match expected length: %v", virtfnTarget)
-			continue
-		}
+// getXeTileCount returns the number of tileN dirs in xe PCI device dir.
+func getXeTileCount(deviceXeDir string) uint64 {
+	files, _ := filepath.Glob(path.Join(deviceXeDir, "tile[0-9]*"))
 
-		vfBase := path.Base(virtfn)
-		vfIdxStr := vfBase[6:]
-		klog.V(5).Infof("symlink target: %v, VF Base: %v, VF Idx: %s", virtfnTarget, vfBase, vfIdxStr)
-		if virtfnTarget[3:] != vfDBDF {
-			continue
-		}
+	if len(files) == 0 {
+		return 1
+	}
+	return uint64(len(files))
+}
 
-		vfIdx, err := strconv.ParseUint(vfIdxStr, 10, 64)
-		if err != nil {
-			return 0, fmt.Errorf("could not parse VF index (%v): %v", vfIdxStr, err)
-		}
+// getXeMaxFrequencyMHz returns the highest RP0 (maximum hardware) frequency
+// of the GTs of xe GPU.
+func getXeMaxFrequencyMHz(deviceXeDir string) uint64 {
+	filePaths, _ := filepath.Glob(path.Join(deviceXeDir, "tile*", "gt*", "freq0", "rp0_freq"))
 
-		return vfIdx, nil
+	maxFreqMHz := uint64(0)
+	for _, filePath := range filePaths {
+		maxFreqMHz = max(maxFreqMHz, readUintFile(filePath))
 	}
-	return 0, fmt.Errorf("could not find PF %v symlink to VF %v", parentDBDF, vfDBDF)
+
+	return maxFreqMHz
 }
 
-// getTileCount reads the tile count.
-func getTileCount(drmGpuDir string) (numTiles uint64) {
-	filePath := path.Join(drmGpuDir, "gt/gt*")
-	files, _ := filepath.Glob(filePath)
+// readUintFile returns the number in the file, or 0 if it cannot be read.
+func readUintFile(filePath string) uint64 {
+	dat, err := os.ReadFile(filePath)
+	if err != nil {
+		klog.V(5).Infof("could not read file: %v", err)
+		return 0
+	}
 
-	if len(files) == 0 {
-		return 1
+	value, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 10, 64)
+	if err != nil {
+		klog.V(5).Infof("could not parse %v: %v", filePath, err)
+		return 0
 	}
-	return uint64(len(files))
+
+	return value
 }
 
 // Return the amount of local memory GPU has, if any, otherwise shared memory presumed.
@@ -242,13 +290,44 @@ func getLocalMemoryAmountMiB(drmGpuDir string) uint64 {
 	return totalMiB
 }
 
-// deduceCardAndRenderdIndexes arg is device "<sysfs>/bus/pci/drivers/i915/<DBDF>/drm/" path.
-func DeduceCardAndRenderdIndexes(deviceI915Dir string) (uint64, uint64, error) {
+// getXeLocalMemoryAmountMiB returns the amount of local memory of xe GPU, summed
+// from physical_vram_size_bytes of all its tiles. Zero means shared memory.
+func getXeLocalMemoryAmountMiB(deviceXeDir string) uint64 {
+	filePaths, _ := filepath.Glob(path.Join(deviceXeDir, "tile*", "physical_vram_size_bytes"))
+	if len(filePaths) == 0 {
+		klog.Warningf("no local memory detected in %v", deviceXeDir)
+		return 0
+	}
+
+	totalVramBytes := uint64(0)
+	for _, filePath := range filePaths {
+		dat, err := os.ReadFile(filePath)
+		if err != nil {
+			klog.Errorf("could not read file %v: %v", filePath, err)
+			return 0
+		}
+
+		vramBytes, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 64)
+		if err != nil {
+			klog.Errorf("could not convert %v: %v", filePath, err)
+			return 0
+		}
+		totalVramBytes += vramBytes
+	}
+
+	totalMiB := totalVramBytes / (1024 * 1024)
+	klog.V(5).Infof("detected %d MiB local memory, %v tiles", totalMiB, len(filePaths))
+
+	return totalMiB
+}
+
+// deduceCardAndRenderdIndexes arg is device "<sysfs>/bus/pci/drivers/<i915|xe>/<DBDF>/drm/" path.
+func DeduceCardAndRenderdIndexes(deviceDir string) (uint64, uint64, error) {
 	var cardIdx uint64
 	var renderDidx uint64
 
 	// get card and renderD indexes
-	drmDir := path.Join(deviceI915Dir, "drm")
+	drmDir := path.Join(deviceDir, "drm")
 	drmFiles, err := os.ReadDir(drmDir)
 	if err != nil { // ignore this device
 		return 0, 0, fmt.Errorf("cannot read device folder %v: %v", drmDir, err)
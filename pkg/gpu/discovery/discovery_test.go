@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestDiscoverDevices(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+			"0000-00-03-0-0x0bd5": {Model: "0x0bd5", MemoryMiB: 131072, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x0bd5", Driver: device.XeDriver, MaxFreqMHz: 1600},
+			"0000-00-04-0-0x0bd6": {Model: "0x0bd6", MemoryMiB: 65536, DeviceType: "gpu", CardIdx: 2, RenderdIdx: 130, UID: "0000-00-04-0-0x0bd6", MaxFreqMHz: 1550},
+			"0000-00-05-0-0x0bd9": {Model: "0x0bd9", MemoryMiB: 49152, DeviceType: "gpu", CardIdx: 3, RenderdIdx: 131, UID: "0000-00-05-0-0x0bd9", Driver: device.XeDriver},
+			"0000-00-06-0-0xa780": {Model: "0xa780", MemoryMiB: 0, DeviceType: "gpu", CardIdx: 4, RenderdIdx: 132, UID: "0000-00-06-0-0xa780"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	xeDeviceDir := path.Join(testDirs.SysfsRoot, device.SysfsXePath, "0000:00:03.0")
+	for file, value := range map[string]string{
+		"current_link_speed": "16.0 GT/s PCIe",
+		"current_link_width": "16",
+		"max_link_speed":     "32.0 GT/s PCIe",
+		"max_link_width":     "16",
+	} {
+		if err := os.WriteFile(path.Join(xeDeviceDir, file), []byte(value+"\n"), 0600); err != nil {
+			t.Fatalf("setup error: could not write %v: %v", file, err)
+		}
+	}
+
+	for file, value := range map[string]string{
+		device.SysfsModuleVersionPath(device.XeDriver):           "1.2.3",
+		path.Join(device.SysfsDebugDRIpath, "1/gt0/uc/guc_info"): "GuC firmware: xe/pvc_guc_70.bin\n\tstatus: RUNNING\n\tversion: wanted 70.9.1, found 70.20.0\n",
+		path.Join(device.SysfsDebugDRIpath, "1/gt0/uc/huc_info"): "HuC firmware: xe/pvc_huc.bin\n\tstatus: NOT_SUPPORTED\n",
+		path.Join(device.SysfsDebugDRIpath, "1/ecc_state"):       "enabled\n",
+		path.Join(device.SysfsDebugDRIpath, "3/ecc_state"):       "disabled\n",
+		path.Join(device.SysfsDebugDRIpath, "4/ecc_state"):       "enabled\n",
+	} {
+		filePath := path.Join(testDirs.SysfsRoot, file)
+		if err := os.MkdirAll(path.Dir(filePath), 0750); err != nil {
+			t.Fatalf("setup error: could not create dir for %v: %v", file, err)
+		}
+		if err := os.WriteFile(filePath, []byte(value), 0600); err != nil {
+			t.Fatalf("setup error: could not write %v: %v", file, err)
+		}
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+
+	expected := map[string]struct {
+		driver    string
+		memoryMiB uint64
+		cardIdx   uint64
+		tileCount uint64
+		eus       uint64
+		maxFreq   uint64
+	}{
+		"0000-00-02-0-0x56c0": {device.I915Driver, 8192, 0, 1, 512, 0},
+		"0000-00-03-0-0x0bd5": {device.XeDriver, 131072, 1, 2, 1024, 1600},
+		"0000-00-04-0-0x0bd6": {device.I915Driver, 65536, 2, 2, 896, 1550},
+		"0000-00-05-0-0x0bd9": {device.XeDriver, 49152, 3, 1, 448, 0},
+		"0000-00-06-0-0xa780": {device.I915Driver, 0, 4, 1, 0, 0},
+	}
+
+	if len(detected) != len(expected) {
+		t.Fatalf("expected %d devices, detected %d: %v", len(expected), len(detected), detected)
+	}
+
+	for uid, want := range expected {
+		gpu, found := detected[uid]
+		if !found {
+			t.Errorf("device %v was not detected", uid)
+			continue
+		}
+		if gpu.Driver != want.driver || gpu.MemoryMiB != want.memoryMiB || gpu.CardIdx != want.cardIdx || gpu.TileCount != want.tileCount ||
+			gpu.EUs != want.eus || gpu.MaxFreqMHz != want.maxFreq {
+			t.Errorf("device %v: expected driver %v, %d MiB, card%d, %d tiles, %d EUs, %d MHz, got %+v",
+				uid, want.driver, want.memoryMiB, want.cardIdx, want.tileCount, want.eus, want.maxFreq, gpu)
+		}
+	}
+
+	xeGPU := detected["0000-00-03-0-0x0bd5"]
+	if xeGPU.PCIeGen != 4 || xeGPU.PCIeWidth != 16 || xeGPU.PCIeMaxMTs != 32000 {
+		t.Errorf("unexpected PCIe link of %v: %+v", xeGPU.UID, xeGPU)
+	}
+	if xeGPU.DriverVer != "1.2.3" || xeGPU.GuCVersion != "70.20.0" || xeGPU.HuCVersion != "" {
+		t.Errorf("unexpected versions of %v: %+v", xeGPU.UID, xeGPU)
+	}
+
+	if xeGPU.MemoryType != "HBM2e" || xeGPU.MemoryBandwidthClass() != "high" || xeGPU.ECC == nil || !*xeGPU.ECC {
+		t.Errorf("unexpected memory type or ECC of %v: %+v", xeGPU.UID, xeGPU)
+	}
+
+	iGPU := detected["0000-00-06-0-0xa780"]
+	if iGPU.MemoryType != device.SystemMemoryType || iGPU.MemoryBandwidthClass() != "low" || iGPU.ECC != nil {
+		t.Errorf("unexpected memory type or ECC of %v: %+v", iGPU.UID, iGPU)
+	}
+
+	if xeGPU2 := detected["0000-00-05-0-0x0bd9"]; xeGPU2.ECC == nil || *xeGPU2.ECC {
+		t.Errorf("expected disabled ECC of %v: %+v", xeGPU2.UID, xeGPU2)
+	}
+
+	// ECC of Max GPU without ECC state in debugfs is not known
+	if maxGPU := detected["0000-00-04-0-0x0bd6"]; maxGPU.MemoryType != "HBM2e" || maxGPU.ECC != nil {
+		t.Errorf("unexpected memory type or ECC of %v: %+v", maxGPU.UID, maxGPU)
+	}
+
+	i915GPU := detected["0000-00-02-0-0x56c0"]
+	if i915GPU.PCIeGen != 0 || i915GPU.PCIeWidth != 0 || i915GPU.PCIeMaxMTs != 0 {
+		t.Errorf("expected unknown PCIe link of %v: %+v", i915GPU.UID, i915GPU)
+	}
+	if i915GPU.DriverVer == "" || i915GPU.GuCVersion != "" {
+		t.Errorf("expected kernel release as driver version and no GuC version of %v: %+v", i915GPU.UID, i915GPU)
+	}
+	if i915GPU.MemoryType != "GDDR6" || i915GPU.MemoryBandwidthClass() != "medium" || i915GPU.ECC != nil {
+		t.Errorf("unexpected memory type or ECC of %v: %+v", i915GPU.UID, i915GPU)
+	}
+}
+
+func TestSharedMemory(t *testing.T) {
+	meminfoPath := path.Join(t.TempDir(), "meminfo")
+	if err := os.WriteFile(meminfoPath, []byte("MemTotal:       32768000 kB\nMemFree:         1024000 kB\n"), 0600); err != nil {
+		t.Fatalf("setup error: could not write meminfo: %v", err)
+	}
+
+	testcases := []struct {
+		value     string
+		memoryMiB uint64
+		pass      bool
+	}{
+		{"", 0, true},
+		{"8Gi", 8192, true},
+		{"25%", 8000, true},
+		{"0%", 0, false},
+		{"101%", 0, false},
+		{"-1Gi", 0, false},
+		{"lots", 0, false},
+	}
+
+	for _, testcase := range testcases {
+		policy, err := discovery.ParseSharedMemory(testcase.value)
+		if testcase.pass != (err == nil) {
+			t.Errorf("%q: unexpected result: %v", testcase.value, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		memoryMiB, err := policy.MemoryMiB(meminfoPath)
+		if err != nil || memoryMiB != testcase.memoryMiB {
+			t.Errorf("%q: expected %d MiB, got %d, error: %v", testcase.value, testcase.memoryMiB, memoryMiB, err)
+		}
+	}
+
+	devices := map[string]*device.DeviceInfo{
+		"igpu": {UID: "0000-00-02-0-0xa780", DeviceType: device.GpuDeviceType},
+		"dgpu": {UID: "0000-03-00-0-0x56a0", DeviceType: device.GpuDeviceType, MemoryMiB: 16288},
+		"vf":   {UID: "0000-00-02-1-0xa780", DeviceType: device.VfDeviceType},
+	}
+	discovery.SetSharedMemory(devices, 8192)
+
+	if devices["igpu"].MemoryMiB != 8192 || devices["dgpu"].MemoryMiB != 16288 || devices["vf"].MemoryMiB != 0 {
+		t.Errorf("unexpected memory after setting shared memory: igpu %d, dgpu %d, vf %d",
+			devices["igpu"].MemoryMiB, devices["dgpu"].MemoryMiB, devices["vf"].MemoryMiB)
+	}
+}
+
+func TestDiscoverDevicesSerialNaming(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0", Serial: "0123456789abcdef"},
+			"0000-00-03-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x56c0"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.SerialNamingStyle)
+
+	if gpu, found := detected["sn-0123456789abcdef"]; !found || gpu.UID != "0000-00-02-0-0x56c0" {
+		t.Errorf("device with serial number not named by it: %v", detected)
+	}
+	if _, found := detected["0000-00-03-0-0x56c0"]; !found {
+		t.Errorf("device without serial number not named by UID: %v", detected)
+	}
+}
+
+func TestDiscoverDevicesFaults(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	devices := device.DevicesInfo{
+		"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0", PCIAddress: "0000:00:02.0"},
+		"0000-00-03-0-0x0bd5": {Model: "0x0bd5", MemoryMiB: 131072, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x0bd5", PCIAddress: "0000:00:03.0", Driver: device.XeDriver},
+		"0000-00-04-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 2, RenderdIdx: 130, UID: "0000-00-04-0-0x56c0", PCIAddress: "0000:00:04.0"},
+	}
+	if err := fakesysfs.FakeSysFsGpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, devices, false); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	for uid, faults := range map[string][]string{
+		"0000-00-02-0-0x56c0": {fakesysfs.FaultUnreadableLocalMemory},
+		"0000-00-03-0-0x0bd5": {fakesysfs.FaultUnreadableLocalMemory},
+		"0000-00-04-0-0x56c0": {fakesysfs.FaultNoDRM},
+	} {
+		if err := fakesysfs.InjectGpuFaults(testDirs.SysfsRoot, devices[uid], faults); err != nil {
+			t.Fatalf("setup error: could not inject faults into %v: %v", uid, err)
+		}
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+
+	if len(detected) != 2 {
+		t.Fatalf("expected device without drm dir to be skipped, detected %v", detected)
+	}
+	for _, uid := range []string{"0000-00-02-0-0x56c0", "0000-00-03-0-0x0bd5"} {
+		if gpu, found := detected[uid]; !found || gpu.MemoryMiB != 0 {
+			t.Errorf("expected %v without local memory, got %+v", uid, gpu)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+// SetExclusive marks the devices given by name, UID or PCI address as
+// exclusive, so that they are only ever allocated whole, without time-sliced
+// sharing. Devices that were not detected are ignored.
+func SetExclusive(devices map[string]*device.DeviceInfo, exclusive []string) {
+	for _, id := range exclusive {
+		found := false
+		for name, gpu := range devices {
+			if id == name || id == gpu.UID || id == gpu.PCIAddress {
+				klog.V(5).Infof("GPU %v is exclusive", name)
+				gpu.Exclusive = true
+				found = true
+			}
+		}
+		if !found {
+			klog.Warningf("exclusive GPU %v was not detected", id)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+// ProcMeminfoPath is where host RAM size is read from.
+const ProcMeminfoPath = "/proc/meminfo"
+
+// SharedMemory is the policy for the memory amount published for GPUs without
+// local memory, e.g. integrated GPUs. Zero policy publishes no memory.
+type SharedMemory struct {
+	MiB     uint64 // fixed amount of memory
+	Percent uint64 // percentage of host RAM
+}
+
+// ParseSharedMemory parses the shared memory policy: empty string for no memory,
+// a quantity for fixed amount, e.g. 8Gi, or a percentage of host RAM, e.g. 25%.
+func ParseSharedMemory(value string) (SharedMemory, error) {
+	if value == "" {
+		return SharedMemory{}, nil
+	}
+
+	if percentStr, found := strings.CutSuffix(value, "%"); found {
+		percent, err := strconv.ParseUint(percentStr, 10, 64)
+		if err != nil || percent == 0 || percent > 100 {
+			return SharedMemory{}, fmt.Errorf("invalid shared memory percentage %q, expected 1-100%%", value)
+		}
+
+		return SharedMemory{Percent: percent}, nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() <= 0 {
+		return SharedMemory{}, fmt.Errorf("invalid shared memory amount %q, expected quantity like 8Gi", value)
+	}
+
+	return SharedMemory{MiB: uint64(quantity.Value()) / (1024 * 1024)}, nil
+}
+
+// MemoryMiB returns the amount of shared memory in MiB, reading host RAM size
+// from meminfoPath for the percentage policy.
+func (m SharedMemory) MemoryMiB(meminfoPath string) (uint64, error) {
+	if m.Percent == 0 {
+		return m.MiB, nil
+	}
+
+	hostMiB, err := getHostMemoryMiB(meminfoPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return hostMiB * m.Percent / 100, nil
+}
+
+// SetSharedMemory sets memoryMiB as the memory of GPUs without local memory.
+func SetSharedMemory(devices map[string]*device.DeviceInfo, memoryMiB uint64) {
+	for _, gpu := range devices {
+		if gpu.DeviceType != device.GpuDeviceType || gpu.MemoryMiB != 0 {
+			continue
+		}
+
+		klog.V(5).Infof("GPU %v has no local memory, using %d MiB shared memory", gpu.UID, memoryMiB)
+		gpu.MemoryMiB = memoryMiB
+	}
+}
+
+// getHostMemoryMiB returns MemTotal from meminfo file.
+func getHostMemoryMiB(meminfoPath string) (uint64, error) {
+	file, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not read host memory size: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// MemTotal:       32594060 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "MemTotal:" || fields[2] != "kB" {
+			continue
+		}
+
+		totalKiB, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse MemTotal in %v: %v", meminfoPath, err)
+		}
+
+		return totalKiB / 1024, nil
+	}
+
+	return 0, fmt.Errorf("no MemTotal found in %v", meminfoPath)
+}
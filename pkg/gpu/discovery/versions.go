@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+)
+
+// eccStateFile is the ECC state of local memory in the debugfs DRM card dir.
+const eccStateFile = "ecc_state"
+
+// ucVersionRegexp matches the loaded firmware version in i915 and xe debugfs
+// uc info, e.g. "version: wanted 70.5.1, found 70.13.1".
+var ucVersionRegexp = regexp.MustCompile(`found ([0-9]+\.[0-9]+\.[0-9]+)`)
+
+// getDriverVersion returns the version of out-of-tree KMD module, or the
+// kernel release for in-tree KMD.
+func getDriverVersion(sysfsDir string, driver string) string {
+	versionFile := path.Join(sysfsDir, device.SysfsModuleVersionPath(driver))
+	if dat, err := os.ReadFile(versionFile); err == nil {
+		return strings.TrimSpace(string(dat))
+	}
+
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		klog.V(5).Infof("could not get kernel release: %v", err)
+		return ""
+	}
+
+	return unix.ByteSliceToString(uname.Release[:])
+}
+
+// detectFirmwareVersions sets GuC and HuC firmware versions of the GPU from
+// debugfs, when it is mounted.
+func detectFirmwareVersions(sysfsDir string, newDeviceInfo *device.DeviceInfo) {
+	debugDRIDir := path.Join(sysfsDir, device.SysfsDebugDRIpath, fmt.Sprint(newDeviceInfo.CardIdx))
+
+	newDeviceInfo.GuCVersion = getFirmwareVersion(debugDRIDir, "guc_info")
+	newDeviceInfo.HuCVersion = getFirmwareVersion(debugDRIDir, "huc_info")
+}
+
+// detectECC sets whether ECC of GPU local memory is enabled, as reported by
+// the driver in debugfs. ECC stays unknown when debugfs is not mounted or the
+// driver does not report it.
+func detectECC(sysfsDir string, newDeviceInfo *device.DeviceInfo) {
+	filePath := path.Join(sysfsDir, device.SysfsDebugDRIpath, fmt.Sprint(newDeviceInfo.CardIdx), eccStateFile)
+
+	dat, err := os.ReadFile(filePath)
+	if err != nil {
+		klog.V(5).Infof("ECC state of %v is not known: %v", newDeviceInfo.UID, err)
+		return
+	}
+
+	var ecc bool
+	switch strings.TrimSpace(string(dat)) {
+	case "enabled", "1":
+		ecc = true
+	case "disabled", "0":
+		ecc = false
+	default:
+		klog.Warningf("unexpected ECC state %q in %v", strings.TrimSpace(string(dat)), filePath)
+		return
+	}
+	newDeviceInfo.ECC = &ecc
+}
+
+// getFirmwareVersion returns the firmware version from the uc info file of
+// the first GT, or empty string when not found.
+func getFirmwareVersion(debugDRIDir string, ucInfoFile string) string {
+	files, _ := filepath.Glob(path.Join(debugDRIDir, "gt*", "uc", ucInfoFile))
+	if len(files) == 0 {
+		klog.V(5).Infof("no %v found in %v", ucInfoFile, debugDRIDir)
+		return ""
+	}
+
+	dat, err := os.ReadFile(files[0])
+	if err != nil {
+		klog.V(5).Infof("could not read %v: %v", files[0], err)
+		return ""
+	}
+
+	match := ucVersionRegexp.FindStringSubmatch(string(dat))
+	if match == nil {
+		klog.V(5).Infof("no loaded firmware version in %v", files[0])
+		return ""
+	}
+
+	return match[1]
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2023, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+const (
+	DefaultCDIRoot                   = helpers.DefaultCDIRoot
+	DefaultKubeletPluginDir          = helpers.DefaultKubeletPluginsDir + device.DriverName
+	DefaultKubeletPluginsRegistryDir = helpers.DefaultKubeletPluginsRegistryDir
+)
+
+type configType struct {
+	clientset                 coreclientset.Interface
+	cdiRoot                   string
+	kubeletPluginDir          string
+	kubeletPluginsRegistryDir string
+	nodeName                  string
+	httpEndpoint              string
+	pprofPath                 string
+	auditLog                  string
+	cdiDriftEvents            bool
+	sharedMemory              discovery.SharedMemory
+	namingStyle               string
+	deviceNodePermissions     cdihelpers.DeviceNodePermissions
+	exclusiveGPUs             []string
+	// startPlugin starts the kubelet plugin, helpers.StartPlugin if nil.
+	startPlugin helpers.StartPluginFunc
+}
+
+// gpuFlags are the command line flags specific to the GPU kubelet plugin.
+type gpuFlags struct {
+	sharedMemory   string
+	gpuModels      string
+	namingStyle    string
+	deviceUID      int64
+	deviceGID      int64
+	deviceMode     string
+	exclusiveGPUs  []string
+	cdiDriftEvents bool
+}
+
+func (f *gpuFlags) add(fs *pflag.FlagSet) {
+	fs.StringVar(&f.sharedMemory, "shared-memory", "",
+		"Memory published for GPUs without local memory, e.g. integrated GPUs: a fixed amount like 8Gi, or a percentage of host RAM like 25%. The default is the empty string, which means no memory is published for them.")
+	fs.StringVar(&f.gpuModels, "gpu-models", "",
+		"Path of JSON or YAML file with details of GPU models by PCI device ID, which are added to the built-in supported GPU models, replacing the details of the same device IDs.")
+	fs.StringVar(&f.namingStyle, "naming", device.DefaultNamingStyle,
+		"Naming of devices. Options: machine, named by PCI address and device ID, or serial, named by PCIe device serial number when GPU has it, so that names do not change when PCI addresses do.")
+	fs.StringSliceVar(&f.exclusiveGPUs, "exclusive-gpus", nil,
+		"Comma-separated names, UIDs or PCI addresses of GPUs which are only ever allocated whole, without time-sliced sharing, e.g. latency-critical production GPUs on nodes with shared development GPUs.")
+	fs.Int64Var(&f.deviceUID, "device-node-uid", -1,
+		"Owner user ID of the GPU device nodes in containers. The default is -1, which keeps the owner of the host device nodes.")
+	fs.Int64Var(&f.deviceGID, "device-node-gid", -1,
+		"Owner group ID of the GPU device nodes in containers, e.g. render group ID of the container image, so that non-root containers can open the devices. The default is -1, which keeps the group of the host device nodes.")
+	fs.StringVar(&f.deviceMode, "device-node-mode", "",
+		"Octal permissions of the GPU device nodes in containers, e.g. 0660. The default is the empty string, which keeps the permissions of the host device nodes.")
+}
+
+// NewCommand returns the command running the GPU kubelet plugin.
+func NewCommand(use string) *cobra.Command {
+	gpuflags := &gpuFlags{}
+
+	return helpers.NewApp(use, "Intel GPU resource-driver kubelet plugin",
+		func(ctx context.Context, flags *helpers.AppFlags) error {
+			return run(ctx, flags, gpuflags)
+		},
+		gpuflags.add,
+		helpers.CDIDriftEventsFlag(&gpuflags.cdiDriftEvents))
+}
+
+func run(ctx context.Context, flags *helpers.AppFlags, gpuflags *gpuFlags) error {
+	sharedMemory, err := discovery.ParseSharedMemory(gpuflags.sharedMemory)
+	if err != nil {
+		return err
+	}
+
+	if gpuflags.gpuModels != "" {
+		if err := device.LoadModelDetails(gpuflags.gpuModels); err != nil {
+			return err
+		}
+	}
+
+	if gpuflags.namingStyle != device.DefaultNamingStyle && gpuflags.namingStyle != device.SerialNamingStyle {
+		return fmt.Errorf("unsupported naming %q, expected %v or %v", gpuflags.namingStyle, device.DefaultNamingStyle, device.SerialNamingStyle)
+	}
+
+	deviceNodePermissions, err := cdihelpers.ParseDeviceNodePermissions(gpuflags.deviceUID, gpuflags.deviceGID, gpuflags.deviceMode)
+	if err != nil {
+		return err
+	}
+
+	coreclient, err := flags.NewKubeClient()
+	if err != nil {
+		return err
+	}
+
+	// GPU device nodes are looked up from their own directory.
+	if *flags.DevfsRoot != "" {
+		if err := os.Setenv(device.DevDriEnvVarName, path.Join(*flags.DevfsRoot, "dri")); err != nil {
+			return fmt.Errorf("set %v: %v", device.DevDriEnvVarName, err)
+		}
+	}
+
+	config := &configType{
+		nodeName:                  flags.NodeNameOrDefault("127.0.0.1"),
+		clientset:                 coreclient,
+		cdiRoot:                   flags.CDIDirOrDefault(DefaultCDIRoot),
+		kubeletPluginDir:          path.Join(flags.KubeletPluginsDir(), device.DriverName),
+		kubeletPluginsRegistryDir: flags.KubeletPluginsRegistryDir(),
+		httpEndpoint:              *flags.HTTPEndpoint,
+		pprofPath:                 *flags.PprofPath,
+		auditLog:                  *flags.AuditLog,
+		cdiDriftEvents:            gpuflags.cdiDriftEvents,
+		sharedMemory:              sharedMemory,
+		namingStyle:               gpuflags.namingStyle,
+		deviceNodePermissions:     deviceNodePermissions,
+		exclusiveGPUs:             gpuflags.exclusiveGPUs,
+	}
+
+	return callPlugin(ctx, config)
+}
+
+func callPlugin(ctx context.Context, config *configType) error {
+	if err := os.MkdirAll(config.kubeletPluginDir, 0750); err != nil {
+		return fmt.Errorf("failed to create plugin dir: %v", err)
+	}
+
+	driver, err := newDriver(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	if config.httpEndpoint != "" {
+		if err := startHTTPEndpoint(config, driver); err != nil {
+			return err
+		}
+	}
+
+	helpers.WaitForStopSignal()
+
+	if err := driver.Shutdown(ctx); err != nil {
+		klog.FromContext(ctx).Error(err, "could not stop DRA driver gracefully")
+		return err
+	}
+
+	return nil
+}
+
+// startHTTPEndpoint serves the liveness and readiness checks and metrics of
+// the plugin, and optionally the profiling data.
+func startHTTPEndpoint(config *configType, driver *driver) error {
+	mux := http.NewServeMux()
+	mux.Handle(helpers.HealthzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegistrationCheck(driver.plugin),
+		"cdi":          helpers.WritableDirCheck(config.cdiRoot),
+	})
+	mux.Handle(helpers.ReadyzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegisteredCheck(driver.plugin),
+		"cdi":          helpers.WritableDirCheck(config.cdiRoot),
+	})
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(
+		helpers.NewDeviceUsageCollector("intel_gpu", driver.state.DeviceUsage),
+		helpers.NewCDIDriftCollector("intel_gpu", driver.state.CDIDrift))
+	mux.Handle(helpers.MetricsPath, metrics.HandlerFor(registry, metrics.HandlerOpts{}))
+
+	if config.pprofPath != "" {
+		helpers.AddPprofHandlers(mux, config.pprofPath)
+	}
+
+	return helpers.ServeHTTPEndpoint(config.httpEndpoint, mux)
+}
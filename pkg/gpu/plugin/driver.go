@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
+)
+
+// compile-time test for implementation conformance with the interface.
+var _ drav1.DRAPluginServer = (*driver)(nil)
+
+type driver struct {
+	client   coreclientset.Interface
+	state    *nodeState
+	plugin   kubeletplugin.DRAPlugin
+	recorder record.EventRecorder
+	audit    *helpers.AuditLogger
+	retrier  *helpers.UnprepareRetrier
+}
+
+func newDriver(ctx context.Context, config *configType) (*driver, error) {
+	driverVersion.PrintDriverVersion(device.DriverName)
+	sysfsRoot := device.GetSysfsRoot()
+	preparedClaimFilePath := path.Join(config.kubeletPluginDir, device.PreparedClaimsFileName)
+	klog.V(5).Infof("Prepared claims: %v", preparedClaimFilePath)
+
+	namingStyle := config.namingStyle
+	if namingStyle == "" {
+		namingStyle = device.DefaultNamingStyle
+	}
+
+	detectedDevices := discovery.DiscoverDevices(sysfsRoot, namingStyle)
+	if config.sharedMemory != (discovery.SharedMemory{}) {
+		sharedMemoryMiB, err := config.sharedMemory.MemoryMiB(discovery.ProcMeminfoPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply shared memory policy: %v", err)
+		}
+		discovery.SetSharedMemory(detectedDevices, sharedMemoryMiB)
+	}
+	discovery.SetExclusive(detectedDevices, config.exclusiveGPUs)
+	if len(detectedDevices) == 0 {
+		klog.Info("No supported devices detected")
+	}
+
+	klog.V(3).Info("Creating new NodeState")
+	state, err := newNodeState(detectedDevices, config.cdiRoot, preparedClaimFilePath, sysfsRoot, config.nodeName, config.deviceNodePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new NodeState: %v", err)
+	}
+
+	d := &driver{
+		state:    state,
+		client:   config.clientset,
+		recorder: helpers.NewEventRecorder(config.clientset, device.DriverName, config.nodeName),
+	}
+
+	if config.auditLog != "" {
+		if d.audit, err = helpers.NewAuditLogger(config.auditLog, device.DriverName, config.nodeName); err != nil {
+			return nil, err
+		}
+	}
+
+	d.retrier = helpers.NewUnprepareRetrier(func(ctx context.Context, claim *drav1.Claim) error {
+		return d.state.Unprepare(ctx, claim.UID)
+	}, d.recorder)
+
+	if d.state.checkpointLost {
+		klog.Info("Prepared claims file was lost, recovering prepared claims")
+		if err := helpers.RecoverPreparedClaims(ctx, config.clientset, device.DriverName, config.nodeName, d.state.Prepare); err != nil {
+			klog.Errorf("could not recover prepared claims: %v", err)
+		}
+	}
+
+	d.reportMissingPreparedDevices(config.nodeName)
+	helpers.ReportCDIDrift(d.recorder, config.nodeName, d.state.CDIDrift(), config.cdiDriftEvents)
+
+	helpers.ReportNoDevices(d.recorder, config.nodeName, len(detectedDevices))
+
+	opts := helpers.PluginOptions{
+		DriverName:          device.DriverName,
+		NodeName:            config.nodeName,
+		Clientset:           config.clientset,
+		RegistrarSocketPath: path.Join(config.kubeletPluginsRegistryDir, device.PluginRegistrarFileName),
+		PluginSocketPath:    path.Join(config.kubeletPluginDir, device.PluginSocketFileName),
+	}
+
+	startPlugin := config.startPlugin
+	if startPlugin == nil {
+		startPlugin = helpers.StartPlugin
+	}
+	if d.plugin, err = startPlugin(ctx, d, opts, d.state.GetResources()); err != nil {
+		return nil, err
+	}
+
+	go d.retrier.Run(ctx, helpers.UnprepareRetryInterval)
+
+	klog.V(3).Info("Finished creating new driver")
+	return d, nil
+}
+
+func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepareResourcesRequest) (*drav1.NodePrepareResourcesResponse, error) {
+	klog.V(5).Infof("NodePrepareResource is called: request: %+v", req)
+
+	preparedResources := &drav1.NodePrepareResourcesResponse{Claims: map[string]*drav1.NodePrepareResourceResponse{}}
+
+	for _, claim := range req.Claims {
+		preparedResources.Claims[claim.UID] = d.nodePrepareResources(ctx, claim)
+		d.audit.LogPrepare(claim, preparedResources.Claims[claim.UID])
+	}
+
+	return preparedResources, nil
+}
+
+func (d *driver) nodePrepareResources(ctx context.Context, claimMetadata *drav1.Claim) *drav1.NodePrepareResourceResponse {
+	klog.V(5).Infof("NodePrepareResource is called: request: %+v", claimMetadata)
+
+	if claimPreparation, found := d.state.PreparedDevices(claimMetadata.UID); found {
+		klog.V(3).Infof("Claim %s was already prepared, nothing to do", claimMetadata.UID)
+		return &drav1.NodePrepareResourceResponse{
+			Devices: claimPreparation,
+		}
+	}
+
+	claim, err := d.client.ResourceV1beta1().ResourceClaims(claimMetadata.Namespace).Get(ctx, claimMetadata.Name, metav1.GetOptions{})
+	if err != nil {
+		return helpers.PrepareFailed(d.recorder, claimMetadata, fmt.Sprintf("could not find ResourceClaim %s in namespace %s: %v", claimMetadata.Name, claimMetadata.Namespace, err))
+	}
+
+	if err := d.state.Prepare(ctx, claim); err != nil {
+		return helpers.PrepareFailed(d.recorder, claimMetadata, fmt.Sprintf("error preparing devices for claim %v: %v", claimMetadata.UID, err))
+	}
+
+	claimPreparation, _ := d.state.PreparedDevices(claimMetadata.UID)
+	return &drav1.NodePrepareResourceResponse{Devices: claimPreparation}
+}
+
+// reportMissingPreparedDevices records a Warning Event on the Node for every
+// checkpointed claim preparation referring to a device that is no longer present.
+func (d *driver) reportMissingPreparedDevices(nodeName string) {
+	for claimUID, deviceNames := range d.state.MissingPreparedDevices() {
+		for _, deviceName := range deviceNames {
+			klog.Warningf("prepared device %v of claim %v is no longer available", deviceName, claimUID)
+			d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.PreparedDeviceMissingReason,
+				"device %v prepared for claim %v is no longer available on node", deviceName, claimUID)
+		}
+	}
+}
+
+func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnprepareResourcesRequest) (*drav1.NodeUnprepareResourcesResponse, error) {
+	klog.V(5).Infof("NodeUnprepareResource is called: number of claims: %d", len(req.Claims))
+	unpreparedResources := &drav1.NodeUnprepareResourcesResponse{
+		Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
+	}
+
+	for _, claim := range req.Claims {
+		result := &drav1.NodeUnprepareResourceResponse{}
+		if err := d.state.Unprepare(ctx, claim.UID); err != nil {
+			result.Error = fmt.Sprintf("could not unprepare resource: %v", err)
+			d.retrier.Failed(claim, err)
+		} else {
+			d.retrier.Succeeded(claim.UID)
+		}
+
+		unpreparedResources.Claims[claim.UID] = result
+		d.audit.LogUnprepare(claim, result)
+	}
+
+	return unpreparedResources, nil
+}
+
+func (d *driver) Shutdown(ctx context.Context) error {
+	d.plugin.Stop()
+	return nil
+}
@@ -0,0 +1,838 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/discovery"
+	drahelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestFakeSysfs(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Errorf("could not create fake system dirs: %v", err)
+		return
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 8192, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0", MaxVFs: 16},
+		},
+		false,
+	); err != nil {
+		t.Errorf("setup error: could not create fake sysfs: %v", err)
+		return
+	}
+
+	if err := os.RemoveAll(testDirs.TestRoot); err != nil {
+		t.Errorf("could not cleanup fake sysfs %v", testDirs.TestRoot)
+	}
+}
+
+func getFakeDriver(testDirs helpers.TestDirsType, objects ...runtime.Object) (*driver, error) {
+
+	config := &configType{
+		nodeName:                  "node1",
+		clientset:                 kubefake.NewSimpleClientset(objects...),
+		cdiRoot:                   testDirs.CdiRoot,
+		kubeletPluginDir:          testDirs.KubeletPluginDir,
+		kubeletPluginsRegistryDir: testDirs.KubeletPluginRegistryDir,
+	}
+
+	if err := os.MkdirAll(config.kubeletPluginDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating fake driver plugin dir: %v", err)
+	}
+	if err := os.MkdirAll(config.kubeletPluginsRegistryDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed creating fake driver plugin dir: %v", err)
+	}
+
+	os.Setenv("SYSFS_ROOT", testDirs.SysfsRoot)
+
+	return newDriver(context.TODO(), config)
+}
+
+func withTimeSlicing(claim *resourcev1.ResourceClaim, interval string) *resourcev1.ResourceClaim {
+	claim.Status.Allocation.Devices.Config = []resourcev1.DeviceAllocationConfiguration{
+		{
+			Source: resourcev1.AllocationConfigSourceClaim,
+			DeviceConfiguration: resourcev1.DeviceConfiguration{
+				Opaque: &resourcev1.OpaqueDeviceConfiguration{
+					Driver: device.DriverName,
+					Parameters: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "gpu.intel.com/v1alpha1", "kind": "GpuConfig", "timeSlicing": {"interval": "` + interval + `"}}`),
+					},
+				},
+			},
+		},
+	}
+	return claim
+}
+
+func TestNodePrepareResources(t *testing.T) {
+	type testCase struct {
+		name                   string
+		claims                 []*resourcev1.ResourceClaim
+		request                *drav1.NodePrepareResourcesRequest
+		expectedResponse       *drav1.NodePrepareResourcesResponse
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
+		expectedTimeslice      map[string]string // engine timeslice file, relative to sysfs root, and its value
+		exclusiveGPUs          []string
+	}
+
+	testcases := []testCase{
+		{
+			name: "blank request",
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "single GPU",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {
+						Devices: []*drav1.Device{
+							{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"}},
+						},
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {
+					{
+						RequestNames: []string{"request1"},
+						PoolName:     "node1",
+						DeviceName:   "0000-00-02-0-0x56c0",
+						CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"},
+					},
+				},
+			},
+		},
+		{
+			name: "single GPU with time-slicing",
+			claims: []*resourcev1.ResourceClaim{
+				withTimeSlicing(helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}), "5ms"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {
+						Devices: []*drav1.Device{
+							{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"}},
+						},
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {
+					{
+						RequestNames: []string{"request1"},
+						PoolName:     "node1",
+						DeviceName:   "0000-00-02-0-0x56c0",
+						CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"},
+					},
+				},
+			},
+			expectedTimeslice: map[string]string{
+				"bus/pci/drivers/i915/0000:00:02.0/drm/card0/engine/rcs0/timeslice_duration_ms": "5",
+			},
+		},
+		{
+			name: "exclusive GPU with time-slicing",
+			claims: []*resourcev1.ResourceClaim{
+				withTimeSlicing(helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}), "5ms"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim1", Namespace: "namespace1", UID: "uid1"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {
+						Error: "error preparing devices for claim uid1: device 0000-00-02-0-0x56c0 is exclusive, time-sliced sharing is not allowed",
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+			exclusiveGPUs:  []string{"0000:00:02.0"},
+		},
+		{
+			name: "VF with time-slicing",
+			claims: []*resourcev1.ResourceClaim{
+				withTimeSlicing(helpers.NewClaim("namespace2", "claim2", "uid2", "request2", "gpu.intel.com", "node1", []string{"0000-00-03-1-0x56c0"}), "5ms"),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim2", Namespace: "namespace2", UID: "uid2"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {
+						Error: "error preparing devices for claim uid2: time-slicing is not supported for vf device 0000-00-03-1-0x56c0",
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "single existing VF",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim("namespace2", "claim2", "uid2", "request2", "gpu.intel.com", "node1", []string{"0000-00-03-1-0x56c0"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim2", Namespace: "namespace2", UID: "uid2"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {
+						Devices: []*drav1.Device{
+							{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-03-1-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"}},
+						},
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {
+					{
+						RequestNames: []string{"request2"},
+						PoolName:     "node1",
+						DeviceName:   "0000-00-03-1-0x56c0",
+						CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"},
+					},
+				},
+			},
+		},
+		{
+			name: "monitoring claim",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewMonitoringClaim(
+					"namespace3", "monitor", "uid3", "monitor", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0", "0000-00-03-0-0x56c0", "0000-00-03-1-0x56c0", "0000-00-04-0-0x0000"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "monitor", Namespace: "namespace3", UID: "uid3"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid3": {
+						Devices: []*drav1.Device{
+							{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"}},
+							{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-0-0x56c0"}},
+							{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-03-1-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"}},
+							{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-04-0-0x0000", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-04-0-0x0000"}},
+						},
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid3": {
+					{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"}},
+					{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-0-0x56c0"}},
+					{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-03-1-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"}},
+					{RequestNames: []string{"monitor"}, PoolName: "node1", DeviceName: "0000-00-04-0-0x0000", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-04-0-0x0000"}},
+				},
+			},
+		},
+		{
+			name: "single GPU, already prepared claim",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewMonitoringClaim("namespace4", "claim4", "uid4", "request4", "gpu.intel.com", "node1", []string{"0000-00-03-1-0x56c0"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim4", Namespace: "namespace4", UID: "uid4"},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid4": {
+						Devices: []*drav1.Device{
+							{
+								RequestNames: []string{"request4"}, PoolName: "node1", DeviceName: "0000-00-03-1-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"},
+							},
+						},
+					},
+				},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid4": {
+					{
+						RequestNames: []string{"request4"},
+						PoolName:     "node1",
+						DeviceName:   "0000-00-03-1-0x56c0",
+						CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"},
+					},
+				},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid4": {
+					{
+						RequestNames: []string{"request4"},
+						PoolName:     "node1",
+						DeviceName:   "0000-00-03-1-0x56c0",
+						CDIDeviceIDs: []string{"intel.com/gpu=0000-00-03-1-0x56c0"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		testDirs, err := helpers.NewTestDirs(device.DriverName)
+		defer helpers.CleanupTest(t, testcase.name, testDirs.TestRoot)
+		if err != nil {
+			t.Errorf("%v: setup error: %v", testcase.name, err)
+			return
+		}
+
+		if err := fakesysfs.FakeSysFsGpuContents(
+			testDirs.SysfsRoot,
+			testDirs.DevfsRoot,
+			device.DevicesInfo{
+				"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0", MaxVFs: 16},
+				"0000-00-03-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x56c0", MaxVFs: 16},
+				"0000-00-03-1-0x56c0": {Model: "0x56c0", MemoryMiB: 8064, DeviceType: "vf", CardIdx: 2, RenderdIdx: 130, UID: "0000-00-03-1-0x56c0", VFIndex: 0, VFProfile: "flex170_m2", ParentUID: "0000-00-03-0-0x56c0"},
+				// dummy, no SR-IOV tiles
+				"0000-00-04-0-0x0000": {Model: "0x0000", MemoryMiB: 14248, DeviceType: "gpu", CardIdx: 3, RenderdIdx: 131, UID: "0000-00-04-0-0x0000", MaxVFs: 16},
+			},
+			false,
+		); err != nil {
+			t.Errorf("setup error: could not create fake sysfs: %v", err)
+			return
+		}
+
+		preparedClaimFilePath := path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName)
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
+			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
+		}
+
+		driver, driverErr := getFakeDriver(testDirs)
+		if driverErr != nil {
+			t.Errorf("could not create kubelet-plugin: %v\n", driverErr)
+			continue
+		}
+		discovery.SetExclusive(driver.state.allocatable, testcase.exclusiveGPUs)
+
+		for _, testClaim := range testcase.claims {
+			createdClaim, err := driver.client.ResourceV1beta1().ResourceClaims(testClaim.Namespace).Create(context.TODO(), testClaim, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("could not create test claim: %v", err)
+			}
+			t.Logf("created test claim: %+v", createdClaim)
+		}
+
+		response, err := driver.NodePrepareResources(context.TODO(), testcase.request)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+		}
+
+		if !reflect.DeepEqual(testcase.expectedResponse, response) {
+			responseJSON, _ := json.MarshalIndent(response, "", "\t")
+			expectedResponseJSON, _ := json.MarshalIndent(testcase.expectedResponse, "", "\t")
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
+		}
+
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		expectedPreparedClaims := testcase.expectedPreparedClaims
+		if expectedPreparedClaims == nil {
+			expectedPreparedClaims = drahelpers.ClaimPreparations{}
+		}
+
+		if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) {
+			preparedClaimsJSON, _ := json.MarshalIndent(preparedClaims, "", "\t")
+			expectedPreparedClaimsJSON, _ := json.MarshalIndent(testcase.expectedPreparedClaims, "", "\t")
+			t.Errorf(
+				"%v: unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
+				testcase.name, string(preparedClaimsJSON), string(expectedPreparedClaimsJSON),
+			)
+		}
+
+		for file, expectedValue := range testcase.expectedTimeslice {
+			if value, _ := os.ReadFile(path.Join(testDirs.SysfsRoot, file)); string(value) != expectedValue {
+				t.Errorf("%v: expected timeslice %v in %v, got %q", testcase.name, expectedValue, file, value)
+			}
+		}
+	}
+}
+
+func TestTimeslicingSharedGPU(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "TestTimeslicingSharedGPU", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+			"0000-00-03-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x56c0"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	claims := []*resourcev1.ResourceClaim{
+		withTimeSlicing(helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}), "5ms"),
+		withTimeSlicing(helpers.NewClaim("namespace1", "claim2", "uid2", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}), "5ms"),
+		withTimeSlicing(helpers.NewClaim("namespace1", "claim3", "uid3", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}), "10ms"),
+		// the second device is missing, so preparing fails after setting the timeslice of the first one
+		withTimeSlicing(helpers.NewClaim("namespace1", "claim4", "uid4", "request1", "gpu.intel.com", "node1", []string{"0000-00-03-0-0x56c0", "0000-00-09-0-0x56c0"}), "10ms"),
+	}
+	objects := []runtime.Object{}
+	for _, claim := range claims {
+		objects = append(objects, claim)
+	}
+
+	driver, err := getFakeDriver(testDirs, objects...)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+
+	timesliceFiles := map[string]string{
+		"0000:00:02.0": "bus/pci/drivers/i915/0000:00:02.0/drm/card0/engine/rcs0/timeslice_duration_ms",
+		"0000:00:03.0": "bus/pci/drivers/i915/0000:00:03.0/drm/card1/engine/rcs0/timeslice_duration_ms",
+	}
+	timeslice := func(pciAddress string) string {
+		value, _ := os.ReadFile(path.Join(testDirs.SysfsRoot, timesliceFiles[pciAddress]))
+		return string(value)
+	}
+	prepare := func(uid string, name string) string {
+		response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{{UID: uid, Name: name, Namespace: "namespace1"}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return response.Claims[uid].Error
+	}
+	unprepare := func(uid string, name string) {
+		response, err := driver.NodeUnprepareResources(context.TODO(), &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{{UID: uid, Name: name, Namespace: "namespace1"}}})
+		if err != nil || response.Claims[uid].Error != "" {
+			t.Fatalf("unexpected unprepare response: %+v, %v", response, err)
+		}
+	}
+
+	if prepare("uid1", "claim1") != "" || prepare("uid2", "claim2") != "" || timeslice("0000:00:02.0") != "5" {
+		t.Fatalf("expected claims with the same timeslice to share the GPU, got timeslice %q", timeslice("0000:00:02.0"))
+	}
+	if prepare("uid3", "claim3") == "" || timeslice("0000:00:02.0") != "5" {
+		t.Errorf("expected conflicting timeslice to fail, got timeslice %q", timeslice("0000:00:02.0"))
+	}
+	if prepare("uid4", "claim4") == "" || timeslice("0000:00:03.0") != "1" {
+		t.Errorf("expected failed prepare to restore the default timeslice, got %q", timeslice("0000:00:03.0"))
+	}
+
+	unprepare("uid1", "claim1")
+	if timeslice("0000:00:02.0") != "5" {
+		t.Errorf("expected timeslice of the other claim to stay, got %q", timeslice("0000:00:02.0"))
+	}
+
+	// timeslices of claims prepared before a restart are restored from sysfs
+	driver, err = getFakeDriver(testDirs, objects...)
+	if err != nil {
+		t.Fatalf("could not restart kubelet-plugin: %v", err)
+	}
+	if prepare("uid3", "claim3") == "" {
+		t.Errorf("expected conflicting timeslice to fail after restart")
+	}
+
+	unprepare("uid2", "claim2")
+	if timeslice("0000:00:02.0") != "1" {
+		t.Errorf("expected default timeslice after the last claim was unprepared, got %q", timeslice("0000:00:02.0"))
+	}
+	if prepare("uid3", "claim3") != "" || timeslice("0000:00:02.0") != "10" {
+		t.Errorf("expected timeslice of unshared GPU to be set, got %q", timeslice("0000:00:02.0"))
+	}
+}
+
+func TestNodeUnprepareResources(t *testing.T) {
+	type testCase struct {
+		name                   string
+		request                *drav1.NodeUnprepareResourcesRequest
+		expectedResponse       *drav1.NodeUnprepareResourcesResponse
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
+	}
+
+	testcases := []testCase{
+		{
+			name: "blank request",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
+			},
+			preparedClaims:         drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "single GPU",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim1", Namespace: "namespace1", UID: "uid1"},
+				},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"uid1": {}},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-b3-00-0-0x0bda", CDIDeviceIDs: []string{"intel.com/gpu=0000-b3-00-0-0x0bda"}}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{},
+		},
+		{
+			name: "single VF without cleanup",
+			request: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{Name: "claim2", Namespace: "namespace2", UID: "uid2"},
+				},
+			},
+			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"uid2": {}},
+			},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-af-00-1-0x0bda", CDIDeviceIDs: []string{"intel.com/gpu=0000-af-00-1-0x0bda"}}},
+				"uid3": {{RequestNames: []string{"request3"}, PoolName: "node1", DeviceName: "0000-af-00-2-0x0bda", CDIDeviceIDs: []string{"intel.com/gpu=0000-af-00-2-0x0bda"}}},
+			},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid3": {{RequestNames: []string{"request3"}, PoolName: "node1", DeviceName: "0000-af-00-2-0x0bda", CDIDeviceIDs: []string{"intel.com/gpu=0000-af-00-2-0x0bda"}}},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		testDirs, err := helpers.NewTestDirs(device.DriverName)
+		defer helpers.CleanupTest(t, "TestNodeUnprepareResources", testDirs.TestRoot)
+		if err != nil {
+			t.Errorf("%v: setup error: %v", testcase.name, err)
+			return
+		}
+
+		if err := fakesysfs.FakeSysFsGpuContents(
+			testDirs.SysfsRoot,
+			testDirs.DevfsRoot,
+			device.DevicesInfo{
+				"0000-b3-00-0-0x0bda": {Model: "0x0bda", MemoryMiB: 49136, DeviceType: "gpu", CardIdx: 0, UID: "0000-b3-00-0-0x0bda", MaxVFs: 63},
+				"0000-af-00-0-0x0bda": {Model: "0x0bda", MemoryMiB: 49136, DeviceType: "gpu", CardIdx: 1, UID: "0000-af-00-0-0x0bda", MaxVFs: 63},
+				"0000-af-00-1-0x0bda": {Model: "0x0bda", MemoryMiB: 22528, Millicores: 500, DeviceType: "vf", CardIdx: 2, UID: "0000-af-00-1-0x0bda", VFIndex: 0, VFProfile: "max_47g_c2", ParentUID: "0000-af-00-0-0x0bda"},
+				"0000-af-00-2-0x0bda": {Model: "0x0bda", MemoryMiB: 22528, Millicores: 500, DeviceType: "vf", CardIdx: 3, UID: "0000-af-00-2-0x0bda", VFIndex: 1, VFProfile: "max_47g_c2", ParentUID: "0000-af-00-0-0x0bda"},
+			},
+			false,
+		); err != nil {
+			t.Errorf("%v: setup error: could not create fake sysfs: %v", testcase.name, err)
+			return
+		}
+
+		preparedClaimsFilePath := path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName)
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimsFilePath, testcase.preparedClaims); err != nil {
+			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
+			continue
+		}
+
+		driver, driverErr := getFakeDriver(testDirs)
+		if driverErr != nil {
+			t.Errorf("could not create kubelet-plugin: %v\n", driverErr)
+			continue
+		}
+
+		response, err := driver.NodeUnprepareResources(context.TODO(), testcase.request)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimsFilePath)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(response, testcase.expectedResponse) {
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, response, testcase.expectedResponse)
+		}
+
+		if !reflect.DeepEqual(testcase.expectedPreparedClaims, preparedClaims) {
+			preparedClaimsJSON, _ := json.MarshalIndent(preparedClaims, "", "\t")
+			expectedPreparedClaimsJSON, _ := json.MarshalIndent(testcase.expectedPreparedClaims, "", "\t")
+			t.Errorf(
+				"%v: unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
+				testcase.name, preparedClaimsJSON, expectedPreparedClaimsJSON,
+			)
+		}
+	}
+}
+
+func TestRecoverPreparedClaims(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "recover prepared claims", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	claim := helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"})
+	claim.Status.ReservedFor = []resourcev1.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod1", UID: "pod-uid1"}}
+
+	expectedPreparedClaims := drahelpers.ClaimPreparations{
+		"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x56c0", CDIDeviceIDs: []string{"intel.com/gpu=0000-00-02-0-0x56c0"}}},
+	}
+	preparedClaimsFilePath := path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName)
+
+	// fresh install, no CDI specs and no prepared claims file, nothing to recover
+	driver, err := getFakeDriver(testDirs, claim)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+
+	preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimsFilePath)
+	if err != nil {
+		t.Fatalf("could not read prepared claims: %v", err)
+	}
+	if len(preparedClaims) != 0 || len(driver.state.prepared) != 0 {
+		t.Errorf("unexpected prepared claims recovered on fresh install: %+v", preparedClaims)
+	}
+
+	// prepared claims file deleted while CDI specs exist
+	if err := os.Remove(preparedClaimsFilePath); err != nil {
+		t.Fatalf("setup error: could not delete prepared claims file: %v", err)
+	}
+	driver, err = getFakeDriver(testDirs, claim)
+	if err != nil {
+		t.Fatalf("could not restart kubelet-plugin: %v", err)
+	}
+
+	preparedClaims, err = drahelpers.ReadPreparedClaimsFromFile(preparedClaimsFilePath)
+	if err != nil {
+		t.Fatalf("could not read prepared claims: %v", err)
+	}
+	if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) || !reflect.DeepEqual(expectedPreparedClaims, driver.state.prepared) {
+		t.Errorf("unexpected prepared claims recovered after deletion: %+v", preparedClaims)
+	}
+
+	// corrupted prepared claims file, as if it was lost
+	if err := os.WriteFile(preparedClaimsFilePath, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: could not corrupt prepared claims file: %v", err)
+	}
+	driver, err = getFakeDriver(testDirs, claim)
+	if err != nil {
+		t.Fatalf("could not restart kubelet-plugin: %v", err)
+	}
+
+	preparedClaims, err = drahelpers.ReadPreparedClaimsFromFile(preparedClaimsFilePath)
+	if err != nil {
+		t.Fatalf("could not read prepared claims: %v", err)
+	}
+	if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) || !reflect.DeepEqual(expectedPreparedClaims, driver.state.prepared) {
+		t.Errorf("unexpected prepared claims recovered after corruption: %+v", preparedClaims)
+	}
+}
+
+func TestPrepareFailedEvents(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "TestPrepareFailedEvents", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	claim := helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-09-0-0x56c0"})
+	driver, err := getFakeDriver(testDirs, claim)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	driver.recorder = recorder
+
+	response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{
+		{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+		{UID: "uid2", Name: "claim2", Namespace: "namespace1"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedEvents := map[string]bool{}
+	for uid, substring := range map[string]string{"uid1": "0000-00-09-0-0x56c0", "uid2": "could not find ResourceClaim claim2"} {
+		claimError := response.Claims[uid].Error
+		if !strings.Contains(claimError, substring) {
+			t.Errorf("%v: expected error with %q, got %q", uid, substring, claimError)
+		}
+		expectedEvents["Warning "+drahelpers.PrepareFailedReason+" "+claimError] = true
+	}
+
+	if len(recorder.Events) != len(expectedEvents) {
+		t.Fatalf("expected %d events, got %d", len(expectedEvents), len(recorder.Events))
+	}
+	for range expectedEvents {
+		if event := <-recorder.Events; !expectedEvents[event] {
+			t.Errorf("unexpected event %q, expected one of %v", event, expectedEvents)
+		}
+	}
+}
+
+// TestPrepareWhileRetryingUnprepare prepares claims while the unprepare
+// retrier frees them, so that go test -race catches unlocked access to the
+// prepared claims.
+func TestPrepareWhileRetryingUnprepare(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	defer helpers.CleanupTest(t, "TestPrepareWhileRetryingUnprepare", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsGpuContents(
+		testDirs.SysfsRoot,
+		testDirs.DevfsRoot,
+		device.DevicesInfo{
+			"0000-00-02-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 0, RenderdIdx: 128, UID: "0000-00-02-0-0x56c0"},
+			"0000-00-03-0-0x56c0": {Model: "0x56c0", MemoryMiB: 16256, DeviceType: "gpu", CardIdx: 1, RenderdIdx: 129, UID: "0000-00-03-0-0x56c0"},
+		},
+		false,
+	); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	driver, err := getFakeDriver(testDirs)
+	if err != nil {
+		t.Fatalf("could not create kubelet-plugin: %v", err)
+	}
+
+	for _, claim := range []*resourcev1.ResourceClaim{
+		helpers.NewClaim("namespace1", "claim1", "uid1", "request1", "gpu.intel.com", "node1", []string{"0000-00-02-0-0x56c0"}),
+		helpers.NewClaim("namespace1", "claim2", "uid2", "request2", "gpu.intel.com", "node1", []string{"0000-00-03-0-0x56c0"}),
+	} {
+		if _, err := driver.client.ResourceV1beta1().ResourceClaims(claim.Namespace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("could not create test claim: %v", err)
+		}
+	}
+
+	claims := []*drav1.Claim{
+		{UID: "uid1", Name: "claim1", Namespace: "namespace1"},
+		{UID: "uid2", Name: "claim2", Namespace: "namespace1"},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: claims})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			for uid, claimResponse := range response.Claims {
+				if claimResponse.Error != "" {
+					t.Errorf("%v: unexpected prepare error: %v", uid, claimResponse.Error)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			for _, claim := range claims {
+				driver.retrier.Failed(claim, fmt.Errorf("unprepare timed out"))
+			}
+			driver.retrier.Retry(context.TODO())
+		}
+	}()
+	wg.Wait()
+
+	if pending := driver.retrier.Pending(); pending != 0 {
+		t.Errorf("expected no pending unprepare retries, got %d", pending)
+	}
+}
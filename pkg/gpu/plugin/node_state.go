@@ -0,0 +1,494 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	cdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gpu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+type nodeState struct {
+	sync.Mutex
+	cdiCache               *cdiapi.Cache
+	allocatable            device.DevicesInfo
+	prepared               helpers.ClaimPreparations
+	preparedClaimsFilePath string
+	cdiDrift               helpers.CDIDrift
+	nodeName               string
+	sysfsRoot              string
+	checkpointLost         bool // prepared claims file was missing or corrupted
+	timeslices             map[string]*timesliceUsage
+}
+
+// timesliceUsage is the scheduler timeslice set on a GPU, and the prepared
+// claims that requested it. The default timeslice is restored when the last
+// of them is unprepared.
+type timesliceUsage struct {
+	interval time.Duration
+	claims   map[string]bool
+}
+
+func newNodeState(
+	detectedDevices map[string]*device.DeviceInfo, cdiRoot string, preparedClaimFilePath string, sysfsRoot string, nodeName string,
+	deviceNodePermissions cdihelpers.DeviceNodePermissions) (*nodeState, error) {
+	for ddev := range detectedDevices {
+		klog.V(3).Infof("new device: %+v", ddev)
+	}
+
+	cdiCache, err := helpers.NewCDICache(cdiRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Devices are in use when the plugin has written CDI specs or created VFs
+	// before, so a missing prepared claims file is lost rather than new.
+	inUse := cdiregistry.GPU.HasDevices(cdiCache)
+	for _, ddev := range detectedDevices {
+		if ddev.DeviceType == device.VfDeviceType {
+			inUse = true
+		}
+	}
+
+	// syncDetectedDevicesWithRegistry overrides uid in detecteddevices from existing cdi spec
+	cdiDrift, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true, deviceNodePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sync detected devices to CDI registry: %v", err)
+	}
+
+	// hack for tests on slow machines
+	time.Sleep(250 * time.Millisecond)
+
+	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
+	for duid, ddev := range detectedDevices {
+		klog.V(5).Infof("CDI device: %v : %+v", duid, ddev)
+	}
+
+	preparedClaims, checkpointLost, err := helpers.GetOrCreatePreparedClaims(preparedClaimFilePath, inUse)
+	if err != nil {
+		klog.Errorf("Error getting prepared claims: %v", err)
+		return nil, fmt.Errorf("failed to get prepared claims: %v", err)
+	}
+
+	klog.V(5).Info("Creating NodeState")
+	state := &nodeState{
+		cdiCache:               cdiCache,
+		allocatable:            detectedDevices,
+		prepared:               preparedClaims,
+		cdiDrift:               cdiDrift,
+		preparedClaimsFilePath: preparedClaimFilePath,
+		checkpointLost:         checkpointLost,
+		sysfsRoot:              sysfsRoot,
+		nodeName:               nodeName,
+		timeslices:             map[string]*timesliceUsage{},
+	}
+	state.restoreTimeslices()
+
+	for duid, ddev := range state.allocatable {
+		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
+	}
+
+	return state, nil
+}
+
+func (s *nodeState) GetResources() kubeletplugin.Resources {
+	devices := []resourcev1.Device{}
+
+	for gpuUID, gpu := range s.allocatable {
+		tiles := int64(gpu.TileCount)
+		newDevice := resourcev1.Device{
+			Name: gpuUID,
+			Basic: &resourcev1.BasicDevice{
+				Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+					"model": {
+						StringValue: &gpu.ModelName,
+					},
+					"family": {
+						StringValue: &gpu.FamilyName,
+					},
+					"tiles": {
+						IntValue: &tiles,
+					},
+				},
+				Capacity: map[resourcev1.QualifiedName]resourcev1.DeviceCapacity{
+					"memory":     {Value: resource.MustParse(fmt.Sprintf("%vMi", gpu.MemoryMiB))},
+					"millicores": {Value: *resource.NewDecimalQuantity(*inf.NewDec(int64(1000), inf.Scale(0)), resource.DecimalSI)},
+				},
+			},
+		}
+
+		addPCIAttributes(newDevice.Basic.Attributes, gpu)
+		newDevice.Basic.Attributes["exclusive"] = resourcev1.DeviceAttribute{BoolValue: &gpu.Exclusive}
+		addPCIeLinkAttributes(newDevice.Basic.Attributes, gpu)
+		addVersionAttributes(newDevice.Basic.Attributes, gpu)
+		addComputeAttributes(newDevice.Basic.Attributes, gpu)
+		addMemoryAttributes(newDevice.Basic.Attributes, gpu)
+
+		devices = append(devices, newDevice)
+	}
+
+	return kubeletplugin.Resources{Devices: devices}
+}
+
+// addKnownIntAttributes adds integer attributes, skipping unknown zero values.
+func addKnownIntAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, values map[resourcev1.QualifiedName]uint64) {
+	for name, value := range values {
+		if value == 0 {
+			continue
+		}
+		intValue := int64(value)
+		attributes[name] = resourcev1.DeviceAttribute{IntValue: &intValue}
+	}
+}
+
+// addPCIAttributes adds the PCI address, so that claims can be pinned to a
+// particular physical GPU also when devices are named by serial number.
+func addPCIAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, gpu *device.DeviceInfo) {
+	if gpu.PCIAddress != "" {
+		attributes["pciAddress"] = resourcev1.DeviceAttribute{StringValue: &gpu.PCIAddress}
+	}
+}
+
+// addPCIeLinkAttributes adds the PCIe link attributes that were detected.
+func addPCIeLinkAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, gpu *device.DeviceInfo) {
+	linkAttributes := map[resourcev1.QualifiedName]uint64{
+		"pcieGeneration":   gpu.PCIeGen,
+		"pcieLinkWidth":    gpu.PCIeWidth,
+		"pcieMaxLinkSpeed": gpu.PCIeMaxMTs,
+	}
+
+	addKnownIntAttributes(attributes, linkAttributes)
+}
+
+// addComputeAttributes adds the known Xe-core and EU counts, and maximum
+// frequency.
+func addComputeAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, gpu *device.DeviceInfo) {
+	computeAttributes := map[resourcev1.QualifiedName]uint64{
+		"xeCores":         gpu.XeCores,
+		"executionUnits":  gpu.EUs,
+		"maxFrequencyMHz": gpu.MaxFreqMHz,
+	}
+
+	addKnownIntAttributes(attributes, computeAttributes)
+}
+
+// addMemoryAttributes adds the known memory type, its bandwidth class and ECC
+// state.
+func addMemoryAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, gpu *device.DeviceInfo) {
+	if gpu.MemoryType != "" {
+		attributes["memoryType"] = resourcev1.DeviceAttribute{StringValue: &gpu.MemoryType}
+	}
+	if bandwidthClass := gpu.MemoryBandwidthClass(); bandwidthClass != "" {
+		attributes["memoryBandwidthClass"] = resourcev1.DeviceAttribute{StringValue: &bandwidthClass}
+	}
+	if gpu.ECC != nil {
+		attributes["ecc"] = resourcev1.DeviceAttribute{BoolValue: gpu.ECC}
+	}
+}
+
+// addVersionAttributes adds the KMD and its version, and the detected GuC and
+// HuC firmware versions.
+func addVersionAttributes(attributes map[resourcev1.QualifiedName]resourcev1.DeviceAttribute, gpu *device.DeviceInfo) {
+	driver := gpu.Driver
+	if driver == "" {
+		driver = device.I915Driver
+	}
+	attributes["driver"] = resourcev1.DeviceAttribute{StringValue: &driver}
+
+	if gpu.DriverVer != "" {
+		attributes["driverVersion"] = resourcev1.DeviceAttribute{StringValue: &gpu.DriverVer}
+	}
+	if gpu.GuCVersion != "" {
+		attributes["gucVersion"] = resourcev1.DeviceAttribute{VersionValue: &gpu.GuCVersion}
+	}
+	if gpu.HuCVersion != "" {
+		attributes["hucVersion"] = resourcev1.DeviceAttribute{VersionValue: &gpu.HuCVersion}
+	}
+}
+
+// restoreTimeslices attributes the timeslices set on GPUs before a restart
+// to the claims prepared on them, as the requested timeslices of the claims
+// are not saved.
+func (s *nodeState) restoreTimeslices() {
+	for claimUID, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			gpu, found := s.allocatable[claimDevice.DeviceName]
+			if !found || gpu.DeviceType != device.GpuDeviceType {
+				continue
+			}
+			interval, modified, err := gpu.Timeslice(s.sysfsRoot)
+			if err != nil || !modified {
+				continue
+			}
+			if s.timeslices[claimDevice.DeviceName] == nil {
+				s.timeslices[claimDevice.DeviceName] = &timesliceUsage{interval: interval, claims: map[string]bool{}}
+			}
+			s.timeslices[claimDevice.DeviceName].claims[claimUID] = true
+		}
+	}
+}
+
+// setTimeslice sets the timeslice of the GPU for the claim, unless other
+// prepared claims have set a different timeslice on it.
+func (s *nodeState) setTimeslice(gpu *device.DeviceInfo, deviceName string, claimUID string, interval time.Duration) error {
+	usage, found := s.timeslices[deviceName]
+	if found && usage.interval != interval {
+		return fmt.Errorf("device %v is time-sliced with %v by other claims, %v requested", deviceName, usage.interval, interval)
+	}
+
+	if !found {
+		if err := gpu.SetTimeslice(s.sysfsRoot, interval); err != nil {
+			return err
+		}
+		usage = &timesliceUsage{interval: interval, claims: map[string]bool{}}
+		s.timeslices[deviceName] = usage
+		klog.V(5).Infof("Set %v timeslice on device %v", interval, deviceName)
+	}
+	usage.claims[claimUID] = true
+
+	return nil
+}
+
+// releaseTimeslice restores the default timeslice of the GPU when the claim
+// was the last prepared claim which set the timeslice.
+func (s *nodeState) releaseTimeslice(gpu *device.DeviceInfo, deviceName string, claimUID string) error {
+	usage, found := s.timeslices[deviceName]
+	if !found || !usage.claims[claimUID] {
+		return nil
+	}
+
+	delete(usage.claims, claimUID)
+	if len(usage.claims) > 0 {
+		return nil
+	}
+
+	delete(s.timeslices, deviceName)
+	return gpu.ResetTimeslice(s.sysfsRoot)
+}
+
+func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if claim.Status.Allocation == nil {
+		return fmt.Errorf("no allocation found in claim %v/%v status", claim.Namespace, claim.Name)
+	}
+
+	claimUID := string(claim.UID)
+	// timeslices set for the claim are released if preparing it fails
+	timeslicedDevices := []string{}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, deviceName := range timeslicedDevices {
+			if resetErr := s.releaseTimeslice(s.allocatable[deviceName], deviceName, claimUID); resetErr != nil {
+				klog.Warningf("Could not restore default timeslice: %v", resetErr)
+			}
+		}
+	}()
+
+	allocatedDevices := []*drav1.Device{}
+
+	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
+		// ATM the only pool is cluster node's pool: all devices on current node.
+		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.nodeName {
+			klog.FromContext(ctx).Info("ignoring claim allocation device", "device pool", allocatedDevice.Pool, "device driver", allocatedDevice.Driver,
+				"expected pool", s.nodeName, "expected driver", device.DriverName)
+			continue
+		}
+
+		allocatableDevice, found := s.allocatable[allocatedDevice.Device]
+		if !found {
+			return fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
+		}
+
+		config, err := requestConfig(claim, allocatedDevice.Request)
+		if err != nil {
+			return err
+		}
+		if config != nil && config.TimeSlicing != nil {
+			if allocatableDevice.Exclusive {
+				return fmt.Errorf("device %v is exclusive, time-sliced sharing is not allowed", allocatedDevice.Device)
+			}
+			if err := s.setTimeslice(allocatableDevice, allocatedDevice.Device, claimUID, config.TimeSlicing.Interval.Duration); err != nil {
+				return err
+			}
+			timeslicedDevices = append(timeslicedDevices, allocatedDevice.Device)
+		}
+
+		newDevice := drav1.Device{
+			RequestNames: []string{allocatedDevice.Request},
+			PoolName:     allocatedDevice.Pool,
+			DeviceName:   allocatedDevice.Device,
+			CDIDeviceIDs: []string{allocatableDevice.CDIName()},
+		}
+		allocatedDevices = append(allocatedDevices, &newDevice)
+	}
+
+	previousDevices, wasPrepared := s.prepared[claimUID]
+	s.prepared[claimUID] = allocatedDevices
+
+	if err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared); err != nil {
+		klog.Errorf("Error writing prepared claims to file: %v", err)
+		if wasPrepared {
+			s.prepared[claimUID] = previousDevices
+		} else {
+			delete(s.prepared, claimUID)
+		}
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	klog.V(5).Infof("Created prepared claim %v allocation", claim.UID)
+	return nil
+}
+
+// requestConfig returns the opaque configuration of the driver for the request,
+// nil if there is none. Configuration from the ResourceClaim follows
+// configuration from the DeviceClass, so the last one wins.
+func requestConfig(claim *resourcev1.ResourceClaim, request string) (*device.GpuConfig, error) {
+	var gpuConfig *device.GpuConfig
+
+	for _, config := range claim.Status.Allocation.Devices.Config {
+		if config.Opaque == nil || config.Opaque.Driver != device.DriverName {
+			continue
+		}
+		if len(config.Requests) > 0 && !slices.Contains(config.Requests, request) {
+			continue
+		}
+
+		decoded, err := device.DecodeGpuConfig(config.Opaque.Parameters.Raw)
+		if err != nil {
+			return nil, err
+		}
+		gpuConfig = decoded
+	}
+
+	return gpuConfig, nil
+}
+
+func (s *nodeState) Unprepare(ctx context.Context, claimUID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.prepared[claimUID] == nil {
+		return nil
+	}
+
+	klog.V(5).Infof("Freeing devices from claim %v", claimUID)
+	for _, claimDevice := range s.prepared[claimUID] {
+		if allocatableDevice, found := s.allocatable[claimDevice.DeviceName]; found {
+			if err := s.releaseTimeslice(allocatableDevice, claimDevice.DeviceName, claimUID); err != nil {
+				klog.Warningf("Could not restore default timeslice: %v", err)
+			}
+		}
+	}
+
+	claimDevices := s.prepared[claimUID]
+	delete(s.prepared, claimUID)
+
+	// write prepared claims to file, the claim stays prepared when it fails so
+	// that unprepare can be retried.
+	if err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared); err != nil {
+		s.prepared[claimUID] = claimDevices
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+// PreparedDevices returns the devices prepared for the claim, and whether the
+// claim is prepared.
+func (s *nodeState) PreparedDevices(claimUID string) ([]*drav1.Device, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	claimDevices, found := s.prepared[claimUID]
+	return claimDevices, found
+}
+
+// MissingPreparedDevices returns the prepared devices that are not
+// allocatable, by the UID of the claim they are prepared for.
+func (s *nodeState) MissingPreparedDevices() map[string][]string {
+	s.Lock()
+	defer s.Unlock()
+
+	missing := map[string][]string{}
+	for claimUID, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			if _, found := s.allocatable[claimDevice.DeviceName]; !found {
+				missing[claimUID] = append(missing[claimUID], claimDevice.DeviceName)
+			}
+		}
+	}
+
+	return missing
+}
+
+// DeviceUsage returns memory and millicores of every allocatable GPU, and how
+// much of it is taken by prepared claims.
+func (s *nodeState) DeviceUsage() []helpers.DeviceUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	preparedDevices := map[string]bool{}
+	for _, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			preparedDevices[claimDevice.DeviceName] = true
+		}
+	}
+
+	usage := []helpers.DeviceUsage{}
+	for gpuUID, gpu := range s.allocatable {
+		// Devices are allocated to claims as a whole.
+		allocatedShare := 0.0
+		if preparedDevices[gpuUID] {
+			allocatedShare = 1
+		}
+
+		memory := float64(gpu.MemoryMiB * 1024 * 1024)
+		millicores := float64(gpu.Millicores)
+		usage = append(usage,
+			helpers.DeviceUsage{Device: gpuUID, Resource: "memory", Total: memory, Allocated: memory * allocatedShare},
+			helpers.DeviceUsage{Device: gpuUID, Resource: "millicores", Total: millicores, Allocated: millicores * allocatedShare})
+	}
+
+	return usage
+}
+
+// CDIDrift returns CDI registry devices that were rewritten to match detected devices.
+func (s *nodeState) CDIDrift() helpers.CDIDrift {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cdiDrift
+}
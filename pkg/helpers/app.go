@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/component-base/logs"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	"k8s.io/component-base/term"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SysfsRootEnvVarName = "SYSFS_ROOT"
+	DevfsRootEnvVarName = "DEVFS_ROOT"
+	NodeNameEnvVarName  = "NODE_NAME"
+
+	// FakeNodeName is the node name in fake mode when it is not given.
+	FakeNodeName = "fake-node"
+)
+
+// AppFlags are the command line flags shared by all kubelet plugins.
+type AppFlags struct {
+	Kubeconfig   *string
+	KubeAPIQPS   *float32
+	KubeAPIBurst *int
+	HTTPEndpoint *string
+	PprofPath    *string
+	AuditLog     *string
+	SysfsRoot    *string
+	DevfsRoot    *string
+	CDIDir       *string
+	NodeName     *string
+	FakeMode     *bool
+}
+
+// RunFunc starts the kubelet plugin and returns when it has stopped.
+type RunFunc func(ctx context.Context, flags *AppFlags) error
+
+// PluginFlagsFunc adds the flags specific to one kubelet plugin.
+type PluginFlagsFunc func(fs *pflag.FlagSet)
+
+// NewApp returns the command of a kubelet plugin with the logging, Kubernetes
+// client, HTTP server and audit flags. It is used as the main command of the
+// per-accelerator binaries, and as a subcommand of intel-resource-driver.
+// Optional pluginFlags add the plugin specific flags.
+func NewApp(use string, short string, run RunFunc, pluginFlags ...PluginFlagsFunc) *cobra.Command {
+	logsconfig := logsapi.NewLoggingConfiguration()
+	fgate := featuregate.NewFeatureGate()
+	utilruntime.Must(logsapi.AddFeatureGates(fgate))
+
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+	}
+
+	flags := addAppFlags(cmd, logsconfig, pluginFlags)
+
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := logsapi.ValidateAndApply(logsconfig, fgate); err != nil {
+			return fmt.Errorf("failed to validate logs config: %v", err)
+		}
+
+		return flags.applyNodeFlags()
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return run(cmd.Context(), flags)
+	}
+
+	return cmd
+}
+
+func addAppFlags(cmd *cobra.Command, logsconfig *logsapi.LoggingConfiguration, pluginFlags []PluginFlagsFunc) *AppFlags {
+	flags := &AppFlags{}
+
+	sharedFlagSets := cliflag.NamedFlagSets{}
+	fs := sharedFlagSets.FlagSet("logging")
+	logsapi.AddFlags(logsconfig, fs)
+	logs.AddFlags(fs, logs.SkipLoggingConfigurationFlags())
+
+	fs = sharedFlagSets.FlagSet("Kubernetes client")
+	flags.Kubeconfig = fs.String("kubeconfig", "", "Absolute path to the kube.config file")
+	flags.KubeAPIQPS = fs.Float32("kube-api-qps", 15, "QPS to use while communicating with the kubernetes apiserver.")
+	flags.KubeAPIBurst = fs.Int("kube-api-burst", 45, "Burst to use while communicating with the kubernetes apiserver.")
+
+	fs = sharedFlagSets.FlagSet("HTTP server")
+	flags.HTTPEndpoint = fs.String("http-endpoint", "",
+		"The TCP network address where the HTTP server for health checks, metrics and profiling will listen (example: `:8080`). The default is the empty string, which means the server is disabled.")
+	flags.PprofPath = fs.String("pprof-path", "",
+		"The HTTP path where pprof profiling will be available, disabled if empty. Requires --http-endpoint.")
+
+	fs = sharedFlagSets.FlagSet("node")
+	flags.SysfsRoot = fs.String("sysfs-root", "",
+		"Root of the sysfs the devices are discovered from, e.g. fake sysfs created by device-faker. The default is the empty string, which means the "+SysfsRootEnvVarName+" environment variable, or /sys.")
+	flags.DevfsRoot = fs.String("devfs-root", "",
+		"Root of the devfs the device nodes are in, e.g. fake devfs created by device-faker. The default is the empty string, which means the "+DevfsRootEnvVarName+" environment variable, or /dev.")
+	flags.CDIDir = fs.String("cdi-dir", "",
+		"Directory where the CDI specs of the devices are written. The default is the empty string, which means the cdi directory next to --sysfs-root in fake mode, or the default CDI directory of the driver.")
+	flags.NodeName = fs.String("node-name", "",
+		"Name of the node the plugin publishes the devices of. The default is the empty string, which means the "+NodeNameEnvVarName+" environment variable.")
+	flags.FakeMode = fs.Bool("fake-mode", false,
+		"Run without a cluster, for development against device-faker output: Kubernetes API calls go to an in-memory fake API server, kubelet plugin sockets and state are kept in the kubelet-plugin directory, and CDI specs are written to the cdi directory next to --sysfs-root. Requires --sysfs-root.")
+
+	fs = sharedFlagSets.FlagSet("audit")
+	flags.AuditLog = fs.String("audit-log", "",
+		"Path of the file where a JSON record of every claim preparation and unpreparation is appended, \"-\" for stdout. The default is the empty string, which means auditing is disabled.")
+
+	if len(pluginFlags) > 0 {
+		fs = sharedFlagSets.FlagSet("plugin")
+		for _, addFlags := range pluginFlags {
+			addFlags(fs)
+		}
+	}
+
+	fs = cmd.PersistentFlags()
+	for _, f := range sharedFlagSets.FlagSets {
+		fs.AddFlagSet(f)
+	}
+
+	cols, _, _ := term.TerminalSize(cmd.OutOrStdout())
+	cliflag.SetUsageAndHelpFunc(cmd, sharedFlagSets, cols)
+
+	return flags
+}
+
+// applyNodeFlags passes the root directories to device discovery through the
+// environment variables it reads, so that the flags work for all drivers.
+func (f *AppFlags) applyNodeFlags() error {
+	if *f.FakeMode {
+		if *f.SysfsRoot == "" {
+			return errors.New("--fake-mode requires --sysfs-root")
+		}
+		if f.NodeNameOrDefault("") == "" {
+			*f.NodeName = FakeNodeName
+		}
+	}
+
+	for envVar, root := range map[string]string{
+		SysfsRootEnvVarName: *f.SysfsRoot,
+		DevfsRootEnvVarName: *f.DevfsRoot,
+	} {
+		if root == "" {
+			continue
+		}
+		if err := os.Setenv(envVar, root); err != nil {
+			return fmt.Errorf("set %v: %v", envVar, err)
+		}
+	}
+
+	return nil
+}
+
+// CDIDirOrDefault returns the --cdi-dir directory if given. Otherwise it is
+// the cdi directory next to the fake sysfs in fake mode, so that a development
+// run does not write CDI specs of fake devices to the host, or defaultDir.
+func (f *AppFlags) CDIDirOrDefault(defaultDir string) string {
+	if *f.CDIDir != "" {
+		return *f.CDIDir
+	}
+	if *f.FakeMode {
+		return f.fakeDir("cdi")
+	}
+	return defaultDir
+}
+
+// NodeNameOrDefault returns the --node-name or the NODE_NAME environment
+// variable, or defaultName if neither is set.
+func (f *AppFlags) NodeNameOrDefault(defaultName string) string {
+	if *f.NodeName != "" {
+		return *f.NodeName
+	}
+	if nodeName, found := os.LookupEnv(NodeNameEnvVarName); found {
+		return nodeName
+	}
+	return defaultName
+}
+
+// KubeletPluginsDir returns the directory of the kubelet plugin sockets and
+// state, which in fake mode is next to the fake sysfs as device-faker creates it.
+func (f *AppFlags) KubeletPluginsDir() string {
+	if *f.FakeMode {
+		return f.fakeDir("kubelet-plugin/plugins") + "/"
+	}
+	return DefaultKubeletPluginsDir
+}
+
+// KubeletPluginsRegistryDir returns the directory of the kubelet plugin
+// registration sockets, which in fake mode is next to the fake sysfs.
+func (f *AppFlags) KubeletPluginsRegistryDir() string {
+	if *f.FakeMode {
+		return f.fakeDir("kubelet-plugin/plugins_registry") + "/"
+	}
+	return DefaultKubeletPluginsRegistryDir
+}
+
+// fakeDir returns dir in the fake file system root, the parent of the fake
+// sysfs, laid out the same way as device-faker and plugintesthelpers do.
+func (f *AppFlags) fakeDir(dir string) string {
+	return path.Join(path.Dir(path.Clean(*f.SysfsRoot)), dir)
+}
+
+// ClientSetConfig returns the client configuration from the KUBECONFIG env
+// var or --kubeconfig flag, or the in-cluster configuration.
+func (f *AppFlags) ClientSetConfig() (*rest.Config, error) {
+	var csconfig *rest.Config
+	kubeconfigEnv := os.Getenv("KUBECONFIG")
+
+	if kubeconfigEnv != "" {
+		klog.V(5).Info("Found KUBECONFIG environment variable set, using that..")
+		*f.Kubeconfig = kubeconfigEnv
+	}
+
+	var err error
+	if *f.Kubeconfig == "" {
+		csconfig, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("create in-cluster client configuration: %v", err)
+		}
+	} else {
+		csconfig, err = clientcmd.BuildConfigFromFlags("", *f.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("create out-of-cluster client configuration: %v", err)
+		}
+	}
+
+	csconfig.QPS = *f.KubeAPIQPS
+	csconfig.Burst = *f.KubeAPIBurst
+
+	return csconfig, nil
+}
+
+// NewKubeClient returns a Kubernetes client configured by the flags. In fake
+// mode it is an in-memory fake client with the node of the plugin.
+func (f *AppFlags) NewKubeClient() (coreclientset.Interface, error) {
+	if *f.FakeMode {
+		klog.Info("Fake mode, using in-memory Kubernetes API")
+		return newFakeKubeClient(f.NodeNameOrDefault(FakeNodeName)), nil
+	}
+
+	csconfig, err := f.ClientSetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("create client configuration: %v", err)
+	}
+
+	coreclient, err := coreclientset.NewForConfig(csconfig)
+	if err != nil {
+		return nil, fmt.Errorf("create core client: %v", err)
+	}
+
+	return coreclient, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logsapi "k8s.io/component-base/logs/api/v1"
+)
+
+// parseAppFlags parses args like NewApp does, without applying the logging
+// configuration, which can be done only once in a process.
+func parseAppFlags(t *testing.T, args ...string) (*AppFlags, error) {
+	cmd := &cobra.Command{Use: "test"}
+	flags := addAppFlags(cmd, logsapi.NewLoggingConfiguration(), nil)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("could not parse %v: %v", args, err)
+	}
+	return flags, flags.applyNodeFlags()
+}
+
+func TestNodeFlags(t *testing.T) {
+	t.Setenv(SysfsRootEnvVarName, "")
+	t.Setenv(DevfsRootEnvVarName, "")
+	t.Setenv(NodeNameEnvVarName, "")
+	if err := os.Unsetenv(NodeNameEnvVarName); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	flags, err := parseAppFlags(t, "--sysfs-root", "/tmp/test-1/sysfs", "--devfs-root", "/tmp/test-1/dev", "--cdi-dir", "/tmp/test-1/cdi", "--fake-mode")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if os.Getenv(SysfsRootEnvVarName) != "/tmp/test-1/sysfs" || os.Getenv(DevfsRootEnvVarName) != "/tmp/test-1/dev" {
+		t.Errorf("expected root flags in environment, got %v and %v", os.Getenv(SysfsRootEnvVarName), os.Getenv(DevfsRootEnvVarName))
+	}
+	if cdiDir := flags.CDIDirOrDefault(DefaultCDIRoot); cdiDir != "/tmp/test-1/cdi" {
+		t.Errorf("expected CDI dir from flag, got %v", cdiDir)
+	}
+	if nodeName := flags.NodeNameOrDefault("127.0.0.1"); nodeName != FakeNodeName {
+		t.Errorf("expected fake node name, got %v", nodeName)
+	}
+	if dir := flags.KubeletPluginsDir(); dir != "/tmp/test-1/kubelet-plugin/plugins/" {
+		t.Errorf("expected kubelet plugins dir next to fake sysfs, got %v", dir)
+	}
+	if dir := flags.KubeletPluginsRegistryDir(); dir != "/tmp/test-1/kubelet-plugin/plugins_registry/" {
+		t.Errorf("expected kubelet plugins registry dir next to fake sysfs, got %v", dir)
+	}
+
+	client, err := flags.NewKubeClient()
+	if err != nil {
+		t.Fatalf("could not create fake client: %v", err)
+	}
+	if _, err := client.CoreV1().Nodes().Get(context.TODO(), FakeNodeName, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected fake client to have the node: %v", err)
+	}
+}
+
+func TestNodeFlagsDefaults(t *testing.T) {
+	t.Setenv(NodeNameEnvVarName, "env-node")
+
+	flags, err := parseAppFlags(t)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cdiDir := flags.CDIDirOrDefault(DefaultCDIRoot); cdiDir != DefaultCDIRoot {
+		t.Errorf("expected default CDI dir, got %v", cdiDir)
+	}
+	if nodeName := flags.NodeNameOrDefault("127.0.0.1"); nodeName != "env-node" {
+		t.Errorf("expected node name from environment, got %v", nodeName)
+	}
+	if flags.KubeletPluginsDir() != DefaultKubeletPluginsDir || flags.KubeletPluginsRegistryDir() != DefaultKubeletPluginsRegistryDir {
+		t.Errorf("expected default kubelet dirs, got %v and %v", flags.KubeletPluginsDir(), flags.KubeletPluginsRegistryDir())
+	}
+
+	if _, err := parseAppFlags(t, "--fake-mode"); err == nil {
+		t.Errorf("expected --fake-mode without --sysfs-root to fail")
+	}
+
+	flags, err = parseAppFlags(t, "--fake-mode", "--sysfs-root", "/tmp/test-2/sysfs/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cdiDir := flags.CDIDirOrDefault(DefaultCDIRoot); cdiDir != "/tmp/test-2/cdi" {
+		t.Errorf("expected CDI dir next to fake sysfs, got %v", cdiDir)
+	}
+}
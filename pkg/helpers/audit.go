@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+const (
+	AuditActionPrepare   = "prepare"
+	AuditActionUnprepare = "unprepare"
+)
+
+// AuditRecord is a single JSON line of the audit log.
+type AuditRecord struct {
+	Time           time.Time `json:"time"`
+	Action         string    `json:"action"`
+	Driver         string    `json:"driver"`
+	Node           string    `json:"node"`
+	ClaimUID       string    `json:"claimUID"`
+	ClaimNamespace string    `json:"claimNamespace"`
+	ClaimName      string    `json:"claimName"`
+	Devices        []string  `json:"devices,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// AuditLogger writes a record of every claim preparation and unpreparation.
+// A nil AuditLogger discards all records.
+type AuditLogger struct {
+	sync.Mutex
+	encoder  *json.Encoder
+	driver   string
+	nodeName string
+	now      func() time.Time
+}
+
+// NewAuditLogger returns an AuditLogger appending to the file at auditLogPath,
+// or writing to stdout when the path is "-".
+func NewAuditLogger(auditLogPath string, driver string, nodeName string) (*AuditLogger, error) {
+	var output io.Writer = os.Stdout
+	if auditLogPath != "-" {
+		f, err := os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log %v: %v", auditLogPath, err)
+		}
+		output = f
+	}
+
+	return newAuditLogger(output, driver, nodeName), nil
+}
+
+func newAuditLogger(output io.Writer, driver string, nodeName string) *AuditLogger {
+	return &AuditLogger{
+		encoder:  json.NewEncoder(output),
+		driver:   driver,
+		nodeName: nodeName,
+		now:      time.Now,
+	}
+}
+
+// LogPrepare records the devices prepared for the claim, or the failure reason.
+func (a *AuditLogger) LogPrepare(claim *drav1.Claim, response *drav1.NodePrepareResourceResponse) {
+	devices := []string{}
+	for _, preparedDevice := range response.Devices {
+		devices = append(devices, preparedDevice.PoolName+"/"+preparedDevice.DeviceName)
+	}
+
+	a.log(AuditActionPrepare, claim, devices, response.Error)
+}
+
+// LogUnprepare records the unpreparation of the claim, or the failure reason.
+func (a *AuditLogger) LogUnprepare(claim *drav1.Claim, response *drav1.NodeUnprepareResourceResponse) {
+	a.log(AuditActionUnprepare, claim, nil, response.Error)
+}
+
+func (a *AuditLogger) log(action string, claim *drav1.Claim, devices []string, reason string) {
+	if a == nil {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	record := AuditRecord{
+		Time:           a.now().UTC(),
+		Action:         action,
+		Driver:         a.driver,
+		Node:           a.nodeName,
+		ClaimUID:       claim.UID,
+		ClaimNamespace: claim.Namespace,
+		ClaimName:      claim.Name,
+		Devices:        devices,
+		Error:          reason,
+	}
+
+	if err := a.encoder.Encode(record); err != nil {
+		klog.Errorf("could not write audit record: %v", err)
+	}
+}
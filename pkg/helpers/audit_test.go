@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+func TestAuditLogger(t *testing.T) {
+	type testCase struct {
+		name     string
+		log      func(a *AuditLogger)
+		expected string
+	}
+
+	claim := &drav1.Claim{UID: "uid1", Namespace: "default", Name: "claim1"}
+
+	testcases := []testCase{
+		{
+			name: "prepared devices",
+			log: func(a *AuditLogger) {
+				a.LogPrepare(claim, &drav1.NodePrepareResourceResponse{
+					Devices: []*drav1.Device{
+						{PoolName: "node1", DeviceName: "card0"},
+						{PoolName: "node1", DeviceName: "card1"},
+					},
+				})
+			},
+			expected: `{"time":"2024-01-02T03:04:05Z","action":"prepare","driver":"gpu.intel.com","node":"node1","claimUID":"uid1","claimNamespace":"default","claimName":"claim1","devices":["node1/card0","node1/card1"]}
+`,
+		},
+		{
+			name: "failed preparation",
+			log: func(a *AuditLogger) {
+				a.LogPrepare(claim, &drav1.NodePrepareResourceResponse{Error: "could not find allocatable device card2"})
+			},
+			expected: `{"time":"2024-01-02T03:04:05Z","action":"prepare","driver":"gpu.intel.com","node":"node1","claimUID":"uid1","claimNamespace":"default","claimName":"claim1","error":"could not find allocatable device card2"}
+`,
+		},
+		{
+			name: "unprepared claim",
+			log: func(a *AuditLogger) {
+				a.LogUnprepare(claim, &drav1.NodeUnprepareResourceResponse{})
+			},
+			expected: `{"time":"2024-01-02T03:04:05Z","action":"unprepare","driver":"gpu.intel.com","node":"node1","claimUID":"uid1","claimNamespace":"default","claimName":"claim1"}
+`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		output := &bytes.Buffer{}
+		auditLogger := newAuditLogger(output, "gpu.intel.com", "node1")
+		auditLogger.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+		testcase.log(auditLogger)
+		if output.String() != testcase.expected {
+			t.Errorf("%v: unexpected audit record:\n%s\nexpected:\n%s", testcase.name, output.String(), testcase.expected)
+		}
+	}
+
+	// nil AuditLogger discards records.
+	var auditLogger *AuditLogger
+	auditLogger.LogUnprepare(claim, &drav1.NodeUnprepareResourceResponse{})
+}
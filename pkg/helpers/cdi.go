@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// CDIDrift lists devices of the CDI registry that did not match the detected
+// devices when syncing the registry, and were rewritten.
+type CDIDrift struct {
+	// Fixed devices had stale device nodes.
+	Fixed []string
+	// Removed devices were no longer present on the node.
+	Removed []string
+}
+
+func (d CDIDrift) Empty() bool {
+	return len(d.Fixed) == 0 && len(d.Removed) == 0
+}
+
+func (d CDIDrift) String() string {
+	return fmt.Sprintf("fixed devices %v, removed devices %v", d.Fixed, d.Removed)
+}
+
+// Add appends devices of another drift.
+func (d *CDIDrift) Add(other CDIDrift) {
+	d.Fixed = append(d.Fixed, other.Fixed...)
+	d.Removed = append(d.Removed, other.Removed...)
+}
+
+// CDIDriftEventsFlag returns the plugin flags function adding the
+// --cdi-drift-events flag, which enables the Events of ReportCDIDrift.
+func CDIDriftEventsFlag(events *bool) PluginFlagsFunc {
+	return func(fs *pflag.FlagSet) {
+		fs.BoolVar(events, "cdi-drift-events", false,
+			"Record a Warning Event on the Node when CDI devices did not match the detected devices on start and were rewritten, e.g. to notice other agents writing CDI specs. The drift is logged, and exported as a metric with --http-endpoint, also without Events.")
+	}
+}
+
+// ReportCDIDrift logs CDI registry devices which did not match the detected
+// devices, and with events enabled, records a Warning Event on the Node.
+func ReportCDIDrift(recorder record.EventRecorder, nodeName string, drift CDIDrift, events bool) {
+	if drift.Empty() {
+		return
+	}
+
+	klog.Warningf("CDI registry did not match detected devices: %v", drift)
+	if events {
+		recorder.Eventf(NodeReference(nodeName), corev1.EventTypeWarning, CDISpecDriftReason,
+			"CDI registry did not match detected devices and was rewritten: %v", drift)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReportCDIDrift(t *testing.T) {
+	testcases := []struct {
+		name           string
+		args           []string
+		drift          CDIDrift
+		expectedEvents []string
+	}{
+		{
+			name:  "events disabled by default",
+			drift: CDIDrift{Fixed: []string{"card0"}},
+		},
+		{
+			name:           "events enabled",
+			args:           []string{"--cdi-drift-events"},
+			drift:          CDIDrift{Fixed: []string{"card0"}, Removed: []string{"card1"}},
+			expectedEvents: []string{"Warning CDISpecDrift CDI registry did not match detected devices and was rewritten: fixed devices [card0], removed devices [card1]"},
+		},
+		{
+			name: "events enabled, no drift",
+			args: []string{"--cdi-drift-events"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			var events bool
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			CDIDriftEventsFlag(&events)(fs)
+			if err := fs.Parse(testcase.args); err != nil {
+				t.Fatalf("could not parse %v: %v", testcase.args, err)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			ReportCDIDrift(recorder, "node1", testcase.drift, events)
+
+			if len(recorder.Events) != len(testcase.expectedEvents) {
+				t.Fatalf("expected %d events, got %d", len(testcase.expectedEvents), len(recorder.Events))
+			}
+			for _, expected := range testcase.expectedEvents {
+				if event := <-recorder.Events; event != expected {
+					t.Errorf("unexpected event %q, expected %q", event, expected)
+				}
+			}
+		})
+	}
+}
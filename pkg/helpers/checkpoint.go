@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+// corruptedSuffix is appended to the name of a prepared claims file that
+// could not be parsed.
+const corruptedSuffix = ".corrupted"
+
+// ClaimPreparations are the devices prepared for every claim UID, checkpointed
+// so that a restarted plugin answers kubelet the same way.
+type ClaimPreparations map[string][]*drav1.Device
+
+// GetOrCreatePreparedClaims reads prepared claims from the checkpoint file, or
+// creates an empty checkpoint file. The returned lost is true when the file
+// was corrupted, or was missing while devices were inUse, e.g. CDI specs of
+// the driver existed, and prepared claims need to be recovered with
+// RecoverPreparedClaims. A missing file on a fresh install is not lost. A
+// corrupted file is kept with corruptedSuffix.
+func GetOrCreatePreparedClaims(preparedClaimsFilePath string, inUse bool) (preparedClaims ClaimPreparations, lost bool, err error) {
+	if _, err := os.Stat(preparedClaimsFilePath); os.IsNotExist(err) {
+		klog.V(5).Infof("could not find file %v. Creating file", preparedClaimsFilePath)
+		if err := WritePreparedClaimsToFile(preparedClaimsFilePath, nil); err != nil {
+			return nil, false, fmt.Errorf("failed creating file %v. Err: %v", preparedClaimsFilePath, err)
+		}
+
+		klog.V(5).Infof("empty prepared claims file created %v", preparedClaimsFilePath)
+
+		return ClaimPreparations{}, inUse, nil
+	}
+
+	preparedClaimsBytes, err := os.ReadFile(preparedClaimsFilePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading file %v. Err: %v", preparedClaimsFilePath, err)
+	}
+
+	preparedClaims = make(ClaimPreparations)
+	if err := json.Unmarshal(preparedClaimsBytes, &preparedClaims); err != nil {
+		klog.Errorf("prepared claims file %v is corrupted: %v", preparedClaimsFilePath, err)
+		if err := KeepCorruptedFile(preparedClaimsFilePath); err != nil {
+			return nil, false, err
+		}
+		if err := WritePreparedClaimsToFile(preparedClaimsFilePath, nil); err != nil {
+			return nil, false, fmt.Errorf("failed creating file %v. Err: %v", preparedClaimsFilePath, err)
+		}
+
+		return ClaimPreparations{}, true, nil
+	}
+
+	return preparedClaims, false, nil
+}
+
+// KeepCorruptedFile moves aside a state file that could not be parsed, with
+// corruptedSuffix, so that a new one can be created and the corrupted one
+// inspected.
+func KeepCorruptedFile(filePath string) error {
+	klog.Warningf("keeping corrupted file %v as %v", filePath, filePath+corruptedSuffix)
+	if err := os.Rename(filePath, filePath+corruptedSuffix); err != nil {
+		return fmt.Errorf("failed moving corrupted file %v. Err: %v", filePath, err)
+	}
+
+	return nil
+}
+
+// RecoverPreparedClaims calls prepare for every ResourceClaim with devices of
+// the driver allocated on the node and reserved for Pods. Such claims may have
+// been prepared before the prepared claims file was lost, and preparing them
+// again restores their preparations. Claims that cannot be prepared are skipped.
+func RecoverPreparedClaims(ctx context.Context, clientset kubernetes.Interface, driverName string, nodeName string,
+	prepare func(ctx context.Context, claim *resourcev1.ResourceClaim) error) error {
+	claims, err := clientset.ResourceV1beta1().ResourceClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list ResourceClaims: %v", err)
+	}
+
+	for idx := range claims.Items {
+		claim := &claims.Items[idx]
+		if len(claim.Status.ReservedFor) == 0 || !allocatedOnNode(claim, driverName, nodeName) {
+			continue
+		}
+
+		if err := prepare(ctx, claim); err != nil {
+			klog.Warningf("could not recover preparation of claim %v/%v: %v", claim.Namespace, claim.Name, err)
+			continue
+		}
+		klog.Infof("Recovered preparation of claim %v/%v", claim.Namespace, claim.Name)
+	}
+
+	return nil
+}
+
+// allocatedOnNode returns true when the claim has devices of the driver
+// allocated from the node's pool.
+func allocatedOnNode(claim *resourcev1.ResourceClaim, driverName string, nodeName string) bool {
+	if claim.Status.Allocation == nil {
+		return false
+	}
+
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver == driverName && result.Pool == nodeName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadPreparedClaimsFromFile returns unmarshaled content of the prepared claims JSON file.
+func ReadPreparedClaimsFromFile(preparedClaimsFilePath string) (ClaimPreparations, error) {
+	preparedClaims := make(ClaimPreparations)
+
+	preparedClaimsBytes, err := os.ReadFile(preparedClaimsFilePath)
+	if err != nil {
+		klog.V(5).Infof("could not read prepared claims configuration from file %v. Err: %v", preparedClaimsFilePath, err)
+		return nil, fmt.Errorf("failed reading file %v. Err: %v", preparedClaimsFilePath, err)
+	}
+
+	if err := json.Unmarshal(preparedClaimsBytes, &preparedClaims); err != nil {
+		klog.V(5).Infof("Could not parse default prepared claims configuration from file %v. Err: %v", preparedClaimsFilePath, err)
+		return nil, fmt.Errorf("failed parsing file %v. Err: %v", preparedClaimsFilePath, err)
+	}
+
+	return preparedClaims, nil
+}
+
+// WritePreparedClaimsToFile serializes prepared claims and writes them to the checkpoint file.
+func WritePreparedClaimsToFile(preparedClaimsFilePath string, preparedClaims ClaimPreparations) error {
+	if preparedClaims == nil {
+		preparedClaims = ClaimPreparations{}
+	}
+	encodedPreparedClaims, err := json.MarshalIndent(preparedClaims, "", "  ")
+	if err != nil {
+		return fmt.Errorf("prepared claims JSON encoding failed. Err: %v", err)
+	}
+	return os.WriteFile(preparedClaimsFilePath, encodedPreparedClaims, 0600)
+}
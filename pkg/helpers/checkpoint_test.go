@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+func TestPreparedClaimsCheckpoint(t *testing.T) {
+	preparedClaimsFilePath := path.Join(t.TempDir(), "preparedClaims.json")
+
+	preparedClaims, lost, err := GetOrCreatePreparedClaims(preparedClaimsFilePath, false)
+	if err != nil {
+		t.Fatalf("could not create prepared claims file: %v", err)
+	}
+	if len(preparedClaims) != 0 || lost {
+		t.Errorf("expected no prepared claims in new file on fresh install, got %v, lost %v", preparedClaims, lost)
+	}
+
+	if err := os.Remove(preparedClaimsFilePath); err != nil {
+		t.Fatalf("could not remove prepared claims file: %v", err)
+	}
+	preparedClaims, lost, err = GetOrCreatePreparedClaims(preparedClaimsFilePath, true)
+	if err != nil {
+		t.Fatalf("could not create prepared claims file: %v", err)
+	}
+	if len(preparedClaims) != 0 || !lost {
+		t.Errorf("expected no prepared claims in new file and lost checkpoint with devices in use, got %v, lost %v", preparedClaims, lost)
+	}
+
+	expected := ClaimPreparations{
+		"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "card0", CDIDeviceIDs: []string{"intel.com/gpu=card0"}}},
+		"uid2": []*drav1.Device{},
+	}
+	if err := WritePreparedClaimsToFile(preparedClaimsFilePath, expected); err != nil {
+		t.Fatalf("could not write prepared claims: %v", err)
+	}
+
+	preparedClaims, lost, err = GetOrCreatePreparedClaims(preparedClaimsFilePath, true)
+	if err != nil {
+		t.Fatalf("could not read prepared claims: %v", err)
+	}
+	if !reflect.DeepEqual(preparedClaims, expected) || lost {
+		t.Errorf("unexpected prepared claims %+v, lost %v, expected %+v", preparedClaims, lost, expected)
+	}
+
+	if err := WritePreparedClaimsToFile(preparedClaimsFilePath, nil); err != nil {
+		t.Fatalf("could not write empty prepared claims: %v", err)
+	}
+	if preparedClaims, err = ReadPreparedClaimsFromFile(preparedClaimsFilePath); err != nil || len(preparedClaims) != 0 {
+		t.Errorf("expected no prepared claims, got %v (%v)", preparedClaims, err)
+	}
+}
+
+func TestCorruptedPreparedClaimsCheckpoint(t *testing.T) {
+	preparedClaimsFilePath := path.Join(t.TempDir(), "preparedClaims.json")
+	if err := os.WriteFile(preparedClaimsFilePath, []byte(`{"uid1": [{"poolName": `), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	preparedClaims, lost, err := GetOrCreatePreparedClaims(preparedClaimsFilePath, false)
+	if err != nil || len(preparedClaims) != 0 || !lost {
+		t.Errorf("expected no prepared claims and lost checkpoint, got %v, lost %v, error: %v", preparedClaims, lost, err)
+	}
+
+	if _, err := os.Stat(preparedClaimsFilePath + corruptedSuffix); err != nil {
+		t.Errorf("corrupted file was not kept: %v", err)
+	}
+	if preparedClaims, err := ReadPreparedClaimsFromFile(preparedClaimsFilePath); err != nil || len(preparedClaims) != 0 {
+		t.Errorf("expected new empty prepared claims file, got %v (%v)", preparedClaims, err)
+	}
+}
+
+func TestRecoverPreparedClaims(t *testing.T) {
+	newClaim := func(name string, pool string, reserved bool) *resourcev1.ResourceClaim {
+		claim := &resourcev1.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+			Status: resourcev1.ResourceClaimStatus{
+				Allocation: &resourcev1.AllocationResult{
+					Devices: resourcev1.DeviceAllocationResult{
+						Results: []resourcev1.DeviceRequestAllocationResult{
+							{Request: "gpu", Driver: "gpu.intel.com", Pool: pool, Device: "card0"},
+						},
+					},
+				},
+			},
+		}
+		if reserved {
+			claim.Status.ReservedFor = []resourcev1.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod-" + name}}
+		}
+		return claim
+	}
+
+	clientset := kubefake.NewSimpleClientset(
+		newClaim("in-use", "node1", true),
+		newClaim("not-reserved", "node1", false),
+		newClaim("other-node", "node2", true),
+	)
+
+	recovered := []string{}
+	err := RecoverPreparedClaims(context.TODO(), clientset, "gpu.intel.com", "node1", func(ctx context.Context, claim *resourcev1.ResourceClaim) error {
+		recovered = append(recovered, claim.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not recover prepared claims: %v", err)
+	}
+
+	if !reflect.DeepEqual(recovered, []string{"in-use"}) {
+		t.Errorf("unexpected recovered claims: %v", recovered)
+	}
+}
+
+// TestRecoverPreparedClaimsRBAC runs RecoverPreparedClaims with the
+// permissions the ClusterRole of every kubelet plugin deployment grants.
+func TestRecoverPreparedClaimsRBAC(t *testing.T) {
+	manifests, err := filepath.Glob("../../deployments/*/resource-driver.yaml")
+	if err != nil || len(manifests) == 0 {
+		t.Fatalf("could not find deployment manifests: %v", err)
+	}
+
+	for _, manifest := range manifests {
+		t.Run(filepath.Base(filepath.Dir(manifest)), func(t *testing.T) {
+			rules := clusterRoleRules(t, manifest)
+
+			clientset := kubefake.NewSimpleClientset()
+			clientset.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				resource := action.GetResource()
+				for _, rule := range rules {
+					if ruleAllows(rule.APIGroups, resource.Group) && ruleAllows(rule.Resources, resource.Resource) && ruleAllows(rule.Verbs, action.GetVerb()) {
+						return false, nil, nil
+					}
+				}
+				return true, nil, apierrors.NewForbidden(resource.GroupResource(), "", fmt.Errorf("%v is not allowed", action.GetVerb()))
+			})
+
+			err := RecoverPreparedClaims(context.TODO(), clientset, "gpu.intel.com", "node1", func(ctx context.Context, claim *resourcev1.ResourceClaim) error {
+				return nil
+			})
+			if err != nil {
+				t.Errorf("could not recover prepared claims with the permissions of %v: %v", manifest, err)
+			}
+		})
+	}
+}
+
+// clusterRoleRules returns the rules of the ClusterRoles in the manifest.
+func clusterRoleRules(t *testing.T, manifest string) []rbacv1.PolicyRule {
+	t.Helper()
+
+	file, err := os.Open(manifest)
+	if err != nil {
+		t.Fatalf("could not open manifest: %v", err)
+	}
+	defer file.Close()
+
+	rules := []rbacv1.PolicyRule{}
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		role := rbacv1.ClusterRole{}
+		if err := decoder.Decode(&role); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			t.Fatalf("could not decode manifest %v: %v", manifest, err)
+		}
+		if role.Kind == "ClusterRole" {
+			rules = append(rules, role.Rules...)
+		}
+	}
+
+	if len(rules) == 0 {
+		t.Fatalf("no ClusterRole rules in manifest %v", manifest)
+	}
+
+	return rules
+}
+
+func ruleAllows(values []string, value string) bool {
+	return slices.Contains(values, value) || slices.Contains(values, rbacv1.ResourceAll)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// DrainTimeout is how long a stopping plugin waits for the DRA calls in
+// flight, shorter than the default termination grace period of Pods.
+const DrainTimeout = 20 * time.Second
+
+// InFlightCalls tracks the DRA gRPC calls being served, so that they can
+// finish before the plugin stops.
+type InFlightCalls struct {
+	sync.Mutex
+	calls    sync.WaitGroup
+	draining bool
+}
+
+// Interceptor counts the calls in flight, and rejects new calls once
+// draining has started, so that kubelet retries them later.
+func (c *InFlightCalls) Interceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	c.Lock()
+	if c.draining {
+		c.Unlock()
+		return nil, status.Errorf(codes.Unavailable, "DRA plugin is shutting down, %v rejected", info.FullMethod)
+	}
+	c.calls.Add(1)
+	c.Unlock()
+
+	defer c.calls.Done()
+	return handler(ctx, req)
+}
+
+// Drain rejects new calls and waits until the calls in flight have finished,
+// or ctx is done.
+func (c *InFlightCalls) Drain(ctx context.Context) error {
+	c.Lock()
+	c.draining = true
+	c.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.calls.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop drains the calls in flight, waiting at most DrainTimeout, and then
+// stops publishing resources, stops the gRPC server and unregisters the plugin
+// from kubelet.
+func (p *draPlugin) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), DrainTimeout)
+	defer cancel()
+
+	klog.Info("Finishing DRA calls in flight")
+	if err := p.inFlight.Drain(ctx); err != nil {
+		klog.Warningf("DRA calls still in flight after %v, stopping anyway: %v", DrainTimeout, err)
+	}
+
+	p.stopPublishing()
+	p.DRAPlugin.Stop()
+}
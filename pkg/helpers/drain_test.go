@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInFlightCalls(t *testing.T) {
+	inFlight := &InFlightCalls{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/v1beta1.DRAPlugin/NodePrepareResources"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	callDone := make(chan error)
+	go func() {
+		_, err := inFlight.Interceptor(context.TODO(), nil, info, func(ctx context.Context, req any) (any, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+		callDone <- err
+	}()
+	<-started
+
+	// the call in flight does not finish before the deadline
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if err := inFlight.Drain(ctx); err == nil {
+		t.Errorf("expected drain to time out while a call is in flight")
+	}
+
+	// new calls are rejected once draining has started
+	_, err := inFlight.Interceptor(context.TODO(), nil, info, func(ctx context.Context, req any) (any, error) {
+		t.Errorf("call was not rejected while draining")
+		return nil, nil
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable error for a new call, got: %v", err)
+	}
+
+	close(release)
+	if err := inFlight.Drain(context.TODO()); err != nil {
+		t.Errorf("unexpected drain error after the call finished: %v", err)
+	}
+	if err := <-callDone; err != nil {
+		t.Errorf("unexpected error of the call in flight: %v", err)
+	}
+}
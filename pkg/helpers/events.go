@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+const (
+	// PrepareFailedReason is the Event reason used when devices of a ResourceClaim
+	// could not be prepared on the node.
+	PrepareFailedReason = "PrepareFailed"
+	// UnprepareFailedReason is the Event reason used when devices of a ResourceClaim
+	// could not be unprepared on the node after repeated attempts.
+	UnprepareFailedReason = "UnprepareFailed"
+	// PreparedDeviceMissingReason is the Event reason used when a device recorded
+	// as prepared in the checkpoint file is no longer present on the node.
+	PreparedDeviceMissingReason = "PreparedDeviceMissing"
+	// CDISpecDriftReason is the Event reason used when CDI devices did not match
+	// the detected devices and were rewritten.
+	CDISpecDriftReason = "CDISpecDrift"
+	// DeviceUnhealthyReason is the Event reason used when a device became
+	// unhealthy and was withdrawn from allocation.
+	DeviceUnhealthyReason = "DeviceUnhealthy"
+	// DeviceRecoveredReason is the Event reason used when an unhealthy device
+	// became healthy again and was published for allocation.
+	DeviceRecoveredReason = "DeviceRecovered"
+	// PrerequisitesMissingReason is the Event reason used when the node does not
+	// fulfill the prerequisites of using the devices, and none are published.
+	PrerequisitesMissingReason = "PrerequisitesMissing"
+	// NoDevicesReason is the Event reason used when the kubelet plugin did not
+	// discover any supported devices on the node.
+	NoDevicesReason = "NoDevices"
+)
+
+// NewEventRecorder returns an EventRecorder posting Events to the API server
+// on behalf of the component running on the given node.
+func NewEventRecorder(clientset kubernetes.Interface, component string, nodeName string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component, Host: nodeName})
+}
+
+// ClaimReference returns a reference to the ResourceClaim described by the
+// kubelet request, so that Events can be recorded without fetching the claim.
+func ClaimReference(claim *drav1.Claim) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: resourcev1.SchemeGroupVersion.String(),
+		Kind:       "ResourceClaim",
+		Namespace:  claim.Namespace,
+		Name:       claim.Name,
+		UID:        types.UID(claim.UID),
+	}
+}
+
+// NodeReference returns a reference to the Node object. Like kubelet, the
+// node name is used as the UID.
+func NodeReference(nodeName string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: nodeName,
+		UID:  types.UID(nodeName),
+	}
+}
+
+// PrepareFailed records a Warning Event on the ResourceClaim so that the failure
+// reason is visible to the user, and returns it as the kubelet response.
+func PrepareFailed(recorder record.EventRecorder, claim *drav1.Claim, reason string) *drav1.NodePrepareResourceResponse {
+	recorder.Event(ClaimReference(claim), corev1.EventTypeWarning, PrepareFailedReason, reason)
+
+	return &drav1.NodePrepareResourceResponse{Error: reason}
+}
+
+// ReportNoDevices records a Warning Event on the Node when the kubelet plugin
+// discovered no devices. Readiness of the plugin does not depend on devices,
+// so that the plugin DaemonSet also rolls out to nodes without them.
+func ReportNoDevices(recorder record.EventRecorder, nodeName string, devices int) {
+	if devices > 0 {
+		return
+	}
+
+	recorder.Event(NodeReference(nodeName), corev1.EventTypeWarning, NoDevicesReason, "no supported devices discovered on node")
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+func TestPrepareFailed(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+
+	response := PrepareFailed(recorder, &drav1.Claim{UID: "uid1", Name: "claim1", Namespace: "default"}, "device is busy")
+	if response.Error != "device is busy" || len(response.Devices) != 0 {
+		t.Errorf("unexpected response %+v", response)
+	}
+
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Warning PrepareFailed device is busy" {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestReportNoDevices(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+
+	ReportNoDevices(recorder, "node1", 2)
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected no events with devices, got %d", len(recorder.Events))
+	}
+
+	ReportNoDevices(recorder, "node1", 0)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Warning NoDevices no supported devices discovered on node" {
+		t.Errorf("unexpected event %q", event)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+)
+
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// HealthCheck returns nil when the checked condition holds.
+type HealthCheck func() error
+
+// HealthChecks is an http.Handler reporting the result of every named check.
+// The response is 200 when all checks pass, 503 otherwise.
+type HealthChecks map[string]HealthCheck
+
+func (c HealthChecks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var report strings.Builder
+	healthy := true
+	for _, name := range names {
+		if err := c[name](); err != nil {
+			healthy = false
+			fmt.Fprintf(&report, "[-] %s failed: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(&report, "[+] %s ok\n", name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !healthy {
+		klog.V(3).Infof("%s check failed:\n%s", r.URL.Path, report.String())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_, _ = w.Write([]byte(report.String()))
+}
+
+// PluginRegistrationCheck fails when kubelet rejected the plugin registration.
+// A plugin that has not been registered yet is not considered failed.
+func PluginRegistrationCheck(plugin kubeletplugin.DRAPlugin) HealthCheck {
+	return func() error {
+		status := plugin.RegistrationStatus()
+		if status != nil && !status.PluginRegistered {
+			return fmt.Errorf("kubelet rejected registration: %v", status.Error)
+		}
+		return nil
+	}
+}
+
+// PluginRegisteredCheck fails until kubelet has registered the plugin.
+func PluginRegisteredCheck(plugin kubeletplugin.DRAPlugin) HealthCheck {
+	return func() error {
+		status := plugin.RegistrationStatus()
+		if status == nil {
+			return fmt.Errorf("registration with kubelet has not completed yet")
+		}
+		if !status.PluginRegistered {
+			return fmt.Errorf("kubelet rejected registration: %v", status.Error)
+		}
+		return nil
+	}
+}
+
+// WritableDirCheck fails when a file cannot be created in the directory.
+func WritableDirCheck(dir string) HealthCheck {
+	return func() error {
+		f, err := os.CreateTemp(dir, ".healthcheck-")
+		if err != nil {
+			return fmt.Errorf("directory %v is not writable: %v", dir, err)
+		}
+		f.Close()
+
+		return os.Remove(f.Name())
+	}
+}
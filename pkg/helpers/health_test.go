@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHealthChecks(t *testing.T) {
+	type testCase struct {
+		name           string
+		checks         HealthChecks
+		expectedStatus int
+		expectedBody   string
+	}
+
+	writableDir := t.TempDir()
+	passing := func() error { return nil }
+	failing := func() error { return fmt.Errorf("broken") }
+
+	testcases := []testCase{
+		{
+			name:           "no checks",
+			checks:         HealthChecks{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "all checks pass",
+			checks:         HealthChecks{"b": passing, "a": passing},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[+] a ok\n[+] b ok\n",
+		},
+		{
+			name:           "one check fails",
+			checks:         HealthChecks{"a": passing, "b": failing},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "[+] a ok\n[-] b failed: broken\n",
+		},
+		{
+			name:           "missing directory is not writable",
+			checks:         HealthChecks{"cdi": WritableDirCheck("/nonexistent/cdi")},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "temporary directory is writable",
+			checks:         HealthChecks{"cdi": WritableDirCheck(writableDir)},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[+] cdi ok\n",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		recorder := httptest.NewRecorder()
+		testcase.checks.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, HealthzPath, nil))
+
+		if recorder.Code != testcase.expectedStatus {
+			t.Errorf("%v: unexpected status %v, expected %v", testcase.name, recorder.Code, testcase.expectedStatus)
+		}
+		if testcase.expectedBody != "" && recorder.Body.String() != testcase.expectedBody {
+			t.Errorf("%v: unexpected body %q, expected %q", testcase.name, recorder.Body.String(), testcase.expectedBody)
+		}
+	}
+
+	if leftovers, _ := os.ReadDir(writableDir); len(leftovers) != 0 {
+		t.Errorf("writable check left files behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// ServeHTTPEndpoint starts serving mux on the TCP address in the background.
+// Listen errors are returned, later serving errors are only logged.
+func ServeHTTPEndpoint(endpoint string, mux *http.ServeMux) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("could not listen on %v: %v", endpoint, err)
+	}
+
+	klog.Infof("Serving HTTP on %v", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			klog.Errorf("HTTP server on %v failed: %v", endpoint, err)
+		}
+	}()
+
+	return nil
+}
+
+// AddPprofHandlers serves the runtime profiling data under pprofPath.
+func AddPprofHandlers(mux *http.ServeMux, pprofPath string) {
+	pprofPath = strings.TrimSuffix(pprofPath, "/")
+
+	// pprof.Index only resolves profile names under /debug/pprof/.
+	mux.HandleFunc(pprofPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, pprofPath+"/")
+		if name == "" {
+			pprof.Index(w, r)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	})
+	mux.HandleFunc(pprofPath+"/cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPath+"/profile", pprof.Profile)
+	mux.HandleFunc(pprofPath+"/symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPath+"/trace", pprof.Trace)
+}
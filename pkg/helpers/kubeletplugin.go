@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+
+	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+)
+
+const (
+	DefaultCDIRoot                   = "/etc/cdi"
+	DefaultKubeletPath               = "/var/lib/kubelet/"
+	DefaultKubeletPluginsDir         = DefaultKubeletPath + "plugins/"
+	DefaultKubeletPluginsRegistryDir = DefaultKubeletPath + "plugins_registry/"
+)
+
+// PluginOptions describe how a kubelet plugin is registered to kubelet.
+type PluginOptions struct {
+	DriverName string
+	NodeName   string
+	Clientset  coreclientset.Interface
+	// RegistrarSocketPath is the socket kubelet finds the plugin from.
+	RegistrarSocketPath string
+	// PluginSocketPath is the socket the DRA gRPC service is served at.
+	PluginSocketPath string
+}
+
+// DefaultPluginOptions returns the options with sockets in the default kubelet
+// directories for the driver.
+func DefaultPluginOptions(driverName string, nodeName string, clientset coreclientset.Interface) PluginOptions {
+	return PluginOptionsAt(DefaultKubeletPluginsDir, DefaultKubeletPluginsRegistryDir, driverName, nodeName, clientset)
+}
+
+// PluginOptionsAt returns the options with sockets in the given kubelet plugins
+// and plugin registry directories.
+func PluginOptionsAt(pluginsDir string, registryDir string, driverName string, nodeName string, clientset coreclientset.Interface) PluginOptions {
+	return PluginOptions{
+		DriverName:          driverName,
+		NodeName:            nodeName,
+		Clientset:           clientset,
+		RegistrarSocketPath: path.Join(registryDir, driverName+".sock"),
+		PluginSocketPath:    path.Join(pluginsDir, driverName, "plugin.sock"),
+	}
+}
+
+// draPlugin is a DRA plugin which finishes the calls in flight before it
+// stops, and publishes the node's devices in several ResourceSlices when they
+// do not fit in one. Prepared claims and CDI specs are written before a call
+// returns, so they are up to date once the calls have finished.
+type draPlugin struct {
+	kubeletplugin.DRAPlugin
+	ctx      context.Context
+	opts     PluginOptions
+	inFlight *InFlightCalls
+
+	sliceMutex      sync.Mutex
+	sliceController *resourceslice.Controller
+}
+
+// StartPluginFunc starts the kubelet plugin of a driver. It is StartPlugin,
+// except in unit tests that do not run the plugin with kubelet.
+type StartPluginFunc func(ctx context.Context, server drav1.DRAPluginServer, opts PluginOptions, resources kubeletplugin.Resources) (kubeletplugin.DRAPlugin, error)
+
+var _ StartPluginFunc = StartPlugin
+
+// StartPlugin creates the socket directories, serves the DRA service, registers
+// it to kubelet and publishes the node's devices as ResourceSlices. Stopping the
+// returned plugin finishes the DRA calls in flight before unregistering it.
+func StartPlugin(ctx context.Context, server drav1.DRAPluginServer, opts PluginOptions, resources kubeletplugin.Resources) (kubeletplugin.DRAPlugin, error) {
+	for _, dir := range []string{path.Dir(opts.RegistrarSocketPath), path.Dir(opts.PluginSocketPath)} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create socket dir %v: %v", dir, err)
+		}
+	}
+
+	klog.Infof(`Starting DRA resource-driver kubelet-plugin
+RegistrarSocketPath: %v
+PluginSocketPath: %v
+KubeletPluginSocketPath: %v`,
+		opts.RegistrarSocketPath,
+		opts.PluginSocketPath,
+		opts.PluginSocketPath)
+
+	inFlight := &InFlightCalls{}
+	plugin, err := kubeletplugin.Start(
+		ctx,
+		[]any{server},
+		kubeletplugin.GRPCInterceptor(inFlight.Interceptor),
+		kubeletplugin.KubeClient(opts.Clientset),
+		kubeletplugin.NodeName(opts.NodeName),
+		kubeletplugin.DriverName(opts.DriverName),
+		kubeletplugin.RegistrarSocketPath(opts.RegistrarSocketPath),
+		kubeletplugin.PluginSocketPath(opts.PluginSocketPath),
+		kubeletplugin.KubeletPluginSocketPath(opts.PluginSocketPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start kubelet-plugin: %v", err)
+	}
+
+	draPlugin := &draPlugin{DRAPlugin: plugin, ctx: ctx, opts: opts, inFlight: inFlight}
+
+	klog.FromContext(ctx).Info("Publishing resources", "len", len(resources.Devices))
+	klog.V(5).Infof("devices: %+v", resources.Devices)
+	if err := draPlugin.PublishResources(ctx, resources); err != nil {
+		draPlugin.Stop()
+		return nil, fmt.Errorf("error publishing resources: %v", err)
+	}
+
+	return draPlugin, nil
+}
+
+// WaitForStopSignal blocks until the process is asked to terminate.
+func WaitForStopSignal() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigc)
+
+	sig := <-sigc
+	klog.Infof("Received %v signal, exiting.", sig)
+}
+
+// NewCDICache refreshes the default CDI registry from cdiRoot and returns its cache.
+func NewCDICache(cdiRoot string) (*cdiapi.Cache, error) {
+	if err := os.MkdirAll(cdiRoot, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create CDI root dir: %v", err)
+	}
+
+	klog.V(5).Info("Refreshing CDI registry")
+	if err := cdiapi.Configure(cdiapi.WithSpecDirs(cdiRoot)); err != nil {
+		return nil, fmt.Errorf("unable to refresh the CDI registry: %v", err)
+	}
+
+	return cdiapi.GetDefaultCache(), nil
+}
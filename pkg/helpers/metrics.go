@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"k8s.io/component-base/metrics"
+)
+
+const MetricsPath = "/metrics"
+
+// DeviceUsage is the total and allocated amount of a single resource of a device.
+type DeviceUsage struct {
+	Device    string
+	Resource  string
+	Total     float64
+	Allocated float64
+}
+
+// deviceUsageCollector exports DeviceUsage as gauges, sampled on every scrape.
+type deviceUsageCollector struct {
+	metrics.BaseStableCollector
+
+	capacityDesc  *metrics.Desc
+	allocatedDesc *metrics.Desc
+	usage         func() []DeviceUsage
+}
+
+// NewDeviceUsageCollector returns a collector exporting <namespace>_device_capacity
+// and <namespace>_device_allocated gauges per device and resource, as reported
+// by the usage function.
+func NewDeviceUsageCollector(namespace string, usage func() []DeviceUsage) metrics.StableCollector {
+	labels := []string{"device", "resource"}
+
+	return &deviceUsageCollector{
+		capacityDesc: metrics.NewDesc(namespace+"_device_capacity",
+			"Total amount of the resource on the device.", labels, nil, metrics.ALPHA, ""),
+		allocatedDesc: metrics.NewDesc(namespace+"_device_allocated",
+			"Amount of the resource on the device allocated to prepared claims.", labels, nil, metrics.ALPHA, ""),
+		usage: usage,
+	}
+}
+
+func (c *deviceUsageCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.capacityDesc
+	ch <- c.allocatedDesc
+}
+
+func (c *deviceUsageCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	for _, usage := range c.usage() {
+		ch <- metrics.NewLazyConstMetric(c.capacityDesc, metrics.GaugeValue, usage.Total, usage.Device, usage.Resource)
+		ch <- metrics.NewLazyConstMetric(c.allocatedDesc, metrics.GaugeValue, usage.Allocated, usage.Device, usage.Resource)
+	}
+}
+
+// cdiDriftCollector exports the number of CDI devices rewritten because of drift.
+type cdiDriftCollector struct {
+	metrics.BaseStableCollector
+
+	driftDesc *metrics.Desc
+	drift     func() CDIDrift
+}
+
+// NewCDIDriftCollector returns a collector exporting <namespace>_cdi_drift_devices_total
+// counter of CDI devices fixed or removed when syncing the CDI registry.
+func NewCDIDriftCollector(namespace string, drift func() CDIDrift) metrics.StableCollector {
+	return &cdiDriftCollector{
+		driftDesc: metrics.NewDesc(namespace+"_cdi_drift_devices_total",
+			"Number of CDI devices that did not match detected devices and were rewritten.", []string{"action"}, nil, metrics.ALPHA, ""),
+		drift: drift,
+	}
+}
+
+func (c *cdiDriftCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.driftDesc
+}
+
+func (c *cdiDriftCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	drift := c.drift()
+	ch <- metrics.NewLazyConstMetric(c.driftDesc, metrics.CounterValue, float64(len(drift.Fixed)), "fixed")
+	ch <- metrics.NewLazyConstMetric(c.driftDesc, metrics.CounterValue, float64(len(drift.Removed)), "removed")
+}
+
+// DeviceTelemetry is the sampled temperature and power of a device, nil when
+// the device does not report them.
+type DeviceTelemetry struct {
+	Device             string
+	TemperatureCelsius *float64
+	PowerWatts         *float64
+}
+
+// deviceTelemetryCollector exports DeviceTelemetry as gauges, sampled on every scrape.
+type deviceTelemetryCollector struct {
+	metrics.BaseStableCollector
+
+	temperatureDesc *metrics.Desc
+	powerDesc       *metrics.Desc
+	telemetry       func() []DeviceTelemetry
+}
+
+// NewDeviceTelemetryCollector returns a collector exporting <namespace>_device_temperature_celsius
+// and <namespace>_device_power_watts gauges per device, as reported by the telemetry function.
+func NewDeviceTelemetryCollector(namespace string, telemetry func() []DeviceTelemetry) metrics.StableCollector {
+	labels := []string{"device"}
+
+	return &deviceTelemetryCollector{
+		temperatureDesc: metrics.NewDesc(namespace+"_device_temperature_celsius",
+			"Temperature of the device.", labels, nil, metrics.ALPHA, ""),
+		powerDesc: metrics.NewDesc(namespace+"_device_power_watts",
+			"Power consumption of the device.", labels, nil, metrics.ALPHA, ""),
+		telemetry: telemetry,
+	}
+}
+
+func (c *deviceTelemetryCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.temperatureDesc
+	ch <- c.powerDesc
+}
+
+func (c *deviceTelemetryCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	for _, telemetry := range c.telemetry() {
+		if telemetry.TemperatureCelsius != nil {
+			ch <- metrics.NewLazyConstMetric(c.temperatureDesc, metrics.GaugeValue, *telemetry.TemperatureCelsius, telemetry.Device)
+		}
+		if telemetry.PowerWatts != nil {
+			ch <- metrics.NewLazyConstMetric(c.powerDesc, metrics.GaugeValue, *telemetry.PowerWatts, telemetry.Device)
+		}
+	}
+}
+
+// unhealthyDevicesCollector exports devices withdrawn from allocation because
+// they are unhealthy.
+type unhealthyDevicesCollector struct {
+	metrics.BaseStableCollector
+
+	unhealthyDesc *metrics.Desc
+	unhealthy     func() map[string]string
+}
+
+// NewUnhealthyDevicesCollector returns a collector exporting <namespace>_device_unhealthy
+// gauge of 1 per device and reason, as reported by the unhealthy function
+// returning reasons by device name.
+func NewUnhealthyDevicesCollector(namespace string, unhealthy func() map[string]string) metrics.StableCollector {
+	return &unhealthyDevicesCollector{
+		unhealthyDesc: metrics.NewDesc(namespace+"_device_unhealthy",
+			"Devices which are unhealthy and not published for allocation.", []string{"device", "reason"}, nil, metrics.ALPHA, ""),
+		unhealthy: unhealthy,
+	}
+}
+
+func (c *unhealthyDevicesCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- c.unhealthyDesc
+}
+
+func (c *unhealthyDevicesCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	for device, reason := range c.unhealthy() {
+		ch <- metrics.NewLazyConstMetric(c.unhealthyDesc, metrics.GaugeValue, 1, device, reason)
+	}
+}
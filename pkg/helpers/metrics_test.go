@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestDeviceUsageCollector(t *testing.T) {
+	type testCase struct {
+		name     string
+		usage    []DeviceUsage
+		expected string
+	}
+
+	testcases := []testCase{
+		{
+			name:     "no devices",
+			usage:    []DeviceUsage{},
+			expected: "",
+		},
+		{
+			name: "one free and one allocated device",
+			usage: []DeviceUsage{
+				{Device: "card0", Resource: "memory", Total: 1024, Allocated: 0},
+				{Device: "card1", Resource: "memory", Total: 2048, Allocated: 2048},
+			},
+			expected: `
+# HELP test_device_allocated [ALPHA] Amount of the resource on the device allocated to prepared claims.
+# TYPE test_device_allocated gauge
+test_device_allocated{device="card0",resource="memory"} 0
+test_device_allocated{device="card1",resource="memory"} 2048
+# HELP test_device_capacity [ALPHA] Total amount of the resource on the device.
+# TYPE test_device_capacity gauge
+test_device_capacity{device="card0",resource="memory"} 1024
+test_device_capacity{device="card1",resource="memory"} 2048
+`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		collector := NewDeviceUsageCollector("test", func() []DeviceUsage { return testcase.usage })
+		if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(testcase.expected),
+			"test_device_capacity", "test_device_allocated"); err != nil {
+			t.Errorf("%v: unexpected metrics: %v", testcase.name, err)
+		}
+	}
+}
+
+func TestCDIDriftCollector(t *testing.T) {
+	drift := CDIDrift{}
+	drift.Add(CDIDrift{Fixed: []string{"card0"}})
+	drift.Add(CDIDrift{Fixed: []string{"card1"}, Removed: []string{"card2"}})
+
+	expected := `
+# HELP test_cdi_drift_devices_total [ALPHA] Number of CDI devices that did not match detected devices and were rewritten.
+# TYPE test_cdi_drift_devices_total counter
+test_cdi_drift_devices_total{action="fixed"} 2
+test_cdi_drift_devices_total{action="removed"} 1
+`
+
+	collector := NewCDIDriftCollector("test", func() CDIDrift { return drift })
+	if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(expected), "test_cdi_drift_devices_total"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestDeviceTelemetryCollector(t *testing.T) {
+	temperature := 41.5
+	power := 95.25
+	telemetry := []DeviceTelemetry{
+		{Device: "accel0", TemperatureCelsius: &temperature, PowerWatts: &power},
+		{Device: "accel1", TemperatureCelsius: &temperature},
+		{Device: "accel2"},
+	}
+
+	expected := `
+# HELP test_device_power_watts [ALPHA] Power consumption of the device.
+# TYPE test_device_power_watts gauge
+test_device_power_watts{device="accel0"} 95.25
+# HELP test_device_temperature_celsius [ALPHA] Temperature of the device.
+# TYPE test_device_temperature_celsius gauge
+test_device_temperature_celsius{device="accel0"} 41.5
+test_device_temperature_celsius{device="accel1"} 41.5
+`
+
+	collector := NewDeviceTelemetryCollector("test", func() []DeviceTelemetry { return telemetry })
+	if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(expected),
+		"test_device_temperature_celsius", "test_device_power_watts"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestUnhealthyDevicesCollector(t *testing.T) {
+	unhealthy := map[string]string{"accel0": "needs reset"}
+
+	expected := `
+# HELP test_device_unhealthy [ALPHA] Devices which are unhealthy and not published for allocation.
+# TYPE test_device_unhealthy gauge
+test_device_unhealthy{device="accel0",reason="needs reset"} 1
+`
+
+	collector := NewUnhealthyDevicesCollector("test", func() map[string]string { return unhealthy })
+	if err := testutil.CustomCollectAndCompare(collector, strings.NewReader(expected), "test_device_unhealthy"); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
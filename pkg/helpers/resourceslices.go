@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/klog/v2"
+)
+
+// SplitDevices splits the devices, sorted by name, into ResourceSlices of at
+// most maxDevices devices each. Sorting keeps the same devices in the same
+// slices between updates, so that unchanged slices are not recreated.
+func SplitDevices(devices []resourcev1.Device, maxDevices int) []resourceslice.Slice {
+	sorted := slices.Clone(devices)
+	slices.SortFunc(sorted, func(a, b resourcev1.Device) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	poolSlices := []resourceslice.Slice{}
+	for chunk := range slices.Chunk(sorted, maxDevices) {
+		poolSlices = append(poolSlices, resourceslice.Slice{Devices: chunk})
+	}
+
+	// An empty pool is published as one empty slice, like kubeletplugin does.
+	if len(poolSlices) == 0 {
+		poolSlices = append(poolSlices, resourceslice.Slice{Devices: sorted})
+	}
+
+	return poolSlices
+}
+
+// PublishResources publishes the devices in the node's pool, split into as many
+// ResourceSlices as needed to fit resourcev1.ResourceSliceMaxDevices devices in
+// each. The ResourceSlice controller bumps the pool generation and updates the
+// slice count of all the slices of the pool on every change.
+func (p *draPlugin) PublishResources(ctx context.Context, resources kubeletplugin.Resources) error {
+	if p.opts.Clientset == nil {
+		return errors.New("no KubeClient found to publish resources")
+	}
+	if p.opts.NodeName == "" {
+		return errors.New("no NodeName was set to publish resources")
+	}
+
+	poolSlices := SplitDevices(resources.Devices, resourcev1.ResourceSliceMaxDevices)
+	klog.FromContext(ctx).V(5).Info("Publishing ResourceSlices", "devices", len(resources.Devices), "slices", len(poolSlices))
+	driverResources := &resourceslice.DriverResources{
+		Pools: map[string]resourceslice.Pool{
+			p.opts.NodeName: {Slices: poolSlices},
+		},
+	}
+
+	p.sliceMutex.Lock()
+	defer p.sliceMutex.Unlock()
+
+	if p.sliceController != nil {
+		p.sliceController.Update(driverResources)
+		return nil
+	}
+
+	// The controller uses the context the plugin was started with, not the
+	// one of this call, so that it runs until the plugin is stopped.
+	controllerCtx := klog.NewContext(p.ctx, klog.LoggerWithName(klog.FromContext(p.ctx), "ResourceSlice controller"))
+	controller, err := resourceslice.StartController(controllerCtx, resourceslice.Options{
+		DriverName: p.opts.DriverName,
+		KubeClient: p.opts.Clientset,
+		Owner: &resourceslice.Owner{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       p.opts.NodeName,
+		},
+		Resources: driverResources,
+	})
+	if err != nil {
+		return fmt.Errorf("start ResourceSlice controller: %w", err)
+	}
+	p.sliceController = controller
+
+	return nil
+}
+
+// stopPublishing stops the ResourceSlice controller, leaving the published
+// slices in place for the next plugin instance.
+func (p *draPlugin) stopPublishing() {
+	p.sliceMutex.Lock()
+	defer p.sliceMutex.Unlock()
+
+	if p.sliceController != nil {
+		p.sliceController.Stop()
+		p.sliceController = nil
+	}
+}
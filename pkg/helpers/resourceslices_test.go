@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+)
+
+func testDevices(count int) []resourcev1.Device {
+	devices := []resourcev1.Device{}
+	// Reverse order to check that devices get sorted.
+	for i := count - 1; i >= 0; i-- {
+		devices = append(devices, resourcev1.Device{Name: fmt.Sprintf("vf-%04d", i)})
+	}
+	return devices
+}
+
+func TestSplitDevices(t *testing.T) {
+	testcases := []struct {
+		devices    int
+		sliceSizes []int
+	}{
+		{0, []int{0}},
+		{1, []int{1}},
+		{resourcev1.ResourceSliceMaxDevices, []int{resourcev1.ResourceSliceMaxDevices}},
+		{300, []int{128, 128, 44}},
+	}
+
+	for _, testcase := range testcases {
+		poolSlices := SplitDevices(testDevices(testcase.devices), resourcev1.ResourceSliceMaxDevices)
+		if len(poolSlices) != len(testcase.sliceSizes) {
+			t.Errorf("%d devices: expected %d slices, got %d", testcase.devices, len(testcase.sliceSizes), len(poolSlices))
+			continue
+		}
+
+		next := 0
+		for i, slice := range poolSlices {
+			if len(slice.Devices) != testcase.sliceSizes[i] {
+				t.Errorf("%d devices: expected %d devices in slice %d, got %d", testcase.devices, testcase.sliceSizes[i], i, len(slice.Devices))
+			}
+			for _, device := range slice.Devices {
+				if expected := fmt.Sprintf("vf-%04d", next); device.Name != expected {
+					t.Errorf("%d devices: expected device %v in slice %d, got %v", testcase.devices, expected, i, device.Name)
+				}
+				next++
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+const (
+	// UnprepareRetryInterval is how often failed claim unpreparations are retried.
+	UnprepareRetryInterval = 30 * time.Second
+	// UnprepareFailedAttempts is the number of failed attempts after which the
+	// failure is reported as an Event on the ResourceClaim.
+	UnprepareFailedAttempts = 5
+)
+
+// UnprepareFunc frees the devices of the claim. It is called again for the
+// same claim until it succeeds, so it has to be idempotent.
+type UnprepareFunc func(ctx context.Context, claim *drav1.Claim) error
+
+// UnprepareRetrier retries failed claim unpreparations in the background, so
+// that a claim is not left half-cleaned when kubelet does not retry it.
+type UnprepareRetrier struct {
+	sync.Mutex
+	unprepare UnprepareFunc
+	recorder  record.EventRecorder
+	failed    map[string]*failedUnprepare
+}
+
+type failedUnprepare struct {
+	claim    *drav1.Claim
+	attempts int
+}
+
+// NewUnprepareRetrier returns an UnprepareRetrier calling unprepare for the
+// failed claims, and recording persistent failures with recorder.
+func NewUnprepareRetrier(unprepare UnprepareFunc, recorder record.EventRecorder) *UnprepareRetrier {
+	return &UnprepareRetrier{
+		unprepare: unprepare,
+		recorder:  recorder,
+		failed:    map[string]*failedUnprepare{},
+	}
+}
+
+// Failed schedules the claim for retrying after an unsuccessful unprepare.
+func (r *UnprepareRetrier) Failed(claim *drav1.Claim, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	failure, found := r.failed[claim.UID]
+	if !found {
+		failure = &failedUnprepare{claim: claim}
+		r.failed[claim.UID] = failure
+	}
+
+	r.recordAttempt(failure, err)
+}
+
+// Succeeded stops retrying the claim, e.g. after kubelet unprepared it.
+func (r *UnprepareRetrier) Succeeded(claimUID string) {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.failed, claimUID)
+}
+
+// Pending returns the number of claims waiting for unprepare retry.
+func (r *UnprepareRetrier) Pending() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.failed)
+}
+
+// Run retries failed unpreparations every interval until ctx is done.
+func (r *UnprepareRetrier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Retry(ctx)
+		}
+	}
+}
+
+// Retry unprepares every failed claim once.
+func (r *UnprepareRetrier) Retry(ctx context.Context) {
+	r.Lock()
+	failures := make([]*failedUnprepare, 0, len(r.failed))
+	for _, failure := range r.failed {
+		failures = append(failures, failure)
+	}
+	r.Unlock()
+
+	for _, failure := range failures {
+		err := r.unprepare(ctx, failure.claim)
+
+		r.Lock()
+		if _, found := r.failed[failure.claim.UID]; found {
+			if err == nil {
+				klog.Infof("Unprepared claim %v on retry %d", failure.claim.UID, failure.attempts)
+				delete(r.failed, failure.claim.UID)
+			} else {
+				r.recordAttempt(failure, err)
+			}
+		}
+		r.Unlock()
+	}
+}
+
+// recordAttempt counts the failed attempt, and reports the failure as an
+// Event once it is persistent. Has to be called with the lock held.
+func (r *UnprepareRetrier) recordAttempt(failure *failedUnprepare, err error) {
+	failure.attempts++
+	klog.Warningf("Unprepare of claim %v failed (attempt %d), retrying: %v", failure.claim.UID, failure.attempts, err)
+
+	if failure.attempts == UnprepareFailedAttempts {
+		r.recorder.Eventf(ClaimReference(failure.claim), corev1.EventTypeWarning, UnprepareFailedReason,
+			"could not unprepare devices after %d attempts, still retrying: %v", failure.attempts, err)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+func TestUnprepareRetrier(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	failuresLeft := map[string]int{"uid1": 1, "uid2": UnprepareFailedAttempts}
+	unprepare := func(ctx context.Context, claim *drav1.Claim) error {
+		if failuresLeft[claim.UID] == 0 {
+			return nil
+		}
+		failuresLeft[claim.UID]--
+		return fmt.Errorf("could not write prepared claims")
+	}
+
+	retrier := NewUnprepareRetrier(unprepare, recorder)
+	for _, claim := range []*drav1.Claim{
+		{UID: "uid1", Namespace: "default", Name: "claim1"},
+		{UID: "uid2", Namespace: "default", Name: "claim2"},
+		{UID: "uid3", Namespace: "default", Name: "claim3"},
+	} {
+		retrier.Failed(claim, unprepare(context.TODO(), claim))
+	}
+
+	// kubelet unprepared the third claim itself.
+	retrier.Succeeded("uid3")
+	if pending := retrier.Pending(); pending != 2 {
+		t.Fatalf("expected 2 claims pending retry, got %d", pending)
+	}
+
+	retrier.Retry(context.TODO())
+	if pending := retrier.Pending(); pending != 1 {
+		t.Fatalf("expected 1 claim pending retry after first retry, got %d", pending)
+	}
+
+	for attempt := 2; attempt < UnprepareFailedAttempts; attempt++ {
+		retrier.Retry(context.TODO())
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event after %d failed attempts, got %d", UnprepareFailedAttempts, len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, UnprepareFailedReason) {
+		t.Errorf("unexpected event: %v", event)
+	}
+
+	retrier.Retry(context.TODO())
+	if pending := retrier.Pending(); pending != 0 {
+		t.Errorf("expected no claims pending retry, got %d", pending)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("unexpected events after successful retry: %d", len(recorder.Events))
+	}
+}
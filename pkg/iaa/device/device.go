@@ -0,0 +1,77 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+)
+
+const (
+	deviceOpCap = "op_cap"
+
+	// Device attributes published for the work queues.
+	CompressionAttribute = "compression"
+	FilterAttribute      = "filter"
+)
+
+// IAA operation codes, bit numbers in the op_cap bitmap.
+const (
+	opDecompress = 0x42
+	opCompress   = 0x43
+	// scan, set membership, extract, select, RLE burst, find unique, expand
+	opFilterFirst = 0x50
+	opFilterLast  = 0x56
+)
+
+// IAA is Intel In-Memory Analytics Accelerator. IAA devices are idxd devices
+// named iaxN, their work queues are published with the supported operations.
+var IAA = &device.Kind{
+	Name:         "IAA",
+	DevicePrefix: "iax",
+	DevfsPath:    "iax",
+	UIDPrefix:    "iaa",
+	Capabilities: capabilities,
+}
+
+func capabilities(devicedir string) (map[string]bool, error) {
+	opcap, err := readOpCap(devicedir)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]bool{
+		CompressionAttribute: opcap.Bit(opCompress) == 1 && opcap.Bit(opDecompress) == 1,
+		FilterAttribute:      hasFilterOps(opcap),
+	}, nil
+}
+
+// readOpCap parses the operation capability bitmap of the device. The kernel
+// prints the bitmap as comma separated hexadecimal words, most significant first.
+func readOpCap(devicedir string) (*big.Int, error) {
+	str, err := device.ReadFile(devicedir, deviceOpCap)
+	if err != nil {
+		return nil, err
+	}
+
+	opcap, ok := new(big.Int).SetString(strings.ReplaceAll(str, ",", ""), 16)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse %s value '%s'", deviceOpCap, str)
+	}
+
+	return opcap, nil
+}
+
+func hasFilterOps(opcap *big.Int) bool {
+	for op := opFilterFirst; op <= opFilterLast; op++ {
+		if opcap.Bit(op) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+)
+
+// Decompress, compress and filter operations.
+const testOpCap = "00000000,00000000,00000000,00000000,00000000,007f000c,00000000,00000001"
+
+func newFakeIAADevices(t *testing.T) device.Devices {
+	testRoot := t.TempDir()
+	sysfsRoot := filepath.Join(testRoot, "sysfs")
+
+	// DSA and IAA devices share the dsa bus.
+	if err := fakesysfs.FakeSysFsDSAContents(sysfsRoot, filepath.Join(testRoot, "devfs"), fakesysfs.DSADevices{
+		{Device: "dsa0", PCIAddress: "0000:6a:01.0", State: "enabled", NumaNode: 0,
+			WorkQueues: []fakesysfs.DSAWorkQueue{
+				{WorkQueue: "wq0.0", State: "enabled", Mode: "dedicated", Type: "user", Size: 16, GroupID: 0},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	if err := fakesysfs.FakeSysFsIAAContents(sysfsRoot, filepath.Join(testRoot, "devfs"), fakesysfs.IAADevices{
+		{Device: "iax1", PCIAddress: "0000:6a:02.0", State: "enabled", NumaNode: 0, OpCap: testOpCap,
+			WorkQueues: []fakesysfs.IAAWorkQueue{
+				{WorkQueue: "wq1.0", State: "enabled", Mode: "dedicated", Type: "user", Size: 16, GroupID: 0},
+				{WorkQueue: "wq1.1", State: "enabled", Mode: "shared", Type: "user", Size: 32, GroupID: 1},
+				{WorkQueue: "wq1.2", State: "disabled", Mode: "shared", Type: "user", Size: 32, GroupID: 1},
+				{WorkQueue: "wq1.3", State: "enabled", Mode: "dedicated", Type: "kernel", Size: 16, GroupID: 1},
+			},
+			Engines: []fakesysfs.IAAEngine{
+				{Engine: "engine1.0", GroupID: 0},
+				{Engine: "engine1.1", GroupID: 1},
+				{Engine: "engine1.2", GroupID: 1},
+				{Engine: "engine1.3", GroupID: -1},
+			},
+		},
+		{Device: "iax3", PCIAddress: "0000:e7:02.0", State: "disabled", NumaNode: 1, OpCap: testOpCap},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	iaadevices, err := device.New(sysfsRoot, IAA)
+	if err != nil {
+		t.Fatalf("could not discover IAA devices: %v", err)
+	}
+
+	return iaadevices
+}
+
+func TestNew(t *testing.T) {
+	iaadevices := newFakeIAADevices(t)
+
+	if len(iaadevices) != 1 {
+		t.Fatalf("expected only enabled device to be discovered, got %d devices", len(iaadevices))
+	}
+
+	d := iaadevices[0]
+	if d.Device != "iax1" || d.PCIAddress != "0000:6a:02.0" || d.NumaNode != 0 || !d.Capabilities[CompressionAttribute] || !d.Capabilities[FilterAttribute] {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	uids := []string{}
+	for uid := range d.WorkQueues {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	if len(uids) != 2 || uids[0] != "iaa-wq1-0" || uids[1] != "iaa-wq1-1" {
+		t.Fatalf("expected only enabled user work queues, got %v", uids)
+	}
+
+	dedicated := d.WorkQueues["iaa-wq1-0"]
+	if dedicated.Mode != device.Dedicated || dedicated.Size != 16 || dedicated.Engines != 1 {
+		t.Errorf("unexpected dedicated work queue %+v", dedicated)
+	}
+
+	shared := d.WorkQueues["iaa-wq1-1"]
+	if shared.Mode != device.Shared || shared.Size != 32 || shared.Engines != 2 {
+		t.Errorf("unexpected shared work queue %+v", shared)
+	}
+
+	if shared.DeviceNode() != "/dev/iax/wq1.1" {
+		t.Errorf("unexpected device node %v", shared.DeviceNode())
+	}
+}
+
+func TestReadOpCap(t *testing.T) {
+	type testCase struct {
+		name        string
+		opcap       string
+		compression bool
+		filter      bool
+	}
+
+	testcases := []testCase{
+		{"all operations", testOpCap, true, true},
+		{"compression only", "00000000,00000000,00000000,00000000,00000000,0000000c,00000000,00000001", true, false},
+		{"decompression only", "00000000,00000000,00000000,00000000,00000000,00000004,00000000,00000001", false, false},
+		{"filter only", "00000000,00000000,00000000,00000000,00000000,00010000,00000000,00000001", false, true},
+		{"64-bit words", "0000000000000000,0000000000000000,00000000007f000c,0000000000000001", true, true},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, deviceOpCap), []byte(testcase.opcap+"\n"), 0600); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+
+		opcap, err := readOpCap(dir)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", testcase.name, err)
+			continue
+		}
+
+		compression := opcap.Bit(opCompress) == 1 && opcap.Bit(opDecompress) == 1
+		if compression != testcase.compression || hasFilterOps(opcap) != testcase.filter {
+			t.Errorf("%v: unexpected capabilities: compression %v, filter %v", testcase.name, compression, hasFilterOps(opcap))
+		}
+	}
+}
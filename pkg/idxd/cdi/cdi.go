@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cdi
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/klog/v2"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispecs "tags.cncf.io/container-device-interface/specs-go"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+)
+
+const (
+	CDIRoot = cdiapi.DefaultDynamicDir
+)
+
+// CDI keeps the work queue devices of one idxd device family, e.g. DSA, in
+// the CDI spec of the family.
+type CDI struct {
+	cache  *cdiapi.Cache
+	family cdiregistry.Family
+}
+
+func New(cdidir string, family cdiregistry.Family) (*CDI, error) {
+
+	if err := cdiapi.Configure(cdiapi.WithSpecDirs(cdidir)); err != nil {
+		return nil, fmt.Errorf("unable to refresh the CDI registry: %v", err)
+	}
+
+	cdiCache := cdiapi.GetDefaultCache()
+
+	cdi := &CDI{
+		cache:  cdiCache,
+		family: family,
+	}
+
+	return cdi, nil
+}
+
+// HasDevices returns true when the CDI spec of the idxd device family has devices, i.e. the
+// kubelet plugin has run on the node before.
+func (c *CDI) HasDevices() bool {
+	return c.family.HasDevices(c.cache)
+}
+
+func (c *CDI) SyncDevices(wqs device.WorkQueues) error {
+	klog.V(5).Info("Syncing CDI devices")
+
+	wqspec := &cdispecs.Spec{
+		Kind: c.family.Kind(),
+	}
+	wqspecname := c.family.SpecName()
+
+	for _, vendorspec := range c.family.Specs(c.cache) {
+		vendorspecname := path.Base(vendorspec.GetPath())
+
+		if vendorspec.Kind != c.family.Kind() {
+			klog.V(5).Infof("Spec file %s is for other kind %s, skipping...", vendorspecname, vendorspec.Kind)
+			continue
+		}
+
+		name := wqspecname + path.Ext(vendorspecname)
+		if name == vendorspecname {
+			klog.V(5).Infof("Adding rest of the devices to '%s'", name)
+			wqspec = vendorspec.Spec
+		}
+
+		vendorspecupdate := false
+		vendorspecdevices := []cdispecs.Device{}
+
+		for _, vendordevice := range vendorspec.Devices {
+			if _, exists := wqs[vendordevice.Name]; exists {
+				klog.V(5).Infof("Vendor spec %s contains device name %s", vendorspecname, vendordevice.Name)
+
+				delete(wqs, vendordevice.Name)
+				vendorspecdevices = append(vendorspecdevices, vendordevice)
+			} else {
+				klog.Warningf("CDI device '%s' in spec file '%s' does not exist", vendordevice.Name, vendorspecname)
+				vendorspecupdate = true
+			}
+		}
+		if vendorspecupdate {
+			// Update spec file that has a nonexistent device.
+			klog.Infof("Updating spec file %s with existing devices", path.Base(vendorspec.GetPath()))
+
+			vendorspec.Devices = vendorspecdevices
+			err := c.cache.WriteSpec(vendorspec.Spec, vendorspecname)
+			if err != nil {
+				klog.Warningf("Failed to update existing CDI spec file %s: %v", vendorspecname, err)
+			}
+		}
+	}
+
+	if len(wqs) > 0 {
+		return c.appendDevices(wqspec, wqs, wqspecname)
+	}
+
+	return nil
+}
+
+func (c *CDI) adddevicespec(spec *cdispecs.Spec, wqs device.WorkQueues) error {
+
+	for _, wq := range wqs {
+		cdidevice := cdispecs.Device{
+			Name: wq.UID(),
+			ContainerEdits: cdispecs.ContainerEdits{
+				DeviceNodes: []*cdispecs.DeviceNode{
+					{Path: wq.DeviceNode(), HostPath: wq.HostDeviceNode(), Type: "c"},
+				},
+			},
+		}
+		spec.Devices = append(spec.Devices, cdidevice)
+
+		klog.V(5).Infof("Added device %s name %s", cdidevice.ContainerEdits.DeviceNodes[0].Path, cdidevice.Name)
+	}
+	return nil
+}
+
+func (c *CDI) appendDevices(spec *cdispecs.Spec, wqs device.WorkQueues, name string) error {
+
+	klog.V(5).Info("Append CDI devices")
+
+	if err := c.adddevicespec(spec, wqs); err != nil {
+		return err
+	}
+
+	version, err := cdiapi.MinimumRequiredVersion(spec)
+	if err != nil {
+		return fmt.Errorf("minimum CDI spec version not found: %v", err)
+	}
+	spec.Version = version
+
+	err = c.cache.WriteSpec(spec, name)
+	if err != nil {
+		return fmt.Errorf("failed to write CDI spec %s: %v", name, err)
+	}
+
+	klog.Infof("CDI %s: Kind %s, Version %v", name, spec.Kind, spec.Version)
+	return nil
+}
+
+func (c *CDI) OverwriteDevices(wqs device.WorkQueues) error {
+	var err error
+
+	klog.V(5).Info("Add/overwrite CDI devices")
+
+	spec := &cdispecs.Spec{
+		Kind: c.family.Kind(),
+	}
+
+	name, err := cdiapi.GenerateNameForSpec(spec)
+	if err != nil {
+		return fmt.Errorf("spec name not created: %v", err)
+	}
+
+	return c.appendDevices(spec, wqs, name)
+}
@@ -0,0 +1,400 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	SysfsEnvVarName  = "SYSFS_ROOT"
+	sysfsDefaultRoot = "/sys"
+	DevfsEnvVarName  = "DEVFS_ROOT"
+	devfsDefaultRoot = "/dev"
+
+	// idxd kernel driver registers DSA and IAA devices, their work queues
+	// and engines on the dsa bus.
+	busPath       = "bus/dsa/devices"
+	deviceState   = "state"
+	deviceNuma    = "numa_node"
+	wqMode        = "mode"
+	wqState       = "state"
+	wqType        = "type"
+	wqSize        = "size"
+	wqGroupID     = "group_id"
+	engineGroupID = "group_id"
+
+	stateEnabled = "enabled"
+	wqTypeUser   = "user"
+)
+
+var (
+	wqRegexp     = regexp.MustCompile(`^wq[0-9]+\.[0-9]+$`)
+	engineRegexp = regexp.MustCompile(`^engine[0-9]+\.[0-9]+$`)
+)
+
+// Kind describes one type of idxd devices, which differ only by their names
+// and the operations they support.
+type Kind struct {
+	Name         string // used in messages, e.g. DSA
+	DevicePrefix string // idxd device name prefix, e.g. dsa for dsa0
+	DevfsPath    string // directory of work queue device nodes in devfs
+	UIDPrefix    string // prefix of work queue UIDs, e.g. dsa for dsa-wq0-0
+	// Capabilities returns the operations supported by the device as
+	// boolean device attributes, nil if the kind has none.
+	Capabilities func(devicedir string) (map[string]bool, error)
+}
+
+// DSA is Intel Data Streaming Accelerator.
+var DSA = &Kind{
+	Name:         "DSA",
+	DevicePrefix: "dsa",
+	DevfsPath:    "dsa",
+	UIDPrefix:    "dsa",
+}
+
+func (k *Kind) deviceRegexp() *regexp.Regexp {
+	return regexp.MustCompile(`^` + k.DevicePrefix + `[0-9]+$`)
+}
+
+// GetSysfsRoot returns the sysfs mount point from SYSFS_ROOT env var, or /sys.
+func GetSysfsRoot() string {
+	if sysfsRoot := os.Getenv(SysfsEnvVarName); sysfsRoot != "" {
+		return sysfsRoot
+	}
+	return sysfsDefaultRoot
+}
+
+// GetDevfsRoot returns the devfs mount point from DEVFS_ROOT env var, or /dev.
+func GetDevfsRoot() string {
+	if devfsRoot := os.Getenv(DevfsEnvVarName); devfsRoot != "" {
+		return devfsRoot
+	}
+	return devfsDefaultRoot
+}
+
+type WQMode int
+
+const (
+	Dedicated WQMode = iota
+	Shared
+)
+
+var stringToMode = map[string]WQMode{
+	"dedicated": Dedicated,
+	"shared":    Shared,
+}
+
+func (m WQMode) String() string {
+	if m == Shared {
+		return "shared"
+	}
+	return "dedicated"
+}
+
+type Devices []*Device
+
+// Work queues mapped by UID.
+type WorkQueues map[string]*WorkQueue
+
+type Device struct {
+	kind         *Kind
+	Device       string // idxd device name, e.g. dsa0
+	PCIAddress   string
+	NumaNode     int
+	Capabilities map[string]bool
+	WorkQueues   WorkQueues
+}
+
+type WorkQueue struct {
+	device      *Device
+	WorkQueue   string // idxd work queue name, e.g. wq0.0
+	Mode        WQMode
+	Size        int
+	GroupID     int
+	Engines     int      // number of engines in the work queue group
+	AllocatedBy []string // claim UIDs, at most one for dedicated work queues
+}
+
+// New discovers enabled user-type work queues of enabled devices of the kind.
+func New(sysfsRoot string, kind *Kind) (Devices, error) {
+	devices := make(Devices, 0)
+	deviceRegexp := kind.deviceRegexp()
+
+	busdir := filepath.Join(sysfsRoot, busPath)
+	entries, err := os.ReadDir(busdir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			klog.V(5).Infof("No %s devices found on this host. %v does not exist", kind.Name, busdir)
+			return devices, nil
+		}
+		return nil, fmt.Errorf("could not read %v: %v", busdir, err)
+	}
+
+	for _, entry := range entries {
+		if !deviceRegexp.MatchString(entry.Name()) {
+			continue
+		}
+
+		devicedir, err := filepath.EvalSymlinks(filepath.Join(busdir, entry.Name()))
+		if err != nil {
+			klog.Warningf("Expected '%s' to be a symlink: %v", entry.Name(), err)
+			continue
+		}
+
+		newdevice, err := newDevice(devicedir, kind)
+		if err != nil {
+			klog.Warningf("Could not read %s device '%s': %v", kind.Name, entry.Name(), err)
+			continue
+		}
+		if newdevice == nil {
+			klog.V(5).Infof("%s device '%s' is not enabled, skipping", kind.Name, entry.Name())
+			continue
+		}
+
+		devices = append(devices, newdevice)
+	}
+
+	return devices, nil
+}
+
+// newDevice returns nil device if it is not enabled.
+func newDevice(devicedir string, kind *Kind) (*Device, error) {
+	state, err := ReadFile(devicedir, deviceState)
+	if err != nil {
+		return nil, err
+	}
+	if state != stateEnabled {
+		return nil, nil
+	}
+
+	numanode := -1
+	if numa, err := readInt(devicedir, deviceNuma); err == nil {
+		numanode = numa
+	}
+
+	var capabilities map[string]bool
+	if kind.Capabilities != nil {
+		if capabilities, err = kind.Capabilities(devicedir); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Device{
+		kind:         kind,
+		Device:       filepath.Base(devicedir),
+		PCIAddress:   filepath.Base(filepath.Dir(devicedir)),
+		NumaNode:     numanode,
+		Capabilities: capabilities,
+		WorkQueues:   make(WorkQueues),
+	}
+
+	entries, err := os.ReadDir(devicedir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v: %v", devicedir, err)
+	}
+
+	groupengines := map[int]int{}
+	for _, entry := range entries {
+		if !engineRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		groupid, err := readInt(filepath.Join(devicedir, entry.Name()), engineGroupID)
+		if err != nil || groupid < 0 {
+			continue
+		}
+		groupengines[groupid]++
+	}
+
+	for _, entry := range entries {
+		if !wqRegexp.MatchString(entry.Name()) {
+			continue
+		}
+
+		wq, err := d.newWorkQueue(filepath.Join(devicedir, entry.Name()))
+		if err != nil {
+			klog.Warningf("Could not read work queue '%s': %v", entry.Name(), err)
+			continue
+		}
+		if wq == nil {
+			klog.V(5).Infof("Work queue '%s' is not an enabled user work queue, skipping", entry.Name())
+			continue
+		}
+
+		wq.Engines = groupengines[wq.GroupID]
+		d.WorkQueues[wq.UID()] = wq
+	}
+
+	return d, nil
+}
+
+// newWorkQueue returns nil work queue if it is not enabled or not usable from user space.
+func (d *Device) newWorkQueue(wqdir string) (*WorkQueue, error) {
+	state, err := ReadFile(wqdir, wqState)
+	if err != nil {
+		return nil, err
+	}
+	wqtype, err := ReadFile(wqdir, wqType)
+	if err != nil {
+		return nil, err
+	}
+	if state != stateEnabled || wqtype != wqTypeUser {
+		return nil, nil
+	}
+
+	modestr, err := ReadFile(wqdir, wqMode)
+	if err != nil {
+		return nil, err
+	}
+	mode, exists := stringToMode[modestr]
+	if !exists {
+		return nil, fmt.Errorf("unknown work queue mode '%s'", modestr)
+	}
+
+	size, err := readInt(wqdir, wqSize)
+	if err != nil {
+		return nil, err
+	}
+	groupid, err := readInt(wqdir, wqGroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WorkQueue{
+		device:    d,
+		WorkQueue: filepath.Base(wqdir),
+		Mode:      mode,
+		Size:      size,
+		GroupID:   groupid,
+	}, nil
+}
+
+// ReadFile returns the trimmed contents of the sysfs attribute file in dir.
+func ReadFile(dir string, file string) (string, error) {
+	val, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %v", file, err)
+	}
+
+	return strings.TrimSpace(string(val)), nil
+}
+
+func readInt(dir string, file string) (int, error) {
+	str, err := ReadFile(dir, file)
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read value from %s: %v", file, err)
+	}
+
+	return val, nil
+}
+
+func GetResourceDevices(devices Devices) WorkQueues {
+	wqs := make(WorkQueues, 0)
+
+	for _, d := range devices {
+		for uid, wq := range d.WorkQueues {
+			wqs[uid] = wq
+		}
+	}
+
+	return wqs
+}
+
+func (q Devices) find(deviceUID string) *WorkQueue {
+	for _, d := range q {
+		if wq, exists := d.WorkQueues[deviceUID]; exists {
+			return wq
+		}
+	}
+	return nil
+}
+
+// Allocate records work queue as allocated by the claim. Dedicated work queues
+// can be allocated only by one claim, shared work queues by any number of claims.
+func (q Devices) Allocate(deviceUID string, allocatedBy string) (*WorkQueue, error) {
+	if allocatedBy == "" {
+		return nil, fmt.Errorf("no allocator ID given")
+	}
+
+	wq := q.find(deviceUID)
+	if wq == nil {
+		return nil, fmt.Errorf("no such work queue '%s' available", deviceUID)
+	}
+
+	for _, claimuid := range wq.AllocatedBy {
+		if claimuid == allocatedBy {
+			// duplicated request, already allocated
+			return wq, nil
+		}
+	}
+
+	if wq.Mode == Dedicated && len(wq.AllocatedBy) > 0 {
+		return nil, fmt.Errorf("dedicated work queue '%s' is already allocated", deviceUID)
+	}
+
+	wq.AllocatedBy = append(wq.AllocatedBy, allocatedBy)
+
+	return wq, nil
+}
+
+// Free releases all work queues allocated by the claim, returns the number of released work queues.
+func (q Devices) Free(allocatedBy string) int {
+	freed := 0
+
+	for _, d := range q {
+		for _, wq := range d.WorkQueues {
+			for i, claimuid := range wq.AllocatedBy {
+				if claimuid == allocatedBy {
+					wq.AllocatedBy = append(wq.AllocatedBy[:i], wq.AllocatedBy[i+1:]...)
+					freed++
+					break
+				}
+			}
+		}
+	}
+
+	return freed
+}
+
+func (w *WorkQueue) DeviceNode() string {
+	return filepath.Join(devfsDefaultRoot, w.device.kind.DevfsPath, w.WorkQueue)
+}
+
+func (w *WorkQueue) HostDeviceNode() string {
+	return filepath.Join(GetDevfsRoot(), w.device.kind.DevfsPath, w.WorkQueue)
+}
+
+func (w *WorkQueue) Device() string {
+	return w.device.Device
+}
+
+func (w *WorkQueue) PCIAddress() string {
+	return w.device.PCIAddress
+}
+
+func (w *WorkQueue) NumaNode() int {
+	return w.device.NumaNode
+}
+
+// Capabilities returns the operations supported by the device of the work queue.
+func (w *WorkQueue) Capabilities() map[string]bool {
+	return w.device.Capabilities
+}
+
+func (w *WorkQueue) UID() string {
+	return w.device.kind.UIDPrefix + "-" + strings.ReplaceAll(w.WorkQueue, ".", "-")
+}
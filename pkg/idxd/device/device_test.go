@@ -0,0 +1,169 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func newFakeDSADevices(t *testing.T) Devices {
+	testRoot := t.TempDir()
+	sysfsRoot := filepath.Join(testRoot, "sysfs")
+
+	if err := fakesysfs.FakeSysFsDSAContents(sysfsRoot, filepath.Join(testRoot, "devfs"), fakesysfs.DSADevices{
+		{Device: "dsa0", PCIAddress: "0000:6a:01.0", State: "enabled", NumaNode: 0,
+			WorkQueues: []fakesysfs.DSAWorkQueue{
+				{WorkQueue: "wq0.0", State: "enabled", Mode: "dedicated", Type: "user", Size: 16, GroupID: 0},
+				{WorkQueue: "wq0.1", State: "enabled", Mode: "shared", Type: "user", Size: 32, GroupID: 1},
+				{WorkQueue: "wq0.2", State: "disabled", Mode: "shared", Type: "user", Size: 32, GroupID: 1},
+				{WorkQueue: "wq0.3", State: "enabled", Mode: "dedicated", Type: "kernel", Size: 16, GroupID: 1},
+			},
+			Engines: []fakesysfs.DSAEngine{
+				{Engine: "engine0.0", GroupID: 0},
+				{Engine: "engine0.1", GroupID: 1},
+				{Engine: "engine0.2", GroupID: 1},
+				{Engine: "engine0.3", GroupID: -1},
+			},
+		},
+		{Device: "dsa2", PCIAddress: "0000:e7:01.0", State: "disabled", NumaNode: 1},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	dsadevices, err := New(sysfsRoot, DSA)
+	if err != nil {
+		t.Fatalf("could not discover DSA devices: %v", err)
+	}
+
+	return dsadevices
+}
+
+func TestNew(t *testing.T) {
+	dsadevices := newFakeDSADevices(t)
+
+	if len(dsadevices) != 1 {
+		t.Fatalf("expected only enabled device to be discovered, got %d devices", len(dsadevices))
+	}
+
+	d := dsadevices[0]
+	if d.Device != "dsa0" || d.PCIAddress != "0000:6a:01.0" || d.NumaNode != 0 {
+		t.Errorf("unexpected device %+v", d)
+	}
+
+	uids := []string{}
+	for uid := range d.WorkQueues {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	if len(uids) != 2 || uids[0] != "dsa-wq0-0" || uids[1] != "dsa-wq0-1" {
+		t.Fatalf("expected only enabled user work queues, got %v", uids)
+	}
+
+	dedicated := d.WorkQueues["dsa-wq0-0"]
+	if dedicated.Mode != Dedicated || dedicated.Size != 16 || dedicated.Engines != 1 {
+		t.Errorf("unexpected dedicated work queue %+v", dedicated)
+	}
+
+	shared := d.WorkQueues["dsa-wq0-1"]
+	if shared.Mode != Shared || shared.Size != 32 || shared.Engines != 2 {
+		t.Errorf("unexpected shared work queue %+v", shared)
+	}
+
+	if shared.DeviceNode() != "/dev/dsa/wq0.1" {
+		t.Errorf("unexpected device node %v", shared.DeviceNode())
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	type testCase struct {
+		name        string
+		deviceUID   string
+		allocatedBy string
+		pass        bool
+	}
+
+	dsadevices := newFakeDSADevices(t)
+
+	testcases := []testCase{
+		{"dedicated work queue", "dsa-wq0-0", "uid1", true},
+		{"dedicated work queue, same claim", "dsa-wq0-0", "uid1", true},
+		{"dedicated work queue, another claim", "dsa-wq0-0", "uid2", false},
+		{"shared work queue", "dsa-wq0-1", "uid1", true},
+		{"shared work queue, another claim", "dsa-wq0-1", "uid2", true},
+		{"disabled work queue", "dsa-wq0-2", "uid1", false},
+		{"no allocator", "dsa-wq0-1", "", false},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		_, err := dsadevices.Allocate(testcase.deviceUID, testcase.allocatedBy)
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+		}
+	}
+
+	if freed := dsadevices.Free("uid1"); freed != 2 {
+		t.Errorf("expected 2 work queues freed, got %d", freed)
+	}
+
+	if _, err := dsadevices.Allocate("dsa-wq0-0", "uid2"); err != nil {
+		t.Errorf("freed dedicated work queue could not be allocated: %v", err)
+	}
+}
+
+func TestReadStateOrCreateEmpty(t *testing.T) {
+	dsadevices := newFakeDSADevices(t)
+	statefile := filepath.Join(t.TempDir(), "state")
+
+	// a missing state file on a fresh install is not lost
+	if lost, err := dsadevices.ReadStateOrCreateEmpty(statefile, false); err != nil || lost {
+		t.Fatalf("expected missing state file on fresh install not to be lost, got lost %v, error: %v", lost, err)
+	}
+	if _, err := os.Stat(statefile); err != nil {
+		t.Errorf("empty state file was not created: %v", err)
+	}
+
+	// a missing state file with devices in use is lost, as it was deleted
+	if err := os.Remove(statefile); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if lost, err := dsadevices.ReadStateOrCreateEmpty(statefile, true); err != nil || !lost {
+		t.Fatalf("expected missing state file to be lost, got lost %v, error: %v", lost, err)
+	}
+
+	if _, err := dsadevices.Allocate("dsa-wq0-0", "uid1"); err != nil {
+		t.Fatalf("could not allocate work queue: %v", err)
+	}
+	if err := dsadevices.SaveState(statefile); err != nil {
+		t.Fatalf("could not save state: %v", err)
+	}
+
+	restored := newFakeDSADevices(t)
+	if lost, err := restored.ReadStateOrCreateEmpty(statefile, true); err != nil || lost {
+		t.Fatalf("expected state to be read, got lost %v, error: %v", lost, err)
+	}
+	if freed := restored.Free("uid1"); freed != 1 {
+		t.Errorf("expected restored work queue allocation, freed %d", freed)
+	}
+
+	if err := os.WriteFile(statefile, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	if lost, err := newFakeDSADevices(t).ReadStateOrCreateEmpty(statefile, true); err != nil || !lost {
+		t.Errorf("expected corrupted state file to be lost, got lost %v, error: %v", lost, err)
+	}
+	if _, err := os.Stat(statefile + ".corrupted"); err != nil {
+		t.Errorf("corrupted state file was not kept: %v", err)
+	}
+	if lost, err := newFakeDSADevices(t).ReadStateOrCreateEmpty(statefile, true); err != nil || lost {
+		t.Errorf("expected new empty state file, got lost %v, error: %v", lost, err)
+	}
+}
@@ -0,0 +1,102 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// Map allocation id to work queue UIDs.
+type savedAllocations map[string][]string
+
+// ReadStateOrCreateEmpty restores allocations from the state file, or creates
+// an empty state file. The returned lost is true when the state file was
+// corrupted, or was missing while devices were inUse, and allocations of
+// prepared claims need to be recovered. A missing state file on a fresh
+// install is not lost.
+func (q Devices) ReadStateOrCreateEmpty(statefile string, inUse bool) (lost bool, err error) {
+	if statefile == "" {
+		return false, nil
+	}
+
+	if _, err := os.Stat(statefile); os.IsNotExist(err) {
+		klog.Infof("State file '%s' not found, creating empty state file", statefile)
+		return inUse, createEmptyState(statefile)
+	}
+
+	return q.readState(statefile)
+}
+
+func createEmptyState(statefile string) error {
+	f, err := os.OpenFile(statefile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create state file '%s': %v", statefile, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("{}"); err != nil {
+		return fmt.Errorf("failed to write to state file '%s': %v", statefile, err)
+	}
+
+	return nil
+}
+
+func (q Devices) readState(statefile string) (bool, error) {
+	savedstatebytes, err := os.ReadFile(statefile)
+	if err != nil {
+		return false, fmt.Errorf("could not read state file '%s': %v", statefile, err)
+	}
+
+	saveddevices := make(savedAllocations, 0)
+	if err := json.Unmarshal(savedstatebytes, &saveddevices); err != nil {
+		klog.Errorf("State file '%s' is corrupted: %v", statefile, err)
+		if err := helpers.KeepCorruptedFile(statefile); err != nil {
+			return false, err
+		}
+		return true, createEmptyState(statefile)
+	}
+
+	for allocatedby, wqs := range saveddevices {
+		for _, wq := range wqs {
+			if _, err := q.Allocate(wq, allocatedby); err != nil {
+				klog.Errorf("Failed to restore work queue '%s' for '%s': %v", wq, allocatedby, err)
+				continue
+			}
+
+			klog.V(5).Infof("Successfully restored work queue '%s' for '%s'", wq, allocatedby)
+		}
+	}
+
+	return false, nil
+}
+
+func (q Devices) SaveState(statefile string) error {
+	if statefile == "" {
+		return nil
+	}
+
+	saveddevices := make(savedAllocations, 0)
+
+	for _, d := range q {
+		for uid, wq := range d.WorkQueues {
+			for _, allocatedby := range wq.AllocatedBy {
+				saveddevices[allocatedby] = append(saveddevices[allocatedby], uid)
+			}
+		}
+	}
+
+	encodedstate, err := json.MarshalIndent(saveddevices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed save state JSON encoding to file '%s': %v", statefile, err)
+	}
+
+	return os.WriteFile(statefile, encodedstate, 0600)
+}
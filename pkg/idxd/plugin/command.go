@@ -0,0 +1,118 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/cdi"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
+)
+
+// NewCommand returns the command running the kubelet plugin for the idxd
+// devices of the kind, e.g. DSA, published as the device family.
+func NewCommand(use string, kind *device.Kind, family cdiregistry.Family) *cobra.Command {
+	return helpers.NewApp(use, "Intel "+kind.Name+" resource driver kubelet plugin",
+		func(ctx context.Context, flags *helpers.AppFlags) error {
+			return run(ctx, flags, kind, family)
+		})
+}
+
+func run(ctx context.Context, flags *helpers.AppFlags, kind *device.Kind, family cdiregistry.Family) error {
+	var (
+		d   *driver
+		err error
+	)
+
+	driverName := family.DriverName()
+
+	klog.Infof("DRA %s kubelet plugin", kind.Name)
+	driverVersion.PrintDriverVersion(driverName)
+
+	pluginPath := path.Join(flags.KubeletPluginsDir(), driverName)
+	if err := os.MkdirAll(pluginPath, 0750); err != nil {
+		return fmt.Errorf("could not create '%s': %v", pluginPath, err)
+	}
+
+	kubeclient, err := flags.NewKubeClient()
+	if err != nil {
+		return fmt.Errorf("could not create kube client: %v", err)
+	}
+
+	config := &configType{
+		kind:      kind,
+		family:    family,
+		clientset: kubeclient,
+		nodeName:  flags.NodeNameOrDefault(""),
+		cdiRoot:   flags.CDIDirOrDefault(cdi.CDIRoot),
+		stateFile: pluginPath + ".state",
+	}
+
+	if d, err = newDriver(ctx, config); err != nil {
+		return fmt.Errorf("failed to create kubelet plugin driver: %v", err)
+	}
+
+	if *flags.AuditLog != "" {
+		if d.audit, err = helpers.NewAuditLogger(*flags.AuditLog, driverName, d.nodename); err != nil {
+			return err
+		}
+	}
+
+	opts := helpers.PluginOptionsAt(flags.KubeletPluginsDir(), flags.KubeletPluginsRegistryDir(), driverName, d.nodename, d.kubeclient)
+	if d.plugin, err = helpers.StartPlugin(ctx, d, opts, d.resources()); err != nil {
+		return err
+	}
+
+	if *flags.HTTPEndpoint != "" {
+		if err := startHTTPEndpoint(*flags.HTTPEndpoint, *flags.PprofPath, config.cdiRoot, d); err != nil {
+			return err
+		}
+	}
+
+	klog.Infof("DRA kubelet plugin %s running...", driverName)
+
+	helpers.WaitForStopSignal()
+
+	d.plugin.Stop()
+
+	klog.Infof("DRA kubelet plugin %s done", driverName)
+
+	return nil
+}
+
+// startHTTPEndpoint serves the liveness and readiness checks and metrics of
+// the plugin, and optionally the profiling data.
+func startHTTPEndpoint(httpEndpoint string, pprofPath string, cdiRoot string, d *driver) error {
+	mux := http.NewServeMux()
+	mux.Handle(helpers.HealthzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegistrationCheck(d.plugin),
+		"cdi":          helpers.WritableDirCheck(cdiRoot),
+	})
+	mux.Handle(helpers.ReadyzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegisteredCheck(d.plugin),
+		"cdi":          helpers.WritableDirCheck(cdiRoot),
+	})
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(helpers.NewDeviceUsageCollector("intel_"+d.family.Class, d.deviceUsage))
+	mux.Handle(helpers.MetricsPath, metrics.HandlerFor(registry, metrics.HandlerOpts{}))
+
+	if pprofPath != "" {
+		helpers.AddPprofHandlers(mux, pprofPath)
+	}
+
+	return helpers.ServeHTTPEndpoint(httpEndpoint, mux)
+}
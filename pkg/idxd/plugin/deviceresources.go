@@ -0,0 +1,52 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+)
+
+func deviceResources(wqs device.WorkQueues) *[]resourceapi.Device {
+	resourcedevices := []resourceapi.Device{}
+
+	for _, wq := range wqs {
+		device := resourceapi.Device{
+			Name: wq.UID(),
+			Basic: &resourceapi.BasicDevice{
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"mode": {
+						StringValue: ptr.To(wq.Mode.String()),
+					},
+					"device": {
+						StringValue: ptr.To(wq.Device()),
+					},
+					"size": {
+						IntValue: ptr.To(int64(wq.Size)),
+					},
+					"engines": {
+						IntValue: ptr.To(int64(wq.Engines)),
+					},
+					"numaNode": {
+						IntValue: ptr.To(int64(wq.NumaNode())),
+					},
+				},
+			},
+		}
+		for capability, supported := range wq.Capabilities() {
+			device.Basic.Attributes[resourceapi.QualifiedName(capability)] = resourceapi.DeviceAttribute{
+				BoolValue: ptr.To(supported),
+			}
+		}
+		resourcedevices = append(resourcedevices, device)
+
+		klog.V(5).Infof("Adding Device resource: name '%s', mode '%s'", device.Name, wq.Mode.String())
+	}
+
+	return &resourcedevices
+}
@@ -0,0 +1,263 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/cdi"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+)
+
+var _ drav1.DRAPluginServer = &driver{}
+
+type driver struct {
+	sync.Mutex
+	kind       *device.Kind
+	family     cdiregistry.Family
+	kubeclient kubernetes.Interface
+	nodename   string
+	cdi        *cdi.CDI
+	devices    device.Devices
+	plugin     kubeletplugin.DRAPlugin
+	statefile  string
+	recorder   record.EventRecorder
+	audit      *helpers.AuditLogger
+}
+
+func (d *driver) getResourceClaim(ctx context.Context, claim *drav1.Claim) (*resourceapi.ResourceClaim, error) {
+	resourceclaim, err := d.kubeclient.ResourceV1beta1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ResourceClaim %s in namespace %s", claim.Name, claim.Namespace)
+	}
+
+	if resourceclaim.Status.Allocation == nil {
+		return nil, fmt.Errorf("ResourceClaim %s not yet allocated", claim.Name)
+	}
+
+	return resourceclaim, nil
+}
+
+func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepareResourcesRequest) (*drav1.NodePrepareResourcesResponse, error) {
+
+	preparedResourcesResponse := &drav1.NodePrepareResourcesResponse{
+		Claims: map[string]*drav1.NodePrepareResourceResponse{},
+	}
+
+	for _, claim := range req.Claims {
+		klog.V(5).Infof("NodePrepareResources: claim %s", claim.GetUID())
+		preparedResourcesResponse.Claims[claim.GetUID()] = d.allocateResource(ctx, claim)
+		d.audit.LogPrepare(claim, preparedResourcesResponse.Claims[claim.GetUID()])
+	}
+
+	return preparedResourcesResponse, nil
+}
+
+func (d *driver) allocateResource(ctx context.Context, claim *drav1.Claim) *drav1.NodePrepareResourceResponse {
+	resourceclaim, err := d.getResourceClaim(ctx, claim)
+	if err != nil {
+		klog.Errorf("Error fetching ResourceClaim for %s: %v", claim.GetUID(), err)
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
+	}
+
+	return d.prepareResourceClaim(ctx, claim, resourceclaim)
+}
+
+// recoverClaim prepares the allocated ResourceClaim again when the state file
+// was lost.
+func (d *driver) recoverClaim(ctx context.Context, resourceclaim *resourceapi.ResourceClaim) error {
+	claim := &drav1.Claim{Namespace: resourceclaim.Namespace, Name: resourceclaim.Name, UID: string(resourceclaim.UID)}
+	if response := d.prepareResourceClaim(ctx, claim, resourceclaim); response.Error != "" {
+		return errors.New(response.Error)
+	}
+
+	return nil
+}
+
+func (d *driver) prepareResourceClaim(ctx context.Context, claim *drav1.Claim, resourceclaim *resourceapi.ResourceClaim) *drav1.NodePrepareResourceResponse {
+	response := &drav1.NodePrepareResourceResponse{}
+
+	d.Lock()
+	defer d.Unlock()
+
+	for _, deviceallocationresult := range resourceclaim.Status.Allocation.Devices.Results {
+		if deviceallocationresult.Driver != d.family.DriverName() || deviceallocationresult.Pool != d.nodename {
+			klog.V(5).Infof("Driver/pool '%s/%s' not handled by driver (%s/%s)",
+				deviceallocationresult.Driver, deviceallocationresult.Pool,
+				d.family.DriverName(), d.nodename)
+
+			continue
+		}
+
+		requestedDeviceUID := deviceallocationresult.Device
+
+		klog.V(5).Infof("Requested work queue UID '%s'", requestedDeviceUID)
+
+		wq, err := d.devices.Allocate(requestedDeviceUID, claim.GetUID())
+		if err != nil {
+			klog.Errorf("Error allocating work queue %s for %s: %v", requestedDeviceUID, claim.GetUID(), err)
+
+			d.devices.Free(claim.GetUID())
+			return helpers.PrepareFailed(d.recorder, claim, err.Error())
+		}
+
+		cdidevicename := d.family.QualifiedName(wq.UID())
+		klog.V(5).Infof("Allocated CDI device '%s' for claim '%s'", cdidevicename, claim.GetUID())
+
+		response.Devices = append(response.Devices, &drav1.Device{
+			RequestNames: []string{deviceallocationresult.Request},
+			PoolName:     deviceallocationresult.Pool,
+			DeviceName:   deviceallocationresult.Device,
+			CDIDeviceIDs: []string{cdidevicename},
+		})
+	}
+
+	if err := d.devices.SaveState(d.statefile); err != nil {
+		d.devices.Free(claim.GetUID())
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
+	}
+
+	return response
+}
+
+func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnprepareResourcesRequest) (*drav1.NodeUnprepareResourcesResponse, error) {
+
+	unpreparedResourcesResponse := &drav1.NodeUnprepareResourcesResponse{
+		Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
+	}
+
+	for _, claim := range req.Claims {
+		klog.V(5).Infof("NodeUnprepareResources: claim %s", claim.GetUID())
+
+		unpreparedResourcesResponse.Claims[claim.GetUID()] = d.freeDevice(claim)
+		d.audit.LogUnprepare(claim, unpreparedResourcesResponse.Claims[claim.GetUID()])
+	}
+
+	return unpreparedResourcesResponse, nil
+}
+
+// freeDevice releases work queues by claim UID recorded in the driver state,
+// the ResourceClaim may already be deleted.
+func (d *driver) freeDevice(claim *drav1.Claim) *drav1.NodeUnprepareResourceResponse {
+	d.Lock()
+	defer d.Unlock()
+
+	if freed := d.devices.Free(claim.GetUID()); freed == 0 {
+		klog.V(5).Infof("No work queues allocated for claim '%s'", claim.GetUID())
+		return &drav1.NodeUnprepareResourceResponse{}
+	}
+
+	klog.V(5).Infof("Claim with uid '%s' freed", claim.GetUID())
+	if err := d.devices.SaveState(d.statefile); err != nil {
+		return &drav1.NodeUnprepareResourceResponse{
+			Error: err.Error(),
+		}
+	}
+
+	return &drav1.NodeUnprepareResourceResponse{}
+}
+
+func (d *driver) UpdateDeviceResources(ctx context.Context) error {
+	if d.plugin == nil {
+		return nil
+	}
+
+	return d.plugin.PublishResources(ctx, d.resources())
+}
+
+func (d *driver) resources() kubeletplugin.Resources {
+	return kubeletplugin.Resources{
+		Devices: *deviceResources(device.GetResourceDevices(d.devices)),
+	}
+}
+
+// deviceUsage returns the number of usable work queues of every device, and
+// how many of them are allocated to claims.
+func (d *driver) deviceUsage() []helpers.DeviceUsage {
+	d.Lock()
+	defer d.Unlock()
+
+	usage := []helpers.DeviceUsage{}
+	for _, idxd := range d.devices {
+		allocated := 0
+		for _, wq := range idxd.WorkQueues {
+			if len(wq.AllocatedBy) > 0 {
+				allocated++
+			}
+		}
+		usage = append(usage, helpers.DeviceUsage{Device: idxd.Device, Resource: "wqs", Total: float64(len(idxd.WorkQueues)), Allocated: float64(allocated)})
+	}
+
+	return usage
+}
+
+type configType struct {
+	kind      *device.Kind
+	family    cdiregistry.Family
+	clientset kubernetes.Interface
+	nodeName  string
+	cdiRoot   string
+	stateFile string
+}
+
+func newDriver(ctx context.Context, config *configType) (*driver, error) {
+	cdi, err := cdi.New(config.cdiRoot, config.family)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := device.New(device.GetSysfsRoot(), config.kind)
+	if err != nil {
+		return nil, fmt.Errorf("could not find %s devices: %v", config.kind.Name, err)
+	}
+
+	// Devices are in use when the plugin has written CDI specs, so a missing
+	// state file is lost rather than new.
+	inUse := cdi.HasDevices()
+
+	if err := cdi.SyncDevices(device.GetResourceDevices(devices)); err != nil {
+		return nil, fmt.Errorf("cannot sync CDI devices: %v", err)
+	}
+
+	d := &driver{
+		kind:       config.kind,
+		family:     config.family,
+		kubeclient: config.clientset,
+		nodename:   config.nodeName,
+		cdi:        cdi,
+		devices:    devices,
+		statefile:  config.stateFile,
+		recorder:   helpers.NewEventRecorder(config.clientset, config.family.DriverName(), config.nodeName),
+	}
+
+	helpers.ReportNoDevices(d.recorder, config.nodeName, len(device.GetResourceDevices(devices)))
+
+	lost, err := d.devices.ReadStateOrCreateEmpty(d.statefile, inUse)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up save state file '%s': %v", d.statefile, err)
+	}
+
+	if lost {
+		klog.Info("State file was lost, recovering prepared claims")
+		if err := helpers.RecoverPreparedClaims(ctx, config.clientset, config.family.DriverName(), config.nodeName, d.recoverClaim); err != nil {
+			klog.Errorf("could not recover prepared claims: %v", err)
+		}
+	}
+
+	return d, nil
+}
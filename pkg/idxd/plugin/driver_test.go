@@ -0,0 +1,301 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	iaadevice "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/iaa/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/idxd/device"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+const (
+	testNodeName  = "test-node-01"
+	testNameSpace = "test-namespace-01"
+)
+
+// newFakeSysfs creates fake sysfs with one DSA device in testRoot and returns
+// its path.
+func newFakeSysfs(t *testing.T, testRoot string) string {
+	sysfsRoot := filepath.Join(testRoot, "sysfs")
+
+	if err := fakesysfs.FakeSysFsDSAContents(sysfsRoot, filepath.Join(testRoot, "devfs"), fakesysfs.DSADevices{
+		{Device: "dsa0", PCIAddress: "0000:6a:01.0", State: "enabled", NumaNode: 0,
+			WorkQueues: []fakesysfs.DSAWorkQueue{
+				{WorkQueue: "wq0.0", State: "enabled", Mode: "dedicated", Type: "user", Size: 16, GroupID: 0},
+				{WorkQueue: "wq0.1", State: "enabled", Mode: "shared", Type: "user", Size: 32, GroupID: 1},
+			},
+			Engines: []fakesysfs.DSAEngine{
+				{Engine: "engine0.0", GroupID: 0},
+				{Engine: "engine0.1", GroupID: 1},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	return sysfsRoot
+}
+
+func newFakeDriver(t *testing.T) *driver {
+	testRoot := t.TempDir()
+	sysfsRoot := newFakeSysfs(t, testRoot)
+
+	dsadevices, err := device.New(sysfsRoot, device.DSA)
+	if err != nil {
+		t.Fatalf("could not discover DSA devices: %v", err)
+	}
+
+	return &driver{
+		kind:       device.DSA,
+		family:     cdiregistry.DSA,
+		kubeclient: kubefake.NewSimpleClientset(),
+		nodename:   testNodeName,
+		devices:    dsadevices,
+		statefile:  filepath.Join(testRoot, "state"),
+		recorder:   &record.FakeRecorder{},
+	}
+}
+
+func TestDriver(t *testing.T) {
+	type testCase struct {
+		name             string
+		claims           []*resourcev1.ResourceClaim
+		prepare          *drav1.NodePrepareResourcesRequest
+		unprepare        *drav1.NodeUnprepareResourcesRequest
+		expectedResponse *drav1.NodePrepareResourcesResponse
+	}
+
+	driver := newFakeDriver(t)
+	driverName := cdiregistry.DSA.DriverName()
+
+	testcases := []testCase{
+		{
+			name: "DSA allocate dedicated work queue",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"dsa-wq0-0"}),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dsa-wq0-0", CDIDeviceIDs: []string{"intel.com/dsa=dsa-wq0-0"}}}},
+				},
+			},
+		},
+		{
+			name: "DSA dedicated work queue already allocated",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim2", "uid2", "request1", driverName, testNodeName, []string{"dsa-wq0-0"}),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid2", Name: "claim2", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Error: "dedicated work queue 'dsa-wq0-0' is already allocated"},
+				},
+			},
+		},
+		{
+			name: "DSA shared work queue for two claims",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim3", "uid3", "request1", driverName, testNodeName, []string{"dsa-wq0-1"}),
+				helpers.NewClaim(testNameSpace, "claim4", "uid4", "request1", driverName, testNodeName, []string{"dsa-wq0-1"}),
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{
+					{UID: "uid3", Name: "claim3", Namespace: testNameSpace},
+					{UID: "uid4", Name: "claim4", Namespace: testNameSpace},
+				},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid3": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dsa-wq0-1", CDIDeviceIDs: []string{"intel.com/dsa=dsa-wq0-1"}}}},
+					"uid4": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dsa-wq0-1", CDIDeviceIDs: []string{"intel.com/dsa=dsa-wq0-1"}}}},
+				},
+			},
+		},
+		{
+			name: "DSA dedicated work queue after unprepare",
+			unprepare: &drav1.NodeUnprepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			prepare: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid2", Name: "claim2", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "dsa-wq0-0", CDIDeviceIDs: []string{"intel.com/dsa=dsa-wq0-0"}}}},
+				},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		for _, testClaim := range testcase.claims {
+			createdClaim, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testClaim.Namespace).Create(context.TODO(), testClaim, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("could not create test claim: %v", err)
+				continue
+			}
+			t.Logf("created test claim: %+v", createdClaim)
+		}
+
+		if testcase.unprepare != nil {
+			if _, err := driver.NodeUnprepareResources(context.TODO(), testcase.unprepare); err != nil {
+				t.Errorf("%v: error %v, expected no error", testcase.name, err)
+				continue
+			}
+		}
+
+		response, err := driver.NodePrepareResources(context.TODO(), testcase.prepare)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(testcase.expectedResponse, response) {
+			responseJSON, _ := json.MarshalIndent(response, "", "\t")
+			expectedResponseJSON, _ := json.MarshalIndent(testcase.expectedResponse, "", "\t")
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
+		}
+	}
+}
+
+func TestIAADriver(t *testing.T) {
+	testRoot := t.TempDir()
+	sysfsRoot := filepath.Join(testRoot, "sysfs")
+
+	if err := fakesysfs.FakeSysFsIAAContents(sysfsRoot, filepath.Join(testRoot, "devfs"), fakesysfs.IAADevices{
+		{Device: "iax1", PCIAddress: "0000:6a:02.0", State: "enabled", NumaNode: 0, OpCap: "00000000,00000000,00000000,00000000,00000000,0000000c,00000000,00000001",
+			WorkQueues: []fakesysfs.IAAWorkQueue{
+				{WorkQueue: "wq1.0", State: "enabled", Mode: "dedicated", Type: "user", Size: 16, GroupID: 0},
+			},
+			Engines: []fakesysfs.IAAEngine{
+				{Engine: "engine1.0", GroupID: 0},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	iaadevices, err := device.New(sysfsRoot, iaadevice.IAA)
+	if err != nil {
+		t.Fatalf("could not discover IAA devices: %v", err)
+	}
+
+	driver := &driver{
+		kind:       iaadevice.IAA,
+		family:     cdiregistry.IAA,
+		kubeclient: kubefake.NewSimpleClientset(),
+		nodename:   testNodeName,
+		devices:    iaadevices,
+		statefile:  filepath.Join(testRoot, "state"),
+		recorder:   &record.FakeRecorder{},
+	}
+
+	resources := driver.resources()
+	if len(resources.Devices) != 1 {
+		t.Fatalf("expected one work queue device, got %+v", resources.Devices)
+	}
+	attributes := resources.Devices[0].Basic.Attributes
+	if resources.Devices[0].Name != "iaa-wq1-0" || !*attributes["compression"].BoolValue || *attributes["filter"].BoolValue {
+		t.Errorf("unexpected work queue device %+v", resources.Devices[0])
+	}
+
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", cdiregistry.IAA.DriverName(), testNodeName, []string{"iaa-wq1-0"})
+	if _, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+
+	response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{
+		Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &drav1.NodePrepareResourceResponse{Devices: []*drav1.Device{
+		{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "iaa-wq1-0", CDIDeviceIDs: []string{"intel.com/iaa=iaa-wq1-0"}},
+	}}
+	if !reflect.DeepEqual(response.Claims["uid1"], expected) {
+		t.Errorf("unexpected response: %+v, expected %+v", response.Claims["uid1"], expected)
+	}
+}
+
+func TestRecoverLostState(t *testing.T) {
+	testRoot := t.TempDir()
+	t.Setenv(device.SysfsEnvVarName, newFakeSysfs(t, testRoot))
+
+	driverName := cdiregistry.DSA.DriverName()
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"dsa-wq0-0"})
+	claim.Status.ReservedFor = []resourcev1.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod1", UID: "pod-uid1"}}
+
+	statefile := filepath.Join(testRoot, "state")
+	config := &configType{
+		kind:      device.DSA,
+		family:    cdiregistry.DSA,
+		clientset: kubefake.NewSimpleClientset(claim),
+		nodeName:  testNodeName,
+		cdiRoot:   t.TempDir(),
+		stateFile: statefile,
+	}
+
+	// fresh install, no CDI specs and no state file, nothing to recover
+	driver, err := newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not create driver: %v", err)
+	}
+	if freed := driver.devices.Free("uid1"); freed != 0 {
+		t.Errorf("expected no claim to be recovered on fresh install, freed %d", freed)
+	}
+
+	// state file deleted while CDI specs exist
+	if err := os.Remove(statefile); err != nil {
+		t.Fatalf("setup error: could not delete state file: %v", err)
+	}
+	driver, err = newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not restart driver: %v", err)
+	}
+	if freed := driver.devices.Free("uid1"); freed != 1 {
+		t.Errorf("expected claim to be recovered after state file was deleted, freed %d", freed)
+	}
+
+	// corrupted state file, as if it was lost
+	if err := os.WriteFile(statefile, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: could not corrupt state file: %v", err)
+	}
+	if _, err = newDriver(context.TODO(), config); err != nil {
+		t.Fatalf("could not restart driver: %v", err)
+	}
+	state, err := os.ReadFile(statefile)
+	if err != nil || !strings.Contains(string(state), "dsa-wq0-0") {
+		t.Errorf("expected recovered work queue in state file, got %s, %v", state, err)
+	}
+}
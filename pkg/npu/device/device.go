@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+var (
+	PciRegexp   = pci.AddressRegexp
+	AccelRegexp = regexp.MustCompile(`^accel[0-9]+$`)
+	ModelNames  = map[string]string{
+		"0x7d1d": "Meteor Lake NPU",
+		"0xad1d": "Arrow Lake NPU",
+		"0x643e": "Lunar Lake NPU",
+		"0xb03e": "Panther Lake NPU",
+	}
+	// ModelTOPS is the peak INT8 performance of the NPU in TOPS.
+	ModelTOPS = map[string]int64{
+		"0x7d1d": 11,
+		"0xad1d": 13,
+		"0x643e": 48,
+		"0xb03e": 50,
+	}
+)
+
+const (
+	DevfsEnvVarName  = "DEVFS_ROOT"
+	devfsDefaultRoot = "/dev"
+	DevfsAccelPath   = "accel"
+
+	SysfsEnvVarName  = "SYSFS_ROOT"
+	sysfsDefaultRoot = "/sys"
+
+	// SysfsDriverPath is where intel_vpu driver binds NPU PCI devices,
+	// each of them has an accel/accelN subdirectory.
+	SysfsDriverPath = "bus/pci/drivers/intel_vpu"
+	SysfsAccelPath  = "class/accel"
+
+	CDIVendor        = cdiregistry.Vendor
+	CDIClass         = cdiregistry.NPUClass
+	CDIKind          = CDIVendor + "/" + CDIClass
+	DriverName       = CDIClass + "." + CDIVendor
+	PCIAddressLength = pci.AddressLength
+
+	PreparedClaimsFileName  = "preparedClaims.json"
+	PluginRegistrarFileName = DriverName + ".sock"
+	PluginSocketFileName    = "plugin.sock"
+
+	DefaultNamingStyle = "machine"
+)
+
+// DeviceInfo is an internal structure type to store info about discovered device.
+type DeviceInfo struct {
+	// UID is a unique identifier on node, used in ResourceSlice K8s API object as RFC1123-compliant identifier.
+	// Consists of PCIAddress and Model with colons and dots replaced with hyphens, e.g. 0000-00-0b-0-0x7d1d.
+	UID        string `json:"uid"`
+	PCIAddress string `json:"pciaddress"` // PCI address in Linux DBDF notation for use with sysfs, e.g. 0000:00:0b.0
+	Model      string `json:"model"`      // PCI device ID
+	ModelName  string `json:"modelname"`  // SKU name of the device, e.g. Meteor Lake NPU
+	DeviceIdx  uint64 `json:"deviceidx"`  // accel device number (e.g. 0 for /dev/accel/accel0)
+}
+
+func (n DeviceInfo) CDIName() string {
+	return fmt.Sprintf("%s=%s", CDIKind, n.UID)
+}
+
+func (n *DeviceInfo) DeepCopy() *DeviceInfo {
+	di := *n
+	return &di
+}
+
+func (n *DeviceInfo) SetModelName() {
+	if modelName, found := ModelNames[n.Model]; found {
+		n.ModelName = modelName
+		return
+	}
+	n.ModelName = "Unknown"
+}
+
+// TOPS returns the peak performance of the device model, 0 if unknown.
+func (n *DeviceInfo) TOPS() int64 {
+	return ModelTOPS[n.Model]
+}
+
+func DeviceUIDFromPCIinfo(pciAddress string, pciid string) string {
+	// 0000:00:01.0, 0x0000 -> 0000-00-01-0-0x0000
+	return pci.DeviceUID(pciAddress, pciid)
+}
+
+func PciInfoFromDeviceUID(deviceUID string) (string, string) {
+	// 0000-00-01-0-0x0000 -> 0000:00:01.0, 0x0000
+	return pci.ParseDeviceUID(deviceUID)
+}
+
+// DevicesInfo is a dictionary with DeviceInfo.uid being the key.
+type DevicesInfo map[string]*DeviceInfo
+
+func (n *DevicesInfo) DeepCopy() DevicesInfo {
+	devicesInfoCopy := DevicesInfo{}
+	for duid, device := range *n {
+		devicesInfoCopy[duid] = device.DeepCopy()
+	}
+	return devicesInfoCopy
+}
+
+func GetDevfsRoot() string {
+	devfsRoot, found := os.LookupEnv(DevfsEnvVarName)
+
+	if found {
+		if _, err := os.Stat(path.Join(devfsRoot, DevfsAccelPath)); err == nil {
+			fmt.Printf("using custom devfs location: %v\n", devfsRoot)
+			return devfsRoot
+		} else {
+			fmt.Printf("could not find devfs at '%v' from %v env var: %v\n", devfsRoot, DevfsEnvVarName, err)
+		}
+	}
+
+	fmt.Printf("using default devfs accel location: %v\n", devfsDefaultRoot)
+	return devfsDefaultRoot
+}
+
+// GetSysfsRoot tries to get path where sysfs is mounted from
+// env var, or fallback to hardcoded path.
+func GetSysfsRoot() string {
+	sysfsPath, found := os.LookupEnv(SysfsEnvVarName)
+
+	if found {
+		if _, err := os.Stat(path.Join(sysfsPath, SysfsAccelPath)); err == nil {
+			fmt.Printf("using custom sysfs location: %v\n", sysfsPath)
+			return sysfsPath
+		} else {
+			fmt.Printf("could not find sysfs at '%v' from %v env var: %v\n", sysfsPath, SysfsEnvVarName, err)
+		}
+	}
+
+	fmt.Printf("using default sysfs location: %v\n", sysfsDefaultRoot)
+	// If /sys is not available, devices discovery will fail gracefully.
+	return sysfsDefaultRoot
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+
+	"k8s.io/klog/v2"
+)
+
+// Detect devices from sysfs.
+func DiscoverDevices(sysfsDir, namingStyle string) map[string]*device.DeviceInfo {
+	sysfs := pci.NewSysfs(sysfsDir)
+	sysfsDriverDir := path.Join(sysfsDir, device.SysfsDriverPath)
+
+	devices := make(map[string]*device.DeviceInfo)
+
+	pciAddresses, err := sysfs.DriverDevices(path.Base(device.SysfsDriverPath))
+	if err != nil {
+		klog.Error(err)
+		return devices
+	}
+
+	if len(pciAddresses) == 0 {
+		klog.V(5).Infof("No Intel NPU devices found on this host in %v", sysfsDriverDir)
+		return devices
+	}
+
+	for _, devicePCIAddress := range pciAddresses {
+		klog.V(5).Infof("Found NPU PCI device: %s", devicePCIAddress)
+
+		deviceId, err := sysfs.DeviceID(path.Join(sysfsDriverDir, devicePCIAddress))
+		if err != nil {
+			klog.Errorf("Failed reading device file of %s: %+v", devicePCIAddress, err)
+			continue
+		}
+		uid := device.DeviceUIDFromPCIinfo(devicePCIAddress, deviceId)
+		klog.V(5).Infof("New NPU UID: %v", uid)
+
+		deviceIdx, found := getAccelIndex(path.Join(sysfsDriverDir, devicePCIAddress, "accel"))
+		if !found {
+			klog.V(5).Infof("Could not find device %v Accel index", devicePCIAddress)
+			continue
+		}
+
+		newDeviceInfo := &device.DeviceInfo{
+			UID:        uid,
+			PCIAddress: devicePCIAddress,
+			Model:      deviceId,
+			DeviceIdx:  deviceIdx,
+		}
+		newDeviceInfo.SetModelName()
+
+		devices[determineDeviceName(newDeviceInfo, namingStyle)] = newDeviceInfo
+	}
+
+	return devices
+}
+
+func determineDeviceName(info *device.DeviceInfo, namingStyle string) string {
+	if namingStyle == "classic" {
+		return "accel" + strconv.FormatUint(info.DeviceIdx, 10)
+	}
+
+	return info.UID
+}
+
+// getAccelIndex returns the index of the accelN entry in the device's accel directory.
+func getAccelIndex(deviceAccelDir string) (uint64, bool) {
+	accelDirFiles, err := os.ReadDir(deviceAccelDir)
+	if err != nil {
+		klog.Errorf("could not read sysfs directory %v: %v", deviceAccelDir, err)
+		return 0, false
+	}
+
+	for _, accelFile := range accelDirFiles {
+		accelFileName := accelFile.Name()
+		if !device.AccelRegexp.MatchString(accelFileName) {
+			continue
+		}
+
+		// accelX
+		deviceIdx, err := strconv.ParseUint(accelFileName[5:], 10, 64)
+		if err != nil {
+			klog.V(5).Infof("failed to parse index of Accel device '%v', skipping", accelFileName)
+			continue
+		}
+
+		return deviceIdx, true
+	}
+
+	return 0, false
+}
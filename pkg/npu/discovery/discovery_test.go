@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/discovery"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+)
+
+func TestDiscoverDevices(t *testing.T) {
+	testDirs, err := helpers.NewTestDirs(device.DriverName)
+	if err != nil {
+		t.Fatalf("could not create fake system dirs: %v", err)
+	}
+	defer os.RemoveAll(testDirs.TestRoot)
+
+	faked := device.DevicesInfo{
+		"0000-00-0b-0-0x7d1d": {Model: "0x7d1d", PCIAddress: "0000:00:0b.0", DeviceIdx: 0, UID: "0000-00-0b-0-0x7d1d"},
+		"0000-00-0c-0-0x643e": {Model: "0x643e", PCIAddress: "0000:00:0c.0", DeviceIdx: 1, UID: "0000-00-0c-0-0x643e"},
+	}
+	if err := fakesysfs.FakeSysFsNpuContents(testDirs.SysfsRoot, testDirs.DevfsRoot, faked, false); err != nil {
+		t.Fatalf("setup error: could not create fake sysfs: %v", err)
+	}
+
+	detected := discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+	if len(detected) != len(faked) {
+		t.Fatalf("expected %d devices, detected %d: %v", len(faked), len(detected), detected)
+	}
+
+	for uid, want := range faked {
+		npu, found := detected[uid]
+		if !found {
+			t.Errorf("device %v was not detected", uid)
+			continue
+		}
+		if npu.UID != want.UID || npu.PCIAddress != want.PCIAddress || npu.Model != want.Model || npu.DeviceIdx != want.DeviceIdx || npu.ModelName == "Unknown" {
+			t.Errorf("device %v: expected %+v, got %+v", uid, want, npu)
+		}
+		if _, err := os.Stat(path.Join(testDirs.DevfsRoot, device.DevfsAccelPath, fmt.Sprintf("accel%d", want.DeviceIdx))); err != nil {
+			t.Errorf("device %v: accel device file missing: %v", uid, err)
+		}
+	}
+
+	classic := discovery.DiscoverDevices(testDirs.SysfsRoot, "classic")
+	if npu, found := classic["accel1"]; !found || npu.UID != "0000-00-0c-0-0x643e" {
+		t.Errorf("device not named by accel index with classic naming: %v", classic)
+	}
+
+	if err := fakesysfs.RemoveFakeNpuDevice(testDirs.SysfsRoot, testDirs.DevfsRoot, "0000:00:0c.0"); err != nil {
+		t.Fatalf("could not remove fake device: %v", err)
+	}
+	detected = discovery.DiscoverDevices(testDirs.SysfsRoot, device.DefaultNamingStyle)
+	if _, found := detected["0000-00-0c-0-0x643e"]; found || len(detected) != len(faked)-1 {
+		t.Errorf("removed device still detected: %v", detected)
+	}
+}
@@ -14,22 +14,25 @@
  * limitations under the License.
  */
 
-package main
+package plugin
 
 import (
 	"context"
 	"fmt"
 	"path"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
 
 	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 
-	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
-	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/discovery"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/discovery"
 	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
 )
 
@@ -41,6 +44,9 @@ type driver struct {
 	state    *nodeState
 	sysfsDir string
 	plugin   kubeletplugin.DRAPlugin
+	recorder record.EventRecorder
+	audit    *helpers.AuditLogger
+	retrier  *helpers.UnprepareRetrier
 }
 
 func newDriver(ctx context.Context, config *configType) (*driver, error) {
@@ -63,41 +69,44 @@ func newDriver(ctx context.Context, config *configType) (*driver, error) {
 		state:    state,
 		sysfsDir: sysfsDir,
 		client:   config.clientset,
+		recorder: helpers.NewEventRecorder(config.clientset, device.DriverName, config.nodeName),
 	}
 
-	registrarSocket := path.Join(config.kubeletPluginsRegistryDir, device.PluginRegistrarFileName)
-	pluginSocket := path.Join(config.kubeletPluginDir, device.PluginSocketFileName)
-	klog.Infof(`Starting DRA resource-driver kubelet-plugin
-RegistrarSocketPath: %v
-PluginSocketPath: %v
-KubeletPluginSocketPath: %v`,
-		registrarSocket,
-		pluginSocket,
-		pluginSocket)
-
-	plugin, err := kubeletplugin.Start(
-		ctx,
-		[]any{d},
-		kubeletplugin.KubeClient(config.clientset),
-		kubeletplugin.NodeName(config.nodeName),
-		kubeletplugin.DriverName(device.DriverName),
-		kubeletplugin.RegistrarSocketPath(registrarSocket),
-		kubeletplugin.PluginSocketPath(pluginSocket),
-		kubeletplugin.KubeletPluginSocketPath(pluginSocket),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to start kubelet-plugin: %v", err)
+	if config.auditLog != "" {
+		if d.audit, err = helpers.NewAuditLogger(config.auditLog, device.DriverName, config.nodeName); err != nil {
+			return nil, err
+		}
 	}
 
-	d.plugin = plugin
+	d.retrier = helpers.NewUnprepareRetrier(func(ctx context.Context, claim *drav1.Claim) error {
+		return d.state.FreeClaimDevices(claim.UID)
+	}, d.recorder)
 
-	resources := d.state.GetResources()
-	klog.FromContext(ctx).Info("Publishing resources", "len", len(resources.Devices))
-	klog.V(5).Infof("devices: %+v", resources.Devices)
-	if err := plugin.PublishResources(ctx, resources); err != nil {
-		return nil, fmt.Errorf("error publishing resources: %v", err)
+	if d.state.checkpointLost {
+		klog.Info("Prepared claims file was lost, recovering prepared claims")
+		if err := helpers.RecoverPreparedClaims(ctx, config.clientset, device.DriverName, config.nodeName, d.state.Prepare); err != nil {
+			klog.Errorf("could not recover prepared claims: %v", err)
+		}
 	}
 
+	d.reportMissingPreparedDevices(config.nodeName)
+	helpers.ReportCDIDrift(d.recorder, config.nodeName, d.state.CDIDrift(), config.cdiDriftEvents)
+	helpers.ReportNoDevices(d.recorder, config.nodeName, len(detectedDevices))
+
+	opts := helpers.PluginOptions{
+		DriverName:          device.DriverName,
+		NodeName:            config.nodeName,
+		Clientset:           config.clientset,
+		RegistrarSocketPath: path.Join(config.kubeletPluginsRegistryDir, device.PluginRegistrarFileName),
+		PluginSocketPath:    path.Join(config.kubeletPluginDir, device.PluginSocketFileName),
+	}
+
+	if d.plugin, err = helpers.StartPlugin(ctx, d, opts, d.state.GetResources()); err != nil {
+		return nil, err
+	}
+
+	go d.retrier.Run(ctx, helpers.UnprepareRetryInterval)
+
 	klog.V(3).Info("Finished creating new driver")
 	return d, nil
 }
@@ -109,6 +118,7 @@ func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepar
 
 	for _, claim := range req.Claims {
 		preparedResources.Claims[claim.UID] = d.nodePrepareResource(ctx, claim)
+		d.audit.LogPrepare(claim, preparedResources.Claims[claim.UID])
 	}
 
 	return preparedResources, nil
@@ -117,7 +127,7 @@ func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepar
 func (d *driver) nodePrepareResource(ctx context.Context, claim *drav1.Claim) *drav1.NodePrepareResourceResponse {
 	klog.V(5).Infof("NodePrepareResource is called: request: %+v", claim)
 
-	if claimPreparation, found := d.state.prepared[claim.UID]; found {
+	if claimPreparation, found := d.state.PreparedDevices(claim.UID); found {
 		klog.V(3).Infof("Claim %s was already prepared, nothing to do", claim.UID)
 		return &drav1.NodePrepareResourceResponse{
 			Devices: claimPreparation,
@@ -126,18 +136,27 @@ func (d *driver) nodePrepareResource(ctx context.Context, claim *drav1.Claim) *d
 
 	resourceClaim, err := d.client.ResourceV1beta1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
 	if err != nil {
-		return &drav1.NodePrepareResourceResponse{
-			Error: fmt.Sprintf("could not find ResourceClaim %s in namespace %s: %v", claim.Name, claim.Namespace, err),
-		}
+		return helpers.PrepareFailed(d.recorder, claim, fmt.Sprintf("could not find ResourceClaim %s in namespace %s: %v", claim.Name, claim.Namespace, err))
 	}
 
 	if err := d.state.Prepare(ctx, resourceClaim); err != nil {
-		return &drav1.NodePrepareResourceResponse{
-			Error: err.Error(),
-		}
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
 	}
 
-	return &drav1.NodePrepareResourceResponse{Devices: d.state.prepared[claim.UID]}
+	claimPreparation, _ := d.state.PreparedDevices(claim.UID)
+	return &drav1.NodePrepareResourceResponse{Devices: claimPreparation}
+}
+
+// reportMissingPreparedDevices records a Warning Event on the Node for every
+// checkpointed claim preparation referring to a device that is no longer present.
+func (d *driver) reportMissingPreparedDevices(nodeName string) {
+	for claimUID, deviceNames := range d.state.MissingPreparedDevices() {
+		for _, deviceName := range deviceNames {
+			klog.Warningf("prepared device %v of claim %v is no longer available", deviceName, claimUID)
+			d.recorder.Eventf(helpers.NodeReference(nodeName), corev1.EventTypeWarning, helpers.PreparedDeviceMissingReason,
+				"device %v prepared for claim %v is no longer available on node", deviceName, claimUID)
+		}
+	}
 }
 
 func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnprepareResourcesRequest) (*drav1.NodeUnprepareResourcesResponse, error) {
@@ -148,6 +167,7 @@ func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnpr
 
 	for _, claim := range req.Claims {
 		unpreparedResources.Claims[claim.UID] = d.nodeUnprepareResource(ctx, claim)
+		d.audit.LogUnprepare(claim, unpreparedResources.Claims[claim.UID])
 	}
 
 	return unpreparedResources, nil
@@ -158,8 +178,10 @@ func (d *driver) nodeUnprepareResource(ctx context.Context, claim *drav1.Claim)
 
 	err := d.state.FreeClaimDevices(claim.UID)
 	if err != nil {
+		d.retrier.Failed(claim, err)
 		return &drav1.NodeUnprepareResourceResponse{Error: fmt.Sprintf("error freeing devices: %v", err)}
 	}
+	d.retrier.Succeeded(claim.UID)
 
 	klog.V(3).Infof("Freed devices for claim '%v'", claim.UID)
 	return &drav1.NodeUnprepareResourceResponse{}
@@ -14,7 +14,7 @@
  * limitations under the License.
  */
 
-package main
+package plugin
 
 import (
 	"context"
@@ -30,7 +30,8 @@ import (
 	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
-	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/gaudi/device"
+	drahelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
 	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
 )
 
@@ -41,11 +42,11 @@ func TestFakeSysfs(t *testing.T) {
 		return
 	}
 
-	if err := fakesysfs.FakeSysFsGaudiContents(
+	if err := fakesysfs.FakeSysFsNpuContents(
 		testDirs.SysfsRoot,
 		testDirs.DevfsRoot,
 		device.DevicesInfo{
-			"0000-0f-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:0f:00.0", DeviceIdx: 0, UID: "0000-0f-00-0-0x1020"},
+			"0000-00-0b-0-0x7d1d": {Model: "0x7d1d", PCIAddress: "0000:00:0b.0", DeviceIdx: 0, UID: "0000-00-0b-0-0x7d1d"},
 		},
 		false,
 	); err != nil {
@@ -79,60 +80,60 @@ func TestNodePrepareResources(t *testing.T) {
 		claims                 []*resourcev1.ResourceClaim
 		request                *drav1.NodePrepareResourcesRequest
 		expectedResponse       *drav1.NodePrepareResourcesResponse
-		preparedClaims         ClaimPreparations
-		expectedPreparedClaims ClaimPreparations
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
 	}
 
 	testcases := []testCase{
 		{
-			name: "one Gaudi success",
+			name: "one NPU success",
 			claims: []*resourcev1.ResourceClaim{
-				helpers.NewClaim("default", "claim1", "uid1", "request1", "gaudi.intel.com", "node1", []string{"0000-00-02-0-0x1020"}),
+				helpers.NewClaim("default", "claim1", "uid1", "request1", "npu.intel.com", "node1", []string{"0000-00-02-0-0x7d1d"}),
 			},
 			request: &drav1.NodePrepareResourcesRequest{
 				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: "default"}},
 			},
 			expectedResponse: &drav1.NodePrepareResourcesResponse{
 				Claims: map[string]*drav1.NodePrepareResourceResponse{
-					"uid1": {Devices: []*drav1.Device{{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid1"}}}},
+					"uid1": {Devices: []*drav1.Device{{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}}},
 				},
 			},
 			preparedClaims: nil,
-			expectedPreparedClaims: ClaimPreparations{
-				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid1"}}},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}},
 			},
 		},
 		{
-			name: "single Gaudi, already prepared claim",
+			name: "single NPU, already prepared claim",
 			claims: []*resourcev1.ResourceClaim{
-				helpers.NewClaim("namespace2", "claim2", "uid2", "request2", "gaudi.intel.com", "node1", []string{"0000-00-02-0-0x1020"}),
+				helpers.NewClaim("namespace2", "claim2", "uid2", "request2", "npu.intel.com", "node1", []string{"0000-00-02-0-0x7d1d"}),
 			},
 			request: &drav1.NodePrepareResourcesRequest{
 				Claims: []*drav1.Claim{{Name: "claim2", Namespace: "namespace2", UID: "uid2"}},
 			},
 			expectedResponse: &drav1.NodePrepareResourcesResponse{
 				Claims: map[string]*drav1.NodePrepareResourceResponse{
-					"uid2": {Devices: []*drav1.Device{{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}}},
+					"uid2": {Devices: []*drav1.Device{{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}}},
 				},
 			},
-			preparedClaims: ClaimPreparations{
-				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}},
 			},
-			expectedPreparedClaims: ClaimPreparations{
-				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x1020", CDIDeviceIDs: []string{"intel.com/gaudi=0000-00-02-0-0x1020", "intel.com/gaudi=uid2"}}},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}},
 			},
 		},
 		{
 			name: "single unavailable device",
 			claims: []*resourcev1.ResourceClaim{
-				helpers.NewClaim("namespace3", "claim3", "uid3", "request3", "gaudi.intel.com", "node1", []string{"0000-00-05-0-0x1020"}),
+				helpers.NewClaim("namespace3", "claim3", "uid3", "request3", "npu.intel.com", "node1", []string{"0000-00-05-0-0x7d1d"}),
 			},
 			request: &drav1.NodePrepareResourcesRequest{
 				Claims: []*drav1.Claim{{Name: "claim3", Namespace: "namespace3", UID: "uid3"}},
 			},
 			expectedResponse: &drav1.NodePrepareResourcesResponse{
 				Claims: map[string]*drav1.NodePrepareResourceResponse{
-					"uid3": {Error: "could not find allocatable device 0000-00-05-0-0x1020 (pool node1)"},
+					"uid3": {Error: "could not find allocatable device 0000-00-05-0-0x7d1d (pool node1)"},
 				},
 			},
 		},
@@ -148,13 +149,13 @@ func TestNodePrepareResources(t *testing.T) {
 			return
 		}
 
-		if err := fakesysfs.FakeSysFsGaudiContents(
+		if err := fakesysfs.FakeSysFsNpuContents(
 			testDirs.SysfsRoot,
 			testDirs.DevfsRoot,
 			device.DevicesInfo{
-				"0000-00-02-0-0x1020": {Model: "0x1020", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x1020"},
-				"0000-00-03-0-0x1020": {Model: "0x1020", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x1020"},
-				"0000-00-04-0-0x1020": {Model: "0x1020", DeviceIdx: 2, PCIAddress: "0000:00:04.0", UID: "0000-00-04-0-0x1020"},
+				"0000-00-02-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x7d1d"},
+				"0000-00-03-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x7d1d"},
+				"0000-00-04-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 2, PCIAddress: "0000:00:04.0", UID: "0000-00-04-0-0x7d1d"},
 			},
 			false,
 		); err != nil {
@@ -163,7 +164,7 @@ func TestNodePrepareResources(t *testing.T) {
 		}
 
 		preparedClaimFilePath := path.Join(testDirs.KubeletPluginDir, "preparedClaims.json")
-		if err := writePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
 			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
 			continue
 		}
@@ -194,7 +195,7 @@ func TestNodePrepareResources(t *testing.T) {
 			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
 		}
 
-		preparedClaims, err := readPreparedClaimsFromFile(preparedClaimFilePath)
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
 		if err != nil {
 			t.Errorf("%v: error %v, expected no error", testcase.name, err)
 			continue
@@ -202,7 +203,7 @@ func TestNodePrepareResources(t *testing.T) {
 
 		expectedPreparedClaims := testcase.expectedPreparedClaims
 		if expectedPreparedClaims == nil {
-			expectedPreparedClaims = ClaimPreparations{}
+			expectedPreparedClaims = drahelpers.ClaimPreparations{}
 		}
 
 		if !reflect.DeepEqual(expectedPreparedClaims, preparedClaims) {
@@ -216,14 +217,13 @@ func TestNodePrepareResources(t *testing.T) {
 	}
 }
 
-/*
 func TestNodeUnprepareResources(t *testing.T) {
 	type testCase struct {
 		name                   string
 		request                *drav1.NodeUnprepareResourcesRequest
 		expectedResponse       *drav1.NodeUnprepareResourcesResponse
-		preparedClaims         ClaimPreparations
-		expectedPreparedClaims ClaimPreparations
+		preparedClaims         drahelpers.ClaimPreparations
+		expectedPreparedClaims drahelpers.ClaimPreparations
 	}
 
 	testcases := []testCase{
@@ -235,57 +235,38 @@ func TestNodeUnprepareResources(t *testing.T) {
 			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
 				Claims: map[string]*drav1.NodeUnprepareResourceResponse{},
 			},
-			preparedClaims:         ClaimPreparations{},
-			expectedPreparedClaims: ClaimPreparations{},
-		},
-		{
-			name: "single claim",
-			request: &drav1.NodeUnprepareResourcesRequest{
-				Claims: []*drav1.Claim{
-					{Name: "claim1", Namespace: "namespace1", Uid: "cuid1"},
-				},
-			},
-			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
-				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid1": {}},
-			},
-			preparedClaims: ClaimPreparations{
-				"cuid1": {{UID: "0000-b3-00-0-0x1020"}},
-			},
-			expectedPreparedClaims: ClaimPreparations{},
+			preparedClaims:         drahelpers.ClaimPreparations{},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{},
 		},
 		{
 			name: "subset of claims",
 			request: &drav1.NodeUnprepareResourcesRequest{
-				Claims: []*drav1.Claim{
-					{Name: "claim2", Namespace: "namespace2", Uid: "cuid2"},
-				},
+				Claims: []*drav1.Claim{{Name: "claim2", Namespace: "namespace2", UID: "uid2"}},
 			},
 			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
-				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid2": {}},
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"uid2": {}},
 			},
-			preparedClaims: ClaimPreparations{
-				"cuid1": {{UID: "0000-af-00-0-0x1020"}},
-				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}},
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-03-0-0x7d1d"}}},
 			},
-			expectedPreparedClaims: ClaimPreparations{
-				"cuid1": {{UID: "0000-af-00-0-0x1020", PCIAddress: "0000:af:00.0", DeviceIdx: 1, ModuleIdx: 1, Model: "0x1020"}},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid1": {{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}},
 			},
 		},
 		{
 			name: "non-existent claim success",
 			request: &drav1.NodeUnprepareResourcesRequest{
-				Claims: []*drav1.Claim{
-					{Name: "claim1", Namespace: "namespace1", Uid: "cuid1"},
-				},
+				Claims: []*drav1.Claim{{Name: "claim1", Namespace: "namespace1", UID: "uid1"}},
 			},
 			expectedResponse: &drav1.NodeUnprepareResourcesResponse{
-				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"cuid1": {}},
+				Claims: map[string]*drav1.NodeUnprepareResourceResponse{"uid1": {}},
 			},
-			preparedClaims: ClaimPreparations{
-				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			preparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-03-0-0x7d1d"}}},
 			},
-			expectedPreparedClaims: ClaimPreparations{
-				"cuid2": {{UID: "0000-b3-00-0-0x1020"}},
+			expectedPreparedClaims: drahelpers.ClaimPreparations{
+				"uid2": {{RequestNames: []string{"request2"}, PoolName: "node1", DeviceName: "0000-00-03-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-03-0-0x7d1d"}}},
 			},
 		},
 	}
@@ -293,28 +274,30 @@ func TestNodeUnprepareResources(t *testing.T) {
 	for _, testcase := range testcases {
 		t.Log(testcase.name)
 
-		testDirs, err := helpers.NewTestDirs()
+		testDirs, err := helpers.NewTestDirs(device.DriverName)
 		defer helpers.CleanupTest(t, testcase.name, testDirs.TestRoot)
 		if err != nil {
 			t.Errorf("%v: setup error: %v", testcase.name, err)
 			return
 		}
 
-		if err := fakesysfs.FakeSysFsGaudiContents(
+		if err := fakesysfs.FakeSysFsNpuContents(
 			testDirs.SysfsRoot,
 			testDirs.DevfsRoot,
 			device.DevicesInfo{
-				"0000-b3-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:b3:00.0", DeviceIdx: 0, UID: "0000-b3-00-0-0x1020"},
-				"0000-af-00-0-0x1020": {Model: "0x1020", PCIAddress: "0000:af:00.0", DeviceIdx: 1, UID: "0000-af-00-0-0x1020"},
+				"0000-00-02-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x7d1d"},
+				"0000-00-03-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x7d1d"},
 			},
+			false,
 		); err != nil {
 			t.Errorf("setup error: could not create fake sysfs: %v", err)
 			return
 		}
 
-		preparedClaimFilePath := path.Join(testDirs.DriverPluginRoot, device.PreparedClaimsFileName)
-		if err := writePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
+		preparedClaimFilePath := path.Join(testDirs.KubeletPluginDir, device.PreparedClaimsFileName)
+		if err := drahelpers.WritePreparedClaimsToFile(preparedClaimFilePath, testcase.preparedClaims); err != nil {
 			t.Errorf("%v: error %v, writing prepared claims to file", testcase.name, err)
+			continue
 		}
 
 		driver, driverErr := getFakeDriver(testDirs)
@@ -326,27 +309,26 @@ func TestNodeUnprepareResources(t *testing.T) {
 		response, err := driver.NodeUnprepareResources(context.TODO(), testcase.request)
 		if err != nil {
 			t.Errorf("%v: error %v, expected no error", testcase.name, err)
-		}
-
-		preparedClaims, err := readPreparedClaimsFromFile(preparedClaimFilePath)
-		if err != nil {
-			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
 		}
 
 		if !reflect.DeepEqual(response, testcase.expectedResponse) {
 			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, response, testcase.expectedResponse)
 		}
 
+		preparedClaims, err := drahelpers.ReadPreparedClaimsFromFile(preparedClaimFilePath)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
 		if !reflect.DeepEqual(testcase.expectedPreparedClaims, preparedClaims) {
 			preparedClaimsJSON, _ := json.MarshalIndent(preparedClaims, "", "\t")
 			expectedPreparedClaimsJSON, _ := json.MarshalIndent(testcase.expectedPreparedClaims, "", "\t")
 			t.Errorf(
-				"unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
-				preparedClaimsJSON, expectedPreparedClaimsJSON,
+				"%v: unexpected PreparedClaims:\n%s\nexpected PreparedClaims:\n%s",
+				testcase.name, string(preparedClaimsJSON), string(expectedPreparedClaimsJSON),
 			)
-			break
 		}
 	}
 }
-
-*/
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/klog/v2"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	cdihelpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/cdihelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+)
+
+type nodeState struct {
+	sync.Mutex
+	cdiCache               *cdiapi.Cache
+	allocatable            device.DevicesInfo
+	prepared               helpers.ClaimPreparations
+	preparedClaimsFilePath string
+	cdiDrift               helpers.CDIDrift
+	nodeName               string
+	checkpointLost         bool // prepared claims file was missing or corrupted
+}
+
+func newNodeState(ctx context.Context, detectedDevices map[string]*device.DeviceInfo, cdiRoot string, preparedClaimsFilePath string, nodeName string) (*nodeState, error) {
+	for ddev := range detectedDevices {
+		klog.V(3).Infof("new device: %+v", ddev)
+	}
+
+	cdiCache, err := helpers.NewCDICache(cdiRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Devices are in use when the plugin has written CDI specs before, so a
+	// missing prepared claims file is lost rather than new.
+	inUse := cdiregistry.NPU.HasDevices(cdiCache)
+
+	// syncDetectedDevicesWithRegistry overrides uid in detecteddevices from existing cdi spec
+	cdiDrift, err := cdihelpers.SyncDetectedDevicesWithRegistry(cdiCache, detectedDevices, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sync detected devices to CDI registry: %v", err)
+	}
+
+	klog.V(5).Info("Allocatable devices after CDI registry refresh:")
+	for duid, ddev := range detectedDevices {
+		klog.V(5).Infof("CDI device: %v : %+v", duid, ddev)
+	}
+
+	preparedClaims, checkpointLost, err := helpers.GetOrCreatePreparedClaims(preparedClaimsFilePath, inUse)
+	if err != nil {
+		klog.Errorf("Error getting prepared claims: %v", err)
+		return nil, fmt.Errorf("failed to get prepared claims: %v", err)
+	}
+
+	klog.V(5).Info("Creating NodeState")
+	state := &nodeState{
+		cdiCache:               cdiCache,
+		allocatable:            detectedDevices,
+		prepared:               preparedClaims,
+		cdiDrift:               cdiDrift,
+		preparedClaimsFilePath: preparedClaimsFilePath,
+		checkpointLost:         checkpointLost,
+		nodeName:               nodeName,
+	}
+
+	klog.V(5).Infof("Synced state with CDI and prepared claims: %+v", state)
+	for duid, ddev := range state.allocatable {
+		klog.V(5).Infof("Allocatable device: %v : %+v", duid, ddev)
+	}
+
+	return state, nil
+}
+
+// FreeClaimDevices cleans up prepared claims records and returns error if it was encountered, otherwise nil.
+func (s *nodeState) FreeClaimDevices(claimUID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.prepared[claimUID] == nil {
+		return nil
+	}
+
+	klog.V(5).Infof("Freeing devices from claim %v", claimUID)
+	claimDevices := s.prepared[claimUID]
+	delete(s.prepared, claimUID)
+
+	// write prepared claims to file, the claim stays prepared when it fails so
+	// that unprepare can be retried.
+	if err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared); err != nil {
+		s.prepared[claimUID] = claimDevices
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	return nil
+}
+
+func (s *nodeState) GetResources() kubeletplugin.Resources {
+	devices := []resourcev1.Device{}
+
+	for npuUID, npu := range s.allocatable {
+		tops := npu.TOPS()
+		newDevice := resourcev1.Device{
+			Name: npuUID,
+			Basic: &resourcev1.BasicDevice{
+				Attributes: map[resourcev1.QualifiedName]resourcev1.DeviceAttribute{
+					"model": {
+						StringValue: &npu.ModelName,
+					},
+					"tops": {
+						IntValue: &tops,
+					},
+				},
+			},
+		}
+
+		devices = append(devices, newDevice)
+	}
+
+	return kubeletplugin.Resources{Devices: devices}
+}
+
+func (s *nodeState) Prepare(ctx context.Context, claim *resourcev1.ResourceClaim) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if claim.Status.Allocation == nil {
+		return fmt.Errorf("no allocation found in claim %v/%v status", claim.Namespace, claim.Name)
+	}
+
+	allocatedDevices := []*drav1.Device{}
+
+	for _, allocatedDevice := range claim.Status.Allocation.Devices.Results {
+		// ATM the only pool is cluster node's pool: all devices on current node.
+		if allocatedDevice.Driver != device.DriverName || allocatedDevice.Pool != s.nodeName {
+			klog.FromContext(ctx).Info("ignoring claim allocation device", allocatedDevice)
+			continue
+		}
+
+		allocatableDevice, found := s.allocatable[allocatedDevice.Device]
+		if !found {
+			return fmt.Errorf("could not find allocatable device %v (pool %v)", allocatedDevice.Device, allocatedDevice.Pool)
+		}
+
+		newDevice := drav1.Device{
+			RequestNames: []string{allocatedDevice.Request},
+			PoolName:     allocatedDevice.Pool,
+			DeviceName:   allocatedDevice.Device,
+			CDIDeviceIDs: []string{allocatableDevice.CDIName()},
+		}
+		allocatedDevices = append(allocatedDevices, &newDevice)
+	}
+
+	claimUID := string(claim.UID)
+	previousDevices, wasPrepared := s.prepared[claimUID]
+	s.prepared[claimUID] = allocatedDevices
+
+	if err := helpers.WritePreparedClaimsToFile(s.preparedClaimsFilePath, s.prepared); err != nil {
+		klog.Errorf("Error writing prepared claims to file: %v", err)
+		if wasPrepared {
+			s.prepared[claimUID] = previousDevices
+		} else {
+			delete(s.prepared, claimUID)
+		}
+		return fmt.Errorf("failed to write prepared claims to file: %v", err)
+	}
+
+	klog.V(5).Infof("Created prepared claim %v allocation", claim.UID)
+	return nil
+}
+
+// PreparedDevices returns the devices prepared for the claim, and whether the
+// claim is prepared.
+func (s *nodeState) PreparedDevices(claimUID string) ([]*drav1.Device, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	claimDevices, found := s.prepared[claimUID]
+	return claimDevices, found
+}
+
+// MissingPreparedDevices returns the prepared devices that are not
+// allocatable, by the UID of the claim they are prepared for.
+func (s *nodeState) MissingPreparedDevices() map[string][]string {
+	s.Lock()
+	defer s.Unlock()
+
+	missing := map[string][]string{}
+	for claimUID, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			if _, found := s.allocatable[claimDevice.DeviceName]; !found {
+				missing[claimUID] = append(missing[claimUID], claimDevice.DeviceName)
+			}
+		}
+	}
+
+	return missing
+}
+
+// DeviceUsage returns every allocatable NPU device and whether it is taken
+// by a prepared claim.
+func (s *nodeState) DeviceUsage() []helpers.DeviceUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	preparedDevices := map[string]bool{}
+	for _, claimDevices := range s.prepared {
+		for _, claimDevice := range claimDevices {
+			preparedDevices[claimDevice.DeviceName] = true
+		}
+	}
+
+	usage := []helpers.DeviceUsage{}
+	for npuUID := range s.allocatable {
+		deviceUsage := helpers.DeviceUsage{Device: npuUID, Resource: "devices", Total: 1}
+		if preparedDevices[npuUID] {
+			deviceUsage.Allocated = 1
+		}
+		usage = append(usage, deviceUsage)
+	}
+
+	return usage
+}
+
+// CDIDrift returns CDI registry devices that were rewritten to match detected devices.
+func (s *nodeState) CDIDrift() helpers.CDIDrift {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cdiDrift
+}
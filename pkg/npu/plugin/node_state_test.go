@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/npu/device"
+)
+
+// TestPreparedClaimsWriteFailure checks that prepared claims are not changed
+// when they cannot be written to the prepared claims file.
+func TestPreparedClaimsWriteFailure(t *testing.T) {
+	preparedDevice := &drav1.Device{RequestNames: []string{"request1"}, PoolName: "node1", DeviceName: "0000-00-02-0-0x7d1d", CDIDeviceIDs: []string{"intel.com/npu=0000-00-02-0-0x7d1d"}}
+	state := &nodeState{
+		allocatable: device.DevicesInfo{
+			"0000-00-02-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 0, PCIAddress: "0000:00:02.0", UID: "0000-00-02-0-0x7d1d"},
+			"0000-00-03-0-0x7d1d": {Model: "0x7d1d", DeviceIdx: 1, PCIAddress: "0000:00:03.0", UID: "0000-00-03-0-0x7d1d"},
+		},
+		prepared:               helpers.ClaimPreparations{"uid1": {preparedDevice}},
+		preparedClaimsFilePath: path.Join(t.TempDir(), "missing", device.PreparedClaimsFileName),
+		nodeName:               "node1",
+	}
+	expectedPrepared := helpers.ClaimPreparations{"uid1": {preparedDevice}}
+
+	claim := &resourcev1.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "claim2", Namespace: "namespace2", UID: "uid2"},
+		Status: resourcev1.ResourceClaimStatus{
+			Allocation: &resourcev1.AllocationResult{
+				Devices: resourcev1.DeviceAllocationResult{
+					Results: []resourcev1.DeviceRequestAllocationResult{
+						{Request: "request2", Driver: device.DriverName, Pool: "node1", Device: "0000-00-03-0-0x7d1d"},
+					},
+				},
+			},
+		},
+	}
+
+	if err := state.Prepare(context.TODO(), claim); err == nil {
+		t.Errorf("preparing claim did not fail")
+	}
+	if !reflect.DeepEqual(state.prepared, expectedPrepared) {
+		t.Errorf("failed prepare changed prepared claims to %v", state.prepared)
+	}
+
+	if err := state.FreeClaimDevices("uid1"); err == nil {
+		t.Errorf("unpreparing claim did not fail")
+	}
+	if !reflect.DeepEqual(state.prepared, expectedPrepared) {
+		t.Errorf("failed unprepare changed prepared claims to %v", state.prepared)
+	}
+}
@@ -0,0 +1,435 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pci reads PCI devices, their SR-IOV VFs and driver bindings from sysfs.
+package pci
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DevicesPath = "bus/pci/devices"
+	DriversPath = "bus/pci/drivers"
+
+	// AddressLength is the length of a PCI address, e.g. 0000:00:02.0.
+	AddressLength = len("0000:00:00.0")
+
+	deviceIDFile       = "device"
+	totalVFsFile       = "sriov_totalvfs"
+	numVFsFile         = "sriov_numvfs"
+	driverOverrideFile = "driver_override"
+	physfnLink         = "physfn"
+	virtfnPrefix       = "virtfn"
+	driverLink         = "driver"
+	iommuGroupLink     = "iommu_group"
+	linkSpeedFile      = "current_link_speed"
+	linkWidthFile      = "current_link_width"
+	maxLinkSpeedFile   = "max_link_speed"
+	maxLinkWidthFile   = "max_link_width"
+	configFile         = "config"
+	numaNodeFile       = "numa_node"
+
+	// PCIe extended capabilities start after the 256 bytes of PCI compatible
+	// config space, every one begins with a header of capability ID, version
+	// and offset of the next capability.
+	extCapabilitiesOffset = 0x100
+	extCapabilityDSN      = 0x0003
+)
+
+// linkGenerations maps PCIe link speeds in MT/s to PCIe generations.
+var linkGenerations = map[uint64]uint64{
+	2500:  1,
+	5000:  2,
+	8000:  3,
+	16000: 4,
+	32000: 5,
+	64000: 6,
+}
+
+var AddressRegexp = regexp.MustCompile(`[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// FS is the part of the filesystem used for reading and writing sysfs, so that
+// unit tests can replace it.
+type FS interface {
+	ReadDir(name string) ([]os.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	Readlink(name string) (string, error)
+	EvalSymlinks(name string) (string, error)
+}
+
+type osFS struct{}
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) WriteFile(name string, data []byte) error   { return os.WriteFile(name, data, 0600) }
+func (osFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (osFS) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+
+// Sysfs accesses PCI devices of the sysfs mounted at Root.
+type Sysfs struct {
+	Root string
+	FS   FS
+}
+
+func NewSysfs(sysfsRoot string) *Sysfs {
+	return &Sysfs{Root: sysfsRoot, FS: osFS{}}
+}
+
+// DeviceDir returns the sysfs directory of the PCI device.
+func (s *Sysfs) DeviceDir(address string) string {
+	return path.Join(s.Root, DevicesPath, address)
+}
+
+// DriverDir returns the sysfs directory of the PCI kernel mode driver.
+func (s *Sysfs) DriverDir(driver string) string {
+	return path.Join(s.Root, DriversPath, driver)
+}
+
+// DriverDevices returns addresses of PCI devices bound to the driver. No devices
+// and no error are returned when the driver is not loaded.
+func (s *Sysfs) DriverDevices(driver string) ([]string, error) {
+	entries, err := s.FS.ReadDir(s.DriverDir(driver))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read sysfs directory %v: %v", s.DriverDir(driver), err)
+	}
+
+	addresses := []string{}
+	for _, entry := range entries {
+		if AddressRegexp.MatchString(entry.Name()) {
+			addresses = append(addresses, entry.Name())
+		}
+	}
+
+	return addresses, nil
+}
+
+// ReadFile returns the trimmed contents of the file in the device directory.
+func (s *Sysfs) ReadFile(deviceDir string, file string) (string, error) {
+	contents, err := s.FS.ReadFile(path.Join(deviceDir, file))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// WriteFile writes the value into the file in the device directory.
+func (s *Sysfs) WriteFile(deviceDir string, file string, value string) error {
+	return s.FS.WriteFile(path.Join(deviceDir, file), []byte(value))
+}
+
+// DeviceID returns the PCI device ID, e.g. 0x56c0.
+func (s *Sysfs) DeviceID(deviceDir string) (string, error) {
+	return s.ReadFile(deviceDir, deviceIDFile)
+}
+
+func (s *Sysfs) readUint(deviceDir string, file string) (uint64, error) {
+	value, err := s.ReadFile(deviceDir, file)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %v of %v: %v", file, deviceDir, err)
+	}
+
+	return number, nil
+}
+
+// TotalVFs returns the maximum number of SR-IOV VFs of the PF device.
+func (s *Sysfs) TotalVFs(deviceDir string) (uint64, error) {
+	return s.readUint(deviceDir, totalVFsFile)
+}
+
+// NumVFs returns the number of enabled SR-IOV VFs of the PF device.
+func (s *Sysfs) NumVFs(deviceDir string) (uint64, error) {
+	return s.readUint(deviceDir, numVFsFile)
+}
+
+// SetNumVFs enables the number of SR-IOV VFs of the PF device.
+func (s *Sysfs) SetNumVFs(deviceDir string, numvfs uint64) error {
+	return s.WriteFile(deviceDir, numVFsFile, strconv.FormatUint(numvfs, 10))
+}
+
+// PhysFn returns the address of the PF device of the VF device, and an error
+// when the device is not a VF.
+func (s *Sysfs) PhysFn(deviceDir string) (string, error) {
+	target, err := s.FS.Readlink(path.Join(deviceDir, physfnLink))
+	if err != nil {
+		return "", err
+	}
+
+	address := path.Base(target)
+	if !AddressRegexp.MatchString(address) {
+		return "", fmt.Errorf("unexpected %v symlink target %v", physfnLink, target)
+	}
+
+	return address, nil
+}
+
+// VFs returns addresses of the VF devices of the PF device by their VF index.
+// Symlinks not pointing to a PCI device are skipped.
+func (s *Sysfs) VFs(deviceDir string) (map[uint64]string, error) {
+	entries, err := s.FS.ReadDir(deviceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	vfs := map[uint64]string{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), virtfnPrefix) {
+			continue
+		}
+
+		vfIdx, err := strconv.ParseUint(strings.TrimPrefix(entry.Name(), virtfnPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		target, err := s.FS.Readlink(path.Join(deviceDir, entry.Name()))
+		if err != nil || !AddressRegexp.MatchString(path.Base(target)) {
+			continue
+		}
+
+		vfs[vfIdx] = path.Base(target)
+	}
+
+	return vfs, nil
+}
+
+// VFIndex returns the index of the VF device among VFs of the PF device.
+func (s *Sysfs) VFIndex(pfDeviceDir string, vfAddress string) (uint64, error) {
+	vfs, err := s.VFs(pfDeviceDir)
+	if err != nil {
+		return 0, err
+	}
+
+	for vfIdx, address := range vfs {
+		if address == vfAddress {
+			return vfIdx, nil
+		}
+	}
+
+	return 0, fmt.Errorf("could not find PF %v symlink to VF %v", path.Base(pfDeviceDir), vfAddress)
+}
+
+// Link is the PCIe link of the device. Speeds are in MT/s, e.g. 16000 for
+// 16.0 GT/s.
+type Link struct {
+	Speed    uint64
+	Width    uint64
+	MaxSpeed uint64
+	MaxWidth uint64
+}
+
+// Generation returns the PCIe generation of the current link speed, zero when
+// the speed is unknown.
+func (l Link) Generation() uint64 {
+	return linkGenerations[l.Speed]
+}
+
+// Link returns the current and maximum PCIe link speed and width of the device.
+func (s *Sysfs) Link(deviceDir string) (Link, error) {
+	var link Link
+	var err error
+
+	if link.Speed, err = s.readLinkSpeed(deviceDir, linkSpeedFile); err != nil {
+		return Link{}, err
+	}
+	if link.MaxSpeed, err = s.readLinkSpeed(deviceDir, maxLinkSpeedFile); err != nil {
+		return Link{}, err
+	}
+	if link.Width, err = s.readUint(deviceDir, linkWidthFile); err != nil {
+		return Link{}, err
+	}
+	if link.MaxWidth, err = s.readUint(deviceDir, maxLinkWidthFile); err != nil {
+		return Link{}, err
+	}
+
+	return link, nil
+}
+
+// readLinkSpeed returns link speed in MT/s from the file, e.g. "16.0 GT/s PCIe"
+// is 16000. Speed "Unknown" is zero.
+func (s *Sysfs) readLinkSpeed(deviceDir string, file string) (uint64, error) {
+	value, err := s.ReadFile(deviceDir, file)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[1] != "GT/s" {
+		return 0, nil
+	}
+
+	speed, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %v of %v: %v", file, deviceDir, err)
+	}
+
+	return uint64(speed*1000 + 0.5), nil
+}
+
+// SerialNumber returns the PCIe Device Serial Number of the device as 16 hex
+// digits. Reading the extended config space requires CAP_SYS_ADMIN.
+func (s *Sysfs) SerialNumber(deviceDir string) (string, error) {
+	config, err := s.FS.ReadFile(path.Join(deviceDir, configFile))
+	if err != nil {
+		return "", err
+	}
+
+	offset := extCapabilitiesOffset
+	for visited := 0; offset >= extCapabilitiesOffset && offset+4 <= len(config) && visited < 64; visited++ {
+		header := binary.LittleEndian.Uint32(config[offset:])
+		if header == 0 || header == 0xffffffff {
+			break
+		}
+
+		if header&0xffff == extCapabilityDSN {
+			if offset+12 > len(config) {
+				break
+			}
+			lower := binary.LittleEndian.Uint32(config[offset+4:])
+			upper := binary.LittleEndian.Uint32(config[offset+8:])
+			return fmt.Sprintf("%08x%08x", upper, lower), nil
+		}
+
+		offset = int(header >> 20)
+	}
+
+	return "", fmt.Errorf("no device serial number capability in config of %v", path.Base(deviceDir))
+}
+
+// NUMANode returns the NUMA node of the device, -1 when the platform does not
+// report it.
+func (s *Sysfs) NUMANode(deviceDir string) (int64, error) {
+	value, err := s.ReadFile(deviceDir, numaNodeFile)
+	if err != nil {
+		return -1, err
+	}
+
+	numaNode, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("could not parse %v of %v: %v", numaNodeFile, deviceDir, err)
+	}
+
+	return numaNode, nil
+}
+
+// PCIRoot returns the ID of the PCI root complex the device is under, e.g.
+// 0000:16/0000:16:02.0/0000:17:00.0 is under root complex 16.
+func (s *Sysfs) PCIRoot(deviceDir string) (string, error) {
+	// e.g. /sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/0000:18:00.0/0000:19:00.0
+	target, err := s.FS.EvalSymlinks(deviceDir)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(target, s.Root), "/")
+	for i, part := range parts {
+		if part == "devices" && i+1 < len(parts) && strings.HasPrefix(parts[i+1], "pci0000:") {
+			return strings.TrimPrefix(parts[i+1], "pci0000:"), nil
+		}
+	}
+
+	return "", fmt.Errorf("could not parse PCI root complex from sysfs path %v", target)
+}
+
+// Driver returns the name of the driver the device is bound to.
+func (s *Sysfs) Driver(address string) (string, error) {
+	target, err := s.FS.EvalSymlinks(path.Join(s.DeviceDir(address), driverLink))
+	if err != nil {
+		return "", err
+	}
+
+	return path.Base(target), nil
+}
+
+// IOMMUGroup returns the IOMMU group of the device.
+func (s *Sysfs) IOMMUGroup(address string) (string, error) {
+	target, err := s.FS.EvalSymlinks(path.Join(s.DeviceDir(address), iommuGroupLink))
+	if err != nil {
+		return "", err
+	}
+
+	return path.Base(target), nil
+}
+
+// Unbind unbinds the device from the driver. A device that was not bound to the
+// driver is not an error.
+func (s *Sysfs) Unbind(address string, driver string) error {
+	err := s.WriteFile(s.DriverDir(driver), "unbind", address)
+
+	// fs.PathError is returned if the device was not bound
+	if _, ispatherror := err.(*os.PathError); ispatherror {
+		return nil
+	}
+
+	return err
+}
+
+// Bind binds the device to the driver.
+func (s *Sysfs) Bind(address string, driver string) error {
+	return s.WriteFile(s.DriverDir(driver), "bind", address)
+}
+
+// OverrideDriver binds the device to the driver, also when the driver does not
+// list the device ID, e.g. VFs of QAT and DLB devices to vfio-pci.
+func (s *Sysfs) OverrideDriver(address string, driver string) error {
+	if err := s.WriteFile(s.DeviceDir(address), driverOverrideFile, driver); err != nil {
+		return err
+	}
+
+	if err := s.Unbind(address, driver); err != nil {
+		return err
+	}
+
+	return s.Bind(address, driver)
+}
+
+// RFC1123Address returns the PCI address with colons and the dot replaced with
+// hyphens, e.g. 0000:00:01.0 -> 0000-00-01-0.
+func RFC1123Address(address string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(address, ":", "-"), ".", "-")
+}
+
+// DeviceUID returns the UID of the PCI device, e.g. 0000:00:01.0, 0x0000 -> 0000-00-01-0-0x0000.
+func DeviceUID(address string, deviceID string) string {
+	return fmt.Sprintf("%v-%v", RFC1123Address(address), deviceID)
+}
+
+// ParseDeviceUID returns the PCI address and device ID of the UID, e.g.
+// 0000-00-01-0-0x0000 -> 0000:00:01.0, 0x0000.
+func ParseDeviceUID(deviceUID string) (string, string) {
+	rfc1123Address := deviceUID[:AddressLength]
+	address := strings.Replace(strings.Replace(rfc1123Address, "-", ":", 2), "-", ".", 1)
+	deviceID := deviceUID[AddressLength+1:]
+
+	return address, deviceID
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pci
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeFS is an in-memory FS with files and symlinks, directories are implied by their contents.
+type fakeFS struct {
+	files map[string]string
+	links map[string]string
+}
+
+type fakeDirEntry string
+
+func (e fakeDirEntry) Name() string               { return string(e) }
+func (e fakeDirEntry) IsDir() bool                { return false }
+func (e fakeDirEntry) Type() fs.FileMode          { return fs.ModeSymlink }
+func (e fakeDirEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrInvalid }
+
+// resolve follows symlinks in the directories of the path, and in the last
+// element of the path too when followLast is set.
+func (f *fakeFS) resolve(name string, followLast bool) string {
+	for resolved := false; !resolved; {
+		resolved = true
+		for link, target := range f.links {
+			if strings.HasPrefix(name, link+"/") || (followLast && name == link) {
+				name = path.Join(path.Dir(link), target) + strings.TrimPrefix(name, link)
+				resolved = false
+			}
+		}
+	}
+	return name
+}
+
+func (f *fakeFS) ReadDir(name string) ([]os.DirEntry, error) {
+	name = f.resolve(name, true)
+	names := map[string]bool{}
+	for _, entries := range []map[string]string{f.files, f.links} {
+		for entry := range entries {
+			if path.Dir(entry) == name {
+				names[path.Base(entry)] = true
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := []os.DirEntry{}
+	for entry := range names {
+		entries = append(entries, fakeDirEntry(entry))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+func (f *fakeFS) ReadFile(name string) ([]byte, error) {
+	contents, found := f.files[f.resolve(name, true)]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(contents), nil
+}
+
+func (f *fakeFS) WriteFile(name string, data []byte) error {
+	name = f.resolve(name, true)
+	if _, found := f.files[name]; !found {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f.files[name] = string(data)
+	return nil
+}
+
+func (f *fakeFS) Readlink(name string) (string, error) {
+	target, found := f.links[f.resolve(name, false)]
+	if !found {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return target, nil
+}
+
+func (f *fakeFS) EvalSymlinks(name string) (string, error) {
+	return f.resolve(name, true), nil
+}
+
+func newFakeSysfs() *Sysfs {
+	return &Sysfs{
+		Root: "/sys",
+		FS: &fakeFS{
+			files: map[string]string{
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/device":             "0x1020\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/sriov_totalvfs":     "2\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/sriov_numvfs":       "0\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/current_link_speed": "8.0 GT/s PCIe\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/current_link_width": "8\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/max_link_speed":     "16.0 GT/s PCIe\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/max_link_width":     "16\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/numa_node":          "1\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/numa_node":          "-1\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/current_link_speed": "Unknown\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/current_link_width": "0\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/max_link_speed":     "Unknown\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/max_link_width":     "0\n",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/driver_override":    "\n",
+				"/sys/bus/pci/drivers/vfio-pci/bind":                                   "",
+			},
+			links: map[string]string{
+				"/sys/bus/pci/devices/0000:17:00.0":                             "../../../devices/pci0000:16/0000:16:02.0/0000:17:00.0",
+				"/sys/bus/pci/devices/0000:17:00.1":                             "../../../devices/pci0000:16/0000:16:02.0/0000:17:00.1",
+				"/sys/bus/pci/drivers/4xxx/0000:17:00.0":                        "../../../../devices/pci0000:16/0000:16:02.0/0000:17:00.0",
+				"/sys/bus/pci/drivers/4xxx/module":                              "../../../../module/qat_4xxx",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/virtfn0":     "../0000:17:00.1",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/virtfn1":     "../ffff:ff:1f.x",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/physfn":      "../0000:17:00.0",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/driver":      "../../../../bus/pci/drivers/vfio-pci",
+				"/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/iommu_group": "../../../../kernel/iommu_groups/401",
+			},
+		},
+	}
+}
+
+func TestDriverDevices(t *testing.T) {
+	sysfs := newFakeSysfs()
+
+	addresses, err := sysfs.DriverDevices("4xxx")
+	if err != nil || !reflect.DeepEqual(addresses, []string{"0000:17:00.0"}) {
+		t.Errorf("unexpected 4xxx devices %v, error: %v", addresses, err)
+	}
+
+	addresses, err = sysfs.DriverDevices("i915")
+	if err != nil || len(addresses) != 0 {
+		t.Errorf("expected no devices for driver that is not loaded, got %v, error: %v", addresses, err)
+	}
+}
+
+func TestDeviceFiles(t *testing.T) {
+	sysfs := newFakeSysfs()
+	pfDir := sysfs.DeviceDir("0000:17:00.0")
+
+	if deviceID, err := sysfs.DeviceID(pfDir); err != nil || deviceID != "0x1020" {
+		t.Errorf("unexpected device ID %v, error: %v", deviceID, err)
+	}
+
+	if totalvfs, err := sysfs.TotalVFs(pfDir); err != nil || totalvfs != 2 {
+		t.Errorf("unexpected total VFs %v, error: %v", totalvfs, err)
+	}
+
+	if err := sysfs.SetNumVFs(pfDir, 1); err != nil {
+		t.Errorf("could not set number of VFs: %v", err)
+	}
+	if numvfs, err := sysfs.NumVFs(pfDir); err != nil || numvfs != 1 {
+		t.Errorf("unexpected number of VFs %v, error: %v", numvfs, err)
+	}
+
+	if pciRoot, err := sysfs.PCIRoot(pfDir); err != nil || pciRoot != "16" {
+		t.Errorf("unexpected PCI root %v, error: %v", pciRoot, err)
+	}
+
+	if numaNode, err := sysfs.NUMANode(pfDir); err != nil || numaNode != 1 {
+		t.Errorf("unexpected NUMA node %v, error: %v", numaNode, err)
+	}
+	if numaNode, err := sysfs.NUMANode(sysfs.DeviceDir("0000:17:00.1")); err != nil || numaNode != -1 {
+		t.Errorf("unexpected NUMA node of device without NUMA affinity %v, error: %v", numaNode, err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	sysfs := newFakeSysfs()
+
+	link, err := sysfs.Link(sysfs.DeviceDir("0000:17:00.0"))
+	if err != nil || link != (Link{Speed: 8000, Width: 8, MaxSpeed: 16000, MaxWidth: 16}) {
+		t.Errorf("unexpected PF link %+v, error: %v", link, err)
+	}
+	if link.Generation() != 3 {
+		t.Errorf("expected PCIe generation 3, got %v", link.Generation())
+	}
+
+	link, err = sysfs.Link(sysfs.DeviceDir("0000:17:00.1"))
+	if err != nil || link != (Link{}) || link.Generation() != 0 {
+		t.Errorf("expected unknown VF link, got %+v, error: %v", link, err)
+	}
+
+	if _, err := sysfs.Link("/sys/bus/pci/devices/0000:18:00.0"); err == nil {
+		t.Errorf("expected error for nonexistent device")
+	}
+}
+
+func TestSerialNumber(t *testing.T) {
+	sysfs := newFakeSysfs()
+	fakefs := sysfs.FS.(*fakeFS)
+
+	config := make([]byte, 4096)
+	// AER capability with next capability at 0x140, then DSN
+	binary.LittleEndian.PutUint32(config[0x100:], 0x0001|2<<16|0x140<<20)
+	binary.LittleEndian.PutUint32(config[0x140:], 0x0003|1<<16)
+	binary.LittleEndian.PutUint32(config[0x144:], 0x89abcdef)
+	binary.LittleEndian.PutUint32(config[0x148:], 0x01234567)
+	fakefs.files["/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.0/config"] = string(config)
+	// without CAP_SYS_ADMIN only 64 bytes are readable
+	fakefs.files["/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/config"] = string(config[:64])
+
+	if serial, err := sysfs.SerialNumber(sysfs.DeviceDir("0000:17:00.0")); err != nil || serial != "0123456789abcdef" {
+		t.Errorf("unexpected serial number %v, error: %v", serial, err)
+	}
+
+	if serial, err := sysfs.SerialNumber(sysfs.DeviceDir("0000:17:00.1")); err == nil {
+		t.Errorf("expected error for short config, got serial number %v", serial)
+	}
+}
+
+func TestSRIOV(t *testing.T) {
+	sysfs := newFakeSysfs()
+	pfDir := sysfs.DeviceDir("0000:17:00.0")
+
+	vfs, err := sysfs.VFs(pfDir)
+	if err != nil || !reflect.DeepEqual(vfs, map[uint64]string{0: "0000:17:00.1"}) {
+		t.Errorf("unexpected VFs %v, error: %v", vfs, err)
+	}
+
+	if vfIdx, err := sysfs.VFIndex(pfDir, "0000:17:00.1"); err != nil || vfIdx != 0 {
+		t.Errorf("unexpected VF index %v, error: %v", vfIdx, err)
+	}
+
+	if _, err := sysfs.VFIndex(pfDir, "0000:17:00.2"); err == nil {
+		t.Errorf("expected error for device that is not a VF of the PF")
+	}
+
+	if pf, err := sysfs.PhysFn(sysfs.DeviceDir("0000:17:00.1")); err != nil || pf != "0000:17:00.0" {
+		t.Errorf("unexpected PF %v, error: %v", pf, err)
+	}
+
+	if _, err := sysfs.PhysFn(pfDir); err == nil {
+		t.Errorf("expected error for PF device")
+	}
+}
+
+func TestDriverBinding(t *testing.T) {
+	sysfs := newFakeSysfs()
+	fakefs := sysfs.FS.(*fakeFS)
+
+	if driver, err := sysfs.Driver("0000:17:00.1"); err != nil || driver != "vfio-pci" {
+		t.Errorf("unexpected driver %v, error: %v", driver, err)
+	}
+
+	if iommu, err := sysfs.IOMMUGroup("0000:17:00.1"); err != nil || iommu != "401" {
+		t.Errorf("unexpected IOMMU group %v, error: %v", iommu, err)
+	}
+
+	// vfio-pci/unbind does not exist, as if the device was not bound
+	if err := sysfs.OverrideDriver("0000:17:00.1", "vfio-pci"); err != nil {
+		t.Fatalf("could not override driver: %v", err)
+	}
+
+	if override := fakefs.files["/sys/devices/pci0000:16/0000:16:02.0/0000:17:00.1/driver_override"]; override != "vfio-pci" {
+		t.Errorf("unexpected driver_override %q", override)
+	}
+
+	if bound := fakefs.files["/sys/bus/pci/drivers/vfio-pci/bind"]; bound != "0000:17:00.1" {
+		t.Errorf("unexpected device written to bind %q", bound)
+	}
+}
+
+func TestDeviceUID(t *testing.T) {
+	uid := DeviceUID("0000:03:00.1", "0x56c0")
+	if uid != "0000-03-00-1-0x56c0" {
+		t.Errorf("unexpected UID %v", uid)
+	}
+
+	address, deviceID := ParseDeviceUID(uid)
+	if address != "0000:03:00.1" || deviceID != "0x56c0" {
+		t.Errorf("unexpected PCI address %v and device ID %v", address, deviceID)
+	}
+}
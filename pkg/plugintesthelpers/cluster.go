@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugintesthelpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/cel"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/structured"
+)
+
+const celCacheSize = 10
+
+// FakeCluster is an in-process stand-in for a cluster with DRA enabled: a fake
+// API server holding Nodes, DeviceClasses, ResourceSlices and ResourceClaims,
+// and a scheduler allocating claims from the published ResourceSlices with the
+// same structured parameters allocator kube-scheduler uses. Kubelet plugins
+// under test are given Clientset, and the test calls their DRA services the
+// way kubelet would once a claim is allocated.
+type FakeCluster struct {
+	Clientset *kubefake.Clientset
+	Nodes     []string
+	celCache  *cel.Cache
+}
+
+// NewFakeCluster returns a FakeCluster with the given nodes.
+func NewFakeCluster(nodeNames ...string) (*FakeCluster, error) {
+	clientset := kubefake.NewSimpleClientset()
+	for _, nodeName := range nodeNames {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName, Labels: map[string]string{"kubernetes.io/hostname": nodeName}}}
+		if _, err := clientset.CoreV1().Nodes().Create(context.TODO(), node, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed creating node %v: %v", nodeName, err)
+		}
+	}
+
+	return &FakeCluster{
+		Clientset: clientset,
+		Nodes:     nodeNames,
+		celCache:  cel.NewCache(celCacheSize),
+	}, nil
+}
+
+// InstallDeviceClasses creates the DeviceClasses in the given manifest, e.g.
+// deployments/<driver>/device-class.yaml. Other objects are skipped.
+func (c *FakeCluster) InstallDeviceClasses(ctx context.Context, manifest string) error {
+	file, err := os.Open(manifest)
+	if err != nil {
+		return fmt.Errorf("failed opening manifest: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		class := &resourcev1.DeviceClass{}
+		if err := decoder.Decode(class); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed parsing %v: %v", manifest, err)
+		}
+		if class.Kind != "DeviceClass" {
+			continue
+		}
+		if _, err := c.Clientset.ResourceV1beta1().DeviceClasses().Create(ctx, class, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed creating DeviceClass %v: %v", class.Name, err)
+		}
+	}
+}
+
+// PublishResources replaces the ResourceSlices of the driver on the node with
+// the given devices, like the ResourceSlice controller of a kubelet plugin.
+func (c *FakeCluster) PublishResources(ctx context.Context, driverName string, nodeName string, resources kubeletplugin.Resources) error {
+	sliceClient := c.Clientset.ResourceV1beta1().ResourceSlices()
+	sliceList, err := sliceClient.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed listing ResourceSlices: %v", err)
+	}
+
+	generation := int64(1)
+	for _, slice := range sliceList.Items {
+		if slice.Spec.Driver != driverName || slice.Spec.NodeName != nodeName {
+			continue
+		}
+		generation = max(generation, slice.Spec.Pool.Generation+1)
+		if err := sliceClient.Delete(ctx, slice.Name, metav1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("failed deleting ResourceSlice %v: %v", slice.Name, err)
+		}
+	}
+
+	chunks := slices.Collect(slices.Chunk(resources.Devices, resourcev1.ResourceSliceMaxDevices))
+	if len(chunks) == 0 {
+		chunks = [][]resourcev1.Device{{}}
+	}
+	for i, devices := range chunks {
+		slice := &resourcev1.ResourceSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%v-%v-%d", nodeName, strings.ReplaceAll(driverName, ".", "-"), i)},
+			Spec: resourcev1.ResourceSliceSpec{
+				Driver:   driverName,
+				NodeName: nodeName,
+				Pool: resourcev1.ResourcePool{
+					Name:               nodeName,
+					Generation:         generation,
+					ResourceSliceCount: int64(len(chunks)),
+				},
+				Devices: devices,
+			},
+		}
+		if _, err := sliceClient.Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed creating ResourceSlice %v: %v", slice.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Allocate allocates the devices for the claim on the first node they fit on,
+// skipping the devices already allocated to other claims, and stores the
+// allocation in the claim status. It returns the allocated claim and the node.
+func (c *FakeCluster) Allocate(ctx context.Context, namespace string, name string) (*resourcev1.ResourceClaim, string, error) {
+	claim, err := c.Clientset.ResourceV1beta1().ResourceClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed getting claim: %v", err)
+	}
+	if claim.Status.Allocation != nil {
+		return nil, "", fmt.Errorf("claim %v/%v is already allocated", namespace, name)
+	}
+
+	allocated, err := c.allocatedDevices(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sliceList, err := c.Clientset.ResourceV1beta1().ResourceSlices().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed listing ResourceSlices: %v", err)
+	}
+	resourceSlices := []*resourcev1.ResourceSlice{}
+	for i := range sliceList.Items {
+		resourceSlices = append(resourceSlices, &sliceList.Items[i])
+	}
+
+	for _, nodeName := range c.Nodes {
+		node, err := c.Clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed getting node %v: %v", nodeName, err)
+		}
+
+		allocator, err := structured.NewAllocator(ctx, false, []*resourcev1.ResourceClaim{claim}, allocated, &deviceClassLister{c.Clientset}, resourceSlices, c.celCache)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed creating allocator: %v", err)
+		}
+		results, err := allocator.Allocate(ctx, node)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed allocating claim %v/%v on node %v: %v", namespace, name, nodeName, err)
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		claim.Status.Allocation = &results[0]
+		claim, err = c.Clientset.ResourceV1beta1().ResourceClaims(namespace).UpdateStatus(ctx, claim, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed updating claim status: %v", err)
+		}
+		return claim, nodeName, nil
+	}
+
+	return nil, "", fmt.Errorf("claim %v/%v does not fit on any node", namespace, name)
+}
+
+// Deallocate clears the allocation of the claim, so that its devices can be
+// allocated to other claims.
+func (c *FakeCluster) Deallocate(ctx context.Context, namespace string, name string) error {
+	claim, err := c.Clientset.ResourceV1beta1().ResourceClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed getting claim: %v", err)
+	}
+
+	claim.Status.Allocation = nil
+	if _, err := c.Clientset.ResourceV1beta1().ResourceClaims(namespace).UpdateStatus(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed updating claim status: %v", err)
+	}
+
+	return nil
+}
+
+func (c *FakeCluster) allocatedDevices(ctx context.Context) (sets.Set[structured.DeviceID], error) {
+	claimList, err := c.Clientset.ResourceV1beta1().ResourceClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing claims: %v", err)
+	}
+
+	allocated := sets.New[structured.DeviceID]()
+	for _, claim := range claimList.Items {
+		if claim.Status.Allocation == nil {
+			continue
+		}
+		for _, result := range claim.Status.Allocation.Devices.Results {
+			allocated.Insert(structured.MakeDeviceID(result.Driver, result.Pool, result.Device))
+		}
+	}
+
+	return allocated, nil
+}
+
+// deviceClassLister serves DeviceClasses to the allocator from the fake API server.
+type deviceClassLister struct {
+	clientset *kubefake.Clientset
+}
+
+func (l *deviceClassLister) List() ([]*resourcev1.DeviceClass, error) {
+	classList, err := l.clientset.ResourceV1beta1().DeviceClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	classes := []*resourcev1.DeviceClass{}
+	for i := range classList.Items {
+		classes = append(classes, &classList.Items[i])
+	}
+	return classes, nil
+}
+
+func (l *deviceClassLister) Get(className string) (*resourcev1.DeviceClass, error) {
+	return l.clientset.ResourceV1beta1().DeviceClasses().Get(context.TODO(), className, metav1.GetOptions{})
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugintesthelpers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	registerapi "k8s.io/kubelet/pkg/apis/pluginregistration/v1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+)
+
+// FakeDRAPlugin stands in for the kubelet plugin of a driver under test. It
+// records what the driver publishes, and calls the DRA service of the driver
+// like kubelet would, without kubelet or gRPC sockets. Start is used in place
+// of helpers.StartPlugin.
+type FakeDRAPlugin struct {
+	// The embedded interface is nil, it only implements the unexported
+	// method of kubeletplugin.DRAPlugin.
+	kubeletplugin.DRAPlugin
+
+	// PublishErr is returned by PublishResources when set.
+	PublishErr error
+
+	mutex     sync.Mutex
+	server    drav1.DRAPluginServer
+	options   helpers.PluginOptions
+	published []kubeletplugin.Resources
+	stopped   bool
+}
+
+var _ helpers.StartPluginFunc = (&FakeDRAPlugin{}).Start
+
+// Start records the DRA service of the driver and the plugin options, and
+// publishes the initial resources.
+func (p *FakeDRAPlugin) Start(ctx context.Context, server drav1.DRAPluginServer, opts helpers.PluginOptions, resources kubeletplugin.Resources) (kubeletplugin.DRAPlugin, error) {
+	p.mutex.Lock()
+	p.server = server
+	p.options = opts
+	p.mutex.Unlock()
+
+	if err := p.PublishResources(ctx, resources); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FakeDRAPlugin) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.stopped = true
+}
+
+// RegistrationStatus reports the plugin as registered once it is started.
+func (p *FakeDRAPlugin) RegistrationStatus() *registerapi.RegistrationStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.server == nil {
+		return nil
+	}
+	return &registerapi.RegistrationStatus{PluginRegistered: true}
+}
+
+func (p *FakeDRAPlugin) PublishResources(ctx context.Context, resources kubeletplugin.Resources) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.PublishErr != nil {
+		return p.PublishErr
+	}
+	p.published = append(p.published, resources)
+	return nil
+}
+
+// Options returns the options the plugin was started with.
+func (p *FakeDRAPlugin) Options() helpers.PluginOptions {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.options
+}
+
+// Stopped tells whether the driver stopped the plugin.
+func (p *FakeDRAPlugin) Stopped() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.stopped
+}
+
+// Published returns the resources of every PublishResources call so far.
+func (p *FakeDRAPlugin) Published() []kubeletplugin.Resources {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]kubeletplugin.Resources{}, p.published...)
+}
+
+// PublishedDevices returns the names of the devices published last.
+func (p *FakeDRAPlugin) PublishedDevices() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := []string{}
+	if len(p.published) == 0 {
+		return names
+	}
+	for _, device := range p.published[len(p.published)-1].Devices {
+		names = append(names, device.Name)
+	}
+	return names
+}
+
+// Prepare calls NodePrepareResources of the driver for the claims.
+func (p *FakeDRAPlugin) Prepare(ctx context.Context, claims ...*resourcev1.ResourceClaim) (*drav1.NodePrepareResourcesResponse, error) {
+	server, err := p.startedServer()
+	if err != nil {
+		return nil, err
+	}
+	return server.NodePrepareResources(ctx, &drav1.NodePrepareResourcesRequest{Claims: draClaims(claims)})
+}
+
+// Unprepare calls NodeUnprepareResources of the driver for the claims.
+func (p *FakeDRAPlugin) Unprepare(ctx context.Context, claims ...*resourcev1.ResourceClaim) (*drav1.NodeUnprepareResourcesResponse, error) {
+	server, err := p.startedServer()
+	if err != nil {
+		return nil, err
+	}
+	return server.NodeUnprepareResources(ctx, &drav1.NodeUnprepareResourcesRequest{Claims: draClaims(claims)})
+}
+
+func (p *FakeDRAPlugin) startedServer() (drav1.DRAPluginServer, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.server == nil {
+		return nil, errors.New("plugin has not been started")
+	}
+	if p.stopped {
+		return nil, errors.New("plugin has been stopped")
+	}
+	return p.server, nil
+}
+
+// draClaims returns the claims as kubelet passes them to DRA drivers.
+func draClaims(claims []*resourcev1.ResourceClaim) []*drav1.Claim {
+	draClaims := []*drav1.Claim{}
+	for _, claim := range claims {
+		draClaims = append(draClaims, &drav1.Claim{Namespace: claim.Namespace, UID: string(claim.UID), Name: claim.Name})
+	}
+	return draClaims
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugintesthelpers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+	specs "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// UpdateGoldenEnvVarName makes CompareGolden rewrite the golden files
+	// with the actual output when set, e.g. UPDATE_GOLDEN=1 go test ./pkg/...
+	UpdateGoldenEnvVarName = "UPDATE_GOLDEN"
+
+	// GoldenTestRoot replaces the test root dir in golden output, so that it
+	// does not depend on the temporary dir of the test run.
+	GoldenTestRoot = "/TESTROOT"
+)
+
+// CompareGolden fails the test when actual differs from the contents of the
+// golden file. With UPDATE_GOLDEN set, the golden file is written instead, and
+// the changes show up in the diff of the commit for review.
+func CompareGolden(t *testing.T, goldenPath string, actual []byte) {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnvVarName) != "" {
+		if err := os.MkdirAll(path.Dir(goldenPath), 0755); err != nil {
+			t.Fatalf("could not create golden file dir: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatalf("could not write golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("could not read golden file, run with %v=1 to create it: %v", UpdateGoldenEnvVarName, err)
+	}
+
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output differs from golden file %v, run with %v=1 to update it:\n%v",
+			goldenPath, UpdateGoldenEnvVarName, lineDiff(string(expected), string(actual)))
+	}
+}
+
+// GoldenCDISpecs returns the CDI specs in cdiDir as one YAML document per spec
+// file, in file name order, each preceded by the file name. Devices and their
+// mounts are sorted, and testRoot is replaced by GoldenTestRoot, so that the
+// output only changes when the generated specs do.
+func GoldenCDISpecs(cdiDir string, testRoot string) ([]byte, error) {
+	specFiles, err := filepath.Glob(path.Join(cdiDir, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing CDI specs: %v", err)
+	}
+	sort.Strings(specFiles)
+
+	output := bytes.Buffer{}
+	for _, specFile := range specFiles {
+		specBytes, err := os.ReadFile(specFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading CDI spec: %v", err)
+		}
+
+		spec := &specs.Spec{}
+		if err := yaml.Unmarshal(specBytes, spec); err != nil {
+			return nil, fmt.Errorf("failed parsing CDI spec %v: %v", specFile, err)
+		}
+
+		sort.Slice(spec.Devices, func(i, j int) bool { return spec.Devices[i].Name < spec.Devices[j].Name })
+		for _, device := range spec.Devices {
+			mounts := device.ContainerEdits.Mounts
+			sort.Slice(mounts, func(i, j int) bool { return mounts[i].ContainerPath < mounts[j].ContainerPath })
+		}
+
+		normalized, err := yaml.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding CDI spec %v: %v", specFile, err)
+		}
+
+		fmt.Fprintf(&output, "---\n# %v\n", path.Base(specFile))
+		output.Write(bytes.ReplaceAll(normalized, []byte(testRoot), []byte(GoldenTestRoot)))
+	}
+
+	return output.Bytes(), nil
+}
+
+// lineDiff returns the lines of expected and actual that differ, prefixed
+// with - and + respectively.
+func lineDiff(expected string, actual string) string {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+
+	diff := strings.Builder{}
+	for i := 0; i < max(len(expectedLines), len(actualLines)); i++ {
+		expectedLine, actualLine := "", ""
+		if i < len(expectedLines) {
+			expectedLine = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			actualLine = actualLines[i]
+		}
+		if expectedLine == actualLine {
+			continue
+		}
+		fmt.Fprintf(&diff, "line %d:\n-%v\n+%v\n", i+1, expectedLine, actualLine)
+	}
+
+	return diff.String()
+}
@@ -89,6 +89,52 @@ func NewTestDirsAt(testRoot string, driverName string) (TestDirsType, error) {
 	}, nil
 }
 
+// MultiNodeTestDirs are the test dirs of several nodes under a common test root.
+type MultiNodeTestDirs struct {
+	TestRoot string
+	Nodes    map[string]TestDirsType // mapped by node name
+}
+
+// NewMultiNodeTestDirs creates independent fake CDI root, sysfs, devfs and
+// driverPlugin dirs for each of the nodes, for running several kubelet plugin
+// instances in one test.
+func NewMultiNodeTestDirs(driverName string, nodeNames ...string) (MultiNodeTestDirs, error) {
+	testRoot, err := os.MkdirTemp("", testRootPrefix)
+	if err != nil {
+		return MultiNodeTestDirs{}, fmt.Errorf("failed creating test root dir: %v", err)
+	}
+
+	if err := os.Chmod(testRoot, 0755); err != nil {
+		return MultiNodeTestDirs{}, fmt.Errorf("failed changing permissions to test root dir: %v", err)
+	}
+
+	testDirs := MultiNodeTestDirs{
+		TestRoot: testRoot,
+		Nodes:    map[string]TestDirsType{},
+	}
+
+	for _, nodeName := range nodeNames {
+		if _, found := testDirs.Nodes[nodeName]; found {
+			_ = os.RemoveAll(testRoot)
+			return MultiNodeTestDirs{}, fmt.Errorf("duplicate node name %v", nodeName)
+		}
+
+		nodeDirs, err := NewTestDirsAt(path.Join(testRoot, nodeName), driverName)
+		if err != nil {
+			_ = os.RemoveAll(testRoot)
+			return MultiNodeTestDirs{}, fmt.Errorf("node %v: %v", nodeName, err)
+		}
+		testDirs.Nodes[nodeName] = nodeDirs
+	}
+
+	return testDirs, nil
+}
+
+// Cleanup removes the test dirs of all nodes.
+func (m MultiNodeTestDirs) Cleanup(t *testing.T, testname string) {
+	CleanupTest(t, testname, m.TestRoot)
+}
+
 func CleanupTest(t *testing.T, testname string, testRoot string) {
 	if err := os.RemoveAll(testRoot); err != nil {
 		t.Logf("%v: could not cleanup temp directory %v: %v", testname, testRoot, err)
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2025, Intel Corporation.  All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugintesthelpers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+)
+
+// StressOptions tell how hard StressPrepareUnprepare stresses the driver.
+type StressOptions struct {
+	// Workers is the number of goroutines calling the driver concurrently.
+	Workers int
+	// Rounds is how many times each worker prepares and unprepares each claim.
+	Rounds int
+	// Background, when set, is called repeatedly while the workers run, e.g.
+	// to rediscover devices or publish resources at the same time.
+	Background func()
+	// Seed makes the order of the claims of each worker reproducible.
+	Seed int64
+}
+
+// StressPrepareUnprepare prepares and unprepares the claims concurrently from
+// many workers, each going through all the claims in its own random order, the
+// way kubelet calls a driver for pods starting and stopping on the node at the
+// same time, retries included. Run it with the race detector to find data
+// races in the driver state. It returns the failed calls, and the claims
+// prepared with different devices on different calls.
+func StressPrepareUnprepare(ctx context.Context, server drav1.DRAPluginServer, claims []*drav1.Claim, opts StressOptions) []error {
+	var (
+		mutex    sync.Mutex
+		errs     []error
+		prepared = map[string]string{}
+	)
+	report := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+	}
+	// a claim must get the same devices every time it is prepared
+	checkDevices := func(claim *drav1.Claim, response *drav1.NodePrepareResourceResponse) {
+		devices := ""
+		for _, device := range response.Devices {
+			devices += fmt.Sprintf("%v/%v%v ", device.PoolName, device.DeviceName, device.CDIDeviceIDs)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if previous, found := prepared[claim.UID]; found && previous != devices {
+			errs = append(errs, fmt.Errorf("claim %v prepared with devices %v, earlier with %v", claim.UID, devices, previous))
+		}
+		prepared[claim.UID] = devices
+	}
+
+	stop := make(chan struct{})
+	background := sync.WaitGroup{}
+	if opts.Background != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					opts.Background()
+				}
+			}
+		}()
+	}
+
+	workers := sync.WaitGroup{}
+	for worker := 0; worker < opts.Workers; worker++ {
+		order := rand.New(rand.NewSource(opts.Seed + int64(worker))).Perm(len(claims))
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for round := 0; round < opts.Rounds; round++ {
+				for _, i := range order {
+					claim := claims[i]
+					response, err := server.NodePrepareResources(ctx, &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{claim}})
+					if err != nil {
+						report(fmt.Errorf("prepare %v: %v", claim.UID, err))
+						continue
+					}
+					claimResponse := response.Claims[claim.UID]
+					if claimResponse == nil || claimResponse.Error != "" {
+						report(fmt.Errorf("prepare %v: %+v", claim.UID, claimResponse))
+						continue
+					}
+					checkDevices(claim, claimResponse)
+
+					unprepared, err := server.NodeUnprepareResources(ctx, &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{claim}})
+					if err != nil {
+						report(fmt.Errorf("unprepare %v: %v", claim.UID, err))
+						continue
+					}
+					if unpreparedResponse := unprepared.Claims[claim.UID]; unpreparedResponse == nil || unpreparedResponse.Error != "" {
+						report(fmt.Errorf("unprepare %v: %+v", claim.UID, unpreparedResponse))
+					}
+				}
+			}
+		}()
+	}
+
+	workers.Wait()
+	close(stop)
+	background.Wait()
+
+	return errs
+}
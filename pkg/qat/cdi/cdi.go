@@ -24,13 +24,14 @@ import (
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdispecs "tags.cncf.io/container-device-interface/specs-go"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/cdiregistry"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
 const (
 	CDIRoot   = cdiapi.DefaultDynamicDir
-	CDIVendor = "intel.com"
-	CDIClass  = "qat"
+	CDIVendor = cdiregistry.Vendor
+	CDIClass  = cdiregistry.QATClass
 	CDIKind   = CDIVendor + "/" + CDIClass
 )
 
@@ -53,14 +54,10 @@ func New(cdidir string) (*CDI, error) {
 	return cdi, nil
 }
 
-func (c *CDI) getQatSpecs() []*cdiapi.Spec {
-	qatSpecs := []*cdiapi.Spec{}
-	for _, cdiSpec := range c.cache.GetVendorSpecs(CDIVendor) {
-		if cdiSpec.Kind == CDIKind {
-			qatSpecs = append(qatSpecs, cdiSpec)
-		}
-	}
-	return qatSpecs
+// HasDevices returns true when the CDI spec of QAT has devices, i.e. the
+// kubelet plugin has run on the node before.
+func (c *CDI) HasDevices() bool {
+	return cdiregistry.QAT.HasDevices(c.cache)
 }
 
 func (c *CDI) SyncDevices(vfdevices device.VFDevices) error {
@@ -69,9 +66,9 @@ func (c *CDI) SyncDevices(vfdevices device.VFDevices) error {
 	vfspec := &cdispecs.Spec{
 		Kind: CDIKind,
 	}
-	vfspecname := cdiapi.GenerateSpecName(CDIVendor, CDIClass)
+	vfspecname := cdiregistry.QAT.SpecName()
 
-	for _, vendorspec := range c.getQatSpecs() {
+	for _, vendorspec := range cdiregistry.QAT.Specs(c.cache) {
 		vendorspecname := path.Base(vendorspec.GetPath())
 
 		if vendorspec.Kind != CDIKind {
@@ -0,0 +1,89 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+const (
+	qatNumRingPairs = "qat/num_rps"
+	debugfsPath     = "kernel/debug"
+	firmwareVersion = "version/fw"
+)
+
+// Capabilities describes what a single VF of a PF device provides to a
+// container with the services currently configured on the PF device.
+type Capabilities struct {
+	RingPairs       int    // ring pairs of the VF, 0 when unknown
+	CyInstances     int    // crypto instances, each using a sym and/or asym ring pair
+	DcInstances     int    // compression instances, each using a dc or dcc ring pair
+	FirmwareVersion string // empty when the driver does not report it
+}
+
+// readCapabilities reads the number of ring pairs and the firmware version of
+// the PF device. Neither is reported by every driver, so they are optional.
+func (p *PFDevice) readCapabilities() {
+	if numrps, err := p.read(qatNumRingPairs); err == nil {
+		if p.NumRingPairs, err = strconv.Atoi(numrps); err != nil {
+			klog.Warningf("Cannot read value from %s of '%s': %v", qatNumRingPairs, p.Device, err)
+		}
+	}
+
+	// Firmware version is in the debugfs directory of the driver instance,
+	// which is provided by the out-of-tree QAT driver.
+	driver, err := pci.NewSysfs(getSysfsRoot()).Driver(p.Device)
+	if err != nil {
+		return
+	}
+	fwpath := filepath.Join(getSysfsRoot(), debugfsPath, fmt.Sprintf("qat_%s_%s", driver, p.Device), firmwareVersion)
+	if version, err := os.ReadFile(fwpath); err == nil {
+		p.FirmwareVersion = strings.TrimSpace(string(version))
+	}
+}
+
+// Capabilities returns the capabilities of a VF of the PF device. The ring
+// pairs of a VF are assigned to the configured services in turn.
+func (p *PFDevice) Capabilities() Capabilities {
+	capabilities := Capabilities{FirmwareVersion: p.FirmwareVersion}
+
+	if p.Passthrough || p.TotalVFs == 0 || p.NumRingPairs == 0 {
+		return capabilities
+	}
+	capabilities.RingPairs = p.NumRingPairs / p.TotalVFs
+
+	services := []Services{}
+	for _, s := range []Services{Sym, Asym, Dc, Dcc} {
+		if p.Services.Supports(s) {
+			services = append(services, s)
+		}
+	}
+
+	rings := map[Services]int{}
+	for i := 0; i < capabilities.RingPairs && len(services) > 0; i++ {
+		rings[services[i%len(services)]]++
+	}
+
+	capabilities.CyInstances = max(rings[Sym], rings[Asym])
+	capabilities.DcInstances = rings[Dc] + rings[Dcc]
+
+	return capabilities
+}
+
+// Capabilities returns the capabilities of the VF device.
+func (v *VFDevice) Capabilities() Capabilities {
+	if v.pfdevice == nil {
+		return Capabilities{}
+	}
+	return v.pfdevice.Capabilities()
+}
@@ -0,0 +1,51 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func TestCapabilities(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym;asym", TotalVFs: 16, NumRingPairs: 64, FirmwareVersion: "4.1.0"},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym;dc", TotalVFs: 16, NumRingPairs: 64},
+		{Device: "0000:cc:00.0", State: "up", Services: "asym", TotalVFs: 16, NumRingPairs: 64},
+		{Device: "0000:dd:00.0", State: "up", Services: "dc", TotalVFs: 16},
+	}
+
+	expected := map[string]Capabilities{
+		"0000:aa:00.0": {RingPairs: 4, CyInstances: 2, DcInstances: 0, FirmwareVersion: "4.1.0"},
+		"0000:bb:00.0": {RingPairs: 4, CyInstances: 2, DcInstances: 2},
+		"0000:cc:00.0": {RingPairs: 4, CyInstances: 4, DcInstances: 0},
+		"0000:dd:00.0": {},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	if len(qatdevices) != len(expected) {
+		t.Fatalf("expected %d devices, got %d", len(expected), len(qatdevices))
+	}
+
+	for _, pf := range qatdevices {
+		if capabilities := pf.Capabilities(); capabilities != expected[pf.Device] {
+			t.Errorf("device %s: expected capabilities %+v, got %+v", pf.Device, expected[pf.Device], capabilities)
+		}
+		for _, vf := range pf.AvailableDevices {
+			if capabilities := vf.Capabilities(); capabilities != expected[pf.Device] {
+				t.Errorf("VF %s: expected capabilities %+v, got %+v", vf.UID(), expected[pf.Device], capabilities)
+			}
+		}
+	}
+}
@@ -10,29 +10,34 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
 )
 
 const (
 	devicePath       = "bus/pci/devices"
 	driverPath       = "bus/pci/drivers"
-	moduleName       = "4xxx"
 	vfioPCI          = "vfio-pci"
-	vfioBind         = vfioPCI + "/bind"
-	vfioUnbind       = vfioPCI + "/unbind"
 	pciDevicePattern = "????:??:??.?"
+	deviceID         = "device"
 	qatState         = "qat/state"
 	qatServices      = "qat/cfg_services"
-	driverOverride   = "driver_override"
 	numVFs           = "sriov_numvfs"
 	totalVFs         = "sriov_totalvfs"
 	vfDevicePattern  = "virtfn*"
-	vfDriver         = "driver"
-	vfIOMMU          = "iommu_group"
 	vfDeviceNode     = "/dev/vfio"
 )
 
+var (
+	// stateRetries is the number of attempts of each PF device state change.
+	stateRetries = 3
+	// stateRetryDelay is the delay between the attempts.
+	stateRetryDelay = 500 * time.Millisecond
+)
+
 var sysfsRoot string = ""
 
 func getSysfsRoot() string {
@@ -142,12 +147,22 @@ type AllocatedDevices map[string]VFDevices
 type PFDevice struct {
 	AllowReconfiguration bool // enable dynamic service reconfiguration
 	Device               string
+	Model                string // generation name, e.g. 401xx
 	State                State
 	Services             Services
 	NumVFs               int
 	TotalVFs             int
+	NUMANode             int64            // -1 when the platform does not report it
+	Serial               string           // PCIe device serial number, empty when unknown
+	NumRingPairs         int              // ring pairs of the PF device, 0 when unknown
+	FirmwareVersion      string           // empty when unknown
 	AvailableDevices     VFDevices        // mapped by device uid
 	AllocatedDevices     AllocatedDevices // mapped by claim id
+	vfIndices            map[string]int   // VF indices mapped by VF PCI address
+	driver               string           // kernel driver of the model
+	// Passthrough PF device is bound to vfio-pci and allocated as a whole,
+	// without SR-IOV VFs.
+	Passthrough bool
 }
 
 type VFDriver int
@@ -183,10 +198,15 @@ type VFDevice struct {
 func New() (QATDevices, error) {
 	pcidevices := make(QATDevices, 0)
 
-	pattern := filepath.Join(sysfsDriverPath(), moduleName, pciDevicePattern)
-	paths, err := filepath.Glob(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("no PCI PF devices found")
+	paths := []string{}
+	// PF devices in passthrough mode are bound to vfio-pci
+	for _, driver := range append(modelDrivers(), vfioPCI) {
+		pattern := filepath.Join(sysfsDriverPath(), driver, pciDevicePattern)
+		driverPaths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("no PCI PF devices found")
+		}
+		paths = append(paths, driverPaths...)
 	}
 
 	for _, p := range paths {
@@ -203,6 +223,37 @@ func New() (QATDevices, error) {
 			AllocatedDevices:     make(map[string]VFDevices, 0),
 		}
 
+		modelID, err := newdevice.read(deviceID)
+		if err != nil {
+			klog.Warningf("Could not read device ID of '%s': %v", newdevice.Device, err)
+			continue
+		}
+		passthrough := filepath.Base(filepath.Dir(p)) == vfioPCI
+		model, found := Models[modelID]
+		if !found {
+			// vfio-pci has VFs and other devices too
+			if !passthrough {
+				klog.Warningf("Unsupported QAT device '%s' with device ID %s", newdevice.Device, modelID)
+			}
+			continue
+		}
+		newdevice.Model = model.Model
+		newdevice.driver = model.Driver
+
+		sysfs := pci.NewSysfs(getSysfsRoot())
+		if newdevice.NUMANode, err = sysfs.NUMANode(sysfs.DeviceDir(newdevice.Device)); err != nil {
+			klog.V(5).Infof("Could not read NUMA node of '%s': %v", newdevice.Device, err)
+		}
+		if newdevice.Serial, err = sysfs.SerialNumber(sysfs.DeviceDir(newdevice.Device)); err != nil {
+			klog.V(5).Infof("Could not read serial number of '%s': %v", newdevice.Device, err)
+		}
+
+		if passthrough {
+			newdevice.setPassthrough()
+			pcidevices = append(pcidevices, newdevice)
+			continue
+		}
+
 		if err = newdevice.syncConfig(); err != nil {
 			klog.Warningf("Could not sync config for '%s': %v", newdevice.Device, err)
 			continue
@@ -311,6 +362,8 @@ func (p *PFDevice) syncConfig() error {
 	p.NumVFs = vfs
 	p.TotalVFs = total
 
+	p.readCapabilities()
+
 	return nil
 }
 
@@ -333,6 +386,10 @@ func (p *PFDevice) getServices() (Services, error) {
 func (p *PFDevice) SetServices(srv []Services) error {
 	config := None
 
+	if p.Passthrough {
+		return fmt.Errorf("cannot change QAT configuration of PF device in passthrough mode")
+	}
+
 	if len(p.AllocatedDevices) > 0 {
 		return fmt.Errorf("cannot change QAT configuration while VF devices are allocated")
 	}
@@ -341,25 +398,73 @@ func (p *PFDevice) SetServices(srv []Services) error {
 		config |= s
 	}
 
-	deviceState := p.State
+	if config != None {
+		config &= ^None
+	}
 
-	if err := p.down(); err != nil {
-		return err
+	return p.setServices(config)
+}
+
+// setServices configures the services of the PF device by taking it down,
+// writing the configuration and bringing it back up with its VFs enabled. If
+// any step fails, the previous services and state are restored.
+func (p *PFDevice) setServices(config Services) error {
+	previousState, previousServices := p.State, p.Services
+
+	err := p.transition(config, true)
+	if err == nil {
+		return nil
 	}
 
-	if err := p.write(qatServices, config.String()); err != nil {
-		if deviceState == Up {
-			// attempt to return to previous up state with VFs
-			_ = p.EnableVFs()
-		}
-		return fmt.Errorf("configuration '%s' not supported: %v", config.String(), err)
+	klog.Warningf("Configuring QAT device '%s' services '%s' failed, rolling back to '%s': %v",
+		p.Device, config.String(), previousServices.String(), err)
+
+	if rollbackErr := p.transition(previousServices, previousState == Up); rollbackErr != nil {
+		return fmt.Errorf("configuration '%s' failed: %v, rollback to '%s' failed: %v",
+			config.String(), err, previousServices.String(), rollbackErr)
 	}
 
-	if err := p.EnableVFs(); err != nil {
+	return fmt.Errorf("configuration '%s' not supported: %v", config.String(), err)
+}
+
+// transition takes the PF device down, configures the given services and,
+// if requested, brings the device up. Each step is retried.
+func (p *PFDevice) transition(services Services, up bool) error {
+	if err := retry("set QAT device '"+p.Device+"' down", p.down); err != nil {
 		return err
 	}
 
-	return nil
+	if err := retry("configure QAT device '"+p.Device+"' services", func() error {
+		return p.write(qatServices, services.String())
+	}); err != nil {
+		return err
+	}
+	p.Services = services
+
+	if !up {
+		return nil
+	}
+
+	return retry("bring QAT device '"+p.Device+"' up", p.EnableVFs)
+}
+
+// retry calls fn until it succeeds, at most stateRetries times.
+func retry(what string, fn func() error) error {
+	var err error
+
+	for attempt := 1; attempt <= stateRetries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		klog.Warningf("Attempt %d/%d to %s failed: %v", attempt, stateRetries, what, err)
+
+		if attempt < stateRetries {
+			time.Sleep(stateRetryDelay)
+		}
+	}
+
+	return err
 }
 
 func (p *PFDevice) getVFs() error {
@@ -379,8 +484,15 @@ func (p *PFDevice) getVFs() error {
 
 		vfdevice := filepath.Base(vfpath)
 
+		if index, err := vfIndex(path); err == nil {
+			if p.vfIndices == nil {
+				p.vfIndices = map[string]int{}
+			}
+			p.vfIndices[vfdevice] = index
+		}
+
 		// already in AvailableDevices
-		if _, ok := p.AvailableDevices[deviceuid(vfdevice)]; ok {
+		if _, ok := p.AvailableDevices[p.vfUID(vfdevice)]; ok {
 			break
 		}
 
@@ -451,6 +563,10 @@ func (p *PFDevice) EnableVFs() error {
 		err      error
 	)
 
+	if err := p.disablePassthrough(); err != nil {
+		return err
+	}
+
 	// qat/state does not need to be down
 
 	if totalvfs, err = p.read(totalVFs); err != nil {
@@ -515,6 +631,8 @@ func (p *PFDevice) Allocate(deviceUID string, allocatedBy string) (*VFDevice, er
 }
 
 func (q QATDevices) Allocate(requestedDeviceUID string, requestedService Services, requestedBy string) (*VFDevice, bool, error) {
+	requestedDeviceUID = q.resolveUID(requestedDeviceUID)
+
 	for _, pf := range q {
 		// check for already allocated service mapped by request ID
 		if !pf.Services.Supports(requestedService) {
@@ -547,24 +665,61 @@ func (q QATDevices) Allocate(requestedDeviceUID string, requestedService Service
 		if pf.Services != None || !pf.AllowReconfiguration {
 			continue
 		}
+		if _, exists := pf.AvailableDevices[requestedDeviceUID]; !exists && (requestedDeviceUID != "" || len(pf.AvailableDevices) == 0) {
+			continue
+		}
+		// configure requested service before allocation, as the device
+		// cannot be reconfigured while any of its VFs are allocated
+		if err := pf.SetServices([]Services{requestedService}); err != nil {
+			klog.Warningf("Could not configure PF device '%s' for service '%s': %v", pf.Device, requestedService.String(), err)
+			continue
+		}
 		// attempt allocation of requested device
-		if vf, err := pf.Allocate(requestedDeviceUID, requestedBy); err == nil {
-			// attempt configuration of requested service
-			if err := pf.SetServices([]Services{requestedService}); err != nil {
-				_, _ = pf.free(requestedDeviceUID, requestedBy)
-				continue
+		vf, err := pf.Allocate(requestedDeviceUID, requestedBy)
+		if err != nil {
+			// set PF device configuration back to an unconfigured state
+			if err := pf.SetServices([]Services{None}); err != nil {
+				klog.Warningf("Could not unconfigure PF device '%s': %v", pf.Device, err)
 			}
-			return vf, true, nil
+			continue
 		}
+		return vf, true, nil
 	}
 
 	return nil, false, fmt.Errorf("could not allocate device '%s', service '%s' from any device", requestedDeviceUID, requestedService.String())
 }
 
+// Allocated returns the UIDs of the devices allocated by requestedBy.
+func (q QATDevices) Allocated(requestedBy string) []string {
+	uids := []string{}
+	for _, pf := range q {
+		for uid := range pf.AllocatedDevices[requestedBy] {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids
+}
+
+// IsAllocated returns whether the device is allocated by requestedBy.
+func (q QATDevices) IsAllocated(requestedDeviceUID string, requestedBy string) bool {
+	requestedDeviceUID = q.resolveUID(requestedDeviceUID)
+
+	for _, pf := range q {
+		if _, found := pf.AllocatedDevices[requestedBy][requestedDeviceUID]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (q *QATDevices) Free(requestedDeviceUID string, requestedBy string) (bool, error) {
 	var err error
 	updated := false
 
+	requestedDeviceUID = q.resolveUID(requestedDeviceUID)
+
 	for _, pfdevice := range *q {
 		if updated, err = pfdevice.free(requestedDeviceUID, requestedBy); err == nil {
 			return updated, nil
@@ -618,54 +773,19 @@ func (p *PFDevice) free(requestedDeviceUID string, requestedBy string) (bool, er
 }
 
 func (v *VFDevice) update() {
-	driverpath := filepath.Join(sysfsDevicePath(), v.VFDevice, vfDriver)
-	driver, err := filepath.EvalSymlinks(driverpath)
-	if err == nil {
-		driver = filepath.Base(driver)
-		v.VFDriver = stringToDriver[driver]
-	}
+	sysfs := pci.NewSysfs(getSysfsRoot())
 
-	iommupath := filepath.Join(sysfsDevicePath(), v.VFDevice, vfIOMMU)
-	iommu, err := filepath.EvalSymlinks(iommupath)
-	if err == nil {
-		v.VFIommu = filepath.Base(iommu)
+	if driver, err := sysfs.Driver(v.VFDevice); err == nil {
+		v.VFDriver = stringToDriver[driver]
 	}
-}
 
-func (v *VFDevice) writeFile(file string, val string) error {
-	err := os.WriteFile(file, []byte(val), 0600)
-	return err
-}
-
-func (v *VFDevice) bindVFIODriver() error {
-	return v.writeFile(filepath.Join(sysfsDriverPath(), vfioBind), v.VFDevice)
-}
-
-func (v *VFDevice) unbindVFIODriver() error {
-	err := v.writeFile(filepath.Join(sysfsDriverPath(), vfioUnbind), v.VFDevice)
-
-	// fs.PathError is returned if the device was not bound
-	if _, ispatherror := err.(*os.PathError); ispatherror {
-		return nil
+	if iommu, err := sysfs.IOMMUGroup(v.VFDevice); err == nil {
+		v.VFIommu = iommu
 	}
-
-	return err
-}
-
-func (v *VFDevice) overrideVFIODriver() error {
-	return v.writeFile(filepath.Join(sysfsDevicePath(), v.VFDevice, driverOverride), vfioPCI)
 }
 
 func (v *VFDevice) enableVFIO() error {
-	if err := v.overrideVFIODriver(); err != nil {
-		return err
-	}
-
-	if err := v.unbindVFIODriver(); err != nil {
-		return err
-	}
-
-	if err := v.bindVFIODriver(); err != nil {
+	if err := pci.NewSysfs(getSysfsRoot()).OverrideDriver(v.VFDevice, vfioPCI); err != nil {
 		return err
 	}
 
@@ -691,13 +811,21 @@ func (v *VFDevice) Iommu() string {
 }
 
 func deviceuid(device string) string {
-	return "qatvf-" + strings.ReplaceAll(strings.ReplaceAll(device, ":", "-"), ".", "-")
+	return "qatvf-" + pci.RFC1123Address(device)
 }
 
 func (v *VFDevice) UID() string {
+	if v.pfdevice != nil {
+		return v.pfdevice.vfUID(v.VFDevice)
+	}
 	return deviceuid(v.VFDevice)
 }
 
+// PFDevice returns the PF device of the VF device, nil for the control node.
+func (v *VFDevice) PFDevice() *PFDevice {
+	return v.pfdevice
+}
+
 func (v *VFDevice) Services() string {
 	return v.pfdevice.Services.String()
 }
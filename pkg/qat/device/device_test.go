@@ -6,6 +6,8 @@ package device
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
@@ -516,3 +518,135 @@ func CompareQATDevices(qatdevices QATDevices, expected QATDevices) error {
 
 	return nil
 }
+
+func readServicesFile(t *testing.T, device string) string {
+	services, err := os.ReadFile(path.Join(sysfsDevicePath(), device, qatServices))
+	if err != nil {
+		t.Fatalf("could not read services of '%s': %v", device, err)
+	}
+	return string(services)
+}
+
+func TestAllocateReconfigure(t *testing.T) {
+	stateRetryDelay = 0
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	pf := qatdevices[0]
+	pf.EnableReconfiguration(true)
+
+	vf, updated, err := qatdevices.Allocate("qatvf-0000-aa-00-1", Dc, "id-allocator-1")
+	if err != nil || !updated || vf.UID() != "qatvf-0000-aa-00-1" {
+		t.Fatalf("expected reconfiguring allocation of qatvf-0000-aa-00-1, got %v, %v, %v", vf, updated, err)
+	}
+	if pf.Services != Dc || pf.State != Up || readServicesFile(t, pf.Device) != "dc" {
+		t.Errorf("expected device up with dc services, got %s with '%s'", pf.State.String(), pf.Services.String())
+	}
+
+	updated, err = qatdevices.Free("qatvf-0000-aa-00-1", "id-allocator-1")
+	if err != nil || !updated {
+		t.Fatalf("expected reconfiguring free, got %v, %v", updated, err)
+	}
+	if pf.Services != None || readServicesFile(t, pf.Device) != "" {
+		t.Errorf("expected device without services, got '%s'", pf.Services.String())
+	}
+}
+
+func TestSetServicesRollback(t *testing.T) {
+	stateRetryDelay = 0
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "down", Services: "sym", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	pf := qatdevices[0]
+
+	// make bringing the device up fail
+	if err := fakesysfs.InjectQATFaults(pf.Device, []string{fakesysfs.FaultUnwritableState}); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := pf.SetServices([]Services{Dc}); err == nil {
+		t.Fatalf("expected configuration to fail")
+	}
+	if pf.Services != Sym || pf.State != Down || readServicesFile(t, pf.Device) != "sym" {
+		t.Errorf("expected rollback to down device with sym services, got %s with '%s'", pf.State.String(), pf.Services.String())
+	}
+}
+
+func TestEnableVFsFaults(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:cc:00.0", State: "up", Services: "sym", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := fakesysfs.InjectQATFaults("0000:bb:00.0", []string{fakesysfs.FaultNoVFs}); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	appear, err := fakesysfs.DelayQATVFs("0000:cc:00.0")
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	if len(qatdevices) != 3 {
+		t.Fatalf("expected 3 PF devices, got %d", len(qatdevices))
+	}
+
+	// PF devices with unreadable sriov_numvfs are not discovered at all
+	if err := fakesysfs.InjectQATFaults("0000:aa:00.0", []string{fakesysfs.FaultUnwritableNumVFs}); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := qatdevices[0].EnableVFs(); err == nil {
+		t.Errorf("expected enabling VFs to fail with unwritable sriov_numvfs")
+	}
+
+	for _, pf := range qatdevices[1:] {
+		if err := pf.EnableVFs(); err != nil {
+			t.Errorf("enabling VFs of %s: %v", pf.Device, err)
+		}
+		if len(pf.AvailableDevices) != 0 {
+			t.Errorf("expected no VFs on %s, got %d", pf.Device, len(pf.AvailableDevices))
+		}
+	}
+
+	if err := appear(); err != nil {
+		t.Fatalf("could not create delayed VFs: %v", err)
+	}
+	if err := qatdevices[2].EnableVFs(); err != nil {
+		t.Errorf("enabling VFs of %s: %v", qatdevices[2].Device, err)
+	}
+	if len(qatdevices[2].AvailableDevices) != 2 {
+		t.Errorf("expected 2 VFs on %s after they appeared, got %d", qatdevices[2].Device, len(qatdevices[2].AvailableDevices))
+	}
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+var modelIDRegexp = regexp.MustCompile(`^0x[0-9a-f]{4}$`)
+
+// Model is a supported QAT PF device: its generation name and the kernel
+// driver it is bound to.
+type Model struct {
+	Model  string `json:"model"`
+	Driver string `json:"driver"`
+}
+
+// defaultModels are the supported QAT PF devices, by PCI device ID.
+//
+//go:embed models.json
+var defaultModels []byte
+
+// Models are the supported QAT PF devices by PCI device ID.
+var Models = mustParseModels(defaultModels)
+
+func mustParseModels(data []byte) map[string]Model {
+	models, err := parseModels(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded QAT models: %v", err))
+	}
+
+	return models
+}
+
+func parseModels(data []byte) (map[string]Model, error) {
+	models := map[string]Model{}
+	if err := yaml.UnmarshalStrict(data, &models); err != nil {
+		return nil, err
+	}
+
+	for modelID, model := range models {
+		if !modelIDRegexp.MatchString(modelID) {
+			return nil, fmt.Errorf("invalid PCI device ID %q, expected e.g. 0x4940", modelID)
+		}
+		if model.Model == "" || model.Driver == "" {
+			return nil, fmt.Errorf("device %v has no model or driver name", modelID)
+		}
+	}
+
+	return models, nil
+}
+
+// LoadModels adds QAT models from JSON or YAML file to Models, replacing
+// already known device IDs.
+func LoadModels(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("could not read QAT models file: %v", err)
+	}
+
+	models, err := parseModels(data)
+	if err != nil {
+		return fmt.Errorf("could not parse QAT models file %v: %v", filePath, err)
+	}
+
+	for modelID, model := range models {
+		Models[modelID] = model
+	}
+
+	return nil
+}
+
+// modelDrivers returns sorted names of the kernel drivers of all Models.
+func modelDrivers() []string {
+	drivers := []string{}
+	seen := map[string]bool{}
+	for _, model := range Models {
+		if !seen[model.Driver] {
+			seen[model.Driver] = true
+			drivers = append(drivers, model.Driver)
+		}
+	}
+	sort.Strings(drivers)
+
+	return drivers
+}
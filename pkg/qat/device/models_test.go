@@ -0,0 +1,105 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func TestLoadModels(t *testing.T) {
+	t.Cleanup(func() { Models = mustParseModels(defaultModels) })
+
+	if Models["0x4942"].Model != "401xx" || Models["0x4946"].Driver != "420xx" {
+		t.Fatalf("embedded QAT models not loaded: %v", Models)
+	}
+
+	testcases := []struct {
+		name     string
+		contents string
+		pass     bool
+	}{
+		{"yaml", "\"0x4950\":\n  model: 5xxx\n  driver: 5xxx\n", true},
+		{"json", `{"0x4940": {"model": "4xxx new", "driver": "4xxx"}}`, true},
+		{"no driver", `{"0x4951": {"model": "5xxx"}}`, false},
+		{"invalid device ID", `{"4950": {"model": "5xxx", "driver": "5xxx"}}`, false},
+		{"unknown field", `{"0x4950": {"model": "5xxx", "driver": "5xxx", "vfs": 16}}`, false},
+	}
+
+	for _, testcase := range testcases {
+		filePath := path.Join(t.TempDir(), "models")
+		if err := os.WriteFile(filePath, []byte(testcase.contents), 0600); err != nil {
+			t.Fatalf("setup error: could not write models file: %v", err)
+		}
+
+		err := LoadModels(filePath)
+		if testcase.pass != (err == nil) {
+			t.Errorf("%v: unexpected result: %v", testcase.name, err)
+		}
+	}
+
+	if Models["0x4950"].Driver != "5xxx" || Models["0x4940"].Model != "4xxx new" {
+		t.Errorf("loaded models not added: %v", Models)
+	}
+
+	if err := LoadModels(path.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing models file")
+	}
+}
+
+func TestNewDeviceModels(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", DeviceID: "0x4942", State: "up", Services: "sym", TotalVFs: 1},
+		{Device: "0000:bb:00.0", DeviceID: "0x4946", Driver: "420xx", State: "up", Services: "dc", TotalVFs: 1},
+		{Device: "0000:cc:00.0", DeviceID: "0x4999", State: "up", Services: "dc", TotalVFs: 1},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	models := map[string]string{}
+	for _, pf := range qatdevices {
+		models[pf.Device] = pf.Model
+	}
+	if len(models) != 2 || models["0000:aa:00.0"] != "401xx" || models["0000:bb:00.0"] != "420xx" {
+		t.Errorf("expected 401xx and 420xx devices without the unsupported one, got %v", models)
+	}
+}
+
+func TestCheckPrerequisites(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 1},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if problems := CheckPrerequisites(); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+
+	for _, dir := range []string{"kernel/iommu_groups", "bus/pci/drivers/vfio-pci", "bus/pci/drivers/4xxx"} {
+		if err := os.RemoveAll(path.Join(getSysfsRoot(), dir)); err != nil {
+			t.Fatalf("setup error: %v", err)
+		}
+	}
+
+	problems := CheckPrerequisites()
+	if len(problems) != 3 {
+		t.Errorf("expected IOMMU, vfio-pci and QAT driver problems, got %v", problems)
+	}
+}
@@ -0,0 +1,91 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+const (
+	// DefaultNamingStyle names VF devices by their PCI address.
+	DefaultNamingStyle = "machine"
+	// SerialNamingStyle names VF devices by the PCIe device serial number of
+	// their PF device and their VF index, so that the names do not change
+	// when PCI addresses do.
+	SerialNamingStyle = "serial"
+	serialNamePrefix  = "sn-"
+)
+
+var namingStyle = DefaultNamingStyle
+
+// SetNamingStyle sets the naming of VF devices discovered afterwards.
+func SetNamingStyle(style string) error {
+	if style != DefaultNamingStyle && style != SerialNamingStyle {
+		return fmt.Errorf("unsupported naming %q, expected %v or %v", style, DefaultNamingStyle, SerialNamingStyle)
+	}
+
+	namingStyle = style
+
+	return nil
+}
+
+// vfIndex returns the VF index from the name of the virtfn link of the PF.
+func vfIndex(virtfn string) (int, error) {
+	return strconv.Atoi(strings.TrimPrefix(filepath.Base(virtfn), "virtfn"))
+}
+
+// serialUID returns the serial number based UID of the VF device, or empty
+// string when the serial number of the PF device or the VF index is unknown.
+func (p *PFDevice) serialUID(vfdevice string) string {
+	index, found := p.vfIndices[vfdevice]
+	if p.Serial == "" || !found {
+		return ""
+	}
+
+	return fmt.Sprintf("qatvf-%s%s-%d", serialNamePrefix, p.Serial, index)
+}
+
+// vfUID returns the UID of the VF device, or of the PF device itself in
+// passthrough mode, in the naming style, falling back to the PCI address based
+// UID when PF device has no serial number.
+func (p *PFDevice) vfUID(vfdevice string) string {
+	if vfdevice == p.Device {
+		if namingStyle == SerialNamingStyle && p.Serial != "" {
+			return "qatpf-" + serialNamePrefix + p.Serial
+		}
+		return "qatpf-" + pci.RFC1123Address(vfdevice)
+	}
+
+	if namingStyle == SerialNamingStyle {
+		if uid := p.serialUID(vfdevice); uid != "" {
+			return uid
+		}
+	}
+
+	return deviceuid(vfdevice)
+}
+
+// resolveUID returns the current UID of the VF device with the given UID in
+// either naming style, so that devices prepared before a naming change are
+// found. Unknown UIDs are returned as is.
+func (q QATDevices) resolveUID(uid string) string {
+	for _, pf := range q {
+		if uid == "qatpf-"+pci.RFC1123Address(pf.Device) || pf.Serial != "" && uid == "qatpf-"+serialNamePrefix+pf.Serial {
+			return pf.vfUID(pf.Device)
+		}
+		for vfdevice := range pf.vfIndices {
+			if uid == deviceuid(vfdevice) || uid == pf.serialUID(vfdevice) {
+				return pf.vfUID(vfdevice)
+			}
+		}
+	}
+
+	return uid
+}
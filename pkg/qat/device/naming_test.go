@@ -0,0 +1,115 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func TestSetNamingStyle(t *testing.T) {
+	defer func() { _ = SetNamingStyle(DefaultNamingStyle) }()
+
+	for _, style := range []string{DefaultNamingStyle, SerialNamingStyle} {
+		if err := SetNamingStyle(style); err != nil {
+			t.Errorf("unexpected error for %q: %v", style, err)
+		}
+	}
+	if err := SetNamingStyle("classic"); err == nil {
+		t.Errorf("expected unsupported naming to fail")
+	}
+}
+
+func TestSerialNaming(t *testing.T) {
+	defer func() { _ = SetNamingStyle(DefaultNamingStyle) }()
+	if err := SetNamingStyle(SerialNamingStyle); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, Serial: "0123456789abcdef"},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 1},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	uids := map[string]string{}
+	for uid, vf := range GetResourceDevices(qatdevices) {
+		uids[vf.PCIDevice()] = uid
+	}
+
+	expected := map[string]string{
+		"0000:aa:00.1": "qatvf-sn-0123456789abcdef-1",
+		"0000:aa:00.2": "qatvf-sn-0123456789abcdef-2",
+		"0000:bb:00.1": "qatvf-0000-bb-00-1",
+	}
+	if !reflect.DeepEqual(uids, expected) {
+		t.Errorf("expected UIDs %v, got %v", expected, uids)
+	}
+}
+
+func TestNamingMigration(t *testing.T) {
+	defer func() { _ = SetNamingStyle(DefaultNamingStyle) }()
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, Serial: "0123456789abcdef"},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	statefile := path.Join(t.TempDir(), "qat.state")
+	if err := os.WriteFile(statefile, []byte(`{"claim-1": ["qatvf-0000-aa-00-1"]}`), 0600); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	if err := SetNamingStyle(SerialNamingStyle); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	if _, err := qatdevices.ReadStateOrCreateEmpty(statefile, true); err != nil {
+		t.Fatalf("could not read state: %v", err)
+	}
+
+	if _, found := qatdevices[0].AllocatedDevices["claim-1"]["qatvf-sn-0123456789abcdef-1"]; !found {
+		t.Errorf("expected migrated device to be allocated, got %v", qatdevices[0].AllocatedDevices)
+	}
+
+	saved := savedAllocations{}
+	data, err := os.ReadFile(statefile)
+	if err != nil {
+		t.Fatalf("could not read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("could not parse state file: %v", err)
+	}
+	if !reflect.DeepEqual(saved, savedAllocations{"claim-1": {"qatvf-sn-0123456789abcdef-1"}}) {
+		t.Errorf("expected migrated state file, got %v", saved)
+	}
+
+	// claims allocated with the previous naming are unprepared with it
+	if _, err := qatdevices.Free("qatvf-0000-aa-00-1", "claim-1"); err != nil {
+		t.Errorf("could not free device by previous UID: %v", err)
+	}
+}
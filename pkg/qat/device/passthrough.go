@@ -0,0 +1,87 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/pci"
+)
+
+// passthroughServices are the services of a PF device in passthrough mode,
+// which the driver in the container configures.
+const passthroughServices = Sym | Asym | Dc
+
+// EnablePassthrough disables SR-IOV of the PF device and binds it to
+// vfio-pci, so that the PF device itself is allocated to a single claim.
+func (p *PFDevice) EnablePassthrough() error {
+	if p.Passthrough {
+		return nil
+	}
+
+	if len(p.AllocatedDevices) > 0 {
+		return fmt.Errorf("cannot enable passthrough while VF devices are allocated")
+	}
+
+	if err := p.write(numVFs, "0"); err != nil {
+		return fmt.Errorf("cannot disable VFs: %v", err)
+	}
+
+	sysfs := pci.NewSysfs(getSysfsRoot())
+	if err := sysfs.Unbind(p.Device, p.driver); err != nil {
+		return fmt.Errorf("cannot unbind from %s: %v", p.driver, err)
+	}
+	if err := sysfs.OverrideDriver(p.Device, vfioPCI); err != nil {
+		return fmt.Errorf("cannot bind to %s: %v", vfioPCI, err)
+	}
+
+	p.setPassthrough()
+
+	return nil
+}
+
+// setPassthrough makes the PF device itself its only allocatable device.
+func (p *PFDevice) setPassthrough() {
+	p.Passthrough = true
+	p.Services = passthroughServices
+	p.AvailableDevices = VFDevices{}
+
+	pf := &VFDevice{
+		pfdevice: p,
+		VFDevice: p.Device,
+	}
+	pf.update()
+	p.AvailableDevices[pf.UID()] = pf
+}
+
+// disablePassthrough binds the PF device back to its kernel driver, so that
+// its VFs can be enabled.
+func (p *PFDevice) disablePassthrough() error {
+	if !p.Passthrough {
+		return nil
+	}
+
+	if len(p.AllocatedDevices) > 0 {
+		return fmt.Errorf("cannot disable passthrough while PF device is allocated")
+	}
+
+	sysfs := pci.NewSysfs(getSysfsRoot())
+	if err := sysfs.Unbind(p.Device, vfioPCI); err != nil {
+		return fmt.Errorf("cannot unbind from %s: %v", vfioPCI, err)
+	}
+	if err := sysfs.OverrideDriver(p.Device, p.driver); err != nil {
+		return fmt.Errorf("cannot bind to %s: %v", p.driver, err)
+	}
+
+	p.Passthrough = false
+	p.AvailableDevices = VFDevices{}
+
+	return p.syncConfig()
+}
+
+// IsPF returns whether the device is a PF device in passthrough mode.
+func (v *VFDevice) IsPF() bool {
+	return v.pfdevice != nil && v.VFDevice == v.pfdevice.Device
+}
@@ -0,0 +1,89 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func TestPassthrough(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	pf := qatdevices[0]
+
+	if err := pf.EnablePassthrough(); err != nil {
+		t.Fatalf("could not enable passthrough: %v", err)
+	}
+
+	devices := GetResourceDevices(qatdevices)
+	passthrough, found := devices["qatpf-0000-aa-00-0"]
+	if len(devices) != 1 || !found || !passthrough.IsPF() {
+		t.Fatalf("expected only PF device qatpf-0000-aa-00-0, got %v", devices)
+	}
+	if passthrough.DeviceNode() != "/dev/vfio/301" {
+		t.Errorf("expected PF device node of IOMMU group 301, got %s", passthrough.DeviceNode())
+	}
+
+	if _, _, err := qatdevices.Allocate("qatpf-0000-aa-00-0", Unset, "id-allocator-1"); err != nil {
+		t.Errorf("could not allocate PF device: %v", err)
+	}
+	if err := pf.SetServices([]Services{Dc}); err == nil {
+		t.Errorf("expected configuring services in passthrough mode to fail")
+	}
+	if err := pf.EnableVFs(); err == nil {
+		t.Errorf("expected enabling VFs of allocated PF device to fail")
+	}
+	if _, err := qatdevices.Free("qatpf-0000-aa-00-0", "id-allocator-1"); err != nil {
+		t.Errorf("could not free PF device: %v", err)
+	}
+
+	if err := pf.EnableVFs(); err != nil {
+		t.Fatalf("could not enable VFs: %v", err)
+	}
+	if devices := GetResourceDevices(qatdevices); pf.Passthrough || len(devices) != 2 {
+		t.Errorf("expected 2 VF devices after disabling passthrough, got %v", devices)
+	}
+}
+
+func TestDiscoverPassthrough(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, Passthrough: true},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+	if len(qatdevices) != 2 {
+		t.Fatalf("expected 2 PF devices, got %d", len(qatdevices))
+	}
+
+	devices := GetResourceDevices(qatdevices)
+	if len(devices) != 3 {
+		t.Errorf("expected PF device and 2 VF devices, got %v", devices)
+	}
+	if pf, found := devices["qatpf-0000-aa-00-0"]; !found || pf.Services() != "sym;asym;dc" {
+		t.Errorf("expected passthrough PF device with all services, got %v", devices)
+	}
+}
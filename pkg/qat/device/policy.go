@@ -0,0 +1,126 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AllocationPolicy is the order in which VF devices are published. The
+// scheduler allocates the first matching devices in the published order, so
+// the order decides whether claims get VFs of the same or different PFs.
+type AllocationPolicy string
+
+const (
+	// PackPolicy publishes the VFs one PF device after another, so that one
+	// PF device is used up before the next one.
+	PackPolicy AllocationPolicy = "pack"
+	// SpreadPolicy interleaves the VFs of the PF devices, so that consecutive
+	// allocations get VFs of different PF devices.
+	SpreadPolicy AllocationPolicy = "spread"
+	// SpreadNUMAPolicy interleaves the VFs of the NUMA nodes (sockets), and
+	// within a NUMA node the VFs of its PF devices.
+	SpreadNUMAPolicy AllocationPolicy = "spread-numa"
+)
+
+var allocationPolicies = []AllocationPolicy{PackPolicy, SpreadPolicy, SpreadNUMAPolicy}
+
+// ParseAllocationPolicy parses the allocation policy, empty string being the
+// pack policy.
+func ParseAllocationPolicy(value string) (AllocationPolicy, error) {
+	if value == "" {
+		return PackPolicy, nil
+	}
+
+	policy := AllocationPolicy(value)
+	if !slices.Contains(allocationPolicies, policy) {
+		names := []string{}
+		for _, p := range allocationPolicies {
+			names = append(names, string(p))
+		}
+		return "", fmt.Errorf("unknown allocation policy %q, expected one of: %s", value, strings.Join(names, ", "))
+	}
+
+	return policy, nil
+}
+
+// OrderDevices returns the VF devices in the order of the allocation policy.
+func OrderDevices(vfdevices VFDevices, policy AllocationPolicy) []*VFDevice {
+	ordered := []*VFDevice{}
+	for _, vf := range vfdevices {
+		ordered = append(ordered, vf)
+	}
+	slices.SortFunc(ordered, func(a, b *VFDevice) int {
+		return strings.Compare(a.VFDevice, b.VFDevice)
+	})
+
+	switch policy {
+	case SpreadPolicy:
+		return interleave(groupDevices(ordered, pfDevice))
+	case SpreadNUMAPolicy:
+		nodes := [][]*VFDevice{}
+		for _, node := range groupDevices(ordered, numaNode) {
+			nodes = append(nodes, interleave(groupDevices(node, pfDevice)))
+		}
+		return interleave(nodes)
+	default:
+		return ordered
+	}
+}
+
+func pfDevice(vf *VFDevice) string {
+	if vf.pfdevice == nil {
+		return ""
+	}
+	return vf.pfdevice.Device
+}
+
+func numaNode(vf *VFDevice) string {
+	if vf.pfdevice == nil {
+		return ""
+	}
+	return fmt.Sprintf("%08d", vf.pfdevice.NUMANode)
+}
+
+// groupDevices groups the sorted devices by key, keeping their order within
+// the groups, and returns the groups sorted by key.
+func groupDevices(vfdevices []*VFDevice, key func(*VFDevice) string) [][]*VFDevice {
+	groups := map[string][]*VFDevice{}
+	keys := []string{}
+	for _, vf := range vfdevices {
+		k := key(vf)
+		if _, found := groups[k]; !found {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], vf)
+	}
+	slices.Sort(keys)
+
+	grouped := [][]*VFDevice{}
+	for _, k := range keys {
+		grouped = append(grouped, groups[k])
+	}
+
+	return grouped
+}
+
+// interleave takes one device of each group in turn.
+func interleave(groups [][]*VFDevice) []*VFDevice {
+	interleaved := []*VFDevice{}
+	for i := 0; len(groups) > 0; i++ {
+		remaining := [][]*VFDevice{}
+		for _, group := range groups {
+			if i < len(group) {
+				interleaved = append(interleaved, group[i])
+				remaining = append(remaining, group)
+			}
+		}
+		groups = remaining
+	}
+
+	return interleaved
+}
@@ -0,0 +1,92 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+)
+
+func TestParseAllocationPolicy(t *testing.T) {
+	for value, expected := range map[string]AllocationPolicy{
+		"":            PackPolicy,
+		"pack":        PackPolicy,
+		"spread":      SpreadPolicy,
+		"spread-numa": SpreadNUMAPolicy,
+	} {
+		if policy, err := ParseAllocationPolicy(value); err != nil || policy != expected {
+			t.Errorf("%q: expected %v, got %v, %v", value, expected, policy, err)
+		}
+	}
+
+	if _, err := ParseAllocationPolicy("random"); err == nil {
+		t.Errorf("expected unknown policy to fail")
+	}
+}
+
+func TestOrderDevices(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, NumaNode: 0},
+		{Device: "0000:bb:00.0", State: "up", Services: "sym", TotalVFs: 2, NumaNode: 1},
+		{Device: "0000:cc:00.0", State: "up", Services: "sym", TotalVFs: 2, NumaNode: 0},
+	}
+
+	expected := map[AllocationPolicy][]string{
+		PackPolicy:       {"0000:aa:00.1", "0000:aa:00.2", "0000:bb:00.1", "0000:bb:00.2", "0000:cc:00.1", "0000:cc:00.2"},
+		SpreadPolicy:     {"0000:aa:00.1", "0000:bb:00.1", "0000:cc:00.1", "0000:aa:00.2", "0000:bb:00.2", "0000:cc:00.2"},
+		SpreadNUMAPolicy: {"0000:aa:00.1", "0000:bb:00.1", "0000:cc:00.1", "0000:bb:00.2", "0000:aa:00.2", "0000:cc:00.2"},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+
+	qatdevices, err := New()
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	for policy, expectedOrder := range expected {
+		order := []string{}
+		for _, vf := range OrderDevices(GetResourceDevices(qatdevices), policy) {
+			order = append(order, vf.PCIDevice())
+		}
+		if !reflect.DeepEqual(order, expectedOrder) {
+			t.Errorf("%s: expected %v, got %v", policy, expectedOrder, order)
+		}
+	}
+}
+
+// syntheticVFDevices returns VFs of pfs PF devices with vfs VFs each, spread
+// over numaNodes NUMA nodes, without sysfs.
+func syntheticVFDevices(pfs int, vfs int, numaNodes int) VFDevices {
+	vfdevices := VFDevices{}
+	for i := 0; i < pfs; i++ {
+		pf := &PFDevice{Device: fmt.Sprintf("0000:%02x:00.0", i), NUMANode: int64(i % numaNodes)}
+		for j := 1; j <= vfs; j++ {
+			vf := &VFDevice{pfdevice: pf, VFDevice: fmt.Sprintf("0000:%02x:%02x.%x", i, j/8, j%8)}
+			vfdevices[vf.VFDevice] = vf
+		}
+	}
+	return vfdevices
+}
+
+func BenchmarkOrderDevices(b *testing.B) {
+	vfdevices := syntheticVFDevices(256, 16, 4)
+
+	for _, policy := range allocationPolicies {
+		b.Run(string(policy), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if ordered := OrderDevices(vfdevices, policy); len(ordered) != len(vfdevices) {
+					b.Fatalf("expected %d devices, got %d", len(vfdevices), len(ordered))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/* Copyright (C) 2025 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	iommuGroupsPath = "kernel/iommu_groups"
+	moduleLink      = "module"
+	moduleVersion   = "version"
+)
+
+// CheckPrerequisites returns the kernel prerequisites of using QAT VFs in
+// containers which the host does not fulfill: an enabled IOMMU, the vfio-pci
+// driver, and a loaded QAT driver of a supported model.
+func CheckPrerequisites() []string {
+	problems := []string{}
+
+	iommuGroups, err := os.ReadDir(filepath.Join(getSysfsRoot(), iommuGroupsPath))
+	if err != nil || len(iommuGroups) == 0 {
+		problems = append(problems, "IOMMU is not enabled, add intel_iommu=on to the kernel command line")
+	}
+
+	if _, err := os.Stat(filepath.Join(sysfsDriverPath(), vfioPCI)); err != nil {
+		problems = append(problems, "vfio-pci driver is not available, load the vfio-pci kernel module")
+	}
+
+	loaded := []string{}
+	for _, driver := range modelDrivers() {
+		driverDir := filepath.Join(sysfsDriverPath(), driver)
+		if _, err := os.Stat(driverDir); err != nil {
+			continue
+		}
+		loaded = append(loaded, driver)
+
+		// In-tree modules do not have a version.
+		if version, err := os.ReadFile(filepath.Join(driverDir, moduleLink, moduleVersion)); err == nil {
+			klog.Infof("QAT driver %s version %s", driver, strings.TrimSpace(string(version)))
+		}
+	}
+	if len(loaded) == 0 {
+		problems = append(problems, "no QAT kernel driver is loaded, supported drivers: "+strings.Join(modelDrivers(), ", "))
+	}
+
+	return problems
+}
@@ -10,50 +10,73 @@ import (
 	"os"
 
 	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 )
 
 // Map allocation id to VF device.
 type savedAllocations map[string][]string
 
-func (q *QATDevices) ReadStateOrCreateEmpty(statefile string) error {
+// ReadStateOrCreateEmpty restores allocations from the state file, or creates
+// an empty state file. The returned lost is true when the state file was
+// corrupted, or was missing while devices were inUse, and allocations of
+// prepared claims need to be recovered. A missing state file on a fresh
+// install is not lost.
+func (q *QATDevices) ReadStateOrCreateEmpty(statefile string, inUse bool) (lost bool, err error) {
 	if statefile == "" {
-		return nil
+		return false, nil
 	}
 
 	if _, err := os.Stat(statefile); os.IsNotExist(err) {
-		f, err := os.OpenFile(statefile, os.O_CREATE|os.O_WRONLY, 0600)
-		if err != nil {
-			return fmt.Errorf("failed to create state file '%s': %v", statefile, err)
-		}
-		defer f.Close()
+		klog.Infof("State file '%s' not found, creating empty state file", statefile)
+		return inUse, createEmptyState(statefile)
+	}
 
-		if _, err := f.WriteString("{}"); err != nil {
-			return fmt.Errorf("failed to write to state file '%s': %v", statefile, err)
-		}
+	return q.readState(statefile)
+}
 
-		return nil
+func createEmptyState(statefile string) error {
+	f, err := os.OpenFile(statefile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create state file '%s': %v", statefile, err)
 	}
+	defer f.Close()
 
-	return q.readState(statefile)
+	if _, err := f.WriteString("{}"); err != nil {
+		return fmt.Errorf("failed to write to state file '%s': %v", statefile, err)
+	}
+
+	return nil
 }
 
-func (q *QATDevices) readState(statefile string) error {
+func (q *QATDevices) readState(statefile string) (bool, error) {
 	if statefile == "" {
-		return nil
+		return false, nil
 	}
 
 	savedstatebytes, err := os.ReadFile(statefile)
 	if err != nil {
-		return fmt.Errorf("could not read state file '%s': %v", statefile, err)
+		return false, fmt.Errorf("could not read state file '%s': %v", statefile, err)
 	}
 
 	saveddevices := make(savedAllocations, 0)
 	if err := json.Unmarshal(savedstatebytes, &saveddevices); err != nil {
-		return fmt.Errorf("failed parsing state file '%s': %v", statefile, err)
+		klog.Errorf("State file '%s' is corrupted: %v", statefile, err)
+		if err := helpers.KeepCorruptedFile(statefile); err != nil {
+			return false, err
+		}
+		return true, createEmptyState(statefile)
 	}
 
+	migrated := false
 	for allocatedby, vfdevices := range saveddevices {
 		for _, vf := range vfdevices {
+			// devices saved with another naming style get their current UID
+			if uid := q.resolveUID(vf); uid != vf {
+				klog.Infof("Migrating VF device '%s' of '%s' to '%s'", vf, allocatedby, uid)
+				migrated = true
+			}
+
 			_, _, err := q.Allocate(vf, Unset, allocatedby)
 
 			if err != nil {
@@ -65,7 +88,11 @@ func (q *QATDevices) readState(statefile string) error {
 		}
 	}
 
-	return nil
+	if migrated {
+		return false, q.SaveState(statefile)
+	}
+
+	return false, nil
 }
 
 func (q *QATDevices) SaveState(statefile string) error {
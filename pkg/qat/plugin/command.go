@@ -0,0 +1,145 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/cdi"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+	driverVersion "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/version"
+)
+
+// NewCommand returns the command running the QAT kubelet plugin.
+func NewCommand(use string) *cobra.Command {
+	var qatModels, allocationPolicy, namingStyle string
+	var pfPassthrough bool
+
+	return helpers.NewApp(use, "Intel QAT resource driver kubelet plugin",
+		func(ctx context.Context, flags *helpers.AppFlags) error {
+			return run(ctx, flags, qatModels, allocationPolicy, namingStyle, pfPassthrough)
+		},
+		func(fs *pflag.FlagSet) {
+			fs.StringVar(&qatModels, "qat-models", os.Getenv("QAT_MODELS"),
+				"Path of JSON or YAML file with QAT PF device models and their kernel drivers by PCI device ID, which are added to the built-in supported models, replacing the same device IDs. Defaults to the QAT_MODELS environment variable.")
+			fs.StringVar(&allocationPolicy, "allocation-policy", string(device.PackPolicy),
+				"Order of published VF devices, which the scheduler allocates first to last: 'pack' uses up one PF device before the next, 'spread' alternates between PF devices, 'spread-numa' alternates between NUMA nodes and their PF devices.")
+			fs.StringVar(&namingStyle, "naming", device.DefaultNamingStyle,
+				"Naming of VF devices. Options: machine, named by PCI address, or serial, named by PCIe device serial number of the PF device and VF index when PF device has it, so that names do not change when PCI addresses do. Devices of prepared claims are migrated to the new names.")
+			fs.BoolVar(&pfPassthrough, "pf-passthrough", false,
+				"Disable SR-IOV and allocate each PF device as a whole to a single claim through vfio-pci, with the services configured by the driver in the container.")
+		})
+}
+
+func run(ctx context.Context, flags *helpers.AppFlags, qatModels string, allocationPolicy string, namingStyle string, pfPassthrough bool) error {
+	var (
+		d   *driver
+		err error
+	)
+
+	klog.Info("DRA QAT kubelet plugin")
+	driverVersion.PrintDriverVersion(driverName)
+
+	if qatModels != "" {
+		if err := device.LoadModels(qatModels); err != nil {
+			return err
+		}
+	}
+
+	if err := device.SetNamingStyle(namingStyle); err != nil {
+		return err
+	}
+
+	policy, err := device.ParseAllocationPolicy(allocationPolicy)
+	if err != nil {
+		return err
+	}
+
+	pluginPath := path.Join(flags.KubeletPluginsDir(), driverName)
+	if err := os.MkdirAll(pluginPath, 0750); err != nil {
+		return fmt.Errorf("could not create '%s': %v", pluginPath, err)
+	}
+
+	kubeclient, err := flags.NewKubeClient()
+	if err != nil {
+		return fmt.Errorf("could not create kube client: %v", err)
+	}
+
+	config := &configType{
+		clientset:     kubeclient,
+		nodeName:      flags.NodeNameOrDefault(""),
+		cdiRoot:       flags.CDIDirOrDefault(cdi.CDIRoot),
+		stateFile:     pluginPath + ".state",
+		pfPassthrough: pfPassthrough,
+	}
+
+	if d, err = newDriver(ctx, config); err != nil {
+		return fmt.Errorf("failed to create kubelet plugin driver: %v", err)
+	}
+
+	d.allocationPolicy = policy
+
+	if *flags.AuditLog != "" {
+		if d.audit, err = helpers.NewAuditLogger(*flags.AuditLog, driverName, d.nodename); err != nil {
+			return err
+		}
+	}
+
+	opts := helpers.PluginOptionsAt(flags.KubeletPluginsDir(), flags.KubeletPluginsRegistryDir(), driverName, d.nodename, d.kubeclient)
+	if d.plugin, err = helpers.StartPlugin(ctx, d, opts, d.resources()); err != nil {
+		return err
+	}
+
+	if *flags.HTTPEndpoint != "" {
+		if err := startHTTPEndpoint(*flags.HTTPEndpoint, *flags.PprofPath, config.cdiRoot, d); err != nil {
+			return err
+		}
+	}
+
+	klog.Infof("DRA kubelet plugin %s running...", driverName)
+
+	helpers.WaitForStopSignal()
+
+	d.plugin.Stop()
+
+	klog.Infof("DRA kubelet plugin %s done", driverName)
+
+	return nil
+}
+
+// startHTTPEndpoint serves the liveness and readiness checks and metrics of
+// the plugin, and optionally the profiling data.
+func startHTTPEndpoint(httpEndpoint string, pprofPath string, cdiRoot string, d *driver) error {
+	mux := http.NewServeMux()
+	mux.Handle(helpers.HealthzPath, helpers.HealthChecks{
+		"registration": helpers.PluginRegistrationCheck(d.plugin),
+		"cdi":          helpers.WritableDirCheck(cdiRoot),
+	})
+	mux.Handle(helpers.ReadyzPath, helpers.HealthChecks{
+		"registration":  helpers.PluginRegisteredCheck(d.plugin),
+		"cdi":           helpers.WritableDirCheck(cdiRoot),
+		"prerequisites": d.prerequisitesCheck,
+	})
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(helpers.NewDeviceUsageCollector("intel_qat", d.deviceUsage))
+	mux.Handle(helpers.MetricsPath, metrics.HandlerFor(registry, metrics.HandlerOpts{}))
+
+	if pprofPath != "" {
+		helpers.AddPprofHandlers(mux, pprofPath)
+	}
+
+	return helpers.ServeHTTPEndpoint(httpEndpoint, mux)
+}
@@ -2,7 +2,7 @@
  * SPDX-License-Identifier: Apache-2.0
  */
 
-package main
+package plugin
 
 import (
 	"encoding/json"
@@ -0,0 +1,57 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+func deviceResources(qatvfdevices []*device.VFDevice) *[]resourceapi.Device {
+	resourcedevices := []resourceapi.Device{}
+
+	for _, qatvfdevice := range qatvfdevices {
+		device := resourceapi.Device{
+			Name: qatvfdevice.UID(),
+			Basic: &resourceapi.BasicDevice{
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"services": {
+						StringValue: ptr.To(qatvfdevice.Services()),
+					},
+				},
+			},
+		}
+
+		if qatvfdevice.IsPF() {
+			device.Basic.Attributes["passthrough"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(true)}
+		}
+
+		if pf := qatvfdevice.PFDevice(); pf != nil {
+			device.Basic.Attributes["pfDevice"] = resourceapi.DeviceAttribute{StringValue: ptr.To(pf.Device)}
+			if pf.NUMANode >= 0 {
+				device.Basic.Attributes["numaNode"] = resourceapi.DeviceAttribute{IntValue: ptr.To(pf.NUMANode)}
+			}
+		}
+
+		capabilities := qatvfdevice.Capabilities()
+		if capabilities.RingPairs > 0 {
+			device.Basic.Attributes["ringPairs"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(capabilities.RingPairs))}
+			device.Basic.Attributes["cyInstances"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(capabilities.CyInstances))}
+			device.Basic.Attributes["dcInstances"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(capabilities.DcInstances))}
+		}
+		if capabilities.FirmwareVersion != "" {
+			device.Basic.Attributes["firmwareVersion"] = resourceapi.DeviceAttribute{StringValue: ptr.To(capabilities.FirmwareVersion)}
+		}
+
+		resourcedevices = append(resourcedevices, device)
+
+		klog.V(5).Infof("Adding Device resource: name '%s', service '%s'", device.Name, *device.Basic.Attributes["services"].StringValue)
+	}
+
+	return &resourcedevices
+}
@@ -2,42 +2,50 @@
  * SPDX-License-Identifier: Apache-2.0
  */
 
-package main
+package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
 	"sync"
 
+	corev1 "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
 	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/helpers"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/cdi"
 	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
 )
 
 const (
-	driverName             = "qat.intel.com"
-	pluginRegistrationPath = "/var/lib/kubelet/plugins_registry/" + driverName + ".sock"
-	driverPluginPath       = "/var/lib/kubelet/plugins/" + driverName
-	driverPluginSocketPath = driverPluginPath + "/plugin.sock"
-	stateFileName          = driverPluginPath + ".state"
+	driverName = cdi.CDIClass + "." + cdi.CDIVendor
 )
 
 var _ drav1.DRAPluginServer = &driver{}
 
 type driver struct {
 	sync.Mutex
-	kubeclient KubeClient
+	kubeclient kubernetes.Interface
 	nodename   string
 	cdi        *cdi.CDI
 	devices    device.QATDevices
 	plugin     kubeletplugin.DRAPlugin
 	statefile  string
+	recorder   record.EventRecorder
+	audit      *helpers.AuditLogger
+	// allocationPolicy is the order of the published devices.
+	allocationPolicy device.AllocationPolicy
+	// prerequisites lists the missing kernel prerequisites, no devices are
+	// published while it is not empty.
+	prerequisites []string
 }
 
 func (d *driver) getResourceClaim(ctx context.Context, claim *drav1.Claim) (*resourceapi.ResourceClaim, error) {
@@ -62,6 +70,7 @@ func (d *driver) NodePrepareResources(ctx context.Context, req *drav1.NodePrepar
 	for _, claim := range req.Claims {
 		klog.V(5).Infof("NodePrepareResources: claim %s", claim.GetUID())
 		preparedResourcesResponse.Claims[claim.GetUID()] = d.allocateResource(ctx, claim)
+		d.audit.LogPrepare(claim, preparedResourcesResponse.Claims[claim.GetUID()])
 	}
 
 	return preparedResourcesResponse, nil
@@ -71,11 +80,24 @@ func (d *driver) allocateResource(ctx context.Context, claim *drav1.Claim) *drav
 	resourceclaim, err := d.getResourceClaim(ctx, claim)
 	if err != nil {
 		klog.Errorf("Error fetching ResourceClaim for %s: %v", claim.GetUID(), err)
-		return &drav1.NodePrepareResourceResponse{
-			Error: err.Error(),
-		}
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
 	}
 
+	return d.prepareResourceClaim(ctx, claim, resourceclaim)
+}
+
+// recoverClaim prepares the allocated ResourceClaim again when the state file
+// was lost.
+func (d *driver) recoverClaim(ctx context.Context, resourceclaim *resourceapi.ResourceClaim) error {
+	claim := &drav1.Claim{Namespace: resourceclaim.Namespace, Name: resourceclaim.Name, UID: string(resourceclaim.UID)}
+	if response := d.prepareResourceClaim(ctx, claim, resourceclaim); response.Error != "" {
+		return errors.New(response.Error)
+	}
+
+	return nil
+}
+
+func (d *driver) prepareResourceClaim(ctx context.Context, claim *drav1.Claim, resourceclaim *resourceapi.ResourceClaim) *drav1.NodePrepareResourceResponse {
 	response := &drav1.NodePrepareResourceResponse{}
 	deviceConfigurationChanged := false
 
@@ -104,6 +126,9 @@ func (d *driver) allocateResource(ctx context.Context, claim *drav1.Claim) *drav
 
 		klog.V(5).Infof("Requested device UID '%s'", requestedDeviceUID)
 
+		// devices of a claim prepared again are reused and not rolled back
+		alreadyAllocated := d.devices.IsAllocated(requestedDeviceUID, claim.GetUID())
+
 		// allocate specified QAT VF device which can have any service configured
 		vfDevice, deviceConfigurationChanged, err = d.devices.Allocate(requestedDeviceUID, device.Unset, claim.GetUID())
 		if err != nil {
@@ -113,11 +138,11 @@ func (d *driver) allocateResource(ctx context.Context, claim *drav1.Claim) *drav
 			for _, vf := range allocatedvfs {
 				_, _ = d.devices.Free(vf.UID(), claim.GetUID())
 			}
-			return &drav1.NodePrepareResourceResponse{
-				Error: err.Error(),
-			}
+			return helpers.PrepareFailed(d.recorder, claim, err.Error())
+		}
+		if !alreadyAllocated {
+			allocatedvfs = append(allocatedvfs, vfDevice)
 		}
-		allocatedvfs = append(allocatedvfs, vfDevice)
 
 		cdidevicename := cdi.CDIKind + "=" + vfDevice.UID()
 		klog.V(5).Infof("Allocated CDI devices '%s' and '%s' for claim '%s'", cdidevicename, controldevicename, claim.GetUID())
@@ -133,9 +158,7 @@ func (d *driver) allocateResource(ctx context.Context, claim *drav1.Claim) *drav
 
 	// FIXME: deallocate devices if state couldn't be saved for some reason ?
 	if err := d.devices.SaveState(d.statefile); err != nil {
-		return &drav1.NodePrepareResourceResponse{
-			Error: err.Error(),
-		}
+		return helpers.PrepareFailed(d.recorder, claim, err.Error())
 	}
 
 	// FIXME: deallocate devices if couldn't publish resources ?
@@ -160,29 +183,22 @@ func (d *driver) NodeUnprepareResources(ctx context.Context, req *drav1.NodeUnpr
 		klog.V(5).Infof("NodeUnprepareResources: claim %s", claim.GetUID())
 
 		unpreparedResourcesResponse.Claims[claim.GetUID()] = d.freeDevice(ctx, claim)
+		d.audit.LogUnprepare(claim, unpreparedResourcesResponse.Claims[claim.GetUID()])
 	}
 
 	return unpreparedResourcesResponse, nil
 }
 
+// freeDevice frees the devices allocated to the claim. The allocation is
+// looked up from the driver state by claim UID, so that unpreparing is
+// idempotent and works also after the ResourceClaim has been deleted.
 func (d *driver) freeDevice(ctx context.Context, claim *drav1.Claim) *drav1.NodeUnprepareResourceResponse {
 	savestate := false
 
-	resourceclaim, err := d.getResourceClaim(ctx, claim)
-	if err != nil {
-		klog.Errorf("Error fetching ResourceClaim for %s: %v", claim.GetUID(), err)
-		return &drav1.NodeUnprepareResourceResponse{
-			Error: err.Error(),
-		}
-	}
-
 	d.Lock()
 	defer d.Unlock()
 
-	for _, deviceallocationresult := range resourceclaim.Status.Allocation.Devices.Results {
-
-		requestedDeviceUID := deviceallocationresult.Device
-
+	for _, requestedDeviceUID := range d.devices.Allocated(claim.GetUID()) {
 		if updated, err := d.devices.Free(requestedDeviceUID, claim.GetUID()); err != nil {
 			klog.Warningf("Could not free device %s claim '%s': %v", requestedDeviceUID, claim.GetUID(), err)
 		} else {
@@ -214,27 +230,60 @@ func (d *driver) UpdateDeviceResources(ctx context.Context) error {
 		return nil
 	}
 
-	resources := kubeletplugin.Resources{
-		Devices: *deviceResources(device.GetResourceDevices(d.devices)),
+	return d.plugin.PublishResources(ctx, d.resources())
+}
+
+func (d *driver) resources() kubeletplugin.Resources {
+	if len(d.prerequisites) > 0 {
+		return kubeletplugin.Resources{}
 	}
 
-	return d.plugin.PublishResources(ctx, resources)
+	return kubeletplugin.Resources{
+		Devices: *deviceResources(device.OrderDevices(device.GetResourceDevices(d.devices), d.allocationPolicy)),
+	}
 }
 
-func newDriver(ctx context.Context) (*driver, error) {
-	var (
-		clientset  ClientSet
-		err        error
-		kubeclient KubeClient
-	)
+// deviceUsage returns the number of enabled VFs of every QAT PF device, and how
+// many of them are allocated to claims.
+func (d *driver) deviceUsage() []helpers.DeviceUsage {
+	d.Lock()
+	defer d.Unlock()
 
-	nodename := os.Getenv("NODE_NAME")
+	usage := []helpers.DeviceUsage{}
+	for _, pf := range d.devices {
+		allocated := 0
+		for _, vfs := range pf.AllocatedDevices {
+			allocated += len(vfs)
+		}
+		usage = append(usage, helpers.DeviceUsage{Device: pf.Device, Resource: "vfs", Total: float64(pf.NumVFs), Allocated: float64(allocated)})
+	}
+
+	return usage
+}
 
-	if kubeclient, err = clientset.NewKubeClient(); err != nil {
-		return nil, fmt.Errorf("could not create kube client: %v", err)
+// prerequisitesCheck fails when the node does not fulfill the kernel
+// prerequisites of using QAT VFs in containers.
+func (d *driver) prerequisitesCheck() error {
+	if len(d.prerequisites) > 0 {
+		return fmt.Errorf("missing prerequisites: %s", strings.Join(d.prerequisites, "; "))
 	}
+	return nil
+}
+
+// configType is the configuration of the driver.
+type configType struct {
+	clientset kubernetes.Interface
+	nodeName  string
+	cdiRoot   string
+	stateFile string
+	// pfPassthrough allocates PF devices as a whole instead of their VFs.
+	pfPassthrough bool
+}
 
-	cdi, err := cdi.New(cdi.CDIRoot)
+func newDriver(ctx context.Context, config *configType) (*driver, error) {
+	nodename := config.nodeName
+
+	cdi, err := cdi.New(config.cdiRoot)
 	if err != nil {
 		return nil, err
 	}
@@ -244,14 +293,45 @@ func newDriver(ctx context.Context) (*driver, error) {
 		return nil, fmt.Errorf("could not find PF devices: %v", err)
 	}
 
+	// Devices are in use when the plugin has written CDI specs or VFs are
+	// enabled, so a missing state file is lost rather than new.
+	inUse := cdi.HasDevices()
 	for _, pf := range pfdevices {
+		if pf.NumVFs > 0 {
+			inUse = true
+		}
+	}
+
+	// Prepared claims are restored before enabling VFs or passthrough, so
+	// that PF devices with devices in use are not reconfigured under them.
+	lost, err := pfdevices.ReadStateOrCreateEmpty(config.stateFile, inUse)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up save state file '%s': %v", config.stateFile, err)
+	}
+
+	for _, pf := range pfdevices {
+		if len(pf.AllocatedDevices) > 0 && pf.Passthrough != config.pfPassthrough {
+			klog.Warningf("Not switching passthrough mode of PF device '%s' while its devices are prepared", pf.Device)
+			continue
+		}
+
+		if config.pfPassthrough {
+			if err := pf.EnablePassthrough(); err != nil {
+				return nil, fmt.Errorf("cannot enable passthrough of PF device '%s': %v", pf.Device, err)
+			}
+			continue
+		}
+
 		if err := pf.EnableVFs(); err != nil {
 			return nil, fmt.Errorf("cannot enable PF device '%s': %v", pf.Device, err)
 		}
 	}
 
-	if err := getDefaultConfiguration(nodename, pfdevices); err != nil {
-		klog.Warningf("Cannot apply default configuration: %vn", err)
+	// services of PF devices in passthrough mode are configured in containers
+	if !config.pfPassthrough {
+		if err := getDefaultConfiguration(nodename, pfdevices); err != nil {
+			klog.Warningf("Cannot apply default configuration: %vn", err)
+		}
 	}
 
 	detectedcdidevices := device.GetCDIDevices(pfdevices)
@@ -261,15 +341,30 @@ func newDriver(ctx context.Context) (*driver, error) {
 	}
 
 	d := &driver{
-		kubeclient: kubeclient,
+		kubeclient: config.clientset,
 		nodename:   nodename,
 		cdi:        cdi,
 		devices:    pfdevices,
-		statefile:  stateFileName,
+		statefile:  config.stateFile,
+		recorder:   helpers.NewEventRecorder(config.clientset, driverName, nodename),
+	}
+
+	// Claims of a lost state file are recovered after VFs are enabled, as
+	// the PF devices were already reconfigured without knowing about them.
+	if lost {
+		klog.Info("State file was lost, recovering prepared claims")
+		if err := helpers.RecoverPreparedClaims(ctx, config.clientset, driverName, config.nodeName, d.recoverClaim); err != nil {
+			klog.Errorf("could not recover prepared claims: %v", err)
+		}
 	}
 
-	if err := d.devices.ReadStateOrCreateEmpty(d.statefile); err != nil {
-		return nil, fmt.Errorf("could not set up save state file '%s': %v", d.statefile, err)
+	helpers.ReportNoDevices(d.recorder, nodename, len(pfdevices))
+
+	if d.prerequisites = device.CheckPrerequisites(); len(d.prerequisites) > 0 {
+		reason := strings.Join(d.prerequisites, "; ")
+		klog.Warningf("Not publishing QAT devices, missing prerequisites: %s", reason)
+		d.recorder.Eventf(helpers.NodeReference(nodename), corev1.EventTypeWarning, helpers.PrerequisitesMissingReason,
+			"QAT devices not published, missing prerequisites: %s", reason)
 	}
 
 	return d, nil
@@ -0,0 +1,763 @@
+/* Copyright (C) 2024 Intel Corporation
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	resourcev1 "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	drav1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/fakesysfs"
+	helpers "github.com/intel/intel-resource-drivers-for-kubernetes/pkg/plugintesthelpers"
+	"github.com/intel/intel-resource-drivers-for-kubernetes/pkg/qat/device"
+)
+
+const (
+	testNodeName  = "test-node-01"
+	testNameSpace = "test-namespace-01"
+)
+
+func newFakeDriver(ctx context.Context) (*driver, error) {
+	qatdevices, err := device.New()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &driver{
+		kubeclient: kubefake.NewSimpleClientset(),
+		nodename:   testNodeName,
+		devices:    qatdevices,
+		statefile:  "",
+		recorder:   &record.FakeRecorder{},
+	}
+
+	return d, nil
+}
+
+func TestDriver(t *testing.T) {
+	type testCase struct {
+		name             string
+		claims           []*resourcev1.ResourceClaim
+		request          *drav1.NodePrepareResourcesRequest
+		expectedResponse *drav1.NodePrepareResourcesResponse
+	}
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0",
+			State:    "up",
+			Services: "sym;asym",
+			TotalVFs: 3,
+			NumVFs:   0,
+		},
+		{Device: "0000:bb:00.0",
+			State:    "up",
+			Services: "dc",
+			TotalVFs: 3,
+			NumVFs:   0,
+		},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(context.TODO())
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	testcases := []testCase{
+		{
+			name: "QAT allocate device",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}}}},
+				},
+			},
+		},
+		{
+			name: "QAT reallocate same device and same claim UID",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim-a", "uid1", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request1"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}}}},
+				},
+			},
+		},
+		{
+			name: "QAT device already allocated",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim2", "uid2", "request1", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-1"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid2", Name: "claim2", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid2": {Error: "could not allocate device 'qatvf-0000-aa-00-1', service '' from any device"},
+				},
+			},
+		},
+		{
+			name: "QAT two devices",
+			claims: []*resourcev1.ResourceClaim{
+				helpers.NewClaim(testNameSpace, "claim3", "uid1", "request3", "qat.intel.com", testNodeName, []string{"qatvf-0000-aa-00-3", "qatvf-0000-bb-00-1"}),
+			},
+			request: &drav1.NodePrepareResourcesRequest{
+				Claims: []*drav1.Claim{{UID: "uid1", Name: "claim3", Namespace: testNameSpace}},
+			},
+			expectedResponse: &drav1.NodePrepareResourcesResponse{
+				Claims: map[string]*drav1.NodePrepareResourceResponse{
+					"uid1": {Devices: []*drav1.Device{
+						{RequestNames: []string{"request3"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-3", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-3", "intel.com/qat=qatvf-vfio"}},
+						{RequestNames: []string{"request3"}, PoolName: testNodeName, DeviceName: "qatvf-0000-bb-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-bb-00-1", "intel.com/qat=qatvf-vfio"}}}},
+				},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Log(testcase.name)
+
+		for _, testClaim := range testcase.claims {
+			createdClaim, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testClaim.Namespace).Create(context.TODO(), testClaim, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("could not create test claim: %v", err)
+				continue
+			}
+			t.Logf("created test claim: %+v", createdClaim)
+		}
+
+		response, err := driver.NodePrepareResources(context.TODO(), testcase.request)
+		if err != nil {
+			t.Errorf("%v: error %v, expected no error", testcase.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(testcase.expectedResponse, response) {
+			responseJSON, _ := json.MarshalIndent(response, "", "\t")
+			expectedResponseJSON, _ := json.MarshalIndent(testcase.expectedResponse, "", "\t")
+			t.Errorf("%v: unexpected response: %+v, expected response: %v", testcase.name, string(responseJSON), string(expectedResponseJSON))
+		}
+	}
+}
+
+func TestPrerequisites(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, NumVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(context.TODO())
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	if err := driver.prerequisitesCheck(); err != nil {
+		t.Errorf("unexpected prerequisites check error: %v", err)
+	}
+	if len(driver.resources().Devices) == 0 {
+		t.Errorf("expected devices to be published")
+	}
+
+	driver.prerequisites = []string{"IOMMU is not enabled"}
+
+	if err := driver.prerequisitesCheck(); err == nil {
+		t.Errorf("expected prerequisites check to fail")
+	}
+	if len(driver.resources().Devices) != 0 {
+		t.Errorf("expected no devices to be published, got %v", driver.resources().Devices)
+	}
+}
+
+func TestNewDriver(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "down", Services: "sym;asym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testDirs, err := helpers.NewTestDirs(driverName)
+	defer helpers.CleanupTest(t, "TestNewDriver", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create test dirs: %v", err)
+	}
+
+	statefile := path.Join(testDirs.KubeletPluginDir, "qat.state")
+	driver, err := newDriver(context.TODO(), &configType{
+		clientset: kubefake.NewSimpleClientset(),
+		nodeName:  testNodeName,
+		cdiRoot:   testDirs.CdiRoot,
+		stateFile: statefile,
+	})
+	if err != nil {
+		t.Fatalf("could not create driver: %v", err)
+	}
+	driver.recorder = &record.FakeRecorder{}
+
+	if devices := driver.resources().Devices; len(devices) != 4 {
+		t.Errorf("expected 4 published devices, got %v", devices)
+	}
+	for _, pf := range driver.devices {
+		if pf.State != device.Up {
+			t.Errorf("expected PF device %s to be up, got %s", pf.Device, pf.State.String())
+		}
+	}
+
+	cdiSpecs, err := os.ReadDir(testDirs.CdiRoot)
+	if err != nil || len(cdiSpecs) == 0 {
+		t.Fatalf("expected CDI specs to be written: %v", err)
+	}
+	cdiSpec, err := os.ReadFile(path.Join(testDirs.CdiRoot, cdiSpecs[0].Name()))
+	if err != nil {
+		t.Fatalf("could not read CDI spec: %v", err)
+	}
+	for _, name := range []string{"qatvf-0000-aa-00-1", "qatvf-0000-bb-00-2", "qatvf-vfio"} {
+		if !strings.Contains(string(cdiSpec), name) {
+			t.Errorf("expected CDI device %s in spec:\n%s", name, cdiSpec)
+		}
+	}
+
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"qatvf-0000-bb-00-1"})
+	if _, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+	drvClaim := &drav1.Claim{UID: "uid1", Name: "claim1", Namespace: testNameSpace}
+
+	prepared, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+	if err != nil || prepared.Claims["uid1"].Error != "" || len(prepared.Claims["uid1"].Devices) != 1 {
+		t.Fatalf("unexpected prepare response: %+v, %v", prepared, err)
+	}
+
+	state, err := os.ReadFile(statefile)
+	if err != nil || !strings.Contains(string(state), "qatvf-0000-bb-00-1") {
+		t.Errorf("expected prepared device in state file, got %s, %v", state, err)
+	}
+
+	unprepared, err := driver.NodeUnprepareResources(context.TODO(), &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+	if err != nil || unprepared.Claims["uid1"].Error != "" {
+		t.Fatalf("unexpected unprepare response: %+v, %v", unprepared, err)
+	}
+
+	state, err = os.ReadFile(statefile)
+	if err != nil || strings.Contains(string(state), "qatvf-0000-bb-00-1") {
+		t.Errorf("expected no prepared devices in state file, got %s, %v", state, err)
+	}
+}
+
+func TestRestartWithPreparedClaims(t *testing.T) {
+	testcases := []struct {
+		name        string
+		passthrough bool
+		device      string
+	}{
+		{name: "VF mode to passthrough", passthrough: false, device: "qatvf-0000-aa-00-1"},
+		{name: "passthrough to VF mode", passthrough: true, device: "qatpf-0000-aa-00-0"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			setupdevices := fakesysfs.QATDevices{
+				// the PF device with the claim is bound as the driver left it
+				{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2, Passthrough: testcase.passthrough},
+				{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+			}
+
+			defer fakesysfs.FakeSysFsRemove()
+			if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			testDirs, err := helpers.NewTestDirs(driverName)
+			defer helpers.CleanupTest(t, "TestRestartWithPreparedClaims", testDirs.TestRoot)
+			if err != nil {
+				t.Fatalf("could not create test dirs: %v", err)
+			}
+
+			config := &configType{
+				clientset:     kubefake.NewSimpleClientset(),
+				nodeName:      testNodeName,
+				cdiRoot:       testDirs.CdiRoot,
+				stateFile:     path.Join(testDirs.KubeletPluginDir, "qat.state"),
+				pfPassthrough: testcase.passthrough,
+			}
+			driver, err := newDriver(context.TODO(), config)
+			if err != nil {
+				t.Fatalf("could not create driver: %v", err)
+			}
+			driver.recorder = &record.FakeRecorder{}
+
+			claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{testcase.device})
+			if _, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("could not create test claim: %v", err)
+			}
+			drvClaim := &drav1.Claim{UID: "uid1", Name: "claim1", Namespace: testNameSpace}
+
+			prepared, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+			if err != nil || prepared.Claims["uid1"].Error != "" {
+				t.Fatalf("unexpected prepare response: %+v, %v", prepared, err)
+			}
+
+			// restart in the other mode with the claim still prepared
+			config.pfPassthrough = !testcase.passthrough
+			driver, err = newDriver(context.TODO(), config)
+			if err != nil {
+				t.Fatalf("could not restart driver: %v", err)
+			}
+			driver.recorder = &record.FakeRecorder{}
+
+			modes := map[string]bool{}
+			for _, pf := range driver.devices {
+				modes[pf.Device] = pf.Passthrough
+			}
+			if modes["0000:aa:00.0"] != testcase.passthrough || modes["0000:bb:00.0"] != !testcase.passthrough {
+				t.Errorf("expected only PF device without prepared devices to switch mode, got passthrough %v", modes)
+			}
+			if allocated := driver.devices.Allocated("uid1"); len(allocated) != 1 || allocated[0] != testcase.device {
+				t.Errorf("expected %v to stay prepared after restart, got %v", testcase.device, allocated)
+			}
+			numvfs, err := os.ReadFile("/tmp/sysfsroot/bus/pci/devices/0000:aa:00.0/sriov_numvfs")
+			if err != nil || !testcase.passthrough && strings.TrimSpace(string(numvfs)) == "0" {
+				t.Errorf("expected VFs of PF device with prepared devices to stay enabled, got sriov_numvfs %q, %v", numvfs, err)
+			}
+
+			unprepared, err := driver.NodeUnprepareResources(context.TODO(), &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+			if err != nil || unprepared.Claims["uid1"].Error != "" {
+				t.Fatalf("unexpected unprepare response: %+v, %v", unprepared, err)
+			}
+
+			// with the claim unprepared, the next restart switches the mode
+			driver, err = newDriver(context.TODO(), config)
+			if err != nil {
+				t.Fatalf("could not restart driver: %v", err)
+			}
+			for _, pf := range driver.devices {
+				if pf.Passthrough != config.pfPassthrough {
+					t.Errorf("expected PF device %s passthrough %v after claims were unprepared", pf.Device, config.pfPassthrough)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverLostState(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testDirs, err := helpers.NewTestDirs(driverName)
+	defer helpers.CleanupTest(t, "TestRecoverLostState", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create test dirs: %v", err)
+	}
+
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"qatvf-0000-aa-00-1"})
+	claim.Status.ReservedFor = []resourcev1.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod1", UID: "pod-uid1"}}
+
+	statefile := path.Join(testDirs.KubeletPluginDir, "qat.state")
+	config := &configType{
+		clientset: kubefake.NewSimpleClientset(claim),
+		nodeName:  testNodeName,
+		cdiRoot:   testDirs.CdiRoot,
+		stateFile: statefile,
+	}
+
+	// fresh install, no CDI specs, no VFs and no state file, nothing to recover
+	driver, err := newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not create driver: %v", err)
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 0 {
+		t.Errorf("expected no claim to be recovered on fresh install, got %v", allocated)
+	}
+
+	// state file deleted while CDI specs and VFs exist
+	if err := os.Remove(statefile); err != nil {
+		t.Fatalf("setup error: could not delete state file: %v", err)
+	}
+	driver, err = newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not restart driver: %v", err)
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 1 || allocated[0] != "qatvf-0000-aa-00-1" {
+		t.Errorf("expected claim to be recovered after state file was deleted, got %v", allocated)
+	}
+
+	// corrupted state file, as if it was lost
+	if err := os.WriteFile(statefile, []byte(`{"uid1": [`), 0600); err != nil {
+		t.Fatalf("setup error: could not corrupt state file: %v", err)
+	}
+	driver, err = newDriver(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("could not restart driver: %v", err)
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 1 || allocated[0] != "qatvf-0000-aa-00-1" {
+		t.Errorf("expected claim to be recovered, got %v", allocated)
+	}
+	if _, err := os.Stat(statefile + ".corrupted"); err != nil {
+		t.Errorf("corrupted state file was not kept: %v", err)
+	}
+	state, err := os.ReadFile(statefile)
+	if err != nil || !strings.Contains(string(state), "qatvf-0000-aa-00-1") {
+		t.Errorf("expected recovered device in state file, got %s, %v", state, err)
+	}
+}
+
+func TestMixedServiceClaim(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(context.TODO())
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request-sym", driverName, testNodeName, []string{"qatvf-0000-aa-00-1"})
+	claim.Spec.Devices.Requests = append(claim.Spec.Devices.Requests, resourcev1.DeviceRequest{Name: "request-dc", DeviceClassName: driverName, Count: 1})
+	claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+		resourcev1.DeviceRequestAllocationResult{Request: "request-dc", Driver: driverName, Pool: testNodeName, Device: "qatvf-0000-bb-00-1"})
+	if _, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+
+	response, err := driver.NodePrepareResources(context.TODO(), &drav1.NodePrepareResourcesRequest{
+		Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &drav1.NodePrepareResourceResponse{Devices: []*drav1.Device{
+		{RequestNames: []string{"request-sym"}, PoolName: testNodeName, DeviceName: "qatvf-0000-aa-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-aa-00-1", "intel.com/qat=qatvf-vfio"}},
+		{RequestNames: []string{"request-dc"}, PoolName: testNodeName, DeviceName: "qatvf-0000-bb-00-1", CDIDeviceIDs: []string{"intel.com/qat=qatvf-0000-bb-00-1", "intel.com/qat=qatvf-vfio"}},
+	}}
+	if !reflect.DeepEqual(response.Claims["uid1"], expected) {
+		t.Errorf("unexpected response: %+v, expected %+v", response.Claims["uid1"], expected)
+	}
+}
+
+func TestPrepareUnprepareIdempotent(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(context.TODO())
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	claims := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace)
+	claim := helpers.NewClaim(testNameSpace, "claim1", "uid1", "request1", driverName, testNodeName, []string{"qatvf-0000-aa-00-1"})
+	if _, err := claims.Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create test claim: %v", err)
+	}
+	request := &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}}}
+
+	first, err := driver.NodePrepareResources(context.TODO(), request)
+	if err != nil || first.Claims["uid1"].Error != "" {
+		t.Fatalf("unexpected prepare response: %+v, %v", first, err)
+	}
+	second, err := driver.NodePrepareResources(context.TODO(), request)
+	if err != nil || !reflect.DeepEqual(first, second) {
+		t.Errorf("expected same response when preparing again, got %+v, %v", second, err)
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 1 {
+		t.Errorf("expected one allocated device, got %v", allocated)
+	}
+
+	// failing to prepare again keeps the devices prepared before
+	claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+		resourcev1.DeviceRequestAllocationResult{Request: "request1", Driver: driverName, Pool: testNodeName, Device: "qatvf-0000-aa-00-9"})
+	if _, err := claims.Update(context.TODO(), claim, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("could not update test claim: %v", err)
+	}
+	failed, err := driver.NodePrepareResources(context.TODO(), request)
+	if err != nil || failed.Claims["uid1"].Error == "" {
+		t.Errorf("expected prepare to fail, got %+v, %v", failed, err)
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 1 {
+		t.Errorf("expected device prepared before to stay allocated, got %v", allocated)
+	}
+
+	// unprepare does not need the claim
+	if err := claims.Delete(context.TODO(), "claim1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("could not delete test claim: %v", err)
+	}
+	unprepareRequest := &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{{UID: "uid1", Name: "claim1", Namespace: testNameSpace}}}
+	for i := 0; i < 2; i++ {
+		unprepared, err := driver.NodeUnprepareResources(context.TODO(), unprepareRequest)
+		if err != nil || unprepared.Claims["uid1"].Error != "" {
+			t.Errorf("unexpected unprepare response: %+v, %v", unprepared, err)
+		}
+	}
+	if allocated := driver.devices.Allocated("uid1"); len(allocated) != 0 {
+		t.Errorf("expected no allocated devices, got %v", allocated)
+	}
+}
+
+func TestClaimLifecycle(t *testing.T) {
+	ctx := context.TODO()
+
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 2},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 2},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testDirs, err := helpers.NewTestDirs(driverName)
+	defer helpers.CleanupTest(t, "TestClaimLifecycle", testDirs.TestRoot)
+	if err != nil {
+		t.Fatalf("could not create test dirs: %v", err)
+	}
+
+	cluster, err := helpers.NewFakeCluster(testNodeName)
+	if err != nil {
+		t.Fatalf("could not create fake cluster: %v", err)
+	}
+	if err := cluster.InstallDeviceClasses(ctx, "../../../deployments/qat/device-class.yaml"); err != nil {
+		t.Fatalf("could not install device classes: %v", err)
+	}
+
+	driver, err := newDriver(ctx, &configType{
+		clientset: cluster.Clientset,
+		nodeName:  testNodeName,
+		cdiRoot:   testDirs.CdiRoot,
+		stateFile: path.Join(testDirs.KubeletPluginDir, "qat.state"),
+	})
+	if err != nil {
+		t.Fatalf("could not create driver: %v", err)
+	}
+	driver.recorder = &record.FakeRecorder{}
+
+	if err := cluster.PublishResources(ctx, driverName, testNodeName, driver.resources()); err != nil {
+		t.Fatalf("could not publish resources: %v", err)
+	}
+
+	claims := cluster.Clientset.ResourceV1beta1().ResourceClaims(testNameSpace)
+	for _, name := range []string{"claim1", "claim2"} {
+		claim := &resourcev1.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNameSpace, Name: name, UID: types.UID("uid-" + name)},
+			Spec: resourcev1.ResourceClaimSpec{Devices: resourcev1.DeviceClaim{Requests: []resourcev1.DeviceRequest{{
+				Name:            "dc",
+				DeviceClassName: driverName,
+				AllocationMode:  resourcev1.DeviceAllocationModeExactCount,
+				Count:           2,
+				Selectors: []resourcev1.DeviceSelector{{CEL: &resourcev1.CELDeviceSelector{
+					Expression: `device.attributes["qat.intel.com"].services == "dc"`,
+				}}},
+			}}}},
+		}
+		if _, err := claims.Create(ctx, claim, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("could not create claim %v: %v", name, err)
+		}
+	}
+
+	claim, nodeName, err := cluster.Allocate(ctx, testNameSpace, "claim1")
+	if err != nil || nodeName != testNodeName {
+		t.Fatalf("could not allocate claim1: %v", err)
+	}
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if !strings.HasPrefix(result.Device, "qatvf-0000-bb-00-") {
+			t.Errorf("expected dc device from 0000:bb:00.0, got %v", result.Device)
+		}
+	}
+
+	if _, _, err := cluster.Allocate(ctx, testNameSpace, "claim2"); err == nil {
+		t.Errorf("expected claim2 not to fit while claim1 is allocated")
+	}
+
+	drvClaim := &drav1.Claim{UID: "uid-claim1", Name: "claim1", Namespace: testNameSpace}
+	prepared, err := driver.NodePrepareResources(ctx, &drav1.NodePrepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+	if err != nil || prepared.Claims["uid-claim1"].Error != "" || len(prepared.Claims["uid-claim1"].Devices) != 2 {
+		t.Fatalf("unexpected prepare response: %+v, %v", prepared, err)
+	}
+
+	unprepared, err := driver.NodeUnprepareResources(ctx, &drav1.NodeUnprepareResourcesRequest{Claims: []*drav1.Claim{drvClaim}})
+	if err != nil || unprepared.Claims["uid-claim1"].Error != "" {
+		t.Fatalf("unexpected unprepare response: %+v, %v", unprepared, err)
+	}
+	if err := cluster.Deallocate(ctx, testNameSpace, "claim1"); err != nil {
+		t.Fatalf("could not deallocate claim1: %v", err)
+	}
+
+	if _, _, err := cluster.Allocate(ctx, testNameSpace, "claim2"); err != nil {
+		t.Errorf("expected claim2 to fit after claim1 was deallocated: %v", err)
+	}
+}
+
+// BenchmarkAllocate measures how fast the scheduler allocates claims from the
+// devices published in the order of each allocation policy, with thousands of
+// devices on several nodes and the devices of earlier claims in use.
+func BenchmarkAllocate(b *testing.B) {
+	ctx := context.TODO()
+	nodeNames := []string{"node-0", "node-1", "node-2", "node-3"}
+
+	setupdevices := fakesysfs.QATDevices{}
+	for i := 0; i < 64; i++ {
+		services := "sym"
+		if i%2 == 1 {
+			services = "dc"
+		}
+		setupdevices = append(setupdevices, &fakesysfs.PFDevice{
+			Device: fmt.Sprintf("0000:%02x:00.0", 0x10+i), State: "up", Services: services, TotalVFs: 16, NumaNode: i % 2,
+		})
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		b.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(ctx)
+	if err != nil {
+		b.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	for _, policy := range []device.AllocationPolicy{device.PackPolicy, device.SpreadPolicy, device.SpreadNUMAPolicy} {
+		b.Run(string(policy), func(b *testing.B) {
+			cluster, err := helpers.NewFakeCluster(nodeNames...)
+			if err != nil {
+				b.Fatalf("could not create fake cluster: %v", err)
+			}
+			if err := cluster.InstallDeviceClasses(ctx, "../../../deployments/qat/device-class.yaml"); err != nil {
+				b.Fatalf("could not install device classes: %v", err)
+			}
+
+			driver.allocationPolicy = policy
+			for _, nodeName := range nodeNames {
+				if err := cluster.PublishResources(ctx, driverName, nodeName, driver.resources()); err != nil {
+					b.Fatalf("could not publish resources: %v", err)
+				}
+			}
+
+			claims := cluster.Clientset.ResourceV1beta1().ResourceClaims(testNameSpace)
+			for i := 0; i < b.N; i++ {
+				services := []string{"sym", "dc"}[i%2]
+				claim := &resourcev1.ResourceClaim{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNameSpace, Name: fmt.Sprintf("claim-%d", i)},
+					Spec: resourcev1.ResourceClaimSpec{Devices: resourcev1.DeviceClaim{Requests: []resourcev1.DeviceRequest{{
+						Name:            services,
+						DeviceClassName: driverName,
+						AllocationMode:  resourcev1.DeviceAllocationModeExactCount,
+						Count:           1,
+						Selectors: []resourcev1.DeviceSelector{{CEL: &resourcev1.CELDeviceSelector{
+							Expression: fmt.Sprintf(`device.attributes["qat.intel.com"].services == %q`, services),
+						}}},
+					}}}},
+				}
+				if _, err := claims.Create(ctx, claim, metav1.CreateOptions{}); err != nil {
+					b.Fatalf("could not create claim: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := cluster.Allocate(ctx, testNameSpace, fmt.Sprintf("claim-%d", i)); err != nil {
+					b.Fatalf("could not allocate claim-%d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentPrepareUnprepare(t *testing.T) {
+	setupdevices := fakesysfs.QATDevices{
+		{Device: "0000:aa:00.0", State: "up", Services: "sym", TotalVFs: 4},
+		{Device: "0000:bb:00.0", State: "up", Services: "dc", TotalVFs: 4},
+	}
+
+	defer fakesysfs.FakeSysFsRemove()
+	if err := fakesysfs.FakeSysFsQATContents(setupdevices); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	driver, err := newFakeDriver(context.TODO())
+	if err != nil {
+		t.Fatalf("could not create qatdevices with New(): %v", err)
+	}
+
+	claims := []*drav1.Claim{}
+	for _, vf := range []string{"aa-00-1", "aa-00-2", "aa-00-3", "aa-00-4", "bb-00-1", "bb-00-2", "bb-00-3", "bb-00-4"} {
+		name, uid := "claim-"+vf, "uid-"+vf
+		claim := helpers.NewClaim(testNameSpace, name, uid, "request1", driverName, testNodeName, []string{"qatvf-0000-" + vf})
+		if _, err := driver.kubeclient.ResourceV1beta1().ResourceClaims(testNameSpace).Create(context.TODO(), claim, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("could not create test claim: %v", err)
+		}
+		claims = append(claims, &drav1.Claim{UID: uid, Name: name, Namespace: testNameSpace})
+	}
+
+	errs := helpers.StressPrepareUnprepare(context.TODO(), driver, claims, helpers.StressOptions{
+		Workers:    16,
+		Rounds:     10,
+		Background: func() { _ = driver.deviceUsage() },
+	})
+	for _, err := range errs {
+		t.Error(err)
+	}
+
+	if allocated := driver.devices.Allocated(""); len(allocated) != 0 {
+		t.Errorf("expected no allocated devices, got %v", allocated)
+	}
+	for _, claim := range claims {
+		if allocated := driver.devices.Allocated(claim.UID); len(allocated) != 0 {
+			t.Errorf("expected no devices allocated to %v after stress, got %v", claim.UID, allocated)
+		}
+	}
+}
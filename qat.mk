@@ -25,7 +25,9 @@ bin/kubelet-qat-plugin
 QAT_COMMON_SRC = \
 $(COMMON_SRC) \
 pkg/qat/device/*.go \
-pkg/qat/cdi/*.go
+pkg/qat/device/*.json \
+pkg/qat/cdi/*.go \
+pkg/qat/plugin/*.go
 
 QAT_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${QAT_VERSION}
 
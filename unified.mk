@@ -0,0 +1,41 @@
+# Copyright (c) 2024, Intel Corporation.  All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+# Single binary and image with the GPU, Gaudi and QAT kubelet plugins as
+# subcommands, the DaemonSet selects the accelerator with container args.
+
+UNIFIED_VERSION ?= v0.1.0
+UNIFIED_IMAGE_NAME ?= intel-resource-driver
+UNIFIED_IMAGE_VERSION ?= $(UNIFIED_VERSION)
+UNIFIED_IMAGE_TAG ?= $(REGISTRY)/$(UNIFIED_IMAGE_NAME):$(UNIFIED_IMAGE_VERSION)
+
+UNIFIED_LDFLAGS = ${LDFLAGS} -X ${PKG}/pkg/version.driverVersion=${UNIFIED_VERSION}
+
+.PHONY: unified
+unified: bin/intel-resource-driver
+
+bin/intel-resource-driver: cmd/intel-resource-driver/*.go $(GPU_COMMON_SRC) $(GAUDI_COMMON_SRC) $(QAT_COMMON_SRC)
+	CGO_ENABLED=0 GOOS=linux GOARCH=${ARCH} \
+	  go build -a -ldflags "${UNIFIED_LDFLAGS}" -mod vendor -o $@ ./cmd/intel-resource-driver
+
+.PHONY: unified-container-build
+unified-container-build: cleanall vendor
+	@echo "Building unified resource driver container..."
+	$(DOCKER) build --pull --platform="linux/$(ARCH)" -t $(UNIFIED_IMAGE_TAG) \
+	--build-arg LOCAL_LICENSES=$(LOCAL_LICENSES) -f Dockerfile.unified .
+
+.PHONY: unified-container-push
+unified-container-push: unified-container-build
+	$(DOCKER) push $(UNIFIED_IMAGE_TAG)